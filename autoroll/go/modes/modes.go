@@ -12,14 +12,16 @@ import (
 const (
 	MODE_HISTORY_LENGTH = 25
 
-	MODE_RUNNING = "running"
-	MODE_STOPPED = "stopped"
-	MODE_DRY_RUN = "dry run"
+	MODE_RUNNING               = "running"
+	MODE_RUNNING_WITH_ROLLBACK = "running with rollback"
+	MODE_STOPPED               = "stopped"
+	MODE_DRY_RUN               = "dry run"
 )
 
 var (
 	VALID_MODES = []string{
 		MODE_RUNNING,
+		MODE_RUNNING_WITH_ROLLBACK,
 		MODE_STOPPED,
 		MODE_DRY_RUN,
 	}
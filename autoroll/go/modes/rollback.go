@@ -0,0 +1,254 @@
+package modes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.skia.org/infra/go/autoroll"
+	"go.skia.org/infra/go/gitiles"
+	"go.skia.org/infra/go/human"
+	"go.skia.org/infra/go/util"
+)
+
+/*
+	Support for MODE_RUNNING_WITH_ROLLBACK, in which the roller watches the
+	parent repo after each roll lands and rolls back to the last known-good
+	revision if the roll appears to have broken the parent.
+*/
+
+const (
+	// Default amount of time after a roll lands during which we'll watch
+	// the parent repo for breakages.
+	DEFAULT_ROLLBACK_WINDOW = 2 * time.Hour
+
+	// Status of a failed Job in the Task Scheduler.
+	TASK_SCHEDULER_JOB_STATUS_FAILURE = "FAILURE"
+
+	// Default branch of the parent repo into which rolls land.
+	DEFAULT_PARENT_BRANCH = "master"
+
+	// Maximum number of commits on the parent branch which are searched for
+	// the landed roll.
+	PARENT_LOG_LENGTH = 100
+)
+
+// HealthCheck determines whether a landed roll broke the parent repo.
+type HealthCheck interface {
+	// Check returns a non-empty message describing the problem if the
+	// parent repo appears to have been broken by the given landed roll.
+	Check(ctx context.Context, roll *autoroll.AutoRollIssue) (string, error)
+}
+
+// RollbackConfig provides configuration for MODE_RUNNING_WITH_ROLLBACK.
+type RollbackConfig struct {
+	// How long after a roll lands to watch the parent repo, eg. "2h". If
+	// not provided, DEFAULT_ROLLBACK_WINDOW is used.
+	Window string `json:"window"`
+
+	// Health checks. Exactly one must be provided.
+	ParentJobs *ParentJobsHealthCheckConfig `json:"parentJobs"`
+}
+
+// See documentation for util.Validator interface.
+func (c *RollbackConfig) Validate() error {
+	if c.Window != "" {
+		if _, err := human.ParseDuration(c.Window); err != nil {
+			return fmt.Errorf("Invalid rollback window %q: %s", c.Window, err)
+		}
+	}
+	if c.ParentJobs == nil {
+		return errors.New("Exactly one rollback health check must be supplied.")
+	}
+	return c.ParentJobs.Validate()
+}
+
+// GetWindow returns the amount of time after a roll lands during which the
+// parent repo is watched.
+func (c *RollbackConfig) GetWindow() time.Duration {
+	if c.Window == "" {
+		return DEFAULT_ROLLBACK_WINDOW
+	}
+	// Validate ensures that the window can be parsed.
+	rv, err := human.ParseDuration(c.Window)
+	if err != nil {
+		return DEFAULT_ROLLBACK_WINDOW
+	}
+	return rv
+}
+
+// HealthCheck returns the HealthCheck described by the config.
+func (c *RollbackConfig) HealthCheck(client *http.Client, gitcookiesPath string) HealthCheck {
+	return NewParentJobsHealthCheck(c.ParentJobs, client, gitcookiesPath)
+}
+
+// ParentJobsHealthCheckConfig provides configuration for a HealthCheck which
+// considers the parent repo to be broken if any of the given Task Scheduler
+// Jobs fail after a roll lands.
+type ParentJobsHealthCheckConfig struct {
+	// Base URL of the Task Scheduler instance for the parent repo, eg.
+	// "https://task-scheduler.skia.org".
+	TaskSchedulerURL string `json:"taskSchedulerURL"`
+
+	// URL of the parent repo, as used by the Task Scheduler.
+	Repo string `json:"repo"`
+
+	// Branch of the parent repo into which rolls land. If not provided,
+	// DEFAULT_PARENT_BRANCH is used.
+	Branch string `json:"branch"`
+
+	// Names of the Jobs to watch.
+	Jobs []string `json:"jobs"`
+}
+
+// See documentation for util.Validator interface.
+func (c *ParentJobsHealthCheckConfig) Validate() error {
+	if _, err := url.ParseRequestURI(c.TaskSchedulerURL); err != nil {
+		return fmt.Errorf("TaskSchedulerURL is invalid: %s", err)
+	}
+	if c.Repo == "" {
+		return errors.New("Repo is required.")
+	}
+	if len(c.Jobs) == 0 {
+		return errors.New("At least one Job is required.")
+	}
+	return nil
+}
+
+// parentJobsHealthCheck is an implementation of HealthCheck which searches for
+// failed Jobs in the Task Scheduler.
+type parentJobsHealthCheck struct {
+	c      *ParentJobsHealthCheckConfig
+	client *http.Client
+	repo   *gitiles.Repo
+	now    func() time.Time
+}
+
+// NewParentJobsHealthCheck returns a HealthCheck which searches for failed
+// Jobs in the Task Scheduler.
+func NewParentJobsHealthCheck(c *ParentJobsHealthCheckConfig, client *http.Client, gitcookiesPath string) HealthCheck {
+	return &parentJobsHealthCheck{
+		c:      c,
+		client: client,
+		repo:   gitiles.NewRepo(strings.TrimSuffix(c.Repo, "/"), gitcookiesPath, client),
+		now:    time.Now,
+	}
+}
+
+// job contains the fields we care about from a Task Scheduler Job.
+type job struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Revision string `json:"revision"`
+	Issue    string `json:"issue"`
+	IsForce  bool   `json:"isForce"`
+}
+
+// revisionsSinceRoll returns the set of commits on the parent branch, starting
+// with the commit which landed the given roll.
+func (h *parentJobsHealthCheck) revisionsSinceRoll(roll *autoroll.AutoRollIssue) (map[string]bool, error) {
+	branch := h.c.Branch
+	if branch == "" {
+		branch = DEFAULT_PARENT_BRANCH
+	}
+	commits, err := h.repo.Log(fmt.Sprintf("%s~%d", branch, PARENT_LOG_LENGTH), branch)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve log of the parent repo: %s", err)
+	}
+	reviewedOn := regexp.MustCompile(fmt.Sprintf(`(?m)^Reviewed-on: \S*/%d$`, roll.Issue))
+	rv := map[string]bool{}
+	// Commits are listed most recent first.
+	for _, c := range commits {
+		rv[c.Hash] = true
+		if reviewedOn.MatchString(c.Body) {
+			return rv, nil
+		}
+	}
+	return nil, fmt.Errorf("Unable to find the commit for roll %d in the last %d commits of the parent repo.", roll.Issue, PARENT_LOG_LENGTH)
+}
+
+// See documentation for HealthCheck interface.
+func (h *parentJobsHealthCheck) Check(ctx context.Context, roll *autoroll.AutoRollIssue) (string, error) {
+	revisions, err := h.revisionsSinceRoll(roll)
+	if err != nil {
+		return "", err
+	}
+	failed := []string{}
+	for _, name := range h.c.Jobs {
+		params := url.Values{}
+		params.Set("repo", h.c.Repo)
+		params.Set("name", "^"+regexp.QuoteMeta(name)+"$")
+		params.Set("status", TASK_SCHEDULER_JOB_STATUS_FAILURE)
+		// The Task Scheduler ignores time_start unless time_end is also
+		// provided.
+		params.Set("time_start", roll.Modified.UTC().Format(time.RFC3339))
+		params.Set("time_end", h.now().UTC().Format(time.RFC3339))
+		u := strings.TrimSuffix(h.c.TaskSchedulerURL, "/") + "/json/jobs/search?" + params.Encode()
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := h.client.Do(req.WithContext(ctx))
+		if err != nil {
+			return "", fmt.Errorf("Failed to search for jobs: %s", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			util.Close(resp.Body)
+			return "", fmt.Errorf("Failed to search for jobs; got status %s", resp.Status)
+		}
+		var jobs []*job
+		err = json.NewDecoder(resp.Body).Decode(&jobs)
+		util.Close(resp.Body)
+		if err != nil {
+			return "", fmt.Errorf("Failed to decode jobs: %s", err)
+		}
+		for _, j := range jobs {
+			// Try jobs and forced jobs don't indicate a broken parent,
+			// and neither do jobs at revisions before the roll.
+			if j.Issue == "" && !j.IsForce && revisions[j.Revision] {
+				failed = append(failed, name)
+				break
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Sprintf("Parent job(s) failed after the roll landed: %s", strings.Join(failed, ", ")), nil
+	}
+	return "", nil
+}
+
+// FindRollback determines whether the most recently-landed roll needs to be
+// rolled back. recent is the list of recent rolls, most recent first, and
+// isRollback indicates whether the given issue was itself a rollback, in which
+// case it is not checked. Returns the roll to be rolled back and a message
+// describing the problem, or nil if the roll is healthy, was not landed within
+// the given window, or there is no landed roll.
+func FindRollback(ctx context.Context, hc HealthCheck, recent []*autoroll.AutoRollIssue, isRollback func(int64) bool, window time.Duration, now time.Time) (*autoroll.AutoRollIssue, string, error) {
+	var landed *autoroll.AutoRollIssue
+	for _, roll := range recent {
+		if roll.Committed && roll.Result == autoroll.ROLL_RESULT_SUCCESS {
+			landed = roll
+			break
+		}
+	}
+	if landed == nil || landed.RollingFrom == "" || isRollback(landed.Issue) {
+		return nil, "", nil
+	}
+	if now.Sub(landed.Modified) > window {
+		return nil, "", nil
+	}
+	msg, err := hc.Check(ctx, landed)
+	if err != nil {
+		return nil, "", fmt.Errorf("Failed to check health of roll %d: %s", landed.Issue, err)
+	}
+	if msg == "" {
+		return nil, "", nil
+	}
+	return landed, msg, nil
+}
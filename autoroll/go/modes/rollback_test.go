@@ -0,0 +1,221 @@
+package modes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/autoroll"
+	"go.skia.org/infra/go/gitiles"
+	"go.skia.org/infra/go/httputils"
+	"go.skia.org/infra/go/testutils"
+	ts_db "go.skia.org/infra/task_scheduler/go/db"
+)
+
+// testHealthCheck is an implementation of HealthCheck which returns the given
+// message for every roll and records the rolls it was asked to check.
+type testHealthCheck struct {
+	checked []int64
+	msg     string
+}
+
+// See documentation for HealthCheck interface.
+func (h *testHealthCheck) Check(ctx context.Context, roll *autoroll.AutoRollIssue) (string, error) {
+	h.checked = append(h.checked, roll.Issue)
+	return h.msg, nil
+}
+
+func TestFindRollback(t *testing.T) {
+	testutils.SmallTest(t)
+
+	ctx := context.Background()
+	now := time.Unix(1530000000, 0).UTC()
+	landed := &autoroll.AutoRollIssue{
+		Closed:      true,
+		Committed:   true,
+		Issue:       2,
+		Modified:    now.Add(-time.Hour),
+		Result:      autoroll.ROLL_RESULT_SUCCESS,
+		RollingFrom: "abc",
+		RollingTo:   "def",
+	}
+	recent := []*autoroll.AutoRollIssue{
+		{
+			Closed:      true,
+			Issue:       3,
+			Modified:    now,
+			Result:      autoroll.ROLL_RESULT_FAILURE,
+			RollingFrom: "def",
+			RollingTo:   "ghi",
+		},
+		landed,
+		{
+			Closed:      true,
+			Committed:   true,
+			Issue:       1,
+			Modified:    now.Add(-2 * time.Hour),
+			Result:      autoroll.ROLL_RESULT_SUCCESS,
+			RollingFrom: "012",
+			RollingTo:   "abc",
+		},
+	}
+	notRollback := func(int64) bool {
+		return false
+	}
+
+	// Healthy.
+	hc := &testHealthCheck{}
+	roll, msg, err := FindRollback(ctx, hc, recent, notRollback, DEFAULT_ROLLBACK_WINDOW, now)
+	assert.NoError(t, err)
+	assert.Nil(t, roll)
+	assert.Equal(t, "", msg)
+	assert.Equal(t, []int64{2}, hc.checked)
+
+	// Unhealthy; only the most recently-landed roll is rolled back.
+	hc = &testHealthCheck{msg: "broken"}
+	roll, msg, err = FindRollback(ctx, hc, recent, notRollback, DEFAULT_ROLLBACK_WINDOW, now)
+	assert.NoError(t, err)
+	assert.Equal(t, landed, roll)
+	assert.Equal(t, "broken", msg)
+
+	// The roll landed outside of the window.
+	hc = &testHealthCheck{msg: "broken"}
+	roll, _, err = FindRollback(ctx, hc, recent, notRollback, 30*time.Minute, now)
+	assert.NoError(t, err)
+	assert.Nil(t, roll)
+	assert.Equal(t, 0, len(hc.checked))
+
+	// Rollbacks are not themselves rolled back.
+	roll, _, err = FindRollback(ctx, hc, recent, func(issue int64) bool {
+		return issue == 2
+	}, DEFAULT_ROLLBACK_WINDOW, now)
+	assert.NoError(t, err)
+	assert.Nil(t, roll)
+	assert.Equal(t, 0, len(hc.checked))
+
+	// No landed rolls.
+	roll, _, err = FindRollback(ctx, hc, recent[:1], notRollback, DEFAULT_ROLLBACK_WINDOW, now)
+	assert.NoError(t, err)
+	assert.Nil(t, roll)
+	assert.Equal(t, 0, len(hc.checked))
+}
+
+// fakeParent serves the Gitiles log of the parent repo and the Task
+// Scheduler's job search, backed by an in-memory DB.
+func fakeParent(t *testing.T, commits []*gitiles.Commit, jobDB ts_db.JobDB) *httptest.Server {
+	r := mux.NewRouter()
+	r.HandleFunc("/skia.git/+log/{range}", func(w http.ResponseWriter, r *http.Request) {
+		b, err := json.Marshal(&gitiles.Log{Log: commits})
+		assert.NoError(t, err)
+		_, err = w.Write(append([]byte(")]}'\n"), b...))
+		assert.NoError(t, err)
+	})
+	// Mirror the Task Scheduler's jsonJobSearchHandler.
+	r.HandleFunc("/json/jobs/search", func(w http.ResponseWriter, r *http.Request) {
+		var params ts_db.JobSearchParams
+		assert.NoError(t, httputils.ParseFormValues(r, &params))
+		jobs, err := ts_db.SearchJobs(jobDB, &params)
+		assert.NoError(t, err)
+		assert.NoError(t, json.NewEncoder(w).Encode(jobs))
+	})
+	return httptest.NewServer(r)
+}
+
+func TestParentJobsHealthCheck(t *testing.T) {
+	testutils.SmallTest(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	landed := now.Add(-time.Hour)
+	gitTime := func(ts time.Time) *gitiles.Author {
+		return &gitiles.Author{Name: "me", Email: "me@google.com", Time: ts.Format(gitiles.DATE_FORMAT_NO_TZ)}
+	}
+	commit := func(hash, msg string, ts time.Time) *gitiles.Commit {
+		return &gitiles.Commit{Commit: hash, Author: gitTime(ts), Committer: gitTime(ts), Message: msg}
+	}
+	commits := []*gitiles.Commit{
+		commit("c3", "Later commit", now.Add(-30*time.Minute)),
+		commit("c2", "Roll child\n\nChange-Id: I123\nReviewed-on: https://skia-review.googlesource.com/1234\nCommit-Queue: me@google.com", landed),
+		commit("c1", "Earlier commit", landed.Add(-time.Hour)),
+	}
+	jobDB := ts_db.NewInMemoryJobDB()
+	srv := fakeParent(t, commits, jobDB)
+	defer srv.Close()
+
+	c := &RollbackConfig{
+		ParentJobs: &ParentJobsHealthCheckConfig{
+			TaskSchedulerURL: srv.URL + "/",
+			Repo:             srv.URL + "/skia.git",
+			Jobs:             []string{"Build-Debug", "Test-Release"},
+		},
+	}
+	assert.NoError(t, c.Validate())
+	assert.Equal(t, DEFAULT_ROLLBACK_WINDOW, c.GetWindow())
+	c.Window = "30m"
+	assert.NoError(t, c.Validate())
+	assert.Equal(t, 30*time.Minute, c.GetWindow())
+
+	hc := c.HealthCheck(httputils.NewTimeoutClient(), "")
+	hc.(*parentJobsHealthCheck).now = func() time.Time { return now }
+	roll := &autoroll.AutoRollIssue{
+		Issue:    1234,
+		Modified: landed,
+	}
+
+	failedJob := func(name, revision string, created time.Time) *ts_db.Job {
+		return &ts_db.Job{
+			Name:    name,
+			Created: created,
+			Status:  ts_db.JOB_STATUS_FAILURE,
+			RepoState: ts_db.RepoState{
+				Repo:     c.ParentJobs.Repo,
+				Revision: revision,
+			},
+		}
+	}
+	tryJob := failedJob("Test-Release", "c3", now.Add(-10*time.Minute))
+	tryJob.Issue = "5555"
+	tryJob.Patchset = "1"
+	tryJob.Server = "https://skia-review.googlesource.com"
+	forcedJob := failedJob("Test-Release", "c3", now.Add(-10*time.Minute))
+	forcedJob.IsForce = true
+	succeededJob := failedJob("Build-Debug", "c3", now.Add(-10*time.Minute))
+	succeededJob.Status = ts_db.JOB_STATUS_SUCCESS
+	assert.NoError(t, jobDB.PutJobs([]*ts_db.Job{
+		// Failed before the roll landed.
+		failedJob("Test-Release", "c1", landed.Add(-time.Hour)),
+		// Failed after the roll landed, but at a revision before the roll.
+		failedJob("Build-Debug", "c1", now.Add(-10*time.Minute)),
+		tryJob,
+		forcedJob,
+		succeededJob,
+	}))
+
+	// No failures which could have been caused by the roll.
+	msg, err := hc.Check(context.Background(), roll)
+	assert.NoError(t, err)
+	assert.Equal(t, "", msg)
+
+	// A job failed at the roll's commit.
+	assert.NoError(t, jobDB.PutJobs([]*ts_db.Job{failedJob("Test-Release", "c2", now.Add(-5*time.Minute))}))
+	msg, err = hc.Check(context.Background(), roll)
+	assert.NoError(t, err)
+	assert.Equal(t, "Parent job(s) failed after the roll landed: Test-Release", msg)
+
+	// The roll can't be found in the parent repo.
+	_, err = hc.Check(context.Background(), &autoroll.AutoRollIssue{Issue: 999, Modified: landed})
+	assert.Error(t, err)
+
+	// Invalid configs.
+	c.Window = "bogus"
+	assert.Error(t, c.Validate())
+	c.Window = ""
+	c.ParentJobs.Jobs = nil
+	assert.EqualError(t, c.Validate(), "At least one Job is required.")
+	c.ParentJobs = nil
+	assert.EqualError(t, c.Validate(), "Exactly one rollback health check must be supplied.")
+}
@@ -32,6 +32,9 @@ const (
 
 	subjectLastNFailed = "The last {{.N}} {{.ChildName}} into {{.ParentName}} rolls have failed"
 	bodyLastNFailed    = "The roll is failing consistently. Time to investigate. The most recent roll attempt is here: {{.IssueURL}}"
+
+	subjectRollback = "The {{.ChildName}} into {{.ParentName}} AutoRoller has rolled back (issue {{.IssueID}})"
+	bodyRollback    = "A recently-landed roll appears to have broken the parent repo: {{.Message}}. The roller has uploaded a roll back to the last known-good revision and has stopped itself. Please investigate and resume the roller when the problem is fixed. The rollback is here: {{.IssueURL}}"
 )
 
 var (
@@ -55,6 +58,9 @@ var (
 
 	subjectTmplLastNFailed = template.Must(template.New("subjectLastNFailed").Parse(subjectLastNFailed))
 	bodyTmplLastNFailed    = template.Must(template.New("bodyLastNFailed").Parse(bodyLastNFailed))
+
+	subjectTmplRollback = template.Must(template.New("subjectRollback").Parse(subjectRollback))
+	bodyTmplRollback    = template.Must(template.New("bodyRollback").Parse(bodyRollback))
 )
 
 // tmplVars is a struct which contains information used to fill
@@ -190,3 +196,13 @@ func (a *AutoRollNotifier) SendLastNFailed(ctx context.Context, n int, url strin
 		N:        n,
 	}, subjectTmplLastNFailed, bodyTmplLastNFailed, notifier.SEVERITY_ERROR)
 }
+
+// Send a notification that the roller has uploaded a roll back to the last
+// known-good revision and stopped itself.
+func (a *AutoRollNotifier) SendRollback(ctx context.Context, id, url, reason string) {
+	a.send(ctx, &tmplVars{
+		IssueID:  id,
+		IssueURL: url,
+		Message:  reason,
+	}, subjectTmplRollback, bodyTmplRollback, notifier.SEVERITY_ERROR)
+}
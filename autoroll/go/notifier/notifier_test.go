@@ -54,4 +54,10 @@ func TestNotifier(t *testing.T) {
 	assert.Equal(t, "The childRepo into parentRepo AutoRoller is throttled", t1.msgs[2].subject)
 	assert.Equal(t, fmt.Sprintf("The roller is throttled because it attempted to upload too many CLs in too short a time.  The roller will unthrottle at %s.", now.Format(time.RFC1123)), t1.msgs[2].m.Body)
 	assert.Equal(t, notifier.SEVERITY_ERROR, t1.msgs[2].m.Severity)
+
+	n.SendRollback(ctx, "456", "https://codereview/456", "Parent job(s) failed after the roll landed: Build")
+	assert.Equal(t, 4, len(t1.msgs))
+	assert.Equal(t, "The childRepo into parentRepo AutoRoller has rolled back (issue 456)", t1.msgs[3].subject)
+	assert.Equal(t, "A recently-landed roll appears to have broken the parent repo: Parent job(s) failed after the roll landed: Build. The roller has uploaded a roll back to the last known-good revision and has stopped itself. Please investigate and resume the roller when the problem is fixed. The rollback is here: https://codereview/456", t1.msgs[3].m.Body)
+	assert.Equal(t, notifier.SEVERITY_ERROR, t1.msgs[3].m.Severity)
 }
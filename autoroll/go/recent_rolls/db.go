@@ -16,6 +16,7 @@ import (
 var (
 	BUCKET_ROLLS         = []byte("rolls")
 	BUCKET_ROLLS_BY_DATE = []byte("rollsByDate")
+	BUCKET_ROLLBACKS     = []byte("rollbacks")
 )
 
 // db is a struct used for interacting with a database.
@@ -37,6 +38,9 @@ func openDB(filename string) (*db, error) {
 		if _, err := tx.CreateBucketIfNotExists(BUCKET_ROLLS_BY_DATE); err != nil {
 			return err
 		}
+		if _, err := tx.CreateBucketIfNotExists(BUCKET_ROLLBACKS); err != nil {
+			return err
+		}
 		return nil
 	}); err != nil {
 		return nil, err
@@ -211,3 +215,35 @@ func (d *db) GetRecentRolls(N int) ([]*autoroll.AutoRollIssue, error) {
 	}
 	return rv, nil
 }
+
+// InsertRollback inserts the given Rollback into the database.
+func (d *db) InsertRollback(r *Rollback) error {
+	serialized, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(BUCKET_ROLLBACKS).Put(issueToRollKey(r.Issue), serialized)
+	})
+}
+
+// GetRollback retrieves the Rollback performed by the given issue from the
+// database, or nil if the issue was not a rollback.
+func (d *db) GetRollback(issue int64) (*Rollback, error) {
+	var r *Rollback
+	if err := d.db.View(func(tx *bolt.Tx) error {
+		serialized := tx.Bucket(BUCKET_ROLLBACKS).Get(issueToRollKey(issue))
+		if serialized == nil {
+			return nil
+		}
+		r = &Rollback{}
+		if err := json.Unmarshal(serialized, r); err != nil {
+			return err
+		}
+		r.Time = r.Time.UTC()
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
@@ -169,3 +169,34 @@ func TestRolls(t *testing.T) {
 	assert.NoError(t, err)
 	deepequal.AssertDeepEqual(t, recent, expect[:3])
 }
+
+// Test that we insert and retrieve rollbacks as expected.
+func TestRollbacks(t *testing.T) {
+	testutils.MediumTest(t)
+	d := newTestDB(t)
+	defer d.cleanup(t)
+
+	// Not a rollback.
+	rb, err := d.db.GetRollback(101101102)
+	assert.NoError(t, err)
+	assert.Nil(t, rb)
+
+	// Insert and retrieve.
+	expect := &Rollback{
+		Issue:           101101102,
+		RolledBackIssue: 101101101,
+		From:            "def",
+		To:              "abc",
+		Reason:          "Parent job(s) failed after the roll landed: Build",
+		Time:            time.Now().UTC(),
+	}
+	assert.NoError(t, d.db.InsertRollback(expect))
+	rb, err = d.db.GetRollback(expect.Issue)
+	assert.NoError(t, err)
+	deepequal.AssertDeepEqual(t, expect, rb)
+
+	// The rolled-back issue is not itself a rollback.
+	rb, err = d.db.GetRollback(expect.RolledBackIssue)
+	assert.NoError(t, err)
+	assert.Nil(t, rb)
+}
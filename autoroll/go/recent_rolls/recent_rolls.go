@@ -2,6 +2,7 @@ package recent_rolls
 
 import (
 	"sync"
+	"time"
 
 	"go.skia.org/infra/go/autoroll"
 	"go.skia.org/infra/go/sklog"
@@ -9,6 +10,22 @@ import (
 
 const RECENT_ROLLS_LENGTH = 10
 
+// Rollback records that a landed roll was automatically rolled back.
+type Rollback struct {
+	// Issue is the roll which performed the rollback.
+	Issue int64 `json:"issue"`
+	// RolledBackIssue is the landed roll which was rolled back.
+	RolledBackIssue int64 `json:"rolledBackIssue"`
+	// From is the revision which was rolled back.
+	From string `json:"from"`
+	// To is the last known-good revision.
+	To string `json:"to"`
+	// Reason describes why the roll was rolled back.
+	Reason string `json:"reason"`
+	// Time is the time at which the rollback was uploaded.
+	Time time.Time `json:"time"`
+}
+
 // RecentRolls is a struct used for storing and retrieving recent DEPS rolls.
 type RecentRolls struct {
 	db     *db
@@ -82,6 +99,22 @@ func (r *RecentRolls) Get(issue int64) (*autoroll.AutoRollIssue, error) {
 	return r.db.GetRoll(issue)
 }
 
+// AddRollback records that the given Rollback was performed. The roll which
+// performed the rollback should be added separately.
+func (r *RecentRolls) AddRollback(rb *Rollback) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.db.InsertRollback(rb)
+}
+
+// GetRollback returns the Rollback performed by the given issue, or nil if
+// the issue was not a rollback.
+func (r *RecentRolls) GetRollback(issue int64) (*Rollback, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.db.GetRollback(issue)
+}
+
 // GetRecentRolls returns a copy of the recent rolls list.
 func (r *RecentRolls) GetRecentRolls() []*autoroll.AutoRollIssue {
 	r.mtx.RLock()
@@ -416,6 +416,13 @@ func (r *noCheckoutDEPSRepoManager) SetStrategy(s strategy.NextRollStrategy) {
 	r.strategy = s
 }
 
+// See documentation for RepoManager interface.
+func (r *noCheckoutDEPSRepoManager) GetStrategy() strategy.NextRollStrategy {
+	r.strategyMtx.RLock()
+	defer r.strategyMtx.RUnlock()
+	return r.strategy
+}
+
 // See documentation for RepoManager interface.
 func (r *noCheckoutDEPSRepoManager) DefaultStrategy() string {
 	return strategy.ROLL_STRATEGY_BATCH
@@ -425,6 +432,7 @@ func (r *noCheckoutDEPSRepoManager) DefaultStrategy() string {
 func (r *noCheckoutDEPSRepoManager) ValidStrategies() []string {
 	return []string{
 		strategy.ROLL_STRATEGY_BATCH,
+		strategy.ROLL_STRATEGY_BISECT,
 		strategy.ROLL_STRATEGY_LKGR,
 		strategy.ROLL_STRATEGY_SINGLE,
 	}
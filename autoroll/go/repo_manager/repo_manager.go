@@ -87,6 +87,9 @@ type RepoManager interface {
 	// Set the RepoManager's NextRollRevStrategy.
 	SetStrategy(strategy.NextRollStrategy)
 
+	// Return the RepoManager's NextRollRevStrategy.
+	GetStrategy() strategy.NextRollStrategy
+
 	// Return the default NextRollStrategy name.
 	DefaultStrategy() string
 
@@ -277,6 +280,13 @@ func (r *commonRepoManager) SetStrategy(s strategy.NextRollStrategy) {
 	r.strategy = s
 }
 
+// See documentation for RepoManager interface.
+func (r *commonRepoManager) GetStrategy() strategy.NextRollStrategy {
+	r.strategyMtx.RLock()
+	defer r.strategyMtx.RUnlock()
+	return r.strategy
+}
+
 // Set the given strategy on the RepoManager.
 func SetStrategy(ctx context.Context, r RepoManager, s string) error {
 	valid := r.ValidStrategies()
@@ -313,6 +323,7 @@ func (r *commonRepoManager) DefaultStrategy() string {
 func (r *commonRepoManager) ValidStrategies() []string {
 	return []string{
 		strategy.ROLL_STRATEGY_BATCH,
+		strategy.ROLL_STRATEGY_BISECT,
 		strategy.ROLL_STRATEGY_LKGR,
 		strategy.ROLL_STRATEGY_SINGLE,
 	}
@@ -285,3 +285,7 @@ func (r *MockRepoManager) CreateNextRollStrategy(ctx context.Context, s string)
 
 func (r *MockRepoManager) SetStrategy(strategy.NextRollStrategy) {
 }
+
+func (r *MockRepoManager) GetStrategy() strategy.NextRollStrategy {
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"path"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -23,6 +24,7 @@ import (
 	"go.skia.org/infra/go/email"
 	"go.skia.org/infra/go/gerrit"
 	"go.skia.org/infra/go/github"
+	"go.skia.org/infra/go/httputils"
 	"go.skia.org/infra/go/human"
 	"go.skia.org/infra/go/metrics2"
 	"go.skia.org/infra/go/sklog"
@@ -32,6 +34,9 @@ import (
 const (
 	// We'll send a notification if this many rolls fail in a row.
 	NOTIFY_IF_LAST_N_FAILED = 3
+
+	// User name used for mode changes made by the roller itself.
+	AUTOROLL_USER = "AutoRoll Bot"
 )
 
 // AutoRoller is a struct which automates the merging new revisions of one
@@ -51,6 +56,10 @@ type AutoRoller struct {
 	recent          *recent_rolls.RecentRolls
 	retrieveRoll    func(context.Context, *AutoRoller, int64) (RollImpl, error)
 	rm              repo_manager.RepoManager
+	rollbackCheck   modes.HealthCheck
+	rollbackIssue   *autoroll.AutoRollIssue
+	rollbackReason  string
+	rollbackWindow  time.Duration
 	runningMtx      sync.Mutex
 	safetyThrottle  *state_machine.Throttler
 	serverURL       string
@@ -182,6 +191,10 @@ func NewAutoRoller(ctx context.Context, c AutoRollerConfig, emailer *email.GMail
 		strategyHistory: sh,
 		successThrottle: successThrottle,
 	}
+	if c.Rollback != nil {
+		arb.rollbackCheck = c.Rollback.HealthCheck(httputils.NewTimeoutClient(), gitcookiesPath)
+		arb.rollbackWindow = c.Rollback.GetWindow()
+	}
 	sm, err := state_machine.New(arb, workdir, n)
 	if err != nil {
 		return nil, err
@@ -286,6 +299,9 @@ func (r *AutoRoller) GetMode() string {
 
 // SetMode sets the desired mode of the bot.
 func (r *AutoRoller) SetMode(ctx context.Context, mode, user, message string) error {
+	if mode == modes.MODE_RUNNING_WITH_ROLLBACK && r.rollbackCheck == nil {
+		return fmt.Errorf("Mode %q requires a rollback config.", mode)
+	}
 	if err := r.modeHistory.Add(mode, user, message); err != nil {
 		return err
 	}
@@ -356,9 +372,55 @@ func (r *AutoRoller) UploadNewRoll(ctx context.Context, from, to string, dryRun
 		return err
 	}
 	r.currentRoll = roll
+	if s := r.bisectStrategy(); s != nil && !dryRun {
+		if c := s.Culprit(); c != nil {
+			msg := fmt.Sprintf("A previous roll failed. Bisection found the culprit to be %s (%q).", c.Hash, c.Subject)
+			if err := roll.AddComment(msg); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
+// bisectStrategy returns the current NextRollStrategy if it is a
+// BisectStrategy, or nil otherwise.
+func (r *AutoRoller) bisectStrategy() *strategy.BisectStrategy {
+	s, _ := r.rm.GetStrategy().(*strategy.BisectStrategy)
+	return s
+}
+
+// See documentation for state_machine.AutoRollerImpl interface.
+func (r *AutoRoller) UploadRollback(ctx context.Context, to, reason string) error {
+	rolledBack := r.rollbackIssue
+	if rolledBack == nil {
+		return errors.New("No roll to roll back.")
+	}
+	from := r.GetCurrentRev()
+	if err := r.UploadNewRoll(ctx, from, to, false); err != nil {
+		return err
+	}
+	issue, err := strconv.ParseInt(r.currentRoll.IssueID(), 10, 64)
+	if err != nil {
+		return fmt.Errorf("Failed to parse issue ID of rollback: %s", err)
+	}
+	if err := r.recent.AddRollback(&recent_rolls.Rollback{
+		Issue:           issue,
+		RolledBackIssue: rolledBack.Issue,
+		From:            from,
+		To:              to,
+		Reason:          reason,
+		Time:            time.Now().UTC(),
+	}); err != nil {
+		return err
+	}
+	if err := r.AddComment(rolledBack.Issue, fmt.Sprintf("Rolled back by %s: %s", r.currentRoll.IssueURL(), reason), AUTOROLL_USER, time.Now()); err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("Stopping after rolling back %s%d in %s: %s", r.rm.GetIssueUrlBase(), rolledBack.Issue, r.currentRoll.IssueURL(), reason)
+	return r.SetMode(ctx, modes.MODE_STOPPED, AUTOROLL_USER, msg)
+}
+
 // Return a state_machine.Throttler indicating that we have failed to roll too many
 // times within a time period.
 func (r *AutoRoller) FailureThrottle() *state_machine.Throttler {
@@ -375,6 +437,29 @@ func (r *AutoRoller) GetNextRollRev() string {
 	return r.rm.NextRollRev()
 }
 
+// See documentation for state_machine.AutoRollerImpl interface.
+func (r *AutoRoller) GetBisectRev() string {
+	if s := r.bisectStrategy(); s != nil {
+		return s.BisectRev()
+	}
+	return ""
+}
+
+// See documentation for state_machine.AutoRollerImpl interface.
+func (r *AutoRoller) RecordRollResult(rev string, success bool) {
+	if s := r.bisectStrategy(); s != nil {
+		s.RollFinished(rev, success)
+	}
+}
+
+// See documentation for state_machine.AutoRollerImpl interface.
+func (r *AutoRoller) GetRollback() (string, string) {
+	if r.rollbackIssue == nil {
+		return "", ""
+	}
+	return r.rollbackIssue.RollingFrom, r.rollbackReason
+}
+
 // See documentation for state_machine.AutoRollerImpl interface.
 func (r *AutoRoller) RolledPast(ctx context.Context, rev string) (bool, error) {
 	return r.rm.RolledPast(ctx, rev)
@@ -394,7 +479,40 @@ func (r *AutoRoller) SuccessThrottle() *state_machine.Throttler {
 
 // See documentation for state_machine.AutoRollerImpl interface.
 func (r *AutoRoller) UpdateRepos(ctx context.Context) error {
-	return r.rm.Update(ctx)
+	if err := r.rm.Update(ctx); err != nil {
+		return err
+	}
+	return r.updateRollback(ctx)
+}
+
+// updateRollback runs the rollback health check on the most recently-landed
+// roll, if the roller is in MODE_RUNNING_WITH_ROLLBACK.
+func (r *AutoRoller) updateRollback(ctx context.Context) error {
+	r.rollbackIssue = nil
+	r.rollbackReason = ""
+	if r.rollbackCheck == nil || r.GetMode() != modes.MODE_RUNNING_WITH_ROLLBACK {
+		return nil
+	}
+	var isRollbackErr error
+	isRollback := func(issue int64) bool {
+		rb, err := r.recent.GetRollback(issue)
+		if err != nil {
+			isRollbackErr = err
+		}
+		return rb != nil
+	}
+	roll, reason, err := modes.FindRollback(ctx, r.rollbackCheck, r.recent.GetRecentRolls(), isRollback, r.rollbackWindow, time.Now())
+	if err != nil {
+		return err
+	} else if isRollbackErr != nil {
+		return isRollbackErr
+	}
+	if roll != nil {
+		sklog.Warningf("Roll %d needs to be rolled back: %s", roll.Issue, reason)
+		r.rollbackIssue = roll
+		r.rollbackReason = reason
+	}
+	return nil
 }
 
 // Update the status information of the roller.
@@ -426,12 +544,20 @@ func (r *AutoRoller) updateStatus(replaceLastError bool, lastError string) error
 		throttledUntil = successThrottledUntil
 	}
 
+	culprit := ""
+	if s := r.bisectStrategy(); s != nil {
+		if c := s.Culprit(); c != nil {
+			culprit = c.Hash
+		}
+	}
+
 	sklog.Infof("Updating status (%d)", r.rm.CommitsNotRolled())
 	return r.status.Set(&AutoRollStatus{
 		AutoRollMiniStatus: AutoRollMiniStatus{
 			NumFailedRolls:      numFailures,
 			NumNotRolledCommits: r.rm.CommitsNotRolled(),
 		},
+		Culprit:         culprit,
 		CurrentRoll:     r.recent.CurrentRoll(),
 		Error:           lastError,
 		FullHistoryUrl:  r.rm.GetFullHistoryUrl(),
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/flynn/json5"
+	"go.skia.org/infra/autoroll/go/modes"
 	arb_notifier "go.skia.org/infra/autoroll/go/notifier"
 	"go.skia.org/infra/autoroll/go/repo_manager"
 	"go.skia.org/infra/go/human"
@@ -124,6 +125,10 @@ type AutoRollerConfig struct {
 	MaxRollFrequency string `json:"maxRollFrequency"`
 	// Any extra notification systems to be used for this roller.
 	Notifiers []*notifier.Config `json:"notifiers"`
+	// Configuration for automatically rolling back landed rolls which
+	// break the parent repo. Required in order to use
+	// MODE_RUNNING_WITH_ROLLBACK.
+	Rollback *modes.RollbackConfig `json:"rollback"`
 	// Throttling configuration to prevent uploading too many CLs within
 	// too short a time period.
 	SafetyThrottle *ThrottleConfig `json:"safetyThrottle"`
@@ -184,6 +189,11 @@ func (c *AutoRollerConfig) Validate() error {
 	if err := rm[0].Validate(); err != nil {
 		return err
 	}
+	if c.Rollback != nil {
+		if err := c.Rollback.Validate(); err != nil {
+			return err
+		}
+	}
 
 	// Verify that the notifier configs are valid.
 	a := arb_notifier.New("fake", "fake", nil)
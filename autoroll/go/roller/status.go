@@ -14,6 +14,7 @@ import (
 type AutoRollStatus struct {
 	AutoRollMiniStatus
 	ChildHead       string                    `json:"childHead"`
+	Culprit         string                    `json:"culprit"`
 	CurrentRoll     *autoroll.AutoRollIssue   `json:"currentRoll"`
 	Error           string                    `json:"error"`
 	FullHistoryUrl  string                    `json:"fullHistoryUrl"`
@@ -54,6 +55,7 @@ type AutoRollMiniStatus struct {
 // AutoRollStatusCache is a struct used for caching roll-up status
 // information about the AutoRoll Bot.
 type AutoRollStatusCache struct {
+	culprit         string
 	currentRoll     *autoroll.AutoRollIssue
 	fullHistoryUrl  string
 	issueUrlBase    string
@@ -96,6 +98,7 @@ func (c *AutoRollStatusCache) Get(includeError bool, cleanIssue func(*autoroll.A
 			NumFailedRolls:      c.numFailed,
 			NumNotRolledCommits: c.numNotRolled,
 		},
+		Culprit:         c.culprit,
 		FullHistoryUrl:  c.fullHistoryUrl,
 		IssueUrlBase:    c.issueUrlBase,
 		LastRollRev:     c.lastRollRev,
@@ -142,6 +145,7 @@ func (c *AutoRollStatusCache) Set(s *AutoRollStatus) error {
 	if s.LastRoll != nil {
 		c.lastRoll = s.LastRoll.Copy()
 	}
+	c.culprit = s.Culprit
 	c.fullHistoryUrl = s.FullHistoryUrl
 	c.issueUrlBase = s.IssueUrlBase
 	c.lastError = s.Error
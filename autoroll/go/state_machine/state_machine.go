@@ -35,6 +35,12 @@ const (
 	S_DRY_RUN_FAILURE              = "dry run failure"
 	S_DRY_RUN_FAILURE_THROTTLED    = "dry run failure throttled"
 	S_DRY_RUN_SAFETY_THROTTLED     = "dry run safety throttled"
+	S_ROLLBACK_ACTIVE              = "rollback active"
+	S_ROLLBACK_SUCCESS             = "rollback success"
+	S_ROLLBACK_FAILURE             = "rollback failure"
+	S_BISECT_ACTIVE                = "bisect active"
+	S_BISECT_SUCCESS               = "bisect success"
+	S_BISECT_FAILURE               = "bisect failure"
 	S_STOPPED                      = "stopped"
 
 	// Transition function names.
@@ -54,6 +60,13 @@ const (
 	F_RETRY_FAILED_DRY_RUN    = "retry failed dry run"
 	F_NOTIFY_FAILURE_THROTTLE = "notify failure throttled"
 	F_NOTIFY_SAFETY_THROTTLE  = "notify safety throttled"
+	F_UPLOAD_ROLLBACK         = "upload rollback"
+	F_ROLLBACK_LANDED         = "rollback landed"
+	F_CLOSE_ROLLBACK_FAILED   = "close rollback (failed)"
+	F_RECORD_FAILURE          = "record failed roll"
+	F_UPLOAD_BISECT_DRY_RUN   = "upload bisect dry run"
+	F_CLOSE_BISECT_SUCCESS    = "close bisect dry run (succeeded)"
+	F_CLOSE_BISECT_FAILED     = "close bisect dry run (failed)"
 
 	// Maximum number of no-op transitions to perform at once. This is an
 	// arbitrary limit just to keep us from performing an unbounded number
@@ -129,6 +142,22 @@ type AutoRollerImpl interface {
 	// Return the current mode of the AutoRoller.
 	GetMode() string
 
+	// Return the revision at which the next dry run should be performed
+	// while searching for the commit which caused a roll to fail, or the
+	// empty string if no search is in progress. Only used by the bisect
+	// strategy.
+	GetBisectRev() string
+
+	// Return the revision to which we should roll back and a message
+	// describing the problem, if the most recently-landed roll broke the
+	// parent repo. Returns empty strings if no rollback is needed. Only
+	// used in MODE_RUNNING_WITH_ROLLBACK.
+	GetRollback() (string, string)
+
+	// Record the result of a roll or dry run to the given revision. Only
+	// used by the bisect strategy.
+	RecordRollResult(rev string, success bool)
+
 	// Return true if we have already rolled past the given revision.
 	RolledPast(context.Context, string) (bool, error)
 
@@ -142,6 +171,10 @@ type AutoRollerImpl interface {
 
 	// Update the project and sub-project repos.
 	UpdateRepos(context.Context) error
+
+	// Upload a roll back to the given revision, record it as a rollback
+	// and stop the roller. AutoRollerImpl should track the created roll.
+	UploadRollback(ctx context.Context, to, reason string) error
 }
 
 // AutoRollStateMachine is a StateMachine for the AutoRoller.
@@ -367,6 +400,74 @@ func New(impl AutoRollerImpl, workdir string, n *notifier.AutoRollNotifier) (*Au
 		n.SendSafetyThrottled(ctx, s.a.SafetyThrottle().ThrottledUntil())
 		return nil
 	})
+	b.F(F_UPLOAD_ROLLBACK, func(ctx context.Context) error {
+		to, reason := s.a.GetRollback()
+		if to == "" {
+			return fmt.Errorf("No rollback is needed.")
+		}
+		if err := s.a.SafetyThrottle().Inc(); err != nil {
+			return err
+		}
+		if err := s.a.UploadRollback(ctx, to, reason); err != nil {
+			return err
+		}
+		roll := s.a.GetActiveRoll()
+		n.SendRollback(ctx, roll.IssueID(), roll.IssueURL(), reason)
+		return nil
+	})
+	b.F(F_ROLLBACK_LANDED, func(ctx context.Context) error {
+		roll := s.a.GetActiveRoll()
+		if err := s.a.UpdateRepos(ctx); err != nil {
+			return err
+		}
+		n.SendIssueUpdate(ctx, roll.IssueID(), roll.IssueURL(), "This rollback landed successfully. The roller remains stopped.")
+		return nil
+	})
+	b.F(F_CLOSE_ROLLBACK_FAILED, func(ctx context.Context) error {
+		roll := s.a.GetActiveRoll()
+		if err := roll.Close(ctx, autoroll.ROLL_RESULT_FAILURE, fmt.Sprintf("Commit queue failed; closing this rollback.")); err != nil {
+			return err
+		}
+		n.SendIssueUpdate(ctx, roll.IssueID(), roll.IssueURL(), "This rollback was abandoned because the commit queue failed. The roller remains stopped; the sheriff should roll back manually.")
+		return nil
+	})
+	b.F(F_RECORD_FAILURE, func(ctx context.Context) error {
+		s.a.RecordRollResult(s.a.GetActiveRoll().RollingTo(), false)
+		return nil
+	})
+	b.F(F_UPLOAD_BISECT_DRY_RUN, func(ctx context.Context) error {
+		rev := s.a.GetBisectRev()
+		if rev == "" {
+			return fmt.Errorf("No bisection is in progress.")
+		}
+		if err := s.a.SafetyThrottle().Inc(); err != nil {
+			return err
+		}
+		if err := s.a.UploadNewRoll(ctx, s.a.GetCurrentRev(), rev, true); err != nil {
+			return err
+		}
+		roll := s.a.GetActiveRoll()
+		n.SendIssueUpdate(ctx, roll.IssueID(), roll.IssueURL(), fmt.Sprintf("The roller has uploaded a dry run to search for the commit which caused a roll to fail: %s", roll.IssueURL()))
+		return nil
+	})
+	b.F(F_CLOSE_BISECT_SUCCESS, func(ctx context.Context) error {
+		roll := s.a.GetActiveRoll()
+		s.a.RecordRollResult(roll.RollingTo(), true)
+		if err := roll.Close(ctx, autoroll.ROLL_RESULT_DRY_RUN_SUCCESS, fmt.Sprintf("Dry run succeeded; the commit which caused the roll to fail is after %s.", roll.RollingTo())); err != nil {
+			return err
+		}
+		n.SendIssueUpdate(ctx, roll.IssueID(), roll.IssueURL(), "This CL was abandoned because the bisection dry run succeeded.")
+		return nil
+	})
+	b.F(F_CLOSE_BISECT_FAILED, func(ctx context.Context) error {
+		roll := s.a.GetActiveRoll()
+		s.a.RecordRollResult(roll.RollingTo(), false)
+		if err := roll.Close(ctx, autoroll.ROLL_RESULT_DRY_RUN_FAILURE, fmt.Sprintf("Dry run failed; the commit which caused the roll to fail is at or before %s.", roll.RollingTo())); err != nil {
+			return err
+		}
+		n.SendIssueUpdate(ctx, roll.IssueID(), roll.IssueURL(), "This CL was abandoned because the bisection dry run failed.")
+		return nil
+	})
 
 	// States and transitions.
 
@@ -382,10 +483,12 @@ func New(impl AutoRollerImpl, workdir string, n *notifier.AutoRollNotifier) (*Au
 	b.T(S_NORMAL_IDLE, S_NORMAL_SAFETY_THROTTLED, F_NOTIFY_SAFETY_THROTTLE)
 	b.T(S_NORMAL_IDLE, S_NORMAL_SUCCESS_THROTTLED, F_NOOP)
 	b.T(S_NORMAL_IDLE, S_NORMAL_ACTIVE, F_UPLOAD_ROLL)
+	b.T(S_NORMAL_IDLE, S_ROLLBACK_ACTIVE, F_UPLOAD_ROLLBACK)
+	b.T(S_NORMAL_IDLE, S_BISECT_ACTIVE, F_UPLOAD_BISECT_DRY_RUN)
 	b.T(S_NORMAL_ACTIVE, S_NORMAL_ACTIVE, F_UPDATE_ROLL)
 	b.T(S_NORMAL_ACTIVE, S_DRY_RUN_ACTIVE, F_SWITCH_TO_DRY_RUN)
 	b.T(S_NORMAL_ACTIVE, S_NORMAL_SUCCESS, F_NOOP)
-	b.T(S_NORMAL_ACTIVE, S_NORMAL_FAILURE, F_NOOP)
+	b.T(S_NORMAL_ACTIVE, S_NORMAL_FAILURE, F_RECORD_FAILURE)
 	b.T(S_NORMAL_ACTIVE, S_STOPPED, F_CLOSE_STOPPED)
 	b.T(S_NORMAL_SUCCESS, S_NORMAL_IDLE, F_WAIT_FOR_LAND)
 	b.T(S_NORMAL_SUCCESS, S_NORMAL_SUCCESS_THROTTLED, F_WAIT_FOR_LAND)
@@ -393,6 +496,7 @@ func New(impl AutoRollerImpl, workdir string, n *notifier.AutoRollNotifier) (*Au
 	b.T(S_NORMAL_SUCCESS_THROTTLED, S_NORMAL_IDLE, F_NOOP)
 	b.T(S_NORMAL_SUCCESS_THROTTLED, S_DRY_RUN_IDLE, F_NOOP)
 	b.T(S_NORMAL_SUCCESS_THROTTLED, S_STOPPED, F_NOOP)
+	b.T(S_NORMAL_SUCCESS_THROTTLED, S_ROLLBACK_ACTIVE, F_UPLOAD_ROLLBACK)
 	b.T(S_NORMAL_FAILURE, S_NORMAL_IDLE, F_CLOSE_FAILED)
 	b.T(S_NORMAL_FAILURE, S_NORMAL_FAILURE_THROTTLED, F_NOTIFY_FAILURE_THROTTLE)
 	b.T(S_NORMAL_FAILURE_THROTTLED, S_NORMAL_FAILURE_THROTTLED, F_UPDATE_REPOS)
@@ -403,6 +507,22 @@ func New(impl AutoRollerImpl, workdir string, n *notifier.AutoRollNotifier) (*Au
 	b.T(S_NORMAL_SAFETY_THROTTLED, S_NORMAL_IDLE, F_NOOP)
 	b.T(S_NORMAL_SAFETY_THROTTLED, S_NORMAL_SAFETY_THROTTLED, F_UPDATE_REPOS)
 
+	// Rollback states. The roller is stopped when the rollback is uploaded,
+	// but the rollback is allowed to finish before we enter S_STOPPED.
+	b.T(S_ROLLBACK_ACTIVE, S_ROLLBACK_ACTIVE, F_UPDATE_ROLL)
+	b.T(S_ROLLBACK_ACTIVE, S_ROLLBACK_SUCCESS, F_NOOP)
+	b.T(S_ROLLBACK_ACTIVE, S_ROLLBACK_FAILURE, F_NOOP)
+	b.T(S_ROLLBACK_SUCCESS, S_STOPPED, F_ROLLBACK_LANDED)
+	b.T(S_ROLLBACK_FAILURE, S_STOPPED, F_CLOSE_ROLLBACK_FAILED)
+
+	// Bisecting a failed roll.
+	b.T(S_BISECT_ACTIVE, S_BISECT_ACTIVE, F_UPDATE_ROLL)
+	b.T(S_BISECT_ACTIVE, S_BISECT_SUCCESS, F_NOOP)
+	b.T(S_BISECT_ACTIVE, S_BISECT_FAILURE, F_NOOP)
+	b.T(S_BISECT_ACTIVE, S_STOPPED, F_CLOSE_STOPPED)
+	b.T(S_BISECT_SUCCESS, S_NORMAL_IDLE, F_CLOSE_BISECT_SUCCESS)
+	b.T(S_BISECT_FAILURE, S_NORMAL_IDLE, F_CLOSE_BISECT_FAILED)
+
 	// Dry run states.
 	b.T(S_DRY_RUN_IDLE, S_STOPPED, F_NOOP)
 	b.T(S_DRY_RUN_IDLE, S_DRY_RUN_IDLE, F_UPDATE_REPOS)
@@ -444,6 +564,13 @@ func New(impl AutoRollerImpl, workdir string, n *notifier.AutoRollNotifier) (*Au
 // Get the next state.
 func (s *AutoRollStateMachine) GetNext() (string, error) {
 	desiredMode := s.a.GetMode()
+	// Apart from watching for landed rolls which need to be rolled back,
+	// MODE_RUNNING_WITH_ROLLBACK behaves like MODE_RUNNING.
+	rollback := ""
+	if desiredMode == modes.MODE_RUNNING_WITH_ROLLBACK {
+		desiredMode = modes.MODE_RUNNING
+		rollback, _ = s.a.GetRollback()
+	}
 	switch state := s.s.Current(); state {
 	case S_STOPPED:
 		switch desiredMode {
@@ -469,10 +596,17 @@ func (s *AutoRollStateMachine) GetNext() (string, error) {
 		}
 		current := s.a.GetCurrentRev()
 		next := s.a.GetNextRollRev()
-		if current == next {
+		bisect := s.a.GetBisectRev()
+		if rollback != "" && rollback != current {
+			return S_ROLLBACK_ACTIVE, nil
+		} else if current == next && bisect == "" {
 			return S_NORMAL_IDLE, nil
 		} else if s.a.SafetyThrottle().IsThrottled() {
 			return S_NORMAL_SAFETY_THROTTLED, nil
+		} else if bisect != "" {
+			// Dry runs don't land, so they aren't subject to the
+			// success throttle.
+			return S_BISECT_ACTIVE, nil
 		} else if s.a.SuccessThrottle().IsThrottled() {
 			return S_NORMAL_SUCCESS_THROTTLED, nil
 		} else {
@@ -511,6 +645,8 @@ func (s *AutoRollStateMachine) GetNext() (string, error) {
 			return S_DRY_RUN_IDLE, nil
 		} else if desiredMode == modes.MODE_STOPPED {
 			return S_STOPPED, nil
+		} else if rollback != "" && rollback != s.a.GetCurrentRev() {
+			return S_ROLLBACK_ACTIVE, nil
 		} else if s.a.SuccessThrottle().IsThrottled() {
 			return S_NORMAL_SUCCESS_THROTTLED, nil
 		}
@@ -520,6 +656,11 @@ func (s *AutoRollStateMachine) GetNext() (string, error) {
 		if err := throttle.Inc(); err != nil {
 			return "", err
 		}
+		if s.a.GetBisectRev() != "" {
+			// Search for the commit which caused the failure rather
+			// than retrying the same roll.
+			return S_NORMAL_IDLE, nil
+		}
 		if s.a.GetNextRollRev() == s.a.GetActiveRoll().RollingTo() {
 			// Rather than upload the same CL again, we'll try
 			// running the CQ again after a period of throttling.
@@ -533,6 +674,13 @@ func (s *AutoRollStateMachine) GetNext() (string, error) {
 			return S_STOPPED, nil
 		} else if s.a.GetNextRollRev() != s.a.GetActiveRoll().RollingTo() {
 			return S_NORMAL_IDLE, nil
+		} else if rollback != "" {
+			// Close the failed roll so that we can roll back.
+			return S_NORMAL_IDLE, nil
+		} else if s.a.GetBisectRev() != "" {
+			// Close the failed roll so that we can search for the
+			// commit which caused it to fail.
+			return S_NORMAL_IDLE, nil
 		} else if desiredMode == modes.MODE_DRY_RUN {
 			return S_DRY_RUN_ACTIVE, nil
 		} else if s.a.FailureThrottle().IsThrottled() {
@@ -573,7 +721,6 @@ func (s *AutoRollStateMachine) GetNext() (string, error) {
 				return S_DRY_RUN_FAILURE, nil
 			}
 		} else {
-			desiredMode := s.a.GetMode()
 			if desiredMode == modes.MODE_RUNNING {
 				return S_NORMAL_ACTIVE, nil
 			} else if desiredMode == modes.MODE_STOPPED {
@@ -632,6 +779,34 @@ func (s *AutoRollStateMachine) GetNext() (string, error) {
 			return S_DRY_RUN_SAFETY_THROTTLED, nil
 		}
 		return S_DRY_RUN_IDLE, nil
+	case S_ROLLBACK_ACTIVE:
+		// Ignore the mode; the rollback should land even though the
+		// roller has been stopped.
+		currentRoll := s.a.GetActiveRoll()
+		if currentRoll.IsFinished() {
+			if currentRoll.IsSuccess() {
+				return S_ROLLBACK_SUCCESS, nil
+			}
+			return S_ROLLBACK_FAILURE, nil
+		}
+		return S_ROLLBACK_ACTIVE, nil
+	case S_ROLLBACK_SUCCESS, S_ROLLBACK_FAILURE:
+		return S_STOPPED, nil
+	case S_BISECT_ACTIVE:
+		currentRoll := s.a.GetActiveRoll()
+		if currentRoll.IsDryRunFinished() {
+			if currentRoll.IsDryRunSuccess() {
+				return S_BISECT_SUCCESS, nil
+			}
+			return S_BISECT_FAILURE, nil
+		} else if desiredMode != modes.MODE_RUNNING {
+			// We only bisect in normal mode. Close the dry run; we'll
+			// transition to the desired mode from S_STOPPED.
+			return S_STOPPED, nil
+		}
+		return S_BISECT_ACTIVE, nil
+	case S_BISECT_SUCCESS, S_BISECT_FAILURE:
+		return S_NORMAL_IDLE, nil
 	default:
 		return "", fmt.Errorf("Invalid state %q", state)
 	}
@@ -169,6 +169,10 @@ type TestAutoRollerImpl struct {
 	getNextRollRevError  error
 
 	getModeResult   string
+	bisectRev       string
+	rollResults     map[string]bool
+	rollbackRev     string
+	rollbackReason  string
 	rolledPast      map[string]bool
 	safetyThrottle  *Throttler
 	successThrottle *Throttler
@@ -187,6 +191,7 @@ func NewTestAutoRollerImpl(t *testing.T) *TestAutoRollerImpl {
 		t:               t,
 		failureThrottle: failureThrottle,
 		getModeResult:   modes.MODE_RUNNING,
+		rollResults:     map[string]bool{},
 		rolledPast:      map[string]bool{},
 		safetyThrottle:  safetyThrottle,
 		successThrottle: successThrottle,
@@ -255,6 +260,41 @@ func (r *TestAutoRollerImpl) SetMode(ctx context.Context, mode string) {
 	r.getModeResult = mode
 }
 
+// See documentation for AutoRollerImpl.
+func (r *TestAutoRollerImpl) GetBisectRev() string {
+	return r.bisectRev
+}
+
+// Set the result of GetBisectRev.
+func (r *TestAutoRollerImpl) SetBisectRev(rev string) {
+	r.bisectRev = rev
+}
+
+// See documentation for AutoRollerImpl.
+func (r *TestAutoRollerImpl) RecordRollResult(rev string, success bool) {
+	r.rollResults[rev] = success
+}
+
+// See documentation for AutoRollerImpl.
+func (r *TestAutoRollerImpl) GetRollback() (string, string) {
+	return r.rollbackRev, r.rollbackReason
+}
+
+// Set the result of GetRollback.
+func (r *TestAutoRollerImpl) SetRollback(rev, reason string) {
+	r.rollbackRev = rev
+	r.rollbackReason = reason
+}
+
+// See documentation for AutoRollerImpl.
+func (r *TestAutoRollerImpl) UploadRollback(ctx context.Context, to, reason string) error {
+	if err := r.UploadNewRoll(ctx, r.getCurrentRevResult, to, false); err != nil {
+		return err
+	}
+	r.getModeResult = modes.MODE_STOPPED
+	return nil
+}
+
 // See documentation for AutoRollerImpl.
 func (r *TestAutoRollerImpl) RolledPast(ctx context.Context, rev string) (bool, error) {
 	rv, ok := r.rolledPast[rev]
@@ -737,3 +777,172 @@ func TestSuccessThrottle(t *testing.T) {
 	r.successThrottle = successThrottle
 	checkNextState(t, sm, S_NORMAL_IDLE)
 }
+
+func TestRollback(t *testing.T) {
+	testutils.MediumTest(t)
+	r := NewTestAutoRollerImpl(t)
+	workdir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer testutils.RemoveAll(t, workdir)
+	sm, err := New(r, workdir, notifier.New("fake", "fake", nil))
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	failureThrottle, err := NewThrottler(path.Join(workdir, "fail_counter"), time.Hour, 1)
+	assert.NoError(t, err)
+	r.failureThrottle = failureThrottle
+
+	r.SetMode(ctx, modes.MODE_RUNNING_WITH_ROLLBACK)
+	r.SetCurrentRev("HEAD")
+	r.SetNextRollRev("HEAD")
+	checkNextState(t, sm, S_NORMAL_IDLE)
+
+	// Land a roll.
+	r.SetNextRollRev("HEAD+1")
+	checkNextState(t, sm, S_NORMAL_ACTIVE)
+	roll := r.GetActiveRoll().(*TestRollCLImpl)
+	roll.SetSucceeded()
+	r.SetCurrentRev("HEAD+1")
+	checkNextState(t, sm, S_NORMAL_SUCCESS)
+	r.SetRolledPast("HEAD+1", true)
+	checkNextState(t, sm, S_NORMAL_IDLE)
+	checkNextState(t, sm, S_NORMAL_IDLE)
+
+	// The rollback signal is ignored in MODE_RUNNING.
+	r.SetRollback("HEAD", "broken")
+	r.SetMode(ctx, modes.MODE_RUNNING)
+	checkNextState(t, sm, S_NORMAL_IDLE)
+
+	// The roll broke the parent. Ensure that we roll back, even though
+	// there are new commits to roll, and that the roller stops itself.
+	r.SetMode(ctx, modes.MODE_RUNNING_WITH_ROLLBACK)
+	r.SetNextRollRev("HEAD+2")
+	checkNextState(t, sm, S_ROLLBACK_ACTIVE)
+	rollback := r.GetActiveRoll().(*TestRollCLImpl)
+	assert.NotEqual(t, roll, rollback)
+	assert.Equal(t, "HEAD", rollback.RollingTo())
+	rollback.AssertNotDryRun()
+	assert.Equal(t, modes.MODE_STOPPED, r.GetMode())
+
+	// The rollback is not closed even though the roller is stopped.
+	checkNextState(t, sm, S_ROLLBACK_ACTIVE)
+	rollback.SetSucceeded()
+	r.SetCurrentRev("HEAD")
+	r.SetRollback("", "")
+	checkNextState(t, sm, S_ROLLBACK_SUCCESS)
+	checkNextState(t, sm, S_STOPPED)
+	rollback.AssertClosed("")
+	checkNextState(t, sm, S_STOPPED)
+
+	// Resume. Roll forward and land again.
+	r.SetMode(ctx, modes.MODE_RUNNING_WITH_ROLLBACK)
+	checkNextState(t, sm, S_NORMAL_IDLE)
+	checkNextState(t, sm, S_NORMAL_ACTIVE)
+	roll = r.GetActiveRoll().(*TestRollCLImpl)
+	roll.SetSucceeded()
+	r.SetCurrentRev("HEAD+2")
+	checkNextState(t, sm, S_NORMAL_SUCCESS)
+	r.SetRolledPast("HEAD+2", true)
+	checkNextState(t, sm, S_NORMAL_IDLE)
+
+	// If the current revision is already the known-good revision, eg.
+	// because the roll was reverted manually, don't roll back.
+	r.SetRollback("HEAD+2", "broken")
+	checkNextState(t, sm, S_NORMAL_IDLE)
+
+	// A failed roll is closed so that we can roll back; the rollback
+	// itself fails.
+	r.SetRollback("", "")
+	r.SetNextRollRev("HEAD+3")
+	checkNextState(t, sm, S_NORMAL_ACTIVE)
+	roll = r.GetActiveRoll().(*TestRollCLImpl)
+	roll.SetFailed()
+	checkNextState(t, sm, S_NORMAL_FAILURE)
+	checkNextState(t, sm, S_NORMAL_FAILURE_THROTTLED)
+	checkNextState(t, sm, S_NORMAL_FAILURE_THROTTLED)
+	r.SetRollback("HEAD+1", "broken")
+	checkNextState(t, sm, S_NORMAL_IDLE)
+	roll.AssertClosed(autoroll.ROLL_RESULT_FAILURE)
+	checkNextState(t, sm, S_ROLLBACK_ACTIVE)
+	rollback = r.GetActiveRoll().(*TestRollCLImpl)
+	assert.Equal(t, "HEAD+1", rollback.RollingTo())
+	rollback.SetFailed()
+	checkNextState(t, sm, S_ROLLBACK_FAILURE)
+	checkNextState(t, sm, S_STOPPED)
+	rollback.AssertClosed(autoroll.ROLL_RESULT_FAILURE)
+}
+
+func TestBisect(t *testing.T) {
+	testutils.MediumTest(t)
+	r := NewTestAutoRollerImpl(t)
+	workdir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer testutils.RemoveAll(t, workdir)
+	sm, err := New(r, workdir, notifier.New("fake", "fake", nil))
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	failureThrottle, err := NewThrottler(path.Join(workdir, "fail_counter"), time.Hour, 1)
+	assert.NoError(t, err)
+	r.failureThrottle = failureThrottle
+
+	r.SetCurrentRev("HEAD")
+	r.SetNextRollRev("HEAD")
+	checkNextState(t, sm, S_NORMAL_IDLE)
+
+	// The roll fails. Rather than retrying it, we start bisecting, even
+	// though we're failure-throttled.
+	r.SetNextRollRev("HEAD+4")
+	checkNextState(t, sm, S_NORMAL_ACTIVE)
+	roll := r.GetActiveRoll().(*TestRollCLImpl)
+	roll.SetFailed()
+	checkNextState(t, sm, S_NORMAL_FAILURE)
+	assert.Equal(t, map[string]bool{"HEAD+4": false}, r.rollResults)
+	r.SetNextRollRev("HEAD")
+	r.SetBisectRev("HEAD+2")
+	checkNextState(t, sm, S_NORMAL_IDLE)
+	roll.AssertClosed(autoroll.ROLL_RESULT_FAILURE)
+	checkNextState(t, sm, S_BISECT_ACTIVE)
+	roll = r.GetActiveRoll().(*TestRollCLImpl)
+	assert.Equal(t, "HEAD+2", roll.RollingTo())
+	roll.AssertDryRun()
+	checkNextState(t, sm, S_BISECT_ACTIVE)
+
+	// The dry run succeeds.
+	roll.SetDryRunSucceeded()
+	checkNextState(t, sm, S_BISECT_SUCCESS)
+	checkNextState(t, sm, S_NORMAL_IDLE)
+	roll.AssertClosed(autoroll.ROLL_RESULT_DRY_RUN_SUCCESS)
+	assert.True(t, r.rollResults["HEAD+2"])
+
+	// The next dry run fails, so we've found the culprit. Roll everything
+	// before it.
+	r.SetBisectRev("HEAD+3")
+	checkNextState(t, sm, S_BISECT_ACTIVE)
+	roll = r.GetActiveRoll().(*TestRollCLImpl)
+	assert.Equal(t, "HEAD+3", roll.RollingTo())
+	roll.SetDryRunFailed()
+	checkNextState(t, sm, S_BISECT_FAILURE)
+	checkNextState(t, sm, S_NORMAL_IDLE)
+	roll.AssertClosed(autoroll.ROLL_RESULT_DRY_RUN_FAILURE)
+	assert.False(t, r.rollResults["HEAD+3"])
+	r.SetBisectRev("")
+	r.SetNextRollRev("HEAD+2")
+	checkNextState(t, sm, S_NORMAL_ACTIVE)
+	roll = r.GetActiveRoll().(*TestRollCLImpl)
+	assert.Equal(t, "HEAD+2", roll.RollingTo())
+	roll.AssertNotDryRun()
+	roll.SetSucceeded()
+	r.SetCurrentRev("HEAD+2")
+	checkNextState(t, sm, S_NORMAL_SUCCESS)
+	r.SetRolledPast("HEAD+2", true)
+	checkNextState(t, sm, S_NORMAL_IDLE)
+
+	// Stopping the roller closes the dry run.
+	r.SetBisectRev("HEAD+5")
+	checkNextState(t, sm, S_BISECT_ACTIVE)
+	roll = r.GetActiveRoll().(*TestRollCLImpl)
+	r.SetMode(ctx, modes.MODE_STOPPED)
+	checkNextState(t, sm, S_STOPPED)
+	roll.AssertClosed(autoroll.ROLL_RESULT_FAILURE)
+}
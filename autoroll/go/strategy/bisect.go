@@ -0,0 +1,152 @@
+package strategy
+
+import (
+	"context"
+	"sync"
+
+	"go.skia.org/infra/go/vcsinfo"
+)
+
+/*
+	The bisect strategy behaves like the batch strategy until a roll fails.
+	It then performs dry runs on smaller ranges of the not-yet-rolled commits
+	to find the commit which caused the failure, rolls everything before that
+	commit, and reports the culprit.
+
+	The strategy does not persist anything. Instead, it is told the results of
+	rolls and dry runs by the roller, and it derives the state of the search
+	from those results and the list of not-yet-rolled commits. Results for
+	commits which have been rolled are discarded.
+*/
+
+// BisectStrategy is a NextRollStrategy which searches for the commit which
+// caused a batched roll to fail.
+type BisectStrategy struct {
+	mtx       sync.Mutex
+	notRolled []*vcsinfo.LongCommit
+	results   map[string]bool
+}
+
+// StrategyBisect returns a BisectStrategy.
+func StrategyBisect() *BisectStrategy {
+	return &BisectStrategy{
+		notRolled: []*vcsinfo.LongCommit{},
+		results:   map[string]bool{},
+	}
+}
+
+// bisect returns the indexes into s.notRolled of the most recent commit known
+// to roll successfully and of the oldest commit known to cause a failure,
+// given that the earlier commit must precede the later one. Either may be -1
+// if no such commit is known. Note that s.notRolled is in reverse
+// chronological order, so "more recent" means "smaller index". Assumes that
+// the caller holds s.mtx.
+func (s *BisectStrategy) bisect() (int, int) {
+	good, bad := -1, -1
+	for i := len(s.notRolled) - 1; i >= 0; i-- {
+		if success, ok := s.results[s.notRolled[i].Hash]; ok && !success {
+			bad = i
+			break
+		}
+	}
+	if bad == -1 {
+		return -1, -1
+	}
+	for i := bad + 1; i < len(s.notRolled); i++ {
+		if s.results[s.notRolled[i].Hash] {
+			good = i
+			break
+		}
+	}
+	return good, bad
+}
+
+// culprit returns the index into s.notRolled of the commit which caused a
+// roll to fail, or -1 if it has not been found. Assumes that the caller holds
+// s.mtx.
+func (s *BisectStrategy) culprit() int {
+	good, bad := s.bisect()
+	if bad == -1 {
+		return -1
+	}
+	// The commit just before the culprit either succeeded or was already
+	// rolled.
+	if good == bad+1 || (good == -1 && bad == len(s.notRolled)-1) {
+		return bad
+	}
+	return -1
+}
+
+// See documentation for NextRollStrategy interface.
+func (s *BisectStrategy) GetNextRollRev(ctx context.Context, notRolled []*vcsinfo.LongCommit) (string, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.notRolled = notRolled
+	results := make(map[string]bool, len(s.results))
+	for _, c := range notRolled {
+		if success, ok := s.results[c.Hash]; ok {
+			results[c.Hash] = success
+		}
+	}
+	s.results = results
+
+	if len(notRolled) == 0 {
+		return "", nil
+	}
+	head := notRolled[0].Hash
+	good, bad := s.bisect()
+	if bad == -1 {
+		// Nothing has failed; roll everything.
+		return head, nil
+	}
+	culprit := s.culprit()
+	if culprit == -1 {
+		// We're still searching. Don't roll anything until we've
+		// found the culprit.
+		return "", nil
+	}
+	if good != -1 {
+		// Roll everything before the culprit.
+		return notRolled[good].Hash, nil
+	}
+	// The culprit is the oldest not-yet-rolled commit, so there's nothing
+	// we can safely roll. Try rolling everything if new commits have
+	// landed since the last failure, in case the culprit was fixed.
+	if _, ok := s.results[head]; !ok {
+		return head, nil
+	}
+	return "", nil
+}
+
+// RollFinished records the result of a roll or dry run to the given revision.
+func (s *BisectStrategy) RollFinished(rev string, success bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.results[rev] = success
+}
+
+// BisectRev returns the revision at which the next dry run should be
+// performed, or the empty string if we aren't searching for a culprit.
+func (s *BisectStrategy) BisectRev() string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	good, bad := s.bisect()
+	if bad == -1 || s.culprit() != -1 {
+		return ""
+	}
+	if good == -1 {
+		good = len(s.notRolled)
+	}
+	return s.notRolled[bad+(good-bad)/2].Hash
+}
+
+// Culprit returns the commit which caused a roll to fail, or nil if it is not
+// known.
+func (s *BisectStrategy) Culprit() *vcsinfo.LongCommit {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if idx := s.culprit(); idx != -1 {
+		return s.notRolled[idx]
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package strategy
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/go/vcsinfo"
+)
+
+// makeCommits returns n not-yet-rolled commits, in reverse chronological
+// order, named "c<n>" through "c1".
+func makeCommits(n int) []*vcsinfo.LongCommit {
+	rv := make([]*vcsinfo.LongCommit, 0, n)
+	for i := n; i > 0; i-- {
+		rv = append(rv, &vcsinfo.LongCommit{
+			ShortCommit: &vcsinfo.ShortCommit{
+				Hash: fmt.Sprintf("c%d", i),
+			},
+		})
+	}
+	return rv
+}
+
+func TestBisectStrategy(t *testing.T) {
+	testutils.SmallTest(t)
+
+	ctx := context.Background()
+	s := StrategyBisect()
+	check := func(notRolled []*vcsinfo.LongCommit, expectNext, expectBisect, expectCulprit string) {
+		next, err := s.GetNextRollRev(ctx, notRolled)
+		assert.NoError(t, err)
+		assert.Equal(t, expectNext, next)
+		assert.Equal(t, expectBisect, s.BisectRev())
+		culprit := s.Culprit()
+		if expectCulprit == "" {
+			assert.Nil(t, culprit)
+		} else {
+			assert.NotNil(t, culprit)
+			assert.Equal(t, expectCulprit, culprit.Hash)
+		}
+	}
+
+	// Nothing to roll.
+	check(nil, "", "", "")
+
+	// Without failures, behave like the batch strategy.
+	commits := makeCommits(8)
+	check(commits, "c8", "", "")
+
+	// The batch fails. c6 is the culprit.
+	s.RollFinished("c8", false)
+	check(commits, "", "c4", "")
+	s.RollFinished("c4", true)
+	check(commits, "", "c6", "")
+	s.RollFinished("c6", false)
+	check(commits, "", "c5", "")
+	s.RollFinished("c5", true)
+	check(commits, "c5", "", "c6")
+
+	// New commits don't restart the search.
+	commits = makeCommits(10)
+	check(commits, "c5", "", "c6")
+
+	// Once everything before the culprit is rolled, try to roll everything
+	// in case the culprit was fixed, and try again whenever new commits
+	// land.
+	commits = commits[:5]
+	check(commits, "c10", "", "c6")
+	s.RollFinished("c10", false)
+	check(commits, "", "", "c6")
+	commits = append(makeCommits(11)[:1], commits...)
+	check(commits, "c11", "", "c6")
+
+	// The culprit is fixed and the roll lands.
+	s.RollFinished("c11", true)
+	check(nil, "", "", "")
+}
+
+func TestBisectStrategyOldestCommit(t *testing.T) {
+	testutils.SmallTest(t)
+
+	ctx := context.Background()
+	s := StrategyBisect()
+	commits := makeCommits(2)
+	_, err := s.GetNextRollRev(ctx, commits)
+	assert.NoError(t, err)
+	s.RollFinished("c2", false)
+	_, err = s.GetNextRollRev(ctx, commits)
+	assert.NoError(t, err)
+	assert.Equal(t, "c1", s.BisectRev())
+	s.RollFinished("c1", false)
+	next, err := s.GetNextRollRev(ctx, commits)
+	assert.NoError(t, err)
+	assert.Equal(t, "", next)
+	assert.Equal(t, "", s.BisectRev())
+	assert.Equal(t, "c1", s.Culprit().Hash)
+}
@@ -18,6 +18,7 @@ import (
 const (
 	ROLL_STRATEGY_AFDO         = "afdo"
 	ROLL_STRATEGY_BATCH        = "batch"
+	ROLL_STRATEGY_BISECT       = "bisect"
 	ROLL_STRATEGY_FUCHSIA_SDK  = "fuchsiaSDK"
 	ROLL_STRATEGY_LKGR         = "lkgr"
 	ROLL_STRATEGY_REMOTE_BATCH = "remote batch"
@@ -46,6 +47,8 @@ func GetNextRollStrategy(ctx context.Context, strategy, branch, lkgr, upstreamRe
 		}, nil
 	case ROLL_STRATEGY_BATCH:
 		return StrategyHead(branch), nil
+	case ROLL_STRATEGY_BISECT:
+		return StrategyBisect(), nil
 	case ROLL_STRATEGY_FUCHSIA_SDK:
 		return nil, nil // Handled by FuchsiaSDKRepoManager.
 	case ROLL_STRATEGY_LKGR:
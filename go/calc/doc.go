@@ -2,9 +2,13 @@
 //
 //   f(g(h("foo"), i(3, "bar")))
 //
-// Note that while it does understand strings and numbers, it doesn't
-// do binary operators. We can do those via functions if needed, ala
-// add(x, y), sub(x, y), etc.
+// It also understands the binary operators +, -, * and /, with the usual
+// precedence and parentheses for grouping, and rewrites them into calls to
+// the add(x, y), sub(x, y), mul(x, y) and div(x, y) functions, e.g.
+//
+//   (f("a") + f("b")) / 2
+//
+// is parsed as div(add(f("a"), f("b")), 2).
 //
 // Caveats:
 // * Only handles ASCII.
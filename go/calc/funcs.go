@@ -3,6 +3,7 @@ package calc
 import (
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
 
 	"go.skia.org/infra/go/vec32"
@@ -556,3 +557,420 @@ func (TraceStepFunc) Describe() string {
 }
 
 var traceStepFunc = TraceStepFunc{}
+
+// intArg parses the node as a positive integer argument for the named
+// function.
+func intArg(name string, node *Node) (int, error) {
+	if node.Typ != NodeNum {
+		return 0, fmt.Errorf("%s() takes a number as its second argument.", name)
+	}
+	n, err := strconv.Atoi(node.Val)
+	if err != nil {
+		return 0, fmt.Errorf("%s() not a valid integer %s : %s", name, node.Val, err)
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("%s() requires a positive integer, got %d", name, n)
+	}
+	return n, nil
+}
+
+// percentile returns the p-th percentile, p in [0, 100], of the sorted
+// values, linearly interpolating between the closest ranks.
+func percentile(sorted []float32, p float64) float32 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*float32(rank-float64(lo))
+}
+
+// nonMissing returns the values in the slice that aren't
+// vec32.MISSING_DATA_SENTINEL.
+func nonMissing(xs []float32) []float32 {
+	ret := make([]float32, 0, len(xs))
+	for _, v := range xs {
+		if v != vec32.MISSING_DATA_SENTINEL {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// windowFunc evaluates a function that takes a function and a window size
+// and applies fn to the trailing window of each point of each trace.
+//
+// vec32.MISSING_DATA_SENTINEL values are not passed to fn, and if a window
+// only contains vec32.MISSING_DATA_SENTINEL values then the result at that
+// point is vec32.MISSING_DATA_SENTINEL.
+func windowFunc(name string, ctx *Context, node *Node, fn func(window []float32) float32) (Rows, error) {
+	if len(node.Args) != 2 {
+		return nil, fmt.Errorf("%s() takes two arguments.", name)
+	}
+	if node.Args[0].Typ != NodeFunc {
+		return nil, fmt.Errorf("%s() takes a function as its first argument.", name)
+	}
+	n, err := intArg(name, node.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	rows, err := node.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s() failed evaluating argument: %s", name, err)
+	}
+
+	ret := Rows{}
+	for key, r := range rows {
+		row := make([]float32, len(r))
+		for i := range r {
+			begin := i - n + 1
+			if begin < 0 {
+				begin = 0
+			}
+			window := nonMissing(r[begin : i+1])
+			if len(window) == 0 {
+				row[i] = vec32.MISSING_DATA_SENTINEL
+			} else {
+				row[i] = fn(window)
+			}
+		}
+		ret[name+"("+key+")"] = row
+	}
+	return ret, nil
+}
+
+type MovingAvgFunc struct{}
+
+// movingAvgFunc implements Func and computes the average of the trailing
+// window of N points at each point of each trace.
+func (MovingAvgFunc) Eval(ctx *Context, node *Node) (Rows, error) {
+	return windowFunc("moving_avg", ctx, node, vec32.Mean)
+}
+
+func (MovingAvgFunc) Describe() string {
+	return `moving_avg(a, n) computes the moving average of each row over a window of the last n points.
+
+  Missing data points are not included in the average.`
+}
+
+var movingAvgFunc = MovingAvgFunc{}
+
+type MovingMedianFunc struct{}
+
+// movingMedianFunc implements Func and computes the median of the trailing
+// window of N points at each point of each trace.
+func (MovingMedianFunc) Eval(ctx *Context, node *Node) (Rows, error) {
+	return windowFunc("moving_median", ctx, node, func(window []float32) float32 {
+		sort.Slice(window, func(i, j int) bool { return window[i] < window[j] })
+		return percentile(window, 50)
+	})
+}
+
+func (MovingMedianFunc) Describe() string {
+	return `moving_median(a, n) computes the moving median of each row over a window of the last n points.
+
+  Missing data points are not included in the median.`
+}
+
+var movingMedianFunc = MovingMedianFunc{}
+
+type PercentileFunc struct{}
+
+// percentileFunc implements Func and merges the values of all argument rows
+// into a single trace where each point is the given percentile of the values
+// at that point.
+//
+// vec32.MISSING_DATA_SENTINEL values are not included. Note that if all the
+// values at an index are vec32.MISSING_DATA_SENTINEL then the result will be
+// vec32.MISSING_DATA_SENTINEL.
+func (PercentileFunc) Eval(ctx *Context, node *Node) (Rows, error) {
+	if len(node.Args) != 2 {
+		return nil, fmt.Errorf("percentile() takes two arguments.")
+	}
+	if node.Args[0].Typ != NodeFunc {
+		return nil, fmt.Errorf("percentile() takes a function as its first argument.")
+	}
+	if node.Args[1].Typ != NodeNum {
+		return nil, fmt.Errorf("percentile() takes a number as its second argument.")
+	}
+	p, err := strconv.ParseFloat(node.Args[1].Val, 64)
+	if err != nil {
+		return nil, fmt.Errorf("percentile() not a valid number %s : %s", node.Args[1].Val, err)
+	}
+	if p < 0 || p > 100 {
+		return nil, fmt.Errorf("percentile() must be in the range [0, 100], got %g", p)
+	}
+	rows, err := node.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("percentile() argument failed to evaluate: %s", err)
+	}
+
+	if len(rows) == 0 {
+		return rows, nil
+	}
+
+	ret := newRow(rows)
+	values := make([]float32, 0, len(rows))
+	for i := range ret {
+		values = values[:0]
+		for _, r := range rows {
+			if v := r[i]; v != vec32.MISSING_DATA_SENTINEL {
+				values = append(values, v)
+			}
+		}
+		if len(values) > 0 {
+			sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+			ret[i] = percentile(values, p)
+		}
+	}
+	return Rows{ctx.formula: ret}, nil
+}
+
+func (PercentileFunc) Describe() string {
+	return `percentile(a, p) folds all the rows into a single trace where each point is the p-th percentile, 0 to 100, of the values at that point.`
+}
+
+var percentileFunc = PercentileFunc{}
+
+type DiffFunc struct{}
+
+// diffFunc implements Func and computes the difference between each point and
+// the previous point of each trace.
+//
+// The first point, and any point where either value is
+// vec32.MISSING_DATA_SENTINEL, is set to vec32.MISSING_DATA_SENTINEL.
+func (DiffFunc) Eval(ctx *Context, node *Node) (Rows, error) {
+	if len(node.Args) != 1 {
+		return nil, fmt.Errorf("diff() takes a single argument.")
+	}
+	if node.Args[0].Typ != NodeFunc {
+		return nil, fmt.Errorf("diff() takes a function argument.")
+	}
+	rows, err := node.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("diff() failed evaluating argument: %s", err)
+	}
+
+	ret := Rows{}
+	for key, r := range rows {
+		row := make([]float32, len(r))
+		for i := range r {
+			if i == 0 || r[i] == vec32.MISSING_DATA_SENTINEL || r[i-1] == vec32.MISSING_DATA_SENTINEL {
+				row[i] = vec32.MISSING_DATA_SENTINEL
+				continue
+			}
+			row[i] = r[i] - r[i-1]
+		}
+		ret["diff("+key+")"] = row
+	}
+	return ret, nil
+}
+
+func (DiffFunc) Describe() string {
+	return `diff() computes the difference between each point and the previous point of each row.`
+}
+
+var diffFunc = DiffFunc{}
+
+// RankFunc implements Func and selects the N rows with the largest, or
+// smallest, mean value.
+//
+// vec32.MISSING_DATA_SENTINEL values are not included in the mean, and rows
+// with no values are never selected.
+type RankFunc struct {
+	name    string
+	largest bool
+}
+
+func (f RankFunc) Eval(ctx *Context, node *Node) (Rows, error) {
+	if len(node.Args) != 2 {
+		return nil, fmt.Errorf("%s() takes two arguments.", f.name)
+	}
+	if node.Args[0].Typ != NodeFunc {
+		return nil, fmt.Errorf("%s() takes a function as its first argument.", f.name)
+	}
+	n, err := intArg(f.name, node.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	rows, err := node.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s() failed evaluating argument: %s", f.name, err)
+	}
+
+	type ranked struct {
+		key  string
+		mean float32
+	}
+	all := make([]ranked, 0, len(rows))
+	for key, r := range rows {
+		if mean := vec32.MeanMissing(r); mean != vec32.MISSING_DATA_SENTINEL {
+			all = append(all, ranked{key: key, mean: mean})
+		}
+	}
+	// Break ties by key so the selection is stable.
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].mean == all[j].mean {
+			return all[i].key < all[j].key
+		}
+		if f.largest {
+			return all[i].mean > all[j].mean
+		}
+		return all[i].mean < all[j].mean
+	})
+	if len(all) > n {
+		all = all[:n]
+	}
+	ret := Rows{}
+	for _, r := range all {
+		ret[r.key] = rows[r.key]
+	}
+	return ret, nil
+}
+
+func (f RankFunc) Describe() string {
+	if f.largest {
+		return `top_n(a, n) selects the n rows with the largest mean value.`
+	}
+	return `bottom_n(a, n) selects the n rows with the smallest mean value.`
+}
+
+var topNFunc = RankFunc{name: "top_n", largest: true}
+var bottomNFunc = RankFunc{name: "bottom_n", largest: false}
+
+// BinaryFunc implements Func for the binary arithmetic operators +, -, * and
+// /, which the parser rewrites into calls to add(), sub(), mul() and div().
+//
+// Each argument is either a function or a number. If one side is a number,
+// or a function that returns a single row, then it is applied to every row
+// on the other side. Otherwise rows are matched up by key, and rows that
+// appear on only one side are dropped.
+//
+// If either value is vec32.MISSING_DATA_SENTINEL, or the result isn't a finite
+// number, e.g. division by zero, then the result is
+// vec32.MISSING_DATA_SENTINEL.
+type BinaryFunc struct {
+	name     string
+	operator string
+	verb     string
+	op       func(a, b float32) float32
+}
+
+// operand evaluates a single argument to a BinaryFunc, returning either rows,
+// or if the argument is a number then a row with that number at every point.
+func (f BinaryFunc) operand(ctx *Context, node *Node) (Rows, bool, float32, error) {
+	switch node.Typ {
+	case NodeFunc:
+		rows, err := node.Eval(ctx)
+		if err != nil {
+			return nil, false, 0, fmt.Errorf("%s() argument failed to evaluate: %s", f.name, err)
+		}
+		return rows, false, 0, nil
+	case NodeNum:
+		v, err := strconv.ParseFloat(node.Val, 32)
+		if err != nil {
+			return nil, false, 0, fmt.Errorf("%s() not a valid number %s : %s", f.name, node.Val, err)
+		}
+		return nil, true, float32(v), nil
+	default:
+		return nil, false, 0, fmt.Errorf("%s() takes functions or numbers as arguments.", f.name)
+	}
+}
+
+// apply returns op applied point by point to a and b.
+func (f BinaryFunc) apply(a, b []float32) []float32 {
+	ret := make([]float32, len(a))
+	for i := range a {
+		if a[i] == vec32.MISSING_DATA_SENTINEL || b[i] == vec32.MISSING_DATA_SENTINEL {
+			ret[i] = vec32.MISSING_DATA_SENTINEL
+			continue
+		}
+		v := f.op(a[i], b[i])
+		if math.IsInf(float64(v), 0) || math.IsNaN(float64(v)) {
+			v = vec32.MISSING_DATA_SENTINEL
+		}
+		ret[i] = v
+	}
+	return ret
+}
+
+// constRow returns a row of length n with every value set to v.
+func constRow(n int, v float32) []float32 {
+	ret := make([]float32, n)
+	for i := range ret {
+		ret[i] = v
+	}
+	return ret
+}
+
+func (f BinaryFunc) Eval(ctx *Context, node *Node) (Rows, error) {
+	if len(node.Args) != 2 {
+		return nil, fmt.Errorf("%s() takes two arguments.", f.name)
+	}
+	lhs, lhsIsNum, lhsNum, err := f.operand(ctx, node.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	rhs, rhsIsNum, rhsNum, err := f.operand(ctx, node.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	if lhsIsNum && rhsIsNum {
+		return nil, fmt.Errorf("%s() needs at least one function argument.", f.name)
+	}
+
+	ret := Rows{}
+	switch {
+	case rhsIsNum:
+		for key, r := range lhs {
+			ret[f.name+"("+key+")"] = f.apply(r, constRow(len(r), rhsNum))
+		}
+	case lhsIsNum:
+		for key, r := range rhs {
+			ret[f.name+"("+key+")"] = f.apply(constRow(len(r), lhsNum), r)
+		}
+	case len(rhs) == 1:
+		for _, b := range rhs {
+			for key, a := range lhs {
+				if len(a) != len(b) {
+					return nil, fmt.Errorf("%s() rows have different lengths.", f.name)
+				}
+				ret[f.name+"("+key+")"] = f.apply(a, b)
+			}
+		}
+	case len(lhs) == 1:
+		for _, a := range lhs {
+			for key, b := range rhs {
+				if len(a) != len(b) {
+					return nil, fmt.Errorf("%s() rows have different lengths.", f.name)
+				}
+				ret[f.name+"("+key+")"] = f.apply(a, b)
+			}
+		}
+	default:
+		for key, a := range lhs {
+			b, ok := rhs[key]
+			if !ok {
+				continue
+			}
+			if len(a) != len(b) {
+				return nil, fmt.Errorf("%s() rows have different lengths.", f.name)
+			}
+			ret[f.name+"("+key+")"] = f.apply(a, b)
+		}
+	}
+	return ret, nil
+}
+
+func (f BinaryFunc) Describe() string {
+	return fmt.Sprintf(`%s(a, b), or a %s b, %s the rows of a and b point by point.
+
+  Either a or b can be a number. If one side has a single row it is applied to
+  every row on the other side, otherwise rows are matched by key.`, f.name, f.operator, f.verb)
+}
+
+var addFunc = BinaryFunc{name: "add", operator: "+", verb: "adds", op: func(a, b float32) float32 { return a + b }}
+var subFunc = BinaryFunc{name: "sub", operator: "-", verb: "subtracts", op: func(a, b float32) float32 { return a - b }}
+var mulFunc = BinaryFunc{name: "mul", operator: "*", verb: "multiplies", op: func(a, b float32) float32 { return a * b }}
+var divFunc = BinaryFunc{name: "div", operator: "/", verb: "divides", op: func(a, b float32) float32 { return a / b }}
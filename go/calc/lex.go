@@ -16,6 +16,7 @@ const (
 	itemLParen
 	itemRParen
 	itemComma
+	itemOperator
 	itemEOF
 )
 
@@ -35,9 +36,11 @@ type lexer struct {
 	input      string    // The string being parsed.
 	start      int       // The offset of the current lexical item.
 	pos        int       // Current position in input.
+	width      int       // Width of the last char read by next(), 0 at eof.
 	items      chan item // Channel by which items are delivered.
 	state      stateFn   // The next lexing function.
 	peekBuffer []item    // A peekBuffer for peek'd items.
+	lastTyp    itemType  // The type of the last item emitted.
 }
 
 // nextItem returns the next item from the input.
@@ -54,6 +57,9 @@ func (l *lexer) nextItem() item {
 // peekItem allows the caller to look ahead and see the next item that
 // nextItem() will return.
 func (l *lexer) peekItem() item {
+	if len(l.peekBuffer) > 0 {
+		return l.peekBuffer[0]
+	}
 	item := <-l.items
 	l.peekBuffer = append(l.peekBuffer, item)
 	return item
@@ -104,16 +110,18 @@ func newLexer(input string) *lexer {
 // next returns the next char in the input.
 func (l *lexer) next() byte {
 	if int(l.pos) >= len(l.input) {
+		l.width = 0
 		return eof
 	}
 	ch := l.input[l.pos]
+	l.width = 1
 	l.pos += 1
 	return ch
 }
 
 // backUp steps back one rune. Can only be called once per call of next.
 func (l *lexer) backUp() {
-	l.pos -= 1
+	l.pos -= l.width
 }
 
 // run runs the state machine for the lexer.
@@ -128,9 +136,16 @@ func (l *lexer) emit(t itemType) {
 		typ: t,
 		val: l.input[l.start:l.pos],
 	}
+	l.lastTyp = t
 	l.start = l.pos
 }
 
+// afterOperand returns true if the last item emitted could be the left hand
+// side of a binary operator, which is how we tell "1 -2" apart from "f(-2)".
+func (l *lexer) afterOperand() bool {
+	return l.lastTyp == itemNum || l.lastTyp == itemRParen
+}
+
 // lexExp parses the input expression.
 func lexExp(l *lexer) stateFn {
 	switch r := l.next(); {
@@ -153,6 +168,12 @@ func lexExp(l *lexer) stateFn {
 	case unicode.IsSpace(rune(r)):
 		l.ignore()
 		return lexExp
+	case r == '*' || r == '/':
+		l.emit(itemOperator)
+		return lexExp
+	case (r == '+' || r == '-') && l.afterOperand():
+		l.emit(itemOperator)
+		return lexExp
 	case r == '+' || r == '-' || ('0' <= r && r <= '9'):
 		l.backUp()
 		return lexNumber
@@ -62,6 +62,29 @@ func TestLex(t *testing.T) {
 				{itemEOF, ""},
 			},
 		},
+		{
+			input: "(a(1) -2)*b(-3) / 4+5",
+			items: []item{
+				{itemLParen, "("},
+				{itemIdentifier, "a"},
+				{itemLParen, "("},
+				{itemNum, "1"},
+				{itemRParen, ")"},
+				{itemOperator, "-"},
+				{itemNum, "2"},
+				{itemRParen, ")"},
+				{itemOperator, "*"},
+				{itemIdentifier, "b"},
+				{itemLParen, "("},
+				{itemNum, "-3"},
+				{itemRParen, ")"},
+				{itemOperator, "/"},
+				{itemNum, "4"},
+				{itemOperator, "+"},
+				{itemNum, "5"},
+				{itemEOF, ""},
+			},
+		},
 	}
 	for _, tc := range testCases {
 		l := newLexer(tc.input)
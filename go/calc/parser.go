@@ -2,6 +2,7 @@ package calc
 
 import (
 	"fmt"
+	"strings"
 
 	"go.skia.org/infra/go/vec32"
 )
@@ -90,22 +91,32 @@ func NewContext(rowsFromQuery RowsFromQuery, rowsFromShortcut RowsFromShortcut)
 		RowsFromQuery:    rowsFromQuery,
 		RowsFromShortcut: rowsFromShortcut,
 		Funcs: map[string]Func{
-			"filter":       filterFunc,
-			"shortcut":     shortcutFunc,
-			"norm":         normFunc,
-			"fill":         fillFunc,
-			"ave":          aveFunc,
-			"avg":          aveFunc,
-			"count":        countFunc,
-			"ratio":        ratioFunc,
-			"sum":          sumFunc,
-			"geo":          geoFunc,
-			"log":          logFunc,
-			"trace_ave":    traceAveFunc,
-			"trace_avg":    traceAveFunc,
-			"trace_stddev": traceStdDevFunc,
-			"trace_cov":    traceCovFunc,
-			"step":         traceStepFunc,
+			"filter":        filterFunc,
+			"shortcut":      shortcutFunc,
+			"norm":          normFunc,
+			"fill":          fillFunc,
+			"ave":           aveFunc,
+			"avg":           aveFunc,
+			"count":         countFunc,
+			"ratio":         ratioFunc,
+			"sum":           sumFunc,
+			"geo":           geoFunc,
+			"log":           logFunc,
+			"trace_ave":     traceAveFunc,
+			"trace_avg":     traceAveFunc,
+			"trace_stddev":  traceStdDevFunc,
+			"trace_cov":     traceCovFunc,
+			"step":          traceStepFunc,
+			"moving_avg":    movingAvgFunc,
+			"moving_median": movingMedianFunc,
+			"percentile":    percentileFunc,
+			"diff":          diffFunc,
+			"top_n":         topNFunc,
+			"bottom_n":      bottomNFunc,
+			"add":           addFunc,
+			"sub":           subFunc,
+			"mul":           mulFunc,
+			"div":           divFunc,
 		},
 	}
 }
@@ -124,7 +135,49 @@ func (ctx *Context) Eval(exp string) (Rows, error) {
 // parse starts the parsing.
 func parse(input string) (*Node, error) {
 	l := newLexer(input)
-	return parseExp(l)
+	n, err := parseExp(l)
+	if err != nil {
+		return nil, err
+	}
+	if n.Typ != NodeFunc {
+		return nil, fmt.Errorf("Expression: must be a function or arithmetic on functions.")
+	}
+	if it := l.nextItem(); it.typ != itemEOF {
+		return nil, fmt.Errorf("Expression: unexpected input after the expression: %q", it.val)
+	}
+	return n, nil
+}
+
+// operatorFuncs maps binary operators to the names of the Funcs that
+// implement them.
+var operatorFuncs = map[string]string{
+	"+": "add",
+	"-": "sub",
+	"*": "mul",
+	"/": "div",
+}
+
+// parseBinary parses a left associative run of binary operators drawn from
+// ops, where each operand is parsed by operand.
+func parseBinary(l *lexer, ops string, operand func(*lexer) (*Node, error)) (*Node, error) {
+	n, err := operand(l)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		it := l.peekItem()
+		if it.typ != itemOperator || !strings.Contains(ops, it.val) {
+			return n, nil
+		}
+		l.nextItem()
+		rhs, err := operand(l)
+		if err != nil {
+			return nil, fmt.Errorf("Expression: failed parsing right hand side of %q: %s", it.val, err)
+		}
+		op := newNode(operatorFuncs[it.val], NodeFunc)
+		op.Args = []*Node{n, rhs}
+		n = op
+	}
 }
 
 // parseExp parses an expression.
@@ -133,11 +186,48 @@ func parse(input string) (*Node, error) {
 //
 //    fn(arg1, args2)
 //
+// or arithmetic on functions and numbers, such as:
+//
+//    (fn(arg1) + fn(arg2)) / 2
+//
+// The usual precedence applies, i.e. '*' and '/' bind tighter than '+' and
+// '-', and each operator is rewritten into a call to its Func, so the above
+// becomes div(add(fn(arg1), fn(arg2)), 2).
 func parseExp(l *lexer) (*Node, error) {
+	return parseBinary(l, "+-", parseTerm)
+}
+
+// parseTerm parses a run of '*' and '/' operators.
+func parseTerm(l *lexer) (*Node, error) {
+	return parseBinary(l, "*/", parseFactor)
+}
+
+// parseFactor parses a single operand of a binary operator, which is either
+// a function call, a number, or a parenthesized expression.
+func parseFactor(l *lexer) (*Node, error) {
 	it := l.nextItem()
-	if it.typ != itemIdentifier {
+	switch it.typ {
+	case itemIdentifier:
+		return parseFunc(l, it)
+	case itemNum:
+		return newNode(it.val, NodeNum), nil
+	case itemLParen:
+		n, err := parseExp(l)
+		if err != nil {
+			return nil, err
+		}
+		if it := l.nextItem(); it.typ != itemRParen {
+			return nil, fmt.Errorf("Expression: didn't find ')' after a parenthesized expression.")
+		}
+		return n, nil
+	default:
 		return nil, fmt.Errorf("Expression: must begin with an identifier")
 	}
+}
+
+// parseFunc parses a function call, where it is the already consumed
+// identifier.
+func parseFunc(l *lexer, it item) (*Node, error) {
 	n := newNode(it.val, NodeFunc)
 	it = l.nextItem()
 	if it.typ != itemLParen {
@@ -165,7 +255,7 @@ Loop:
 	for {
 		it := l.peekItem()
 		switch it.typ {
-		case itemIdentifier:
+		case itemIdentifier, itemNum, itemLParen:
 			next, err := parseExp(l)
 			if err != nil {
 				return fmt.Errorf("Failed parsing args: %s", err)
@@ -175,10 +265,6 @@ Loop:
 			l.nextItem()
 			node := newNode(it.val, NodeString)
 			p.Args = append(p.Args, node)
-		case itemNum:
-			l.nextItem()
-			node := newNode(it.val, NodeNum)
-			p.Args = append(p.Args, node)
 		case itemComma:
 			l.nextItem()
 			continue
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -344,3 +345,190 @@ func TestLog(t *testing.T) {
 		}
 	}
 }
+
+func TestParseOperators(t *testing.T) {
+	testutils.SmallTest(t)
+
+	testCases := []struct {
+		input string
+		want  string
+	}{
+		{`f()`, `f()`},
+		{`f() + g()`, `add(f(), g())`},
+		{`f() - g() - h()`, `sub(sub(f(), g()), h())`},
+		{`f() + g() * h()`, `add(f(), mul(g(), h()))`},
+		{`(f() + g()) / 2`, `div(add(f(), g()), 2)`},
+		{`2*f()-1`, `sub(mul(2, f()), 1)`},
+		{`ratio(f() + 1, g())`, `ratio(add(f(), 1), g())`},
+		{`f(-1)`, `f(-1)`},
+	}
+	var format func(n *Node) string
+	format = func(n *Node) string {
+		if n.Typ != NodeFunc {
+			return n.Val
+		}
+		args := []string{}
+		for _, a := range n.Args {
+			args = append(args, format(a))
+		}
+		return n.Val + "(" + strings.Join(args, ", ") + ")"
+	}
+	for _, tc := range testCases {
+		n, err := parse(tc.input)
+		assert.NoError(t, err, tc.input)
+		assert.Equal(t, tc.want, format(n), tc.input)
+	}
+
+	for _, tc := range []string{`2`, `f() +`, `(f()`, `f() g()`, `* f()`} {
+		_, err := parse(tc)
+		assert.Error(t, err, tc)
+	}
+}
+
+func TestBinaryOperators(t *testing.T) {
+	testutils.SmallTest(t)
+	ctx := newTestContext(Rows{
+		",name=t1,": []float32{1, 2, e, 4},
+		",name=t2,": []float32{2, 0, 1, 8},
+	}, nil)
+
+	rows, err := ctx.Eval(`filter("name=t1") + filter("name=t2")`)
+	assert.NoError(t, err)
+	assert.Equal(t, Rows{"add(,name=t1,)": []float32{3, 2, e, 12}}, rows)
+
+	rows, err = ctx.Eval(`filter("name=t1") / filter("name=t2")`)
+	assert.NoError(t, err)
+	assert.Equal(t, Rows{"div(,name=t1,)": []float32{0.5, e, e, 0.5}}, rows)
+
+	rows, err = ctx.Eval(`10 - filter("")*2`)
+	assert.NoError(t, err)
+	assert.Equal(t, Rows{
+		"sub(mul(,name=t1,))": []float32{8, 6, e, 2},
+		"sub(mul(,name=t2,))": []float32{6, 10, 8, -6},
+	}, rows)
+
+	// A single row is applied to every row on the other side.
+	rows, err = ctx.Eval(`filter("") - ave(filter(""))`)
+	assert.NoError(t, err)
+	assert.Equal(t, Rows{
+		"sub(,name=t1,)": []float32{-0.5, 1, e, -2},
+		"sub(,name=t2,)": []float32{0.5, -1, 0, 2},
+	}, rows)
+
+	// Otherwise rows are matched by key.
+	rows, err = ctx.Eval(`filter("") * filter("")`)
+	assert.NoError(t, err)
+	assert.Equal(t, Rows{
+		"mul(,name=t1,)": []float32{1, 4, e, 16},
+		"mul(,name=t2,)": []float32{4, 0, 1, 64},
+	}, rows)
+
+	_, err = ctx.Eval(`add(1, 2)`)
+	assert.Error(t, err)
+	_, err = ctx.Eval(`add(filter(""))`)
+	assert.Error(t, err)
+}
+
+func TestMovingAvgAndMedian(t *testing.T) {
+	testutils.SmallTest(t)
+	ctx := newTestContext(Rows{
+		",name=t1,": []float32{1, 5, e, 3, 10, e, e},
+	}, nil)
+
+	rows, err := ctx.Eval(`moving_avg(filter(""), 2)`)
+	assert.NoError(t, err)
+	assert.Equal(t, Rows{"moving_avg(,name=t1,)": []float32{1, 3, 5, 3, 6.5, 10, e}}, rows)
+
+	rows, err = ctx.Eval(`moving_median(filter(""), 3)`)
+	assert.NoError(t, err)
+	assert.Equal(t, Rows{"moving_median(,name=t1,)": []float32{1, 3, 3, 4, 6.5, 6.5, 10}}, rows)
+
+	for _, tc := range []string{
+		`moving_avg(filter(""))`,
+		`moving_avg(filter(""), 0)`,
+		`moving_avg(filter(""), 1.5)`,
+		`moving_median("foo", 2)`,
+	} {
+		_, err := ctx.Eval(tc)
+		assert.Error(t, err, tc)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	testutils.SmallTest(t)
+	ctx := newTestContext(Rows{
+		",name=t1,": []float32{1, 1, e},
+		",name=t2,": []float32{2, e, e},
+		",name=t3,": []float32{3, e, e},
+		",name=t4,": []float32{4, e, e},
+		",name=t5,": []float32{5, e, e},
+	}, nil)
+
+	testCases := []struct {
+		formula string
+		want    []float32
+	}{
+		{`percentile(filter(""), 50)`, []float32{3, 1, e}},
+		{`percentile(filter(""), 0)`, []float32{1, 1, e}},
+		{`percentile(filter(""), 100)`, []float32{5, 1, e}},
+		{`percentile(filter(""), 90)`, []float32{4.6, 1, e}},
+	}
+	for _, tc := range testCases {
+		rows, err := ctx.Eval(tc.formula)
+		assert.NoError(t, err)
+		for i, want := range tc.want {
+			if got := rows[tc.formula][i]; !near(got, want) {
+				t.Errorf("%s mismatch at %d: Got %v Want %v", tc.formula, i, got, want)
+			}
+		}
+	}
+
+	_, err := ctx.Eval(`percentile(filter(""), 101)`)
+	assert.Error(t, err)
+}
+
+func TestDiff(t *testing.T) {
+	testutils.SmallTest(t)
+	ctx := newTestContext(Rows{
+		",name=t1,": []float32{1, 3, e, 4, 2},
+	}, nil)
+
+	rows, err := ctx.Eval(`diff(filter(""))`)
+	assert.NoError(t, err)
+	assert.Equal(t, Rows{"diff(,name=t1,)": []float32{e, 2, e, e, -2}}, rows)
+}
+
+func TestTopAndBottomN(t *testing.T) {
+	testutils.SmallTest(t)
+	ctx := newTestContext(Rows{
+		",name=t1,": []float32{1, 1},
+		",name=t2,": []float32{5, e},
+		",name=t3,": []float32{3, 3},
+		",name=t4,": []float32{e, e},
+	}, nil)
+
+	rows, err := ctx.Eval(`top_n(filter(""), 2)`)
+	assert.NoError(t, err)
+	assert.Equal(t, Rows{
+		",name=t2,": []float32{5, e},
+		",name=t3,": []float32{3, 3},
+	}, rows)
+
+	rows, err = ctx.Eval(`bottom_n(filter(""), 1)`)
+	assert.NoError(t, err)
+	assert.Equal(t, Rows{",name=t1,": []float32{1, 1}}, rows)
+
+	// Asking for more rows than exist returns all rows with data.
+	rows, err = ctx.Eval(`bottom_n(filter(""), 10)`)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 3)
+}
+
+func TestDescribe(t *testing.T) {
+	testutils.SmallTest(t)
+	ctx := NewContext(nil, nil)
+	for name, f := range ctx.Funcs {
+		assert.NotEmpty(t, f.Describe(), name)
+	}
+	assert.Contains(t, ctx.Funcs["div"].Describe(), "a / b")
+}
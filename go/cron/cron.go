@@ -0,0 +1,235 @@
+// Package cron parses cron expressions and computes when they fire.
+//
+// An expression has five space-separated fields:
+//
+//	minute        0-59
+//	hour          0-23
+//	day of month  1-31
+//	month         1-12 or jan-dec
+//	day of week   0-7 or sun-sat, where both 0 and 7 are Sunday
+//
+// Each field is a comma-separated list of "*", a single value "5", a range
+// "1-5", optionally followed by a step "*/4" or "0-30/10". For example,
+// "0 */4 * * *" fires every four hours and "0 9 * * mon-fri" fires at 09:00
+// on weekdays.
+//
+// As in most crons, if both the day of month and the day of week are
+// restricted, i.e. neither is "*", then a day matches if either field
+// matches.
+//
+// The shorthands "@hourly", "@daily", "@weekly", "@monthly" and "@yearly"
+// are also accepted.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MAX_SEARCH is how far ahead Next looks for a matching time before
+	// giving up, which can only happen for expressions such as "0 0 31 2 *"
+	// that never fire.
+	MAX_SEARCH = 5 * 366 * 24 * time.Hour
+)
+
+var (
+	shorthands = map[string]string{
+		"@hourly":  "0 * * * *",
+		"@daily":   "0 0 * * *",
+		"@weekly":  "0 0 * * 0",
+		"@monthly": "0 0 1 * *",
+		"@yearly":  "0 0 1 1 *",
+	}
+
+	monthNames = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	dayNames   = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// field describes one of the fields of a cron expression.
+type field struct {
+	name  string
+	min   int
+	max   int
+	names []string // Names for values, starting at min.
+}
+
+var fields = []field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: monthNames},
+	{name: "day of week", min: 0, max: 7, names: dayNames},
+}
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	expr   string
+	minute map[int]bool
+	hour   map[int]bool
+	dom    map[int]bool
+	month  map[int]bool
+	dow    map[int]bool
+	anyDom bool // True if the day of month field is "*".
+	anyDow bool // True if the day of week field is "*".
+	loc    *time.Location
+}
+
+// Parse parses the given cron expression. Times are evaluated in UTC, use
+// In to change that.
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	full := expr
+	if s, ok := shorthands[strings.ToLower(expr)]; ok {
+		full = s
+	}
+	parts := strings.Fields(full)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("Invalid cron expression %q: expected %d fields but got %d", expr, len(fields), len(parts))
+	}
+	sets := make([]map[int]bool, len(fields))
+	for i, f := range fields {
+		set, err := f.parse(parts[i])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid cron expression %q: %s", expr, err)
+		}
+		sets[i] = set
+	}
+	// Sunday can be written as 0 or 7.
+	if sets[4][7] {
+		sets[4][0] = true
+		delete(sets[4], 7)
+	}
+	return &Schedule{
+		expr:   expr,
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		anyDom: parts[2] == "*",
+		anyDow: parts[4] == "*",
+		loc:    time.UTC,
+	}, nil
+}
+
+// parseValue parses a single value of the field, which may be a number or a
+// name.
+func (f field) parseValue(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", f.name, s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s %d out of range [%d, %d]", f.name, v, f.min, f.max)
+	}
+	return v, nil
+}
+
+// parse parses the field into the set of values it matches.
+func (f field) parse(s string) (map[int]bool, error) {
+	ret := map[int]bool{}
+	for _, item := range strings.Split(s, ",") {
+		rng := item
+		step := 1
+		if idx := strings.Index(item, "/"); idx != -1 {
+			rng = item[:idx]
+			var err error
+			step, err = strconv.Atoi(item[idx+1:])
+			if err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step in %s %q", f.name, item)
+			}
+		}
+		var lo, hi int
+		if rng == "*" {
+			lo, hi = f.min, f.max
+		} else if idx := strings.Index(rng, "-"); idx != -1 {
+			var err error
+			if lo, err = f.parseValue(rng[:idx]); err != nil {
+				return nil, err
+			}
+			if hi, err = f.parseValue(rng[idx+1:]); err != nil {
+				return nil, err
+			}
+			if hi < lo {
+				return nil, fmt.Errorf("invalid %s range %q", f.name, rng)
+			}
+		} else {
+			var err error
+			if lo, err = f.parseValue(rng); err != nil {
+				return nil, err
+			}
+			hi = lo
+			// "5/10" means starting at 5, every 10.
+			if step != 1 {
+				hi = f.max
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			ret[v] = true
+		}
+	}
+	return ret, nil
+}
+
+// In returns a copy of the Schedule which is evaluated in the given location.
+func (s *Schedule) In(loc *time.Location) *Schedule {
+	ret := *s
+	ret.loc = loc
+	return &ret
+}
+
+// String returns the expression the Schedule was parsed from.
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+// matchesDay returns true if the Schedule fires on the day of t.
+func (s *Schedule) matchesDay(t time.Time) bool {
+	dom := s.dom[t.Day()]
+	dow := s.dow[int(t.Weekday())]
+	if s.anyDom || s.anyDow {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Matches returns true if the Schedule fires during the minute of t.
+func (s *Schedule) Matches(t time.Time) bool {
+	t = t.In(s.loc)
+	return s.minute[t.Minute()] && s.hour[t.Hour()] && s.month[int(t.Month())] && s.matchesDay(t)
+}
+
+// Next returns the first time strictly after t at which the Schedule fires,
+// or the zero time if it never fires.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.In(s.loc).Truncate(time.Minute).Add(time.Minute)
+	end := t.Add(MAX_SEARCH)
+	for t.Before(end) {
+		if !s.month[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.loc)
+			continue
+		}
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.loc)
+			continue
+		}
+		if !s.hour[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.loc)
+			continue
+		}
+		if !s.minute[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,97 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+
+	"go.skia.org/infra/go/testutils"
+)
+
+func TestParseErrors(t *testing.T) {
+	testutils.SmallTest(t)
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"* * * foo *",
+		"@never",
+	} {
+		_, err := Parse(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestNext(t *testing.T) {
+	testutils.SmallTest(t)
+	// Wednesday.
+	now := time.Date(2018, time.January, 3, 10, 17, 30, 0, time.UTC)
+	testCases := []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2018, time.January, 3, 10, 18, 0, 0, time.UTC)},
+		{"0 */4 * * *", time.Date(2018, time.January, 3, 12, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2018, time.January, 4, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2018, time.January, 4, 9, 0, 0, 0, time.UTC)},
+		{"30 2 * * sat,sun", time.Date(2018, time.January, 6, 2, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2018, time.January, 7, 0, 0, 0, 0, time.UTC)},
+		{"15,45 * * * *", time.Date(2018, time.January, 3, 10, 45, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2018, time.January, 3, 10, 25, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2018, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 jun *", time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)},
+		// Day of month OR day of week: the 15th or the next Friday.
+		{"0 0 15 * fri", time.Date(2018, time.January, 5, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2018, time.January, 3, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2018, time.January, 4, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2018, time.January, 7, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, tc := range testCases {
+		s, err := Parse(tc.expr)
+		assert.NoError(t, err, tc.expr)
+		assert.Equal(t, tc.expr, s.String())
+		next := s.Next(now)
+		assert.True(t, tc.next.Equal(next), "%s: expected %s but got %s", tc.expr, tc.next, next)
+		if !next.IsZero() {
+			assert.True(t, s.Matches(next), tc.expr)
+		}
+	}
+
+	// Next is strictly after the given time.
+	s, err := Parse("0 9 * * *")
+	assert.NoError(t, err)
+	nine := time.Date(2018, time.January, 3, 9, 0, 0, 0, time.UTC)
+	assert.True(t, s.Next(nine).Equal(nine.Add(24*time.Hour)))
+	assert.True(t, s.Next(nine.Add(-time.Second)).Equal(nine))
+}
+
+func TestIn(t *testing.T) {
+	testutils.SmallTest(t)
+	loc := time.FixedZone("UTC+5:30", 5*60*60+30*60)
+	s, err := Parse("0 9 * * *")
+	assert.NoError(t, err)
+	s = s.In(loc)
+	now := time.Date(2018, time.January, 3, 0, 0, 0, 0, time.UTC)
+	next := s.Next(now)
+	assert.True(t, time.Date(2018, time.January, 3, 3, 30, 0, 0, time.UTC).Equal(next), next.String())
+	assert.True(t, s.Matches(next))
+
+	s, err = Parse("0 */4 * * *")
+	assert.NoError(t, err)
+	next = s.In(loc).Next(now)
+	// 00:00 UTC is 05:30 local time.
+	assert.True(t, time.Date(2018, time.January, 3, 8, 0, 0, 0, loc).Equal(next), next.String())
+}
@@ -43,6 +43,7 @@ const (
 	TRYJOB_TEST_DIGEST_EXP Kind = "TryjobTestDigestExp"
 	MASTER_EXP_CHANGE      Kind = "MasterExpChange"
 	IGNORE_RULE            Kind = "IgnoreRule"
+	IGNORE_RULE_ARCHIVE    Kind = "IgnoreRuleArchive"
 	HELPER_RECENT_KEYS     Kind = "HelperRecentKeys"
 	EXPECTATIONS_BLOB      Kind = "ExpectationsBlob"
 	EXPECTATIONS_BLOB_ROOT Kind = "ExpectationsBlobRoot"
@@ -93,7 +94,7 @@ var (
 		PERF_NS:                []Kind{ACTIVITY, ALERT, REGRESSION, SHORTCUT},
 		PERF_ANDROID_NS:        []Kind{ACTIVITY, ALERT, REGRESSION, SHORTCUT},
 		PERF_ANDROID_MASTER_NS: []Kind{ACTIVITY, ALERT, REGRESSION, SHORTCUT},
-		GOLD_SKIA_PROD_NS:      []Kind{ISSUE, TRYJOB, TRYJOB_RESULT, TRYJOB_EXP_CHANGE, TEST_DIGEST_EXP, TRYJOB_TEST_DIGEST_EXP, MASTER_EXP_CHANGE, IGNORE_RULE, HELPER_RECENT_KEYS, EXPECTATIONS_BLOB, EXPECTATIONS_BLOB_ROOT},
+		GOLD_SKIA_PROD_NS:      []Kind{ISSUE, TRYJOB, TRYJOB_RESULT, TRYJOB_EXP_CHANGE, TEST_DIGEST_EXP, TRYJOB_TEST_DIGEST_EXP, MASTER_EXP_CHANGE, IGNORE_RULE, IGNORE_RULE_ARCHIVE, HELPER_RECENT_KEYS, EXPECTATIONS_BLOB, EXPECTATIONS_BLOB_ROOT},
 		ANDROID_COMPILE_NS:     []Kind{COMPILE_TASK},
 		LEASING_SERVER_NS:      []Kind{TASK},
 		CT_NS:                  []Kind{CAPTURE_SKPS_TASKS, CHROMIUM_ANALYSIS_TASKS, CHROMIUM_BUILD_TASKS, CHROMIUM_PERF_TASKS, LUA_SCRIPT_TASKS, METRICS_ANALYSIS_TASKS, PIXEL_DIFF_TASKS, RECREATE_PAGESETS_TASKS, RECREATE_WEBPAGE_ARCHIVES_TASKS, CLUSTER_TELEMETRY_IDS},
@@ -1,19 +1,52 @@
+// Package gevent implements a distributed eventbus.EventBus on top of a
+// pluggable Transport.
+//
+// Events published with globally=true are encoded with the codec registered
+// for their channel via RegisterCodec, wrapped in a Message and sent via the
+// Transport to every other node. Events published locally, or received from
+// the Transport, are dispatched to subscribers via an in-process
+// eventbus.EventBus.
+//
+// The following Transports are available:
+//
+//   - Cloud Pub/Sub, see New and NewPubSubTransport.
+//   - An in-process loopback, for testing, see NewLoopback.
+//   - A persistent log on disk, which lets nodes resume from their last
+//     acknowledged message after a restart, see NewLogTransport.
+//
+// See Transport for the delivery guarantees. Note that they only apply once a
+// Message has been handed to the Transport: Publish queues globally published
+// events and sends them in the background, retrying until the Transport
+// accepts them or the event bus is closed. Events still queued when the event
+// bus is closed are lost.
 package gevent
 
 import (
-	"context"
 	"fmt"
 	"os"
 	"sync"
-
-	"cloud.google.com/go/pubsub"
-	"google.golang.org/api/option"
+	"time"
 
 	"go.skia.org/infra/go/eventbus"
 	"go.skia.org/infra/go/sklog"
 	"go.skia.org/infra/go/util"
 )
 
+const (
+	// OUTGOING_QUEUE_SIZE is the number of globally published events that can
+	// be waiting to be sent via the Transport before Publish blocks.
+	OUTGOING_QUEUE_SIZE = 1000
+
+	// PUBLISH_RETRY_DELAY is the time between the first attempts to send a
+	// message. The delay doubles after each failed attempt, up to
+	// PUBLISH_MAX_RETRY_DELAY.
+	PUBLISH_RETRY_DELAY = time.Second
+
+	// PUBLISH_MAX_RETRY_DELAY is the maximum time between attempts to send a
+	// message.
+	PUBLISH_MAX_RETRY_DELAY = time.Minute
+)
+
 // codecMap holds codecs for the different event channels. Values are added
 // via the RegisterCodec function.
 var codecMap = sync.Map{}
@@ -23,82 +56,127 @@ func RegisterCodec(channel string, codec util.LRUCodec) {
 	codecMap.Store(channel, codec)
 }
 
-// DistEventBus implements the eventbus.EventBus interfase on top of Cloud PubSub.
-type distEventBus struct {
-	localEventBus eventbus.EventBus
-	client        *pubsub.Client
-	clientID      string
-	topic         *pubsub.Topic
-	sub           *pubsub.Subscription
-	wrapperCodec  util.LRUCodec
-}
-
-// channelWrapper wraps each message to do channel multiplexing on top of a
-// Cloud PubSub topic.
-type channelWrapper struct {
+// Message wraps each event to do channel multiplexing on top of a Transport.
+type Message struct {
 	Sender  string `json:"sender"`    // id of the sending node.
 	Channel string `json:"eventType"` // event channel of this message.
 	Data    []byte `json:"data"`      // payload encoded with the user supplied codec.
 }
 
-// New returns an instance of eventbus.EventBus that is a node in a distributed
-// eventbus.
-// Each instance is a node in a distributed event bus that allows to send events
-// on an arbitrary number of channels.
-// - projectID is the id of the GCP project where the PubSub topic should live.
-// - topicName is the topic to use. It is assume that all message on this topic
-//   are messages of the
-//   event bus.
-// - subscriberName is an id that uniquely identifies this node within the
-//   event bus network.
-// - opts are the options used to create an authenticated PubSub client.
-func New(projectID, topicName, subscriberName string, opts ...option.ClientOption) (eventbus.EventBus, error) {
-	ret := &distEventBus{
-		localEventBus: eventbus.New(),
-		wrapperCodec:  util.JSONCodec(&channelWrapper{}),
-	}
+// MessageHandler is called by a Transport for each Message it delivers. The
+// Message is acknowledged if the handler returns nil, otherwise the Transport
+// will deliver it again.
+type MessageHandler func(msg *Message) error
 
-	// Create the client.
-	var err error
-	opts = append(opts, option.WithScopes(pubsub.ScopePubSub))
-	ret.client, err = pubsub.NewClient(context.Background(), projectID, opts...)
-	if err != nil {
-		return nil, sklog.FmtErrorf("Error creating pubsub client: %s", err)
-	}
+// Transport carries Messages between the nodes of a distributed event bus.
+// Each Transport instance belongs to a single node.
+//
+// Transports provide at-least-once delivery: a Message that has been
+// successfully passed to Publish is delivered to the handler of every node
+// that was subscribed when it was published, and is delivered again until the
+// handler returns nil, including after the node restarts if the Transport is
+// persistent. Handlers must therefore tolerate duplicates.
+//
+// Transports also preserve per-channel ordering: the handler is never called
+// concurrently, and Messages on the same channel are delivered in the order
+// they were published. Note that Cloud Pub/Sub does not guarantee ordering,
+// so the Pub/Sub Transport only honors the at-least-once part of the
+// contract.
+//
+// Note that a node also receives the Messages it publishes.
+type Transport interface {
+	// Publish sends the Message to all nodes. Once Publish returns nil the
+	// Message will be delivered.
+	Publish(msg *Message) error
 
-	// Set up the pubsub client, topic and subscription.
-	if err := ret.setupTopicSub(topicName, subscriberName); err != nil {
-		return nil, err
-	}
+	// Start begins delivering Messages to the handler in the background. It
+	// may only be called once.
+	Start(handler MessageHandler) error
 
-	// Start the receiver.
-	ret.startReceiver()
+	// Close stops delivering Messages and releases any resources.
+	Close() error
+}
+
+// distEventBus implements the eventbus.EventBus interface on top of a Transport.
+type distEventBus struct {
+	localEventBus *eventbus.MemEventBus
+	transport     Transport
+	nodeID        string
+	outgoing      chan *Message
+	retryDelay    time.Duration
+	done          chan struct{}
+	closeOnce     sync.Once
+	wg            sync.WaitGroup
+
+	// callbacks holds the subscribers of each channel, which are called for
+	// events received via the Transport.
+	callbacks map[string][]eventbus.CallbackFn
+	mutex     sync.Mutex // Protects callbacks.
+}
+
+// NewWithTransport returns an instance of eventbus.EventBus that is a node in
+// a distributed event bus, where events are sent between nodes via the given
+// Transport. nodeID uniquely identifies this node within the event bus network.
+//
+// Events received via the Transport are dispatched one at a time, and a
+// Message is only acknowledged once all the callbacks for its channel have
+// returned. This is what extends the delivery guarantees of the Transport
+// to the subscribers, at the cost of a slow callback delaying the delivery of
+// later events.
+//
+// The returned EventBus also implements io.Closer. Close stops sending
+// queued events and closes the Transport.
+func NewWithTransport(nodeID string, transport Transport) (eventbus.EventBus, error) {
+	return newDistEventBus(nodeID, transport, PUBLISH_RETRY_DELAY)
+}
+
+// newDistEventBus returns a new distEventBus which waits retryDelay after the
+// first failed attempt to send a message.
+func newDistEventBus(nodeID string, transport Transport, retryDelay time.Duration) (*distEventBus, error) {
+	ret := &distEventBus{
+		localEventBus: eventbus.New().(*eventbus.MemEventBus),
+		transport:     transport,
+		nodeID:        nodeID,
+		outgoing:      make(chan *Message, OUTGOING_QUEUE_SIZE),
+		retryDelay:    retryDelay,
+		done:          make(chan struct{}),
+		callbacks:     map[string][]eventbus.CallbackFn{},
+	}
+	if err := transport.Start(ret.processReceivedMsg); err != nil {
+		return nil, fmt.Errorf("Failed to start transport: %s", err)
+	}
+	ret.wg.Add(1)
+	go ret.sendOutgoing()
 	return ret, nil
 }
 
+// Close stops sending queued events and closes the Transport.
+func (d *distEventBus) Close() error {
+	var err error
+	d.closeOnce.Do(func() {
+		close(d.done)
+		d.wg.Wait()
+		err = d.transport.Close()
+	})
+	return err
+}
+
 // Publish implements the eventbus.EventBus interface.
 func (d *distEventBus) Publish(channel string, arg interface{}, globally bool) {
 	if globally {
-		// publish to pubsub in the background.
-		go func() {
-			codecInstance, ok := codecMap.Load(channel)
-			if !ok {
-				sklog.Errorf("Unable to publish on channel '%s'. No codec defined.", channel)
-				return
-			}
-
-			msg, err := d.encodeMsg(channel, arg, codecInstance.(util.LRUCodec))
-			if err != nil {
-				sklog.Errorf("Error encoding outgoing message: %s", err)
-				return
-			}
-			ctx := context.Background()
-			pubResult := d.topic.Publish(ctx, msg)
-			if _, err = pubResult.Get(ctx); err != nil {
-				sklog.Errorf("Error publishing message: %s", err)
-				return
+		codecInstance, ok := codecMap.Load(channel)
+		if !ok {
+			sklog.Errorf("Unable to publish on channel '%s'. No codec defined.", channel)
+		} else if msg, err := d.encodeMsg(channel, arg, codecInstance.(util.LRUCodec)); err != nil {
+			sklog.Errorf("Error encoding outgoing message: %s", err)
+		} else {
+			// Messages are sent in the background, but in order, by sendOutgoing.
+			select {
+			case d.outgoing <- msg:
+			case <-d.done:
+				sklog.Errorf("Unable to publish on channel '%s'. The event bus is closed.", channel)
 			}
-		}()
+		}
 	}
 	// Publish the event locally.
 	d.localEventBus.Publish(channel, arg, false)
@@ -106,122 +184,107 @@ func (d *distEventBus) Publish(channel string, arg interface{}, globally bool) {
 
 // SubscribeAsync implements the eventbus.EventBus interface.
 func (d *distEventBus) SubscribeAsync(eventType string, callback eventbus.CallbackFn) {
+	d.mutex.Lock()
+	d.callbacks[eventType] = append(d.callbacks[eventType], callback)
+	d.mutex.Unlock()
 	d.localEventBus.SubscribeAsync(eventType, callback)
 }
 
-// setupTopicSub sets up the topic and subscription.
-func (d *distEventBus) setupTopicSub(topicName, subscriberName string) error {
-	ctx := context.Background()
-
-	// Create the topic if it doesn't exist yet.
-	d.topic = d.client.Topic(topicName)
-	if exists, err := d.topic.Exists(ctx); err != nil {
-		return err
-	} else if !exists {
-		if d.topic, err = d.client.CreateTopic(ctx, topicName); err != nil {
-			return fmt.Errorf("Error creating pubsub topic '%s': %s", topicName, err)
-		}
-	}
-
-	// Create the subscription if it doesn't exist.
-	subName := fmt.Sprintf("%s+%s", subscriberName, topicName)
-	d.sub = d.client.Subscription(subName)
-	if exists, err := d.sub.Exists(ctx); err != nil {
-		return fmt.Errorf("Error checking existence of pubsub subscription '%s': %s", subName, err)
-	} else if !exists {
-		d.sub, err = d.client.CreateSubscription(ctx, subName, pubsub.SubscriptionConfig{
-			Topic: d.topic,
-		})
-		if err != nil {
-			return fmt.Errorf("Error creating pubsub subscription '%s': %s", subName, err)
+// sendOutgoing sends the messages queued by Publish via the Transport, one at
+// a time so they are published in order. A message is retried until it is
+// sent, so a failing Transport blocks all later messages, until the event bus
+// is closed.
+func (d *distEventBus) sendOutgoing() {
+	defer d.wg.Done()
+	for {
+		select {
+		case msg := <-d.outgoing:
+			if !d.publishWithRetry(msg) {
+				return
+			}
+		case <-d.done:
+			return
 		}
 	}
-	// Make the subscription also the id of this client.
-	d.clientID = subName
-	return nil
 }
 
-// startReceiver start a goroutine that processes incoming pubsub messages
-// and fires events on this node.
-func (d *distEventBus) startReceiver() {
-	go func() {
-		ctx := context.Background()
-		for {
-			err := d.sub.Receive(ctx, d.processReceivedMsg)
-			if err != nil {
-				sklog.Errorf("Error receiving message: %s", err)
-				continue
-			}
+// publishWithRetry sends the message via the Transport, retrying with
+// exponential backoff. It returns false if the event bus was closed before
+// the message could be sent.
+func (d *distEventBus) publishWithRetry(msg *Message) bool {
+	delay := d.retryDelay
+	for {
+		err := d.transport.Publish(msg)
+		if err == nil {
+			return true
 		}
-	}()
+		sklog.Errorf("Error publishing message on channel '%s', retrying in %s: %s", msg.Channel, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-d.done:
+			sklog.Errorf("Dropping message on channel '%s'. The event bus is closed.", msg.Channel)
+			return false
+		}
+		if delay *= 2; delay > PUBLISH_MAX_RETRY_DELAY {
+			delay = PUBLISH_MAX_RETRY_DELAY
+		}
+	}
 }
 
-// processReceivedMsg handles each pubsub message that arrives. It unwrapps the
-// enclosed channelWrapper and dispatches the event in this process unless the
-// received message was sent by this node.
-func (d *distEventBus) processReceivedMsg(ctx context.Context, msg *pubsub.Message) {
-	defer msg.Ack()
-	wrapper, data, err := d.decodeMsg(msg)
+// processReceivedMsg handles each Message that arrives via the Transport. It
+// decodes the payload and dispatches the event in this process unless the
+// received message was sent by this node. It returns once all the callbacks
+// for the event have returned.
+func (d *distEventBus) processReceivedMsg(msg *Message) error {
+	// Skip messages sent by this instance, they were dispatched locally in Publish.
+	if msg.Sender == d.nodeID {
+		return nil
+	}
+	data, err := d.decodeMsg(msg)
 	if err != nil {
+		// Redelivering won't help, so log and acknowledge the message.
 		sklog.Errorf("Error decoding message: %s", err)
-		return
+		return nil
 	}
-	// Publish the event locally if it hasn't been sent by this instance.
-	if wrapper.Sender != d.clientID {
-		d.localEventBus.Publish(wrapper.Channel, data, true)
+	d.mutex.Lock()
+	callbacks := d.callbacks[msg.Channel]
+	d.mutex.Unlock()
+
+	var wg sync.WaitGroup
+	for _, callback := range callbacks {
+		wg.Add(1)
+		go func(callback eventbus.CallbackFn) {
+			defer wg.Done()
+			callback(data)
+		}(callback)
 	}
+	wg.Wait()
+	return nil
 }
 
-// decodeMsg unwraps the channelWrapper instance contained in the pubsub message
-// and returns the deserialized payload as an instance of interface{}.
-func (d *distEventBus) decodeMsg(msg *pubsub.Message) (*channelWrapper, interface{}, error) {
-	// Unwrap the payload if this was wrapped in a channel wrapper.
-	var wrapper *channelWrapper = nil
-	payload := msg.Data
-	var codec util.LRUCodec = nil
-	if d.wrapperCodec != nil {
-		tempWrapper, err := d.wrapperCodec.Decode(payload)
-		if err != nil {
-			return nil, nil, fmt.Errorf("Error decoding message wrapper: %s", err)
-		}
-		wrapper = tempWrapper.(*channelWrapper)
-		payload = wrapper.Data
-		codecInst, ok := codecMap.Load(wrapper.Channel)
-		if !ok {
-			return nil, nil, fmt.Errorf("Unable to decode message for channel '%s'. No codec registered.", wrapper.Channel)
-		}
-		codec = codecInst.(util.LRUCodec)
+// decodeMsg returns the deserialized payload of the Message.
+func (d *distEventBus) decodeMsg(msg *Message) (interface{}, error) {
+	codecInst, ok := codecMap.Load(msg.Channel)
+	if !ok {
+		return nil, fmt.Errorf("Unable to decode message for channel '%s'. No codec registered.", msg.Channel)
 	}
-
-	// Deserialize the payload.
-	data, err := codec.Decode(payload)
+	data, err := codecInst.(util.LRUCodec).Decode(msg.Data)
 	if err != nil {
-		return nil, nil, fmt.Errorf("Unable to decode payload of pubsub event: %s", err)
+		return nil, fmt.Errorf("Unable to decode payload of event: %s", err)
 	}
-	return wrapper, data, nil
+	return data, nil
 }
 
-// encodeMsg wraps the given payload into an instance of channelWrapper and
-// creates the necessary pubsub message to send it to the cloud.
-func (d *distEventBus) encodeMsg(channel string, data interface{}, codec util.LRUCodec) (*pubsub.Message, error) {
+// encodeMsg encodes the given payload and wraps it into a Message.
+func (d *distEventBus) encodeMsg(channel string, data interface{}, codec util.LRUCodec) (*Message, error) {
 	payload, err := codec.Encode(data)
 	if err != nil {
 		return nil, err
 	}
-
-	if d.wrapperCodec != nil {
-		wrapper := &channelWrapper{
-			Sender:  d.sub.ID(),
-			Channel: channel,
-			Data:    payload,
-		}
-		var err error
-		if payload, err = d.wrapperCodec.Encode(wrapper); err != nil {
-			return nil, err
-		}
-	}
-	return &pubsub.Message{
-		Data: payload,
+	return &Message{
+		Sender:  d.nodeID,
+		Channel: channel,
+		Data:    payload,
 	}, nil
 }
 
@@ -1,8 +1,11 @@
 package gevent
 
 import (
+	"fmt"
+	"io"
 	"os"
 	"sort"
+	"sync"
 	"testing"
 	"time"
 
@@ -84,3 +87,172 @@ Run the emulator: gcloud beta emulators pubsub start`)
 	sort.Ints(vals)
 	assert.Equal(t, []int{1, 2, 2}, vals)
 }
+
+// receive reads n values from ch, failing the test if they don't arrive in
+// time.
+func receive(t *testing.T, ch chan int, n int) []int {
+	ret := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		select {
+		case v := <-ch:
+			ret = append(ret, v)
+		case <-time.After(10 * time.Second):
+			assert.FailNow(t, "Timeout: did not receive messages in time")
+		}
+	}
+	return ret
+}
+
+func TestEventBusLoopback(t *testing.T) {
+	testutils.SmallTest(t)
+
+	RegisterCodec("loopback-channel", util.JSONCodec(&testType{}))
+	hub := NewLoopback()
+	eventBus, err := NewWithTransport(SUBSCRIBER_1, hub.Transport(SUBSCRIBER_1))
+	assert.NoError(t, err)
+	eventBusTwo, err := NewWithTransport(SUBSCRIBER_2, hub.Transport(SUBSCRIBER_2))
+	assert.NoError(t, err)
+
+	ch := make(chan int, 100)
+	eventBus.SubscribeAsync("loopback-channel", func(e interface{}) {
+		ch <- e.(*testType).ID
+	})
+	chTwo := make(chan int, 100)
+	eventBusTwo.SubscribeAsync("loopback-channel", func(e interface{}) {
+		chTwo <- e.(*testType).ID
+	})
+
+	expected := []int{}
+	for i := 0; i < 20; i++ {
+		eventBusTwo.Publish("loopback-channel", &testType{ID: i}, true)
+		expected = append(expected, i)
+	}
+
+	// Remote events arrive in the order they were published.
+	assert.Equal(t, expected, receive(t, ch, 20))
+
+	// The sender only receives its events once, via local dispatch.
+	vals := receive(t, chTwo, 20)
+	sort.Ints(vals)
+	assert.Equal(t, expected, vals)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 0, len(chTwo))
+}
+
+func TestLoopbackRedelivery(t *testing.T) {
+	testutils.SmallTest(t)
+
+	hub := NewLoopback()
+	sender := hub.Transport("sender")
+
+	// Fail the first attempt to handle each message.
+	ch := make(chan int, 100)
+	failed := map[string]bool{}
+	handler := func(msg *Message) error {
+		if !failed[string(msg.Data)] {
+			failed[string(msg.Data)] = true
+			return fmt.Errorf("Failed")
+		}
+		ch <- int(msg.Data[0])
+		return nil
+	}
+	receiver := hub.Transport("receiver")
+	assert.NoError(t, receiver.Start(handler))
+	assert.Error(t, receiver.Start(handler))
+
+	assert.NoError(t, sender.Publish(&Message{Channel: "c", Data: []byte{1}}))
+	assert.NoError(t, sender.Publish(&Message{Channel: "c", Data: []byte{2}}))
+	assert.Equal(t, []int{1, 2}, receive(t, ch, 2))
+
+	// Messages published while the receiver is down are delivered when it
+	// restarts.
+	assert.NoError(t, receiver.Close())
+	assert.NoError(t, sender.Publish(&Message{Channel: "c", Data: []byte{3}}))
+	receiver = hub.Transport("receiver")
+	assert.NoError(t, receiver.Start(handler))
+	assert.Equal(t, []int{3}, receive(t, ch, 1))
+	assert.NoError(t, receiver.Close())
+
+	// A new node only receives messages published after it started.
+	newNode := hub.Transport("new-node")
+	assert.NoError(t, newNode.Start(handler))
+	assert.NoError(t, sender.Publish(&Message{Channel: "c", Data: []byte{4}}))
+	assert.Equal(t, []int{4}, receive(t, ch, 1))
+	assert.NoError(t, newNode.Close())
+}
+
+// flakyTransport wraps a Transport and fails every call to Publish while
+// failing is true.
+type flakyTransport struct {
+	Transport
+	mutex    sync.Mutex
+	failing  bool
+	attempts int
+}
+
+func (f *flakyTransport) Publish(msg *Message) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.attempts++
+	if f.failing {
+		return fmt.Errorf("Publish failed")
+	}
+	return f.Transport.Publish(msg)
+}
+
+func (f *flakyTransport) setFailing(failing bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.failing = failing
+}
+
+func (f *flakyTransport) getAttempts() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.attempts
+}
+
+func TestEventBusPublishFailure(t *testing.T) {
+	testutils.SmallTest(t)
+
+	RegisterCodec("flaky-channel", util.JSONCodec(&testType{}))
+	hub := NewLoopback()
+	receiver, err := NewWithTransport(SUBSCRIBER_1, hub.Transport(SUBSCRIBER_1))
+	assert.NoError(t, err)
+	ch := make(chan int, 100)
+	receiver.SubscribeAsync("flaky-channel", func(e interface{}) {
+		ch <- e.(*testType).ID
+	})
+
+	flaky := &flakyTransport{Transport: hub.Transport(SUBSCRIBER_2), failing: true}
+	sender, err := newDistEventBus(SUBSCRIBER_2, flaky, time.Millisecond)
+	assert.NoError(t, err)
+
+	// Messages are retried while the Transport fails and are delivered in
+	// order once it recovers.
+	expected := []int{}
+	for i := 0; i < 5; i++ {
+		sender.Publish("flaky-channel", &testType{ID: i}, true)
+		expected = append(expected, i)
+	}
+	assert.NoError(t, testutils.EventuallyConsistent(10*time.Second, func() error {
+		if flaky.getAttempts() < 3 {
+			return testutils.TryAgainErr
+		}
+		return nil
+	}))
+	assert.Equal(t, 0, len(ch))
+	flaky.setFailing(false)
+	assert.Equal(t, expected, receive(t, ch, 5))
+
+	// Closing the event bus stops the retries.
+	flaky.setFailing(true)
+	sender.Publish("flaky-channel", &testType{ID: 5}, true)
+	assert.NoError(t, sender.Close())
+	attempts := flaky.getAttempts()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, attempts, flaky.getAttempts())
+	assert.Equal(t, 0, len(ch))
+	assert.NoError(t, sender.Close())
+	assert.NoError(t, receiver.(io.Closer).Close())
+}
@@ -0,0 +1,232 @@
+package gevent
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+)
+
+const (
+	// LOG_FILENAME is the name of the file in the log directory that holds
+	// every published Message.
+	LOG_FILENAME = "events.log"
+
+	// OFFSET_EXT is the extension of the files in the log directory that
+	// hold the acknowledged offset of each node.
+	OFFSET_EXT = ".offset"
+
+	// LOG_POLL_INTERVAL is how often a node checks the log for new Messages.
+	LOG_POLL_INTERVAL = 100 * time.Millisecond
+
+	// recordHeaderSize is the size of the length prefix of each record.
+	recordHeaderSize = 4
+)
+
+// logTransport implements Transport on top of an append-only log file
+// shared by all nodes.
+//
+// Each record in the log is a 4 byte big-endian length followed by the JSON
+// encoded Message. Each node stores the offset of the first record it hasn't
+// acknowledged in a file of its own, and resumes reading from there after a
+// restart.
+//
+// Records are appended with a single write to a file opened with O_APPEND,
+// so nodes in different processes can share a log on the same machine or on
+// a shared volume. The log is never truncated, and a node that is removed
+// leaves its offset file behind.
+type logTransport struct {
+	dir          string
+	name         string
+	offsetFile   string
+	pollInterval time.Duration
+
+	mutex   sync.Mutex // Serializes Publish.
+	log     *os.File   // The log opened for appending.
+	started bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewLogTransport returns a persistent Transport for the node with the given
+// name, where the log is stored in dir.
+//
+// A node that hasn't been seen before only receives Messages published after
+// Start is called. Otherwise delivery resumes from the first Message the node
+// hasn't acknowledged.
+func NewLogTransport(dir, name string) (Transport, error) {
+	if name == "" || strings.ContainsAny(name, "/\\") {
+		return nil, fmt.Errorf("Invalid node name: %q", name)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Failed to create log directory: %s", err)
+	}
+	log, err := os.OpenFile(filepath.Join(dir, LOG_FILENAME), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open log: %s", err)
+	}
+	return &logTransport{
+		dir:          dir,
+		name:         name,
+		offsetFile:   filepath.Join(dir, name+OFFSET_EXT),
+		pollInterval: LOG_POLL_INTERVAL,
+		log:          log,
+		done:         make(chan struct{}),
+	}, nil
+}
+
+// Publish implements the Transport interface.
+func (t *logTransport) Publish(msg *Message) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("Failed to encode message: %s", err)
+	}
+	record := make([]byte, recordHeaderSize+len(b))
+	binary.BigEndian.PutUint32(record, uint32(len(b)))
+	copy(record[recordHeaderSize:], b)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	// A single write, so concurrent publishers can't interleave records.
+	if _, err := t.log.Write(record); err != nil {
+		return fmt.Errorf("Failed to append to log: %s", err)
+	}
+	return nil
+}
+
+// readOffset returns the acknowledged offset of this node, or -1 if the node
+// has never acknowledged a message.
+func (t *logTransport) readOffset() (int64, error) {
+	b, err := ioutil.ReadFile(t.offsetFile)
+	if os.IsNotExist(err) {
+		return -1, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("Failed to read offset: %s", err)
+	}
+	offset, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid offset in %s: %s", t.offsetFile, err)
+	}
+	return offset, nil
+}
+
+// writeOffset atomically stores the acknowledged offset of this node.
+func (t *logTransport) writeOffset(offset int64) error {
+	return util.WithWriteFile(t.offsetFile, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "%d\n", offset)
+		return err
+	})
+}
+
+// Start implements the Transport interface.
+func (t *logTransport) Start(handler MessageHandler) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.started {
+		return fmt.Errorf("Transport already started.")
+	}
+	offset, err := t.readOffset()
+	if err != nil {
+		return err
+	}
+	if offset == -1 {
+		// A new node starts at the end of the log.
+		st, err := t.log.Stat()
+		if err != nil {
+			return fmt.Errorf("Failed to stat log: %s", err)
+		}
+		offset = st.Size()
+		if err := t.writeOffset(offset); err != nil {
+			return fmt.Errorf("Failed to write initial offset: %s", err)
+		}
+	}
+	r, err := os.Open(filepath.Join(t.dir, LOG_FILENAME))
+	if err != nil {
+		return fmt.Errorf("Failed to open log for reading: %s", err)
+	}
+	t.started = true
+	t.wg.Add(1)
+	go t.deliver(r, offset, handler)
+	return nil
+}
+
+// readRecord reads the Message at the given offset, returning the Message and
+// the offset of the next record. It returns io.EOF if there isn't a complete
+// record at offset yet.
+func readRecord(r io.ReaderAt, offset int64) (*Message, int64, error) {
+	var header [recordHeaderSize]byte
+	if _, err := r.ReadAt(header[:], offset); err != nil {
+		if err == io.EOF {
+			return nil, 0, io.EOF
+		}
+		return nil, 0, err
+	}
+	size := int64(binary.BigEndian.Uint32(header[:]))
+	b := make([]byte, size)
+	if _, err := r.ReadAt(b, offset+recordHeaderSize); err != nil {
+		// A partially written record also returns io.EOF.
+		return nil, 0, err
+	}
+	msg := &Message{}
+	if err := json.Unmarshal(b, msg); err != nil {
+		return nil, 0, fmt.Errorf("Failed to decode message at offset %d: %s", offset, err)
+	}
+	return msg, offset + recordHeaderSize + size, nil
+}
+
+// deliver passes each Message in the log in turn to the handler until the
+// Transport is closed, only moving on to the next Message once the handler
+// succeeds and the new offset has been stored.
+func (t *logTransport) deliver(r *os.File, offset int64, handler MessageHandler) {
+	defer t.wg.Done()
+	defer util.Close(r)
+	for {
+		select {
+		case <-t.done:
+			return
+		default:
+		}
+		msg, next, err := readRecord(r, offset)
+		if err == io.EOF {
+			// Wait for more records.
+			select {
+			case <-t.done:
+				return
+			case <-time.After(t.pollInterval):
+			}
+			continue
+		} else if err != nil {
+			// The log is corrupt, and it's append-only, so give up.
+			sklog.Errorf("Failed to read log, no more messages will be delivered to %q: %s", t.name, err)
+			return
+		}
+		if err := handler(msg); err != nil {
+			time.Sleep(RETRY_DELAY)
+			continue
+		}
+		if err := t.writeOffset(next); err != nil {
+			// The message may be delivered again after a restart, which is
+			// allowed by at-least-once delivery.
+			sklog.Errorf("Failed to write offset: %s", err)
+		}
+		offset = next
+	}
+}
+
+// Close implements the Transport interface.
+func (t *logTransport) Close() error {
+	close(t.done)
+	t.wg.Wait()
+	return t.log.Close()
+}
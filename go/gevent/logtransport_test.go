@@ -0,0 +1,113 @@
+package gevent
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+
+	"go.skia.org/infra/go/testutils"
+)
+
+// newTestLogTransport returns a log Transport that polls the log frequently.
+func newTestLogTransport(t *testing.T, dir, name string) Transport {
+	ret, err := NewLogTransport(dir, name)
+	assert.NoError(t, err)
+	ret.(*logTransport).pollInterval = 5 * time.Millisecond
+	return ret
+}
+
+func TestLogTransport(t *testing.T) {
+	testutils.SmallTest(t)
+
+	dir, cleanup := testutils.TempDir(t)
+	defer cleanup()
+
+	_, err := NewLogTransport(dir, "")
+	assert.Error(t, err)
+	_, err = NewLogTransport(dir, "../node")
+	assert.Error(t, err)
+
+	sender := newTestLogTransport(t, dir, "sender")
+	defer testutils.AssertCloses(t, sender)
+
+	// Published before the receiver exists, so it is never delivered.
+	assert.NoError(t, sender.Publish(&Message{Channel: "c", Data: []byte{0}}))
+
+	// Fail the first attempt to handle each message.
+	ch := make(chan int, 100)
+	failed := map[string]bool{}
+	handler := func(msg *Message) error {
+		if !failed[string(msg.Data)] {
+			failed[string(msg.Data)] = true
+			return fmt.Errorf("Failed")
+		}
+		ch <- int(msg.Data[0])
+		return nil
+	}
+
+	receiver := newTestLogTransport(t, dir, "receiver")
+	assert.NoError(t, receiver.Start(handler))
+	assert.NoError(t, sender.Publish(&Message{Sender: "sender", Channel: "c", Data: []byte{1}}))
+	assert.NoError(t, sender.Publish(&Message{Sender: "sender", Channel: "c", Data: []byte{2}}))
+	assert.Equal(t, []int{1, 2}, receive(t, ch, 2))
+	assert.NoError(t, receiver.Close())
+
+	// Messages published while the receiver is down are delivered when it
+	// restarts, and only those.
+	assert.NoError(t, sender.Publish(&Message{Channel: "c", Data: []byte{3}}))
+	assert.NoError(t, sender.Publish(&Message{Channel: "c", Data: []byte{4}}))
+	receiver = newTestLogTransport(t, dir, "receiver")
+	assert.NoError(t, receiver.Start(handler))
+	assert.Equal(t, []int{3, 4}, receive(t, ch, 2))
+	assert.NoError(t, receiver.Close())
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 0, len(ch))
+
+	_, err = os.Stat(filepath.Join(dir, "receiver"+OFFSET_EXT))
+	assert.NoError(t, err)
+}
+
+func TestLogTransportPartialRecord(t *testing.T) {
+	testutils.SmallTest(t)
+
+	dir, cleanup := testutils.TempDir(t)
+	defer cleanup()
+
+	ch := make(chan int, 100)
+	receiver := newTestLogTransport(t, dir, "receiver")
+	assert.NoError(t, receiver.Start(func(msg *Message) error {
+		ch <- int(msg.Data[0])
+		return nil
+	}))
+	defer testutils.AssertCloses(t, receiver)
+
+	sender := newTestLogTransport(t, dir, "sender")
+	defer testutils.AssertCloses(t, sender)
+	assert.NoError(t, sender.Publish(&Message{Channel: "c", Data: []byte{1}}))
+	assert.Equal(t, []int{1}, receive(t, ch, 1))
+
+	// Write the first half of a record, which must not be delivered or
+	// treated as corrupt until the rest of it is written.
+	b, err := json.Marshal(&Message{Channel: "c", Data: []byte{2}})
+	assert.NoError(t, err)
+	record := make([]byte, recordHeaderSize+len(b))
+	binary.BigEndian.PutUint32(record, uint32(len(b)))
+	copy(record[recordHeaderSize:], b)
+
+	f, err := os.OpenFile(filepath.Join(dir, LOG_FILENAME), os.O_WRONLY|os.O_APPEND, 0644)
+	assert.NoError(t, err)
+	defer testutils.AssertCloses(t, f)
+	_, err = f.Write(record[:len(record)/2])
+	assert.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 0, len(ch))
+	_, err = f.Write(record[len(record)/2:])
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2}, receive(t, ch, 1))
+}
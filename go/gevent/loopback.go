@@ -0,0 +1,128 @@
+package gevent
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RETRY_DELAY is how long the loopback and log Transports wait before
+// delivering a Message again after the handler returned an error.
+const RETRY_DELAY = 10 * time.Millisecond
+
+// Loopback is an in-process hub for event bus nodes, which is useful for
+// testing multiple nodes without Cloud PubSub. Use Transport to create a
+// Transport for each node.
+//
+// Every Message is kept in memory, along with the acknowledged offset of each
+// node, so creating a new Transport with the name of a closed one resumes
+// delivery after the last acknowledged Message, as if the node had restarted.
+type Loopback struct {
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	messages []*Message
+	offsets  map[string]int
+}
+
+// NewLoopback returns a new Loopback.
+func NewLoopback() *Loopback {
+	ret := &Loopback{
+		messages: []*Message{},
+		offsets:  map[string]int{},
+	}
+	ret.cond = sync.NewCond(&ret.mutex)
+	return ret
+}
+
+// Transport returns a Transport for the node with the given name.
+//
+// A node that hasn't been seen before only receives Messages published after
+// Start is called.
+func (l *Loopback) Transport(name string) Transport {
+	return &loopbackTransport{
+		hub:  l,
+		name: name,
+	}
+}
+
+// loopbackTransport implements Transport for a single node of a Loopback.
+type loopbackTransport struct {
+	hub     *Loopback
+	name    string
+	started bool
+	closed  bool // Protected by hub.mutex.
+	wg      sync.WaitGroup
+}
+
+// Publish implements the Transport interface.
+func (t *loopbackTransport) Publish(msg *Message) error {
+	t.hub.mutex.Lock()
+	defer t.hub.mutex.Unlock()
+	if t.closed {
+		return fmt.Errorf("Transport is closed.")
+	}
+	// Copy the message so the receivers can't change what the sender sees.
+	cp := *msg
+	t.hub.messages = append(t.hub.messages, &cp)
+	t.hub.cond.Broadcast()
+	return nil
+}
+
+// Start implements the Transport interface.
+func (t *loopbackTransport) Start(handler MessageHandler) error {
+	t.hub.mutex.Lock()
+	defer t.hub.mutex.Unlock()
+	if t.started {
+		return fmt.Errorf("Transport already started.")
+	}
+	t.started = true
+	if _, ok := t.hub.offsets[t.name]; !ok {
+		t.hub.offsets[t.name] = len(t.hub.messages)
+	}
+	t.wg.Add(1)
+	go t.deliver(handler)
+	return nil
+}
+
+// next blocks until there is a Message to deliver, returning false if the
+// Transport has been closed.
+func (t *loopbackTransport) next() (*Message, bool) {
+	t.hub.mutex.Lock()
+	defer t.hub.mutex.Unlock()
+	for !t.closed && t.hub.offsets[t.name] >= len(t.hub.messages) {
+		t.hub.cond.Wait()
+	}
+	if t.closed {
+		return nil, false
+	}
+	return t.hub.messages[t.hub.offsets[t.name]], true
+}
+
+// deliver passes each Message in turn to the handler until the Transport is
+// closed, only moving on to the next Message once the handler succeeds.
+func (t *loopbackTransport) deliver(handler MessageHandler) {
+	defer t.wg.Done()
+	for {
+		msg, ok := t.next()
+		if !ok {
+			return
+		}
+		if err := handler(msg); err != nil {
+			time.Sleep(RETRY_DELAY)
+			continue
+		}
+		t.hub.mutex.Lock()
+		t.hub.offsets[t.name] += 1
+		t.hub.mutex.Unlock()
+	}
+}
+
+// Close implements the Transport interface.
+func (t *loopbackTransport) Close() error {
+	t.hub.mutex.Lock()
+	t.closed = true
+	t.hub.cond.Broadcast()
+	t.hub.mutex.Unlock()
+	t.wg.Wait()
+	return nil
+}
@@ -0,0 +1,153 @@
+package gevent
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/pubsub"
+	"google.golang.org/api/option"
+
+	"go.skia.org/infra/go/eventbus"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+)
+
+// pubSubTransport implements Transport on top of a Cloud PubSub topic, where
+// each node has its own subscription.
+type pubSubTransport struct {
+	client       *pubsub.Client
+	topic        *pubsub.Topic
+	sub          *pubsub.Subscription
+	wrapperCodec util.LRUCodec
+	cancel       context.CancelFunc
+}
+
+// New returns an instance of eventbus.EventBus that is a node in a distributed
+// eventbus.
+// Each instance is a node in a distributed event bus that allows to send events
+// on an arbitrary number of channels.
+// - projectID is the id of the GCP project where the PubSub topic should live.
+// - topicName is the topic to use. It is assume that all message on this topic
+//   are messages of the
+//   event bus.
+// - subscriberName is an id that uniquely identifies this node within the
+//   event bus network.
+// - opts are the options used to create an authenticated PubSub client.
+func New(projectID, topicName, subscriberName string, opts ...option.ClientOption) (eventbus.EventBus, error) {
+	t, err := NewPubSubTransport(projectID, topicName, subscriberName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	// The subscription is also the id of this node.
+	return NewWithTransport(t.(*pubSubTransport).sub.ID(), t)
+}
+
+// NewPubSubTransport returns a Transport that sends Messages via Cloud PubSub.
+// The arguments are the same as for New.
+func NewPubSubTransport(projectID, topicName, subscriberName string, opts ...option.ClientOption) (Transport, error) {
+	ret := &pubSubTransport{
+		wrapperCodec: util.JSONCodec(&Message{}),
+	}
+
+	// Create the client.
+	var err error
+	opts = append(opts, option.WithScopes(pubsub.ScopePubSub))
+	ret.client, err = pubsub.NewClient(context.Background(), projectID, opts...)
+	if err != nil {
+		return nil, sklog.FmtErrorf("Error creating pubsub client: %s", err)
+	}
+
+	// Set up the pubsub client, topic and subscription.
+	if err := ret.setupTopicSub(topicName, subscriberName); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// setupTopicSub sets up the topic and subscription.
+func (p *pubSubTransport) setupTopicSub(topicName, subscriberName string) error {
+	ctx := context.Background()
+
+	// Create the topic if it doesn't exist yet.
+	p.topic = p.client.Topic(topicName)
+	if exists, err := p.topic.Exists(ctx); err != nil {
+		return err
+	} else if !exists {
+		if p.topic, err = p.client.CreateTopic(ctx, topicName); err != nil {
+			return fmt.Errorf("Error creating pubsub topic '%s': %s", topicName, err)
+		}
+	}
+
+	// Create the subscription if it doesn't exist.
+	subName := fmt.Sprintf("%s+%s", subscriberName, topicName)
+	p.sub = p.client.Subscription(subName)
+	if exists, err := p.sub.Exists(ctx); err != nil {
+		return fmt.Errorf("Error checking existence of pubsub subscription '%s': %s", subName, err)
+	} else if !exists {
+		p.sub, err = p.client.CreateSubscription(ctx, subName, pubsub.SubscriptionConfig{
+			Topic: p.topic,
+		})
+		if err != nil {
+			return fmt.Errorf("Error creating pubsub subscription '%s': %s", subName, err)
+		}
+	}
+	// Only handle one message at a time, see Transport.
+	p.sub.ReceiveSettings.MaxOutstandingMessages = 1
+	p.sub.ReceiveSettings.NumGoroutines = 1
+	return nil
+}
+
+// Publish implements the Transport interface.
+func (p *pubSubTransport) Publish(msg *Message) error {
+	payload, err := p.wrapperCodec.Encode(msg)
+	if err != nil {
+		return fmt.Errorf("Error encoding message wrapper: %s", err)
+	}
+	ctx := context.Background()
+	pubResult := p.topic.Publish(ctx, &pubsub.Message{
+		Data: payload,
+	})
+	if _, err = pubResult.Get(ctx); err != nil {
+		return fmt.Errorf("Error publishing message: %s", err)
+	}
+	return nil
+}
+
+// Start implements the Transport interface. It starts a goroutine that
+// processes incoming pubsub messages.
+func (p *pubSubTransport) Start(handler MessageHandler) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	go func() {
+		for ctx.Err() == nil {
+			err := p.sub.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
+				wrapper, err := p.wrapperCodec.Decode(msg.Data)
+				if err != nil {
+					// Redelivering won't help, so log and acknowledge the message.
+					sklog.Errorf("Error decoding message wrapper: %s", err)
+					msg.Ack()
+					return
+				}
+				if err := handler(wrapper.(*Message)); err != nil {
+					sklog.Errorf("Error handling message: %s", err)
+					msg.Nack()
+					return
+				}
+				msg.Ack()
+			})
+			if err != nil {
+				sklog.Errorf("Error receiving message: %s", err)
+				continue
+			}
+		}
+	}()
+	return nil
+}
+
+// Close implements the Transport interface.
+func (p *pubSubTransport) Close() error {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	return p.client.Close()
+}
@@ -5,6 +5,7 @@ import (
 	"sort"
 	"strings"
 
+	"go.skia.org/infra/go/query"
 	"go.skia.org/infra/go/util"
 )
 
@@ -184,6 +185,72 @@ func (p ParamSet) Matches(right ParamSet) bool {
 	return true
 }
 
+// Intersect returns a new ParamSet that only contains the values that appear
+// in both 'p' and 'right'. Keys that have no values in common are dropped.
+func (p ParamSet) Intersect(right ParamSet) ParamSet {
+	ret := ParamSet{}
+	for key, vals := range p {
+		rightVals, ok := right[key]
+		if !ok {
+			continue
+		}
+		for _, v := range vals {
+			if util.In(v, rightVals) {
+				ret[key] = append(ret[key], v)
+			}
+		}
+	}
+	return ret
+}
+
+// Difference returns a new ParamSet that contains the values in 'p' that
+// don't appear in 'right'. Keys that have no values left are dropped.
+func (p ParamSet) Difference(right ParamSet) ParamSet {
+	ret := ParamSet{}
+	for key, vals := range p {
+		rightVals := right[key]
+		for _, v := range vals {
+			if !util.In(v, rightVals) {
+				ret[key] = append(ret[key], v)
+			}
+		}
+	}
+	return ret
+}
+
+// Restrict returns a new ParamSet that only contains the values in 'p' that
+// can appear in a key that matches the query, i.e. if every key that the
+// ParamSet was built from is passed through q.Matches then the ParamSet
+// built from the matching keys is a subset of the returned ParamSet.
+//
+// Keys that the query doesn't mention keep all their values, unless no OR
+// group of the query can match, in which case the returned ParamSet is empty.
+func (p ParamSet) Restrict(q *query.Query) ParamSet {
+	ret := ParamSet{}
+	for _, group := range q.Groups() {
+		restricted := ParamSet{}
+		for key, vals := range p {
+			for _, v := range vals {
+				if group.MatchesValue(key, v) {
+					restricted[key] = append(restricted[key], v)
+				}
+			}
+		}
+		// The group can't match any key if one of its params has no values.
+		matches := true
+		for _, key := range group.Keys() {
+			if len(restricted[key]) == 0 {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			ret.AddParamSet(restricted)
+		}
+	}
+	return ret
+}
+
 // ParamMatcher is a list of Paramsets that can be matched against. The primary
 // purpose is to match against a set of rules, e.g. ignore rules.
 type ParamMatcher []ParamSet
@@ -3,6 +3,7 @@ package paramtools
 import (
 	"testing"
 
+	"go.skia.org/infra/go/query"
 	"go.skia.org/infra/go/testutils"
 	"go.skia.org/infra/go/util"
 
@@ -244,3 +245,89 @@ func TestMatching(t *testing.T) {
 	}
 	assert.True(t, ParamMatcher{testRule}.MatchAny(testVal))
 }
+
+func TestIntersectDifference(t *testing.T) {
+	testutils.SmallTest(t)
+	a := ParamSet{
+		"arch":   {"x86", "arm"},
+		"config": {"565", "8888"},
+		"os":     {"linux"},
+	}
+	b := ParamSet{
+		"arch":   {"arm", "mips"},
+		"config": {"gpu"},
+		"gpu":    {"nvidia"},
+	}
+
+	assert.Equal(t, ParamSet{"arch": {"arm"}}, a.Intersect(b))
+	assert.Equal(t, ParamSet{"arch": {"arm"}}, b.Intersect(a))
+	assert.Equal(t, ParamSet{}, a.Intersect(ParamSet{}))
+	assert.Equal(t, a, a.Intersect(a))
+
+	assert.Equal(t, ParamSet{
+		"arch":   {"x86"},
+		"config": {"565", "8888"},
+		"os":     {"linux"},
+	}, a.Difference(b))
+	assert.Equal(t, ParamSet{
+		"arch":   {"mips"},
+		"config": {"gpu"},
+		"gpu":    {"nvidia"},
+	}, b.Difference(a))
+	assert.Equal(t, ParamSet{}, a.Difference(a))
+
+	// Neither modifies the receiver.
+	assert.Equal(t, []string{"x86", "arm"}, a["arch"])
+}
+
+func TestRestrict(t *testing.T) {
+	testutils.SmallTest(t)
+	p := ParamSet{
+		"arch":       {"x86", "x86_64", "arm"},
+		"config":     {"565", "8888", "gpu"},
+		"os_version": {"9", "10", "11", "12"},
+	}
+	testCases := []struct {
+		query   string
+		want    ParamSet
+		message string
+	}{
+		{
+			query:   "config=565,gpu",
+			want:    ParamSet{"arch": {"arm", "x86", "x86_64"}, "config": {"565", "gpu"}, "os_version": {"10", "11", "12", "9"}},
+			message: "simple",
+		},
+		{
+			query:   "arch~=^x AND config!=565",
+			want:    ParamSet{"arch": {"x86", "x86_64"}, "config": {"8888", "gpu"}, "os_version": {"10", "11", "12", "9"}},
+			message: "regex and negative",
+		},
+		{
+			query:   "os_version>=10 AND os_version<12 AND config=*",
+			want:    ParamSet{"arch": {"arm", "x86", "x86_64"}, "config": {"565", "8888", "gpu"}, "os_version": {"10", "11"}},
+			message: "comparison and wildcard",
+		},
+		{
+			query:   "(arch=arm AND config=gpu) OR (arch=x86 AND config=565)",
+			want:    ParamSet{"arch": {"arm", "x86"}, "config": {"565", "gpu"}, "os_version": {"10", "11", "12", "9"}},
+			message: "or groups",
+		},
+		{
+			query:   "config=nvpr",
+			want:    ParamSet{},
+			message: "no matching values",
+		},
+		{
+			query:   "config=565 OR model=Nexus5",
+			want:    ParamSet{"arch": {"arm", "x86", "x86_64"}, "config": {"565"}, "os_version": {"10", "11", "12", "9"}},
+			message: "one group can't match",
+		},
+	}
+	for _, tc := range testCases {
+		q, err := query.Parse(tc.query)
+		assert.NoError(t, err, tc.message)
+		got := p.Restrict(q)
+		got.Normalize()
+		assert.Equal(t, tc.want, got, tc.message)
+	}
+}
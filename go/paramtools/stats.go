@@ -0,0 +1,136 @@
+package paramtools
+
+import (
+	"sort"
+)
+
+// ValueCount is the number of traces that have a given value for a key.
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// KeyStats are the statistics for a single key of a Stats.
+type KeyStats struct {
+	Key string `json:"key"`
+
+	// Values are sorted by descending Count, then by Value.
+	Values []ValueCount `json:"values"`
+
+	// Missing is the number of traces that don't have the key at all.
+	Missing int `json:"missing"`
+}
+
+// Stats counts how many traces have each value of each key, which is the
+// ParamSet of the traces along with the cardinality of every value, e.g. it
+// can answer "how many traces have config=8888" without scanning the traces
+// again.
+type Stats struct {
+	// Total is the number of traces added.
+	Total int
+
+	// Counts maps key -> value -> the number of traces with that value.
+	Counts map[string]map[string]int
+}
+
+// NewStats returns a new Stats for the given trace ids, which must be valid
+// structured keys, see query.ValidateKey.
+func NewStats(traceIDs ...string) *Stats {
+	ret := &Stats{
+		Counts: map[string]map[string]int{},
+	}
+	for _, traceID := range traceIDs {
+		ret.AddParams(NewParams(traceID))
+	}
+	return ret
+}
+
+// Add adds the trace with the given id, which must be a valid structured key.
+func (s *Stats) Add(traceID string) {
+	s.AddParams(NewParams(traceID))
+}
+
+// AddParams adds a trace with the given Params.
+func (s *Stats) AddParams(p Params) {
+	s.Total += 1
+	for k, v := range p {
+		values, ok := s.Counts[k]
+		if !ok {
+			values = map[string]int{}
+			s.Counts[k] = values
+		}
+		values[v] += 1
+	}
+}
+
+// Count returns the number of traces where key has the given value.
+func (s *Stats) Count(key, value string) int {
+	return s.Counts[key][value]
+}
+
+// Cardinality returns the number of distinct values of key.
+func (s *Stats) Cardinality(key string) int {
+	return len(s.Counts[key])
+}
+
+// Missing returns the number of traces that don't have key.
+func (s *Stats) Missing(key string) int {
+	n := 0
+	for _, count := range s.Counts[key] {
+		n += count
+	}
+	return s.Total - n
+}
+
+// ParamSet returns the ParamSet of all the traces, with the values sorted.
+func (s *Stats) ParamSet() ParamSet {
+	ret := ParamSet{}
+	for k, values := range s.Counts {
+		ret[k] = make([]string, 0, len(values))
+		for v := range values {
+			ret[k] = append(ret[k], v)
+		}
+	}
+	ret.Normalize()
+	return ret
+}
+
+// Splits returns the sorted keys that split the traces into more than one
+// group, i.e. keys that have more than one value or that are missing from
+// some traces. Keys that have the same value for every trace are omitted.
+func (s *Stats) Splits() []string {
+	ret := []string{}
+	for k := range s.Counts {
+		if s.Cardinality(k) > 1 || s.Missing(k) > 0 {
+			ret = append(ret, k)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// KeyStats returns the statistics for every key, sorted by key.
+func (s *Stats) KeyStats() []KeyStats {
+	ret := make([]KeyStats, 0, len(s.Counts))
+	for k, values := range s.Counts {
+		ks := KeyStats{
+			Key:     k,
+			Values:  make([]ValueCount, 0, len(values)),
+			Missing: s.Missing(k),
+		}
+		for v, count := range values {
+			ks.Values = append(ks.Values, ValueCount{Value: v, Count: count})
+		}
+		sort.Slice(ks.Values, func(i, j int) bool {
+			if ks.Values[i].Count != ks.Values[j].Count {
+				return ks.Values[i].Count > ks.Values[j].Count
+			}
+			return ks.Values[i].Value < ks.Values[j].Value
+		})
+		ret = append(ret, ks)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Key < ret[j].Key
+	})
+	return ret
+}
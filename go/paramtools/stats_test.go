@@ -0,0 +1,69 @@
+package paramtools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.skia.org/infra/go/testutils"
+)
+
+func TestStats(t *testing.T) {
+	testutils.SmallTest(t)
+	s := NewStats(
+		",arch=x86,config=8888,",
+		",arch=x86,config=565,",
+		",arch=x86,config=8888,gpu=nvidia,",
+	)
+	s.AddParams(Params{"arch": "x86", "config": "8888"})
+
+	assert.Equal(t, 4, s.Total)
+	assert.Equal(t, 3, s.Count("config", "8888"))
+	assert.Equal(t, 1, s.Count("config", "565"))
+	assert.Equal(t, 0, s.Count("config", "gpu"))
+	assert.Equal(t, 0, s.Count("unknown", "gpu"))
+	assert.Equal(t, 2, s.Cardinality("config"))
+	assert.Equal(t, 1, s.Cardinality("arch"))
+	assert.Equal(t, 0, s.Cardinality("unknown"))
+	assert.Equal(t, 3, s.Missing("gpu"))
+	assert.Equal(t, 0, s.Missing("arch"))
+
+	assert.Equal(t, ParamSet{
+		"arch":   {"x86"},
+		"config": {"565", "8888"},
+		"gpu":    {"nvidia"},
+	}, s.ParamSet())
+
+	// arch has the same value for every trace.
+	assert.Equal(t, []string{"config", "gpu"}, s.Splits())
+
+	assert.Equal(t, []KeyStats{
+		{
+			Key:    "arch",
+			Values: []ValueCount{{Value: "x86", Count: 4}},
+		},
+		{
+			Key:    "config",
+			Values: []ValueCount{{Value: "8888", Count: 3}, {Value: "565", Count: 1}},
+		},
+		{
+			Key:     "gpu",
+			Values:  []ValueCount{{Value: "nvidia", Count: 1}},
+			Missing: 3,
+		},
+	}, s.KeyStats())
+
+	s.Add(",config=gpu,")
+	assert.Equal(t, 5, s.Total)
+	assert.Equal(t, 1, s.Missing("arch"))
+	assert.Equal(t, []string{"arch", "config", "gpu"}, s.Splits())
+}
+
+func TestStatsEmpty(t *testing.T) {
+	testutils.SmallTest(t)
+	s := NewStats()
+	assert.Equal(t, 0, s.Total)
+	assert.Equal(t, ParamSet{}, s.ParamSet())
+	assert.Equal(t, []string{}, s.Splits())
+	assert.Equal(t, []KeyStats{}, s.KeyStats())
+}
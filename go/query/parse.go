@@ -0,0 +1,237 @@
+package query
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// Text operators used in Parse and Query.String.
+const (
+	OR_OP  = "OR"
+	AND_OP = "AND"
+)
+
+// termOps are the operators allowed in a single term of the text form, longest
+// first so that ">=" is found before ">".
+var termOps = []string{">=", "<=", "!=", "~=", ">", "<", "="}
+
+// Parse parses the text form of a query, for example:
+//
+//	config=8888 OR (config=gpu AND arch=arm)
+//
+// A query is one or more groups separated by OR, and a key matches the query
+// if it matches any group. A group is one or more terms separated by AND,
+// optionally wrapped in parens. Each term is a parameter name, an operator
+// and a value:
+//
+//	config=565,8888    The value is one of '565' or '8888'.
+//	config=*           The parameter is present with any value.
+//	config!=565,8888   The value is neither '565' nor '8888'.
+//	arch~=^x           The value matches the regular expression '^x'.
+//	os_version>=10     The value is numerically >= 10, also >, < and <=.
+//
+// Each parameter may only appear once in a group, except for numeric
+// comparisons, which can be combined to give a range, e.g.
+// "os_version>=10 AND os_version<12".
+//
+// See Query.String for the inverse.
+func Parse(s string) (*Query, error) {
+	v, err := ParseValues(s)
+	if err != nil {
+		return nil, err
+	}
+	return New(v)
+}
+
+// ParseValues parses the text form of a query, see Parse, and returns it in
+// the url.Values form accepted by New.
+func ParseValues(s string) (url.Values, error) {
+	tokens := tokenize(s)
+	ret := url.Values{}
+	group := 0
+	for len(tokens) > 0 {
+		if group > 0 {
+			if !strings.EqualFold(tokens[0], OR_OP) {
+				return nil, fmt.Errorf("Expected %s between groups, found %q", OR_OP, tokens[0])
+			}
+			tokens = tokens[1:]
+		}
+		terms, rest, err := parseGroup(tokens)
+		if err != nil {
+			return nil, err
+		}
+		tokens = rest
+		prefix := ""
+		if group > 0 {
+			prefix = fmt.Sprintf("%d%s", group, GROUP_SEPARATOR)
+		}
+		for key, values := range terms {
+			ret[prefix+key] = values
+		}
+		group += 1
+	}
+	return ret, nil
+}
+
+// tokenize splits the text form of a query into terms, keywords and parens.
+func tokenize(s string) []string {
+	ret := []string{}
+	for _, word := range strings.FieldsFunc(s, unicode.IsSpace) {
+		for strings.HasPrefix(word, "(") {
+			ret = append(ret, "(")
+			word = word[1:]
+		}
+		// Only split off trailing parens that aren't balanced within the word,
+		// so that regexes such as "arch~=^(x86|arm)" are left intact.
+		closing := 0
+		for strings.HasSuffix(word, ")") && strings.Count(word, ")") > strings.Count(word, "(") {
+			word = word[:len(word)-1]
+			closing += 1
+		}
+		if word != "" {
+			ret = append(ret, word)
+		}
+		for i := 0; i < closing; i++ {
+			ret = append(ret, ")")
+		}
+	}
+	return ret
+}
+
+// parseGroup parses a single group from the start of tokens, returning the
+// group in url.Values form and the remaining tokens.
+func parseGroup(tokens []string) (url.Values, []string, error) {
+	parens := len(tokens) > 0 && tokens[0] == "("
+	if parens {
+		tokens = tokens[1:]
+	}
+	ret := url.Values{}
+	for {
+		if len(tokens) == 0 {
+			return nil, nil, fmt.Errorf("Expected a term at the end of the query.")
+		}
+		key, values, err := parseTerm(tokens[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		tokens = tokens[1:]
+		if existing, ok := ret[key]; ok {
+			if !isComparison(existing) || !isComparison(values) {
+				return nil, nil, fmt.Errorf("Parameter %q appears more than once in a group.", key)
+			}
+		}
+		ret[key] = append(ret[key], values...)
+		if len(tokens) == 0 || !strings.EqualFold(tokens[0], AND_OP) {
+			break
+		}
+		tokens = tokens[1:]
+	}
+	if parens {
+		if len(tokens) == 0 || tokens[0] != ")" {
+			return nil, nil, fmt.Errorf("Missing ')' at the end of a group.")
+		}
+		tokens = tokens[1:]
+	}
+	return ret, tokens, nil
+}
+
+// isComparison returns true if the url.Values values are numeric comparisons.
+func isComparison(values []string) bool {
+	for _, v := range values {
+		if _, ok, _ := parseComparison(v); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTerm parses a single term, such as "config!=565,8888", into the
+// parameter name and the values in url.Values form.
+func parseTerm(term string) (string, []string, error) {
+	end := 0
+	for end < len(term) && paramRe.MatchString(term[end:end+1]) {
+		end += 1
+	}
+	key := term[:end]
+	if key == "" {
+		return "", nil, fmt.Errorf("Invalid term, must begin with a parameter name: %q", term)
+	}
+	op := ""
+	for _, o := range termOps {
+		if strings.HasPrefix(term[end:], o) {
+			op = o
+			break
+		}
+	}
+	if op == "" {
+		return "", nil, fmt.Errorf("Invalid term, no operator found: %q", term)
+	}
+	value := term[end+len(op):]
+	if value == "" {
+		return "", nil, fmt.Errorf("Invalid term, no value found: %q", term)
+	}
+	switch op {
+	case "~=":
+		return key, []string{"~" + value}, nil
+	case "=", "!=":
+		if value == "*" && op == "=" {
+			return key, []string{"*"}, nil
+		}
+		values := strings.Split(value, ",")
+		for i, v := range values {
+			if !paramRe.MatchString(v) {
+				return "", nil, fmt.Errorf("Invalid value %q in term %q", v, term)
+			}
+			if op == "!=" {
+				values[i] = "!" + v
+			}
+		}
+		return key, values, nil
+	default:
+		v := op + value
+		if _, _, err := parseComparison(v); err != nil {
+			return "", nil, err
+		}
+		return key, []string{v}, nil
+	}
+}
+
+// formatParam returns the terms in the text form of a single queryParam.
+func formatParam(p queryParam) []string {
+	switch {
+	case p.isWildCard:
+		return []string{p.key + "=*"}
+	case p.isRegex:
+		return []string{p.key + "~=" + p.raw[0][1:]}
+	case p.isCompare:
+		ret := make([]string, 0, len(p.raw))
+		for _, v := range p.raw {
+			ret = append(ret, p.key+v)
+		}
+		return ret
+	case p.isNegative:
+		return []string{p.key + "!=" + strings.Join(p.values, ",")}
+	default:
+		return []string{p.key + "=" + strings.Join(p.values, ",")}
+	}
+}
+
+// String returns the text form of the Query, see Parse.
+func (q *Query) String() string {
+	groups := append([][]queryParam{q.params}, q.or...)
+	ret := make([]string, 0, len(groups))
+	for _, params := range groups {
+		terms := []string{}
+		for _, p := range params {
+			terms = append(terms, formatParam(p)...)
+		}
+		s := strings.Join(terms, " "+AND_OP+" ")
+		if len(groups) > 1 && len(terms) > 1 {
+			s = "(" + s + ")"
+		}
+		ret = append(ret, s)
+	}
+	return strings.Join(ret, " "+OR_OP+" ")
+}
@@ -0,0 +1,106 @@
+package query
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.skia.org/infra/go/testutils"
+)
+
+func TestParse(t *testing.T) {
+	testutils.SmallTest(t)
+	testCases := []struct {
+		input  string
+		values url.Values
+		text   string
+	}{
+		{
+			input:  "",
+			values: url.Values{},
+			text:   "",
+		},
+		{
+			input:  "config=565,8888",
+			values: url.Values{"config": []string{"565", "8888"}},
+			text:   "config=565,8888",
+		},
+		{
+			input:  "config!=565 and arch~=^(x86|arm) AND debug=*",
+			values: url.Values{"config": []string{"!565"}, "arch": []string{"~^(x86|arm)"}, "debug": []string{"*"}},
+			text:   "arch~=^(x86|arm) AND config!=565 AND debug=*",
+		},
+		{
+			input:  "config=8888 OR (config=gpu AND arch=arm)",
+			values: url.Values{"config": []string{"8888"}, "1:config": []string{"gpu"}, "1:arch": []string{"arm"}},
+			text:   "config=8888 OR (arch=arm AND config=gpu)",
+		},
+		{
+			input:  "(os_version>=10 AND os_version<12) or (arch~=^(x86|arm))",
+			values: url.Values{"os_version": []string{">=10", "<12"}, "1:arch": []string{"~^(x86|arm)"}},
+			text:   "(os_version>=10 AND os_version<12) OR arch~=^(x86|arm)",
+		},
+	}
+	for _, tc := range testCases {
+		v, err := ParseValues(tc.input)
+		assert.NoError(t, err, tc.input)
+		assert.Equal(t, tc.values, v, tc.input)
+
+		q, err := Parse(tc.input)
+		assert.NoError(t, err, tc.input)
+		assert.Equal(t, tc.text, q.String(), tc.input)
+		assert.Equal(t, tc.values, q.Values(), tc.input)
+
+		// The text form round trips.
+		q2, err := Parse(q.String())
+		assert.NoError(t, err, tc.input)
+		assert.Equal(t, q.Values(), q2.Values(), tc.input)
+	}
+}
+
+func TestParseMatches(t *testing.T) {
+	testutils.SmallTest(t)
+	q, err := Parse("config=8888 OR (config=gpu AND arch=arm AND os_version>=10)")
+	assert.NoError(t, err)
+	assert.True(t, q.Matches(",arch=x86,config=8888,"))
+	assert.True(t, q.Matches(",arch=arm,config=gpu,os_version=11,"))
+	assert.False(t, q.Matches(",arch=arm,config=gpu,os_version=9,"))
+	assert.False(t, q.Matches(",arch=x86,config=gpu,os_version=11,"))
+}
+
+func TestParseErrors(t *testing.T) {
+	testutils.SmallTest(t)
+	testCases := []string{
+		"config",
+		"config=",
+		"=8888",
+		"config=8888 AND",
+		"config=8888 config=gpu",
+		"config=8888 OR",
+		"(config=8888",
+		"config=8888 AND config=gpu",
+		"config=88 88",
+		"config=!8888",
+		"os_version>=ten",
+		"os_version>=10 AND os_version=12",
+		"arch~=(",
+	}
+	for _, tc := range testCases {
+		_, err := Parse(tc)
+		assert.Error(t, err, tc)
+	}
+}
+
+func TestValuesRoundTrip(t *testing.T) {
+	testutils.SmallTest(t)
+	v := url.Values{
+		"config":       []string{"!565", "8888"},
+		"extra_config": []string{"*"},
+		"1:arch":       []string{"~^x"},
+		"1:os_version": []string{"<=7"},
+	}
+	q, err := New(v)
+	assert.NoError(t, err)
+	assert.Equal(t, v, q.Values())
+	assert.Equal(t, "(config!=565,8888 AND extra_config=*) OR (arch~=^x AND os_version<=7)", q.String())
+}
@@ -26,6 +26,7 @@ import (
 	"net/url"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 
 	"go.skia.org/infra/go/util"
@@ -136,15 +137,65 @@ func ParseKey(key string) (map[string]string, error) {
 	return ret, nil
 }
 
+// GROUP_SEPARATOR separates the group number from the parameter name in
+// url.Values keys for all but the first OR group of a Query, e.g. the key
+// "1:config" is the "config" parameter of the second group. Since ':' isn't a
+// valid char in a parameter name there is no ambiguity.
+const GROUP_SEPARATOR = ":"
+
+// comparisonOps are the numeric comparison operators that can prefix a
+// parameter value, longest first so that ">=" is found before ">".
+var comparisonOps = []string{">=", "<=", ">", "<"}
+
+// comparison is a single numeric comparison against a parameter value.
+type comparison struct {
+	op    string
+	value float64
+}
+
+// matches returns true if x satisfies the comparison.
+func (c comparison) matches(x float64) bool {
+	switch c.op {
+	case ">=":
+		return x >= c.value
+	case "<=":
+		return x <= c.value
+	case ">":
+		return x > c.value
+	case "<":
+		return x < c.value
+	}
+	return false
+}
+
+// parseComparison parses a value of the form ">=10". The returned bool is
+// false if the value doesn't begin with a comparison operator.
+func parseComparison(v string) (comparison, bool, error) {
+	for _, op := range comparisonOps {
+		if strings.HasPrefix(v, op) {
+			f, err := strconv.ParseFloat(v[len(op):], 64)
+			if err != nil {
+				return comparison{}, true, fmt.Errorf("Invalid number in comparison %q: %s", v, err)
+			}
+			return comparison{op: op, value: f}, true, nil
+		}
+	}
+	return comparison{}, false, nil
+}
+
 // queryParam represents a query on a particular parameter in a key.
 type queryParam struct {
+	key         string         // The param key.
+	raw         []string       // The param values as passed to New.
 	keyMatch    string         // The param key, including the leading "," and trailing "=".
 	keyMatchLen int            // The length of keyMatch.
 	isWildCard  bool           // True if this is a wildcard value match.
 	isRegex     bool           // True if this is a regex value match.
 	isNegative  bool           // True if this is a negative value match.
+	isCompare   bool           // True if this is a numeric comparison match.
 	values      []string       // The potential matches for the value.
 	reg         *regexp.Regexp // The regexp to match against, if a regexp search.
+	compares    []comparison   // The comparisons that must all hold, if a numeric comparison.
 }
 
 // Query represents a query against a key, i.e. Query.Matches can return true
@@ -175,6 +226,17 @@ type queryParam struct {
 //
 //		q := New(url.Values{"arch": []string{"~^x"}})
 //
+// If every parameter value begins with one of '>', '>=', '<' or '<=' then the
+// value is compared numerically and all the comparisons must hold. I.e. this
+// will match all keys with an 'os_version' from 10 up to, but not including, 12:
+//
+//		q := New(url.Values{"os_version": []string{">=10", "<12"}})
+//
+// Keys of the form "N:name", where N is a number, put that parameter into
+// the N-th OR group, and a key matches the Query if it matches any group. I.e.
+// this will match config=8888, or config=gpu on arm:
+//
+//		q := New(url.Values{"config": []string{"8888"}, "1:config": []string{"gpu"}, "1:arch": []string{"arm"}})
 //
 // Here is more complex example that matches all tests that have the 'name'
 // parameter with a value of 'desk_nytimes.skp', a 'config' param that does not
@@ -185,14 +247,70 @@ type queryParam struct {
 //        "config": []string{"!565", "8888"},
 //        "extra_config": []string{"*"}})
 //
+// See Parse for a textual form of queries.
 type Query struct {
 	// These are in alphabetical order of parameter name.
 	params []queryParam
+
+	// or are the params of the additional OR groups, each in alphabetical
+	// order of parameter name.
+	or [][]queryParam
+}
+
+// splitGroupKey splits a url.Values key into the OR group number and the
+// parameter name.
+func splitGroupKey(key string) (int, string, error) {
+	parts := strings.SplitN(key, GROUP_SEPARATOR, 2)
+	if len(parts) == 1 {
+		return 0, key, nil
+	}
+	group, err := strconv.Atoi(parts[0])
+	if err != nil || group < 0 {
+		return 0, "", fmt.Errorf("Invalid group in query key %q", key)
+	}
+	return group, parts[1], nil
 }
 
 // New creates a Query from the given url.Values. It represents a query to be
 // used against keys.
 func New(q url.Values) (*Query, error) {
+	groups := map[int]url.Values{}
+	for key, values := range q {
+		group, name, err := splitGroupKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := groups[group]; !ok {
+			groups[group] = url.Values{}
+		}
+		groups[group][name] = values
+	}
+	indices := make([]int, 0, len(groups))
+	for group := range groups {
+		indices = append(indices, group)
+	}
+	sort.Ints(indices)
+
+	ret := &Query{
+		params: []queryParam{},
+		or:     [][]queryParam{},
+	}
+	for i, group := range indices {
+		params, err := newParams(groups[group])
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			ret.params = params
+		} else {
+			ret.or = append(ret.or, params)
+		}
+	}
+	return ret, nil
+}
+
+// newParams creates the queryParams for a single OR group.
+func newParams(q url.Values) ([]queryParam, error) {
 	keys := make([]string, 0, len(q))
 	for k := range q {
 		keys = append(keys, k)
@@ -205,15 +323,17 @@ func New(q url.Values) (*Query, error) {
 		isWildCard := false
 		isRegex := false
 		isNegative := false
+		isCompare := false
 		values := q[key]
 		var reg *regexp.Regexp
+		var compares []comparison
 		var err error
 		// Is this param query a wildcard?
 		if len(q[key]) == 1 {
 			if q[key][0] == "*" {
 				isWildCard = true
 			}
-			if q[key][0][:1] == "~" {
+			if strings.HasPrefix(q[key][0], "~") {
 				isRegex = true
 				reg, err = regexp.Compile(q[key][0][1:])
 				if err != nil {
@@ -235,28 +355,59 @@ func New(q url.Values) (*Query, error) {
 				}
 			}
 		}
+		// Is this param query a numeric comparison?
+		for _, v := range q[key] {
+			c, ok, err := parseComparison(v)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				isCompare = true
+				compares = append(compares, c)
+			}
+		}
+		if isCompare && len(compares) != len(q[key]) {
+			return nil, fmt.Errorf("Can't mix comparisons with other values for %q: %q", key, q[key])
+		}
 		params = append(params, queryParam{
+			key:         key,
+			raw:         q[key],
 			keyMatch:    keyMatch,
 			keyMatchLen: len(keyMatch),
 			isWildCard:  isWildCard,
 			isRegex:     isRegex,
 			isNegative:  isNegative,
+			isCompare:   isCompare,
 			values:      values,
 			reg:         reg,
+			compares:    compares,
 		})
 	}
 
-	return &Query{params: params}, nil
+	return params, nil
 }
 
 // Matches returns true if the given structured key matches the query.
 func (q *Query) Matches(s string) bool {
-	// Search forward in the given structured key. Since q.params are in
+	if matches(q.params, s) {
+		return true
+	}
+	for _, params := range q.or {
+		if matches(params, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches returns true if the given structured key matches all the params.
+func matches(params []queryParam, s string) bool {
+	// Search forward in the given structured key. Since params are in
 	// alphabetical order and structured keys have their params in alphabetical
 	// order we can always search forward in the structured key, i.e. once
 	// we've matched to a certain index in the string we can shorten the string
 	// and only search the remaining chars.
-	for _, part := range q.params {
+	for _, part := range params {
 		//  First find the key.
 		keyIndex := strings.Index(s, part.keyMatch)
 		if keyIndex == -1 {
@@ -269,12 +420,7 @@ func (q *Query) Matches(s string) bool {
 		}
 		// Extract the value string.
 		valueIndex := strings.Index(s, ",")
-		value := s[:valueIndex]
-		if part.isRegex {
-			if !part.reg.MatchString(value) {
-				return false
-			}
-		} else if part.isNegative == util.In(value, part.values) {
+		if !part.matchesValue(s[:valueIndex]) {
 			return false
 		}
 		// Truncate to the value.
@@ -282,3 +428,73 @@ func (q *Query) Matches(s string) bool {
 	}
 	return true
 }
+
+// matchesValue returns true if the given parameter value matches this param.
+func (part queryParam) matchesValue(value string) bool {
+	if part.isWildCard {
+		return true
+	} else if part.isRegex {
+		return part.reg.MatchString(value)
+	} else if part.isCompare {
+		x, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return false
+		}
+		for _, c := range part.compares {
+			if !c.matches(x) {
+				return false
+			}
+		}
+		return true
+	}
+	return part.isNegative != util.In(value, part.values)
+}
+
+// Groups returns each OR group of the Query as a Query of its own, i.e. a key
+// matches the Query if it matches any of the returned Queries.
+func (q *Query) Groups() []*Query {
+	ret := []*Query{{params: q.params, or: [][]queryParam{}}}
+	for _, params := range q.or {
+		ret = append(ret, &Query{params: params, or: [][]queryParam{}})
+	}
+	return ret
+}
+
+// Keys returns the sorted parameter names that appear in the first OR group
+// of the Query. Use Groups to get the keys of all the groups.
+func (q *Query) Keys() []string {
+	ret := make([]string, 0, len(q.params))
+	for _, p := range q.params {
+		ret = append(ret, p.key)
+	}
+	return ret
+}
+
+// MatchesValue returns true if the given value of the parameter named key
+// could appear in a key that matches the first OR group of the Query. It
+// returns true for any value if the group doesn't mention key.
+func (q *Query) MatchesValue(key, value string) bool {
+	for _, p := range q.params {
+		if p.key == key {
+			return p.matchesValue(value)
+		}
+	}
+	return true
+}
+
+// Values returns the Query in url.Values form, i.e. New(q.Values()) returns
+// an equivalent Query.
+func (q *Query) Values() url.Values {
+	ret := url.Values{}
+	groups := append([][]queryParam{q.params}, q.or...)
+	for i, params := range groups {
+		prefix := ""
+		if i > 0 {
+			prefix = fmt.Sprintf("%d%s", i, GROUP_SEPARATOR)
+		}
+		for _, p := range params {
+			ret[prefix+p.key] = append([]string{}, p.raw...)
+		}
+	}
+	return ret
+}
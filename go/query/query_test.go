@@ -171,6 +171,21 @@ func TestNew(t *testing.T) {
 	q, err = New(url.Values{})
 	assert.NoError(t, err)
 	assert.Equal(t, 0, len(q.params))
+
+	q, err = New(url.Values{"os_version": []string{">=10", "<12"}, "1:config": []string{"gpu"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(q.params))
+	assert.Equal(t, true, q.params[0].isCompare)
+	assert.Equal(t, []comparison{{op: ">=", value: 10}, {op: "<", value: 12}}, q.params[0].compares)
+	assert.Equal(t, 1, len(q.or))
+	assert.Equal(t, ",config=", q.or[0][0].keyMatch)
+
+	_, err = New(url.Values{"os_version": []string{">=10", "12"}})
+	assert.Error(t, err)
+	_, err = New(url.Values{"os_version": []string{">=ten"}})
+	assert.Error(t, err)
+	_, err = New(url.Values{"x:config": []string{"gpu"}})
+	assert.Error(t, err)
 }
 
 func TestMatches(t *testing.T) {
@@ -301,6 +316,48 @@ func TestMatches(t *testing.T) {
 			matches: false,
 			reason:  "Negative, wildcard, and miss regexp",
 		},
+		{
+			key:     ",arch=x86,config=8888,os_version=10.1,",
+			query:   url.Values{"os_version": []string{">=10", "<12"}},
+			matches: true,
+			reason:  "Numeric range",
+		},
+		{
+			key:     ",arch=x86,config=8888,os_version=12,",
+			query:   url.Values{"os_version": []string{">=10", "<12"}},
+			matches: false,
+			reason:  "Numeric range miss",
+		},
+		{
+			key:     ",arch=x86,config=8888,os_version=Lollipop,",
+			query:   url.Values{"os_version": []string{">0"}},
+			matches: false,
+			reason:  "Numeric comparison of a non-numeric value",
+		},
+		{
+			key:     ",arch=arm,config=gpu,",
+			query:   url.Values{"config": []string{"8888"}, "1:arch": []string{"arm"}, "1:config": []string{"gpu"}},
+			matches: true,
+			reason:  "OR group match",
+		},
+		{
+			key:     ",arch=x86,config=gpu,",
+			query:   url.Values{"config": []string{"8888"}, "1:arch": []string{"arm"}, "1:config": []string{"gpu"}},
+			matches: false,
+			reason:  "OR group miss",
+		},
+		{
+			key:     ",arch=x86,config=8888,",
+			query:   url.Values{"config": []string{"8888"}, "1:arch": []string{"arm"}, "1:config": []string{"gpu"}},
+			matches: true,
+			reason:  "OR first group match",
+		},
+		{
+			key:     ",arch=x86,config=8888,",
+			query:   url.Values{"2:config": []string{"8888"}},
+			matches: true,
+			reason:  "Groups are renumbered",
+		},
 	}
 	for _, tc := range testCases {
 		q, err := New(tc.query)
@@ -393,3 +450,33 @@ func TestForceValue(t *testing.T) {
 		}
 	}
 }
+
+func TestGroups(t *testing.T) {
+	testutils.SmallTest(t)
+	q, err := Parse("(config=565 AND arch~=^x) OR os_version>=10 OR gpu!=nvidia")
+	assert.NoError(t, err)
+
+	groups := q.Groups()
+	assert.Equal(t, 3, len(groups))
+	assert.Equal(t, []string{"arch", "config"}, groups[0].Keys())
+	assert.Equal(t, []string{"os_version"}, groups[1].Keys())
+	assert.Equal(t, []string{"gpu"}, groups[2].Keys())
+	assert.Equal(t, groups[0].Keys(), q.Keys())
+
+	assert.True(t, q.MatchesValue("config", "565"))
+	assert.False(t, q.MatchesValue("config", "8888"))
+	assert.True(t, q.MatchesValue("arch", "x86"))
+	assert.False(t, q.MatchesValue("arch", "arm"))
+	assert.True(t, q.MatchesValue("unknown", "anything"))
+
+	assert.True(t, groups[1].MatchesValue("os_version", "10"))
+	assert.False(t, groups[1].MatchesValue("os_version", "9"))
+	assert.False(t, groups[1].MatchesValue("os_version", "not-a-number"))
+	assert.True(t, groups[2].MatchesValue("gpu", "amd"))
+	assert.False(t, groups[2].MatchesValue("gpu", "nvidia"))
+
+	// Each group matches on its own.
+	assert.True(t, groups[1].Matches(",os_version=11,"))
+	assert.False(t, groups[0].Matches(",os_version=11,"))
+	assert.True(t, q.Matches(",os_version=11,"))
+}
@@ -28,6 +28,7 @@ import (
 	"go.skia.org/infra/go/common"
 	"go.skia.org/infra/go/database"
 	"go.skia.org/infra/go/ds"
+	"go.skia.org/infra/go/email"
 	"go.skia.org/infra/go/eventbus"
 	"go.skia.org/infra/go/gerrit"
 	"go.skia.org/infra/go/gevent"
@@ -41,6 +42,7 @@ import (
 	"go.skia.org/infra/go/timer"
 	tracedb "go.skia.org/infra/go/trace/db"
 	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/golden/go/autotriage"
 	"go.skia.org/infra/golden/go/db"
 	"go.skia.org/infra/golden/go/diff"
 	"go.skia.org/infra/golden/go/diffstore"
@@ -64,18 +66,26 @@ const (
 
 	// WHITELIST_ALL can be provided as the value for the whitelist file to whitelist all configurations
 	WHITELIST_ALL = "all"
+
+	// GMAIL_TOKEN_CACHE_FILE is the file in storage_dir that caches the token
+	// used to send emails.
+	GMAIL_TOKEN_CACHE_FILE = "google_email_token.data"
 )
 
 // Command line flags.
 var (
 	appTitle            = flag.String("app_title", "Skia Gold", "Title of the deployed up on the front end.")
 	authWhiteList       = flag.String("auth_whitelist", login.DEFAULT_DOMAIN_WHITELIST, "White space separated list of domains and email addresses that are allowed to login.")
+	autoTriageRules     = flag.String("auto_triage_rules", "", "File name of a JSON5 file that contains a list of rules for automatically marking digests as positive. If empty no digests are auto-triaged.")
 	cacheSize           = flag.Int("cache_size", 1, "Approximate cachesize used to cache images and diff metrics in GiB. This is just a way to limit caching. 0 means no caching at all. Use default for testing.")
 	cpuProfile          = flag.Duration("cpu_profile", 0, "Duration for which to profile the CPU usage. After this duration the program writes the CPU profile and exits.")
 	defaultCorpus       = flag.String("default_corpus", "gm", "The corpus identifier shown by default on the frontend.")
 	diffServerGRPCAddr  = flag.String("diff_server_grpc", "", "The grpc port of the diff server. 'diff_server_http also needs to be set.")
 	diffServerImageAddr = flag.String("diff_server_http", "", "The images serving address of the diff server. 'diff_server_grpc has to be set as well.")
 	dsNamespace         = flag.String("ds_namespace", "", "Cloud datastore namespace to be used by this instance.")
+	emailClientID       = flag.String("email_clientid", "", "OAuth Client ID for sending email. Only used when local=true.")
+	emailClientSecret   = flag.String("email_clientsecret", "", "OAuth Client Secret for sending email. Only used when local=true.")
+	emailExpired        = flag.Bool("email_expired_ignores", false, "Send emails to the authors of expired ignore rules. Only one instance per database should set this.")
 	eventTopic          = flag.String("event_topic", "", "The pubsub topic to use for distributed events.")
 	forceLogin          = flag.Bool("force_login", true, "Force the user to be authenticated for all requests.")
 	gsBucketNames       = flag.String("gs_buckets", "skia-infra-gm,chromium-skia-gm", "Comma-separated list of google storage bucket that hold uploaded images.")
@@ -337,6 +347,17 @@ func main() {
 		Git:               git,
 	}
 
+	// Load the auto-triage rules if there are any.
+	if *autoTriageRules != "" {
+		rules, err := autotriage.LoadRules(*autoTriageRules)
+		if err != nil {
+			sklog.Fatalf("Unable to load auto-triage rules: %s", err)
+		}
+		if storages.AutoTriager, err = autotriage.New(rules, storages.ExpectationsStore, storages.DiffStore); err != nil {
+			sklog.Fatalf("Invalid auto-triage rules: %s", err)
+		}
+	}
+
 	// Load the whitelist if there is one and disable querying for issues.
 	if *pubWhiteList != "" && *pubWhiteList != WHITELIST_ALL {
 		if err := storages.LoadWhiteList(*pubWhiteList); err != nil {
@@ -354,7 +375,11 @@ func main() {
 
 	// TODO(stephana): Remove this workaround to avoid circular dependencies once the 'storage' module is cleaned up.
 	storages.IgnoreStore = ignore.NewSQLIgnoreStore(vdb, storages.ExpectationsStore, storages.GetTileStreamNow(time.Minute))
-	if err := ignore.Init(storages.IgnoreStore); err != nil {
+	var emailAuth ignore.Email
+	if *emailExpired {
+		emailAuth = newGMail()
+	}
+	if err := ignore.Init(storages.IgnoreStore, emailAuth, siteURL); err != nil {
 		sklog.Fatalf("Failed to start monitoring for expired ignore rules: %s", err)
 	}
 
@@ -427,6 +452,7 @@ func main() {
 	router.HandleFunc("/json/export", handlers.JsonExportHandler).Methods("GET")
 	router.HandleFunc("/json/tryjob", handlers.JsonTryjobListHandler).Methods("GET")
 	router.HandleFunc("/json/tryjob/{id}", handlers.JsonTryjobSummaryHandler).Methods("GET")
+	router.HandleFunc("/json/tryjob/{id}/conflicts", handlers.JsonTryjobMergeConflictsHandler).Methods("GET")
 
 	// Retrieving that baseline for master and an Gerrit issue are handled the same way
 	router.HandleFunc(web.BASELINE_ROUTE, handlers.JsonBaselineHandler).Methods("GET")
@@ -439,6 +465,7 @@ func main() {
 		router.HandleFunc("/json/ignores/add/", handlers.JsonIgnoresAddHandler).Methods("POST")
 		router.HandleFunc("/json/ignores/del/{id}", handlers.JsonIgnoresDeleteHandler).Methods("POST")
 		router.HandleFunc("/json/ignores/save/{id}", handlers.JsonIgnoresUpdateHandler).Methods("POST")
+		router.HandleFunc("/json/ignores/preview", handlers.JsonIgnoresPreviewHandler).Methods("POST")
 	}
 
 	// For everything else serve the same markup.
@@ -510,3 +537,27 @@ func main() {
 	sklog.Infof("Serving on http://127.0.0.1" + *port)
 	sklog.Fatal(http.ListenAndServe(*port, externalHandler))
 }
+
+// newGMail returns an authenticated GMail client that is used to notify the
+// authors of expired ignore rules.
+func newGMail() *email.GMail {
+	clientID, clientSecret := *emailClientID, *emailClientSecret
+	tokenFile := filepath.Join(*storageDir, GMAIL_TOKEN_CACHE_FILE)
+	if !*local {
+		clientID = metadata.Must(metadata.ProjectGet(metadata.GMAIL_CLIENT_ID))
+		clientSecret = metadata.Must(metadata.ProjectGet(metadata.GMAIL_CLIENT_SECRET))
+		cachedGMailToken := metadata.Must(metadata.ProjectGet(metadata.GMAIL_CACHED_TOKEN))
+		if err := ioutil.WriteFile(tokenFile, []byte(cachedGMailToken), os.ModePerm); err != nil {
+			sklog.Fatalf("Failed to cache token: %s", err)
+		}
+	}
+
+	if *local && (clientID == "" || clientSecret == "") {
+		sklog.Fatal("If -local, -email_expired_ignores requires -email_clientid and -email_clientsecret")
+	}
+	gmail, err := email.NewGMail(clientID, clientSecret, tokenFile)
+	if err != nil {
+		sklog.Fatalf("Failed to create email auth: %s", err)
+	}
+	return gmail
+}
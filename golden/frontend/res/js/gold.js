@@ -24,10 +24,16 @@ var gold = gold || {};
 	gold.METRIC_COMBINED = 'combined';
 	gold.METRIC_PERCENT  = 'percent';
 	gold.METRIC_PIXEL    = 'pixel';
+	gold.METRIC_SSIM     = 'ssim';
+	gold.METRIC_CIEDE2000 = 'ciede2000';
+	gold.METRIC_AA_PIXEL = 'aaPixel';
   gold.allMetrics = [
     gold.METRIC_COMBINED,
     gold.METRIC_PERCENT,
     gold.METRIC_PIXEL,
+    gold.METRIC_SSIM,
+    gold.METRIC_CIEDE2000,
+    gold.METRIC_AA_PIXEL,
   ];
 
   // Default values for match selection.
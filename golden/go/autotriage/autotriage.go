@@ -0,0 +1,302 @@
+// Package autotriage automatically marks untriaged digests as positive if they
+// are sufficiently close to a digest that is already positive.
+package autotriage
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/flynn/json5"
+
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/tiling"
+	"go.skia.org/infra/go/timer"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/golden/go/diff"
+	"go.skia.org/infra/golden/go/expstorage"
+	"go.skia.org/infra/golden/go/types"
+)
+
+const (
+	// AUTO_TRIAGE_USER is the user that is recorded in the triage log for
+	// changes made by the AutoTriager. These changes can be reverted via
+	// ExpectationsStore.UndoChange like any other change.
+	AUTO_TRIAGE_USER = "fuzzy-matcher"
+
+	// logPageSize is the number of triage log entries retrieved at once.
+	logPageSize = 500
+)
+
+// Rule defines when an untriaged digest is automatically marked as positive:
+// It is marked positive if there is a positive digest of the same test from
+// which it differs by at most MaxDiffPixels pixels and at most MaxChannelDelta
+// in every channel.
+type Rule struct {
+	// Query selects the traces the rule applies to, e.g. "name=mytest" for a
+	// single test or "source_type=gm&config=gpu" for a group of traces.
+	Query string `json:"query"`
+
+	// MaxDiffPixels is the maximum number of pixels that may differ from a
+	// positive digest.
+	MaxDiffPixels int `json:"maxDiffPixels"`
+
+	// MaxChannelDelta is the maximum difference of any RGBA channel of any
+	// pixel compared to a positive digest.
+	MaxChannelDelta int `json:"maxChannelDelta"`
+
+	// parsedQuery is Query parsed into url.Values.
+	parsedQuery url.Values
+}
+
+// accepts returns true if the given diff is within the limits of the rule.
+func (r *Rule) accepts(dm *diff.DiffMetrics) bool {
+	if dm.DimDiffer || dm.NumDiffPixels > r.MaxDiffPixels {
+		return false
+	}
+	for _, delta := range dm.MaxRGBADiffs {
+		if delta > r.MaxChannelDelta {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadRules reads a list of rules from the given JSON5 file.
+func LoadRules(fName string) ([]*Rule, error) {
+	f, err := os.Open(fName)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open file %s: %s", fName, err)
+	}
+	defer util.Close(f)
+
+	rules := []*Rule{}
+	if err := json5.NewDecoder(f).Decode(&rules); err != nil {
+		return nil, fmt.Errorf("Unable to decode rules in %s: %s", fName, err)
+	}
+	return rules, nil
+}
+
+// NearestFn returns the subset of candidates that are most likely to be
+// closest to the given digest of the given test, e.g.
+// indexer.SearchIndex.NearestDigests.
+type NearestFn func(test, digest string, candidates []string) []string
+
+// AutoTriager applies a list of rules to the untriaged digests in a tile.
+type AutoTriager struct {
+	rules     []*Rule
+	expStore  expstorage.ExpectationsStore
+	diffStore diff.DiffStore
+
+	// running is 1 while Run is in progress.
+	running int32
+
+	// mutex serializes calls to Triage and protects the fields below.
+	mutex sync.Mutex
+
+	// users is the user that made the latest change to each test/digest
+	// pair in the triage log, keyed by test name and digest.
+	users map[string]map[string]string
+
+	// logTS is the timestamp of the newest triage log entry in users.
+	logTS int64
+}
+
+// New returns a new AutoTriager for the given rules. When a digest matches
+// more than one rule, the first matching rule is applied.
+func New(rules []*Rule, expStore expstorage.ExpectationsStore, diffStore diff.DiffStore) (*AutoTriager, error) {
+	for _, r := range rules {
+		q, err := url.ParseQuery(r.Query)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid query %q in auto-triage rule: %s", r.Query, err)
+		}
+		if len(q) == 0 {
+			return nil, fmt.Errorf("Auto-triage rules must have a non-empty query.")
+		}
+		if r.MaxDiffPixels < 0 || r.MaxChannelDelta < 0 {
+			return nil, fmt.Errorf("Invalid limits in auto-triage rule %q.", r.Query)
+		}
+		r.parsedQuery = q
+	}
+	return &AutoTriager{
+		rules:     rules,
+		expStore:  expStore,
+		diffStore: diffStore,
+		users:     map[string]map[string]string{},
+	}, nil
+}
+
+// Run marks the untriaged digests in the given tile as positive if a rule
+// allows it. Changes are attributed to AUTO_TRIAGE_USER. If a previous call
+// to Run is still in progress, Run returns immediately. See Triage for nearest.
+func (a *AutoTriager) Run(tile *tiling.Tile, nearest NearestFn) error {
+	if !atomic.CompareAndSwapInt32(&a.running, 0, 1) {
+		sklog.Infof("Auto-triage is already running.")
+		return nil
+	}
+	defer atomic.StoreInt32(&a.running, 0)
+	defer timer.New("auto-triage").Stop()
+
+	exp, err := a.expStore.Get()
+	if err != nil {
+		return fmt.Errorf("Unable to retrieve expectations: %s", err)
+	}
+	changes, err := a.Triage(tile, exp, nearest)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	if err := a.expStore.AddChange(changes, AUTO_TRIAGE_USER); err != nil {
+		return fmt.Errorf("Unable to add auto-triaged expectations: %s", err)
+	}
+	sklog.Infof("Auto-triaged digests: %v", changes)
+	return nil
+}
+
+// Triage returns the untriaged digests in the given tile that should be
+// marked as positive according to the rules.
+//
+// Digests that appear in the triage log are never marked, since their label
+// was reset to untriaged deliberately, e.g. by undoing an auto-triage change.
+// Only digests that were marked positive by a human are used as references,
+// so that auto-triaged digests don't allow drifting away from them. If nearest
+// is not nil, each digest is only compared to the references it returns.
+func (a *AutoTriager) Triage(tile *tiling.Tile, exp *expstorage.Expectations, nearest NearestFn) (map[string]types.TestClassification, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if err := a.updateUsers(); err != nil {
+		return nil, err
+	}
+	lastUsers := a.users
+
+	// Find the rule that applies to each untriaged digest.
+	candidates := map[string]map[string]int{}
+	for _, trace := range tile.Traces {
+		ruleIdx := a.ruleFor(trace)
+		if ruleIdx == -1 {
+			continue
+		}
+		gTrace := trace.(*types.GoldenTrace)
+		testName := gTrace.Params_[types.PRIMARY_KEY_FIELD]
+		for _, digest := range gTrace.Values {
+			if digest == types.MISSING_DIGEST || exp.Classification(testName, digest) != types.UNTRIAGED {
+				continue
+			}
+			if _, ok := lastUsers[testName][digest]; ok {
+				continue
+			}
+			if candidates[testName] == nil {
+				candidates[testName] = map[string]int{}
+			}
+			if idx, ok := candidates[testName][digest]; !ok || ruleIdx < idx {
+				candidates[testName][digest] = ruleIdx
+			}
+		}
+	}
+
+	unavailable := a.diffStore.UnavailableDigests()
+	ret := map[string]types.TestClassification{}
+	for testName, digests := range candidates {
+		positives := []string{}
+		for digest, label := range exp.Tests[testName] {
+			if _, ok := unavailable[digest]; !ok && label == types.POSITIVE && lastUsers[testName][digest] != AUTO_TRIAGE_USER {
+				positives = append(positives, digest)
+			}
+		}
+		if len(positives) == 0 {
+			continue
+		}
+		sort.Strings(positives)
+
+		for digest, ruleIdx := range digests {
+			if _, ok := unavailable[digest]; ok {
+				continue
+			}
+			refs := positives
+			if nearest != nil {
+				refs = nearest(testName, digest, positives)
+			}
+			diffs, err := a.diffStore.Get(diff.PRIORITY_BACKGROUND, digest, refs)
+			if err != nil {
+				sklog.Errorf("Unable to diff %s against positive digests of %s: %s", digest, testName, err)
+				continue
+			}
+			for _, d := range diffs {
+				if a.rules[ruleIdx].accepts(d.(*diff.DiffMetrics)) {
+					if ret[testName] == nil {
+						ret[testName] = types.TestClassification{}
+					}
+					ret[testName][digest] = types.POSITIVE
+					break
+				}
+			}
+		}
+	}
+	return ret, nil
+}
+
+// updateUsers adds the triage log entries that were added since the last
+// call to a.users. Entries with the same timestamp as the newest entry seen
+// so far are retrieved again, since more of them may have been added. Must be
+// called with a.mutex held.
+func (a *AutoTriager) updateUsers() error {
+	newer := map[string]map[string]string{}
+	newestTS := a.logTS
+	offset := 0
+	for done := false; !done; {
+		// The log is sorted in reverse chronological order.
+		entries, total, err := a.expStore.QueryLog(offset, logPageSize, true)
+		if err != nil {
+			return fmt.Errorf("Unable to retrieve triage log: %s", err)
+		}
+		for _, entry := range entries {
+			if entry.TS < a.logTS {
+				done = true
+				break
+			}
+			if entry.TS > newestTS {
+				newestTS = entry.TS
+			}
+			for _, d := range entry.Details {
+				if _, ok := newer[d.TestName]; !ok {
+					newer[d.TestName] = map[string]string{}
+				}
+				if _, ok := newer[d.TestName][d.Digest]; !ok {
+					newer[d.TestName][d.Digest] = entry.Name
+				}
+			}
+		}
+		offset += len(entries)
+		if (len(entries) == 0) || (offset >= total) {
+			done = true
+		}
+	}
+
+	for testName, digests := range newer {
+		if _, ok := a.users[testName]; !ok {
+			a.users[testName] = map[string]string{}
+		}
+		for digest, user := range digests {
+			a.users[testName][digest] = user
+		}
+	}
+	a.logTS = newestTS
+	return nil
+}
+
+// ruleFor returns the index of the first rule that matches the given trace or
+// -1 if there is none.
+func (a *AutoTriager) ruleFor(trace tiling.Trace) int {
+	for i, r := range a.rules {
+		if tiling.Matches(trace, r.parsedQuery) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,264 @@
+package autotriage
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/jsonutils"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/go/tiling"
+	"go.skia.org/infra/golden/go/diff"
+	"go.skia.org/infra/golden/go/expstorage"
+	"go.skia.org/infra/golden/go/types"
+)
+
+// mockDiffStore returns the diff metrics stored for each digest, regardless of
+// the digest it is compared to.
+type mockDiffStore map[string]*diff.DiffMetrics
+
+func (m mockDiffStore) Get(priority int64, dMain string, dRest []string) (map[string]interface{}, error) {
+	ret := map[string]interface{}{}
+	for _, d := range dRest {
+		ret[d] = m[dMain]
+	}
+	return ret, nil
+}
+
+func (m mockDiffStore) ImageHandler(urlPrefix string) (http.Handler, error)                   { return nil, nil }
+func (m mockDiffStore) WarmDigests(priority int64, digests []string, sync bool)               {}
+func (m mockDiffStore) WarmDiffs(priority int64, leftDigests []string, rightDigests []string) {}
+func (m mockDiffStore) UnavailableDigests() map[string]*diff.DigestFailure                    { return nil }
+func (m mockDiffStore) PurgeDigests(digests []string, purgeGCS bool) error                    { return nil }
+
+// logExpStore is an in-memory ExpectationsStore that also keeps a triage log
+// and supports undoing changes.
+type logExpStore struct {
+	expstorage.ExpectationsStore
+	// log is sorted in reverse chronological order.
+	log []*expstorage.TriageLogEntry
+	// queries is the number of calls to QueryLog.
+	queries int
+}
+
+func newLogExpStore() *logExpStore {
+	return &logExpStore{ExpectationsStore: expstorage.NewMemExpectationsStore(nil)}
+}
+
+func (l *logExpStore) AddChange(changes map[string]types.TestClassification, userId string) error {
+	return l.addChange(changes, userId, 0)
+}
+
+func (l *logExpStore) addChange(changes map[string]types.TestClassification, userId string, undoChangeID int64) error {
+	if err := l.ExpectationsStore.AddChange(changes, userId); err != nil {
+		return err
+	}
+	entry := &expstorage.TriageLogEntry{
+		ID:           jsonutils.Number(len(l.log) + 1),
+		Name:         userId,
+		TS:           int64(len(l.log) + 1),
+		UndoChangeID: undoChangeID,
+	}
+	for testName, digests := range changes {
+		for digest, label := range digests {
+			entry.Details = append(entry.Details, &expstorage.TriageDetail{TestName: testName, Digest: digest, Label: label.String()})
+		}
+	}
+	entry.ChangeCount = len(entry.Details)
+	l.log = append([]*expstorage.TriageLogEntry{entry}, l.log...)
+	return nil
+}
+
+func (l *logExpStore) QueryLog(offset, size int, details bool) ([]*expstorage.TriageLogEntry, int, error) {
+	l.queries++
+	if offset >= len(l.log) {
+		return []*expstorage.TriageLogEntry{}, len(l.log), nil
+	}
+	end := offset + size
+	if end > len(l.log) {
+		end = len(l.log)
+	}
+	return l.log[offset:end], len(l.log), nil
+}
+
+func (l *logExpStore) UndoChange(changeID int64, userID string) (map[string]types.TestClassification, error) {
+	for i, entry := range l.log {
+		if int64(entry.ID) != changeID {
+			continue
+		}
+		// Restore the label each digest had before the change.
+		changes := map[string]types.TestClassification{}
+		for testName, digests := range entry.GetChanges() {
+			changes[testName] = types.TestClassification{}
+			for digest := range digests {
+				changes[testName][digest] = types.UNTRIAGED
+				for _, older := range l.log[i+1:] {
+					if label, ok := older.GetChanges()[testName][digest]; ok {
+						changes[testName][digest] = label
+						break
+					}
+				}
+			}
+		}
+		return changes, l.addChange(changes, userID, changeID)
+	}
+	return nil, fmt.Errorf("Unknown change %d", changeID)
+}
+
+func metrics(numDiffPixels int, maxRGBA ...int) *diff.DiffMetrics {
+	return &diff.DiffMetrics{
+		NumDiffPixels: numDiffPixels,
+		MaxRGBADiffs:  maxRGBA,
+	}
+}
+
+func TestNew(t *testing.T) {
+	testutils.SmallTest(t)
+	exp := newLogExpStore()
+
+	_, err := New([]*Rule{{Query: "name=foo", MaxDiffPixels: 10}}, exp, mockDiffStore{})
+	assert.NoError(t, err)
+	_, err = New([]*Rule{{Query: ""}}, exp, mockDiffStore{})
+	assert.Error(t, err)
+	_, err = New([]*Rule{{Query: "name=%zz"}}, exp, mockDiffStore{})
+	assert.Error(t, err)
+	_, err = New([]*Rule{{Query: "name=foo", MaxChannelDelta: -1}}, exp, mockDiffStore{})
+	assert.Error(t, err)
+}
+
+func TestRun(t *testing.T) {
+	testutils.SmallTest(t)
+
+	expStore := newLogExpStore()
+	assert.NoError(t, expStore.AddChange(map[string]types.TestClassification{
+		"foo": {"pos1": types.POSITIVE, "neg1": types.NEGATIVE},
+		"bar": {"pos2": types.POSITIVE},
+	}, "user@example.com"))
+	// Digests marked positive by the AutoTriager are not used as references.
+	assert.NoError(t, expStore.AddChange(map[string]types.TestClassification{
+		"baz": {"auto1": types.POSITIVE},
+	}, AUTO_TRIAGE_USER))
+
+	diffStore := mockDiffStore{
+		"close1": metrics(3, 1, 2, 0, 0),
+		"close2": metrics(10, 4, 4, 4, 4),
+		"far1":   metrics(11, 1, 1, 1, 1),
+		"far2":   metrics(1, 5, 0, 0, 0),
+		"close3": metrics(1, 1, 1, 1, 1),
+		"close4": metrics(1, 1, 1, 1, 1),
+		"close5": metrics(1, 1, 1, 1, 1),
+	}
+	diffStore["close3"].DimDiffer = true
+
+	tile := tiling.NewTile()
+	tile.Traces = map[string]tiling.Trace{
+		"a": &types.GoldenTrace{
+			Params_: map[string]string{types.PRIMARY_KEY_FIELD: "foo", "config": "8888"},
+			Values:  []string{"pos1", "close1", "far1", "close2", types.MISSING_DIGEST, "neg1"},
+		},
+		"b": &types.GoldenTrace{
+			Params_: map[string]string{types.PRIMARY_KEY_FIELD: "foo", "config": "gpu"},
+			Values:  []string{"far2", "close3"},
+		},
+		"c": &types.GoldenTrace{
+			// No rule matches this trace.
+			Params_: map[string]string{types.PRIMARY_KEY_FIELD: "bar", "config": "565"},
+			Values:  []string{"close4"},
+		},
+		"d": &types.GoldenTrace{
+			Params_: map[string]string{types.PRIMARY_KEY_FIELD: "baz", "config": "8888"},
+			Values:  []string{"auto1", "close5"},
+		},
+	}
+
+	rules := []*Rule{
+		{Query: "name=foo&config=8888", MaxDiffPixels: 10, MaxChannelDelta: 4},
+		{Query: "config=gpu", MaxDiffPixels: 1, MaxChannelDelta: 4},
+		{Query: "name=baz", MaxDiffPixels: 10, MaxChannelDelta: 4},
+	}
+	at, err := New(rules, expStore, diffStore)
+	assert.NoError(t, err)
+
+	exp, err := expStore.Get()
+	assert.NoError(t, err)
+	expected := map[string]types.TestClassification{
+		"foo": {"close1": types.POSITIVE, "close2": types.POSITIVE},
+	}
+	changes, err := at.Triage(tile, exp, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, changes)
+
+	// Only the references returned by the NearestFn are compared.
+	nearest := map[string][]string{}
+	changes, err = at.Triage(tile, exp, func(test, digest string, candidates []string) []string {
+		nearest[test+"/"+digest] = candidates
+		return []string{}
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]types.TestClassification{}, changes)
+	assert.Equal(t, []string{"pos1"}, nearest["foo/close1"])
+
+	assert.NoError(t, at.Run(tile, nil))
+	exp, err = expStore.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, types.POSITIVE, exp.Classification("foo", "close1"))
+	assert.Equal(t, types.POSITIVE, exp.Classification("foo", "close2"))
+	assert.Equal(t, types.UNTRIAGED, exp.Classification("foo", "far1"))
+	assert.Equal(t, types.UNTRIAGED, exp.Classification("foo", "far2"))
+	assert.Equal(t, types.UNTRIAGED, exp.Classification("foo", "close3"))
+	assert.Equal(t, types.UNTRIAGED, exp.Classification("bar", "close4"))
+	assert.Equal(t, types.UNTRIAGED, exp.Classification("baz", "close5"))
+
+	// Everything that could be triaged has been triaged.
+	changes, err = at.Triage(tile, exp, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]types.TestClassification{}, changes)
+
+	// Undoing the auto-triage change resets the digests to untriaged, and
+	// they are not triaged again.
+	assert.Equal(t, AUTO_TRIAGE_USER, expStore.log[0].Name)
+	_, err = expStore.UndoChange(int64(expStore.log[0].ID), "user@example.com")
+	assert.NoError(t, err)
+	exp, err = expStore.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, types.UNTRIAGED, exp.Classification("foo", "close1"))
+	assert.Equal(t, types.UNTRIAGED, exp.Classification("foo", "close2"))
+
+	changes, err = at.Triage(tile, exp, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]types.TestClassification{}, changes)
+	assert.NoError(t, at.Run(tile, nil))
+	exp, err = expStore.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, types.UNTRIAGED, exp.Classification("foo", "close1"))
+	assert.Equal(t, types.UNTRIAGED, exp.Classification("foo", "close2"))
+}
+
+func TestUpdateUsers(t *testing.T) {
+	testutils.SmallTest(t)
+
+	expStore := newLogExpStore()
+	for i := 0; i <= logPageSize; i++ {
+		assert.NoError(t, expStore.AddChange(map[string]types.TestClassification{
+			"foo": {fmt.Sprintf("digest%d", i): types.POSITIVE},
+		}, "user@example.com"))
+	}
+	at, err := New(nil, expStore, mockDiffStore{})
+	assert.NoError(t, err)
+
+	// The whole log is read initially.
+	assert.NoError(t, at.updateUsers())
+	assert.Equal(t, 2, expStore.queries)
+	assert.Equal(t, logPageSize+1, len(at.users["foo"]))
+	assert.Equal(t, "user@example.com", at.users["foo"]["digest0"])
+
+	// Afterwards, only the newest entries are read.
+	assert.NoError(t, expStore.AddChange(map[string]types.TestClassification{
+		"foo": {"digest0": types.POSITIVE},
+	}, AUTO_TRIAGE_USER))
+	assert.NoError(t, at.updateUsers())
+	assert.Equal(t, 3, expStore.queries)
+	assert.Equal(t, logPageSize+1, len(at.users["foo"]))
+	assert.Equal(t, AUTO_TRIAGE_USER, at.users["foo"]["digest0"])
+}
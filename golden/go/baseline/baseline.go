@@ -3,8 +3,6 @@
 package baseline
 
 import (
-	"fmt"
-
 	"go.skia.org/infra/go/sklog"
 	"go.skia.org/infra/go/tiling"
 	"go.skia.org/infra/golden/go/expstorage"
@@ -139,8 +137,11 @@ func GetBaselineForIssue(issueID int64, tryjobs []*tryjobstore.Tryjob, tryjobRes
 	return ret
 }
 
-// CommitIssueBaseline commits the expectations for the given issue to the master baseline.
-func CommitIssueBaseline(issueID int64, user string, tryjobStore tryjobstore.TryjobStore, expStore expstorage.ExpectationsStore) error {
+// CommitIssueBaseline merges the expectation branch of the given issue into
+// master. The changes are recorded with the users that triaged them in the
+// issue. Changes that conflict with concurrent changes in master are not
+// merged and are stored in the issue instead.
+func CommitIssueBaseline(issueID int64, tryjobStore tryjobstore.TryjobStore, expBranches *expstorage.ExpBranches) error {
 	issueExp, err := tryjobStore.GetExpectations(issueID)
 	if err != nil {
 		return sklog.FmtErrorf("Unable to retrieve expecations for issue %d: %s", issueID, err)
@@ -150,13 +151,16 @@ func CommitIssueBaseline(issueID int64, user string, tryjobStore tryjobstore.Try
 		return nil
 	}
 
-	syntheticUser := fmt.Sprintf("%s:%d", user, issueID)
+	commitFn := func() ([]*expstorage.MergeConflict, error) {
+		report, err := expBranches.Merge(issueID)
+		if err != nil {
+			return nil, sklog.FmtErrorf("Unable to merge expectations for issue %d: %s", issueID, err)
+		}
 
-	commitFn := func() error {
-		if err := expStore.AddChange(issueExp.Tests, syntheticUser); err != nil {
-			return sklog.FmtErrorf("Unable to add expectations for issue %d: %s", issueID, err)
+		for _, c := range report.Conflicts {
+			sklog.Warningf("Merge conflict for issue %d in %s/%s: %s by %s in issue, %s by %s in master.", issueID, c.TestName, c.Digest, c.BranchLabel, c.BranchUser, c.MasterLabel, c.MasterUser)
 		}
-		return nil
+		return report.Conflicts, nil
 	}
 
 	return tryjobStore.CommitIssueExp(issueID, commitFn)
@@ -169,6 +169,24 @@ var migrationSteps = []database.MigrationStep{
 		},
 	},
 
+	// version 11
+	{
+		MySQLUp: []string{
+			`CREATE TABLE ignorerule_archive (
+				id            INT        NOT NULL PRIMARY KEY,
+				userid        TEXT       NOT NULL,
+				updated_by    TEXT       NOT NULL,
+				expires       BIGINT     NOT NULL,
+				query         TEXT       NOT NULL,
+				note          TEXT       NOT NULL,
+				archived      BIGINT     NOT NULL
+			)`,
+		},
+		MySQLDown: []string{
+			`DROP TABLE IF EXISTS ignorerule_archive`,
+		},
+	},
+
 	// Use this is a template for more migration steps.
 	// version x
 	// {
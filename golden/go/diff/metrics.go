@@ -6,9 +6,12 @@ import (
 )
 
 const (
-	METRIC_COMBINED = "combined"
-	METRIC_PERCENT  = "percent"
-	METRIC_PIXEL    = "pixel"
+	METRIC_COMBINED  = "combined"
+	METRIC_PERCENT   = "percent"
+	METRIC_PIXEL     = "pixel"
+	METRIC_SSIM      = "ssim"
+	METRIC_CIEDE2000 = "ciede2000"
+	METRIC_AA_PIXEL  = "aaPixel"
 )
 
 // MetricsFn is the signature a custom diff metric has to implmente.
@@ -16,9 +19,12 @@ type MetricFn func(*DiffMetrics, *image.NRGBA, *image.NRGBA) float32
 
 // metrics contains the custom diff metrics.
 var metrics = map[string]MetricFn{
-	METRIC_COMBINED: combinedDiffMetric,
-	METRIC_PERCENT:  percentDiffMetric,
-	METRIC_PIXEL:    pixelDiffMetric,
+	METRIC_COMBINED:  combinedDiffMetric,
+	METRIC_PERCENT:   percentDiffMetric,
+	METRIC_PIXEL:     pixelDiffMetric,
+	METRIC_SSIM:      ssimDiffMetric,
+	METRIC_CIEDE2000: ciede2000DiffMetric,
+	METRIC_AA_PIXEL:  antiAliasPixelDiffMetric,
 }
 
 // diffMetricIds contains the ids of all diff metrics.
@@ -37,6 +43,35 @@ func GetDiffMetricIDs() []string {
 	return diffMetricIds
 }
 
+// HasAllMetrics returns true if dm contains a value for every available diff
+// metric. Diff metrics computed before a metric was added lack its value until
+// it is added via AddMissingMetrics.
+func HasAllMetrics(dm *DiffMetrics) bool {
+	for _, id := range diffMetricIds {
+		if _, ok := dm.Diffs[id]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// AddMissingMetrics returns a copy of dm that contains a value for every
+// available diff metric. Only the metrics missing from dm are computed, from
+// the images dm was computed from.
+func AddMissingMetrics(dm *DiffMetrics, leftImg *image.NRGBA, rightImg *image.NRGBA) *DiffMetrics {
+	ret := *dm
+	ret.Diffs = make(map[string]float32, len(diffMetricIds))
+	for id, val := range dm.Diffs {
+		ret.Diffs[id] = val
+	}
+	for _, id := range diffMetricIds {
+		if _, ok := ret.Diffs[id]; !ok {
+			ret.Diffs[id] = metrics[id](&ret, leftImg, rightImg)
+		}
+	}
+	return &ret
+}
+
 // DefaultDiffFn implements the DiffFn function type. Calculates the basic
 // image difference along with custom diff metrics.
 func DefaultDiffFn(leftImg *image.NRGBA, rightImg *image.NRGBA) (interface{}, *image.NRGBA) {
@@ -0,0 +1,306 @@
+package diff
+
+import (
+	"image"
+	"math"
+
+	"go.skia.org/infra/go/util"
+)
+
+const (
+	// SSIM_WINDOW is the width and height of the windows over which the
+	// structural similarity is computed.
+	SSIM_WINDOW = 8
+
+	// SSIM_STEP is the distance between the origins of neighboring windows.
+	SSIM_STEP = 4
+
+	// MAX_DELTA_E is the CIEDE2000 color difference between black and white.
+	// It is used for pixels that don't have a counterpart in the other image.
+	MAX_DELTA_E = 100.0
+)
+
+var (
+	// Stabilizing constants of the SSIM formula for 8-bit values.
+	ssimC1 = math.Pow(0.01*255, 2)
+	ssimC2 = math.Pow(0.03*255, 2)
+
+	// srgbToLinear maps 8-bit sRGB values to linear intensities in [0, 1].
+	srgbToLinear [256]float64
+)
+
+func init() {
+	for i := range srgbToLinear {
+		v := float64(i) / 255.0
+		if v <= 0.04045 {
+			srgbToLinear[i] = v / 12.92
+		} else {
+			srgbToLinear[i] = math.Pow((v+0.055)/1.055, 2.4)
+		}
+	}
+}
+
+// ssimDiffMetric returns one minus the mean structural similarity (SSIM) of
+// the luminance of the two images. The result is in [0, 1] where 0 means the
+// images are structurally identical. Implements the MetricFn signature.
+func ssimDiffMetric(basic *DiffMetrics, one *image.NRGBA, two *image.NRGBA) float32 {
+	if basic.DimDiffer {
+		return 1.0
+	}
+	if basic.NumDiffPixels == 0 {
+		return 0
+	}
+	return float32(1.0 - math.Max(0, ssim(one, two)))
+}
+
+// ciede2000DiffMetric returns the largest perceptual color difference
+// (CIEDE2000) between corresponding pixels of the two images. A value below
+// approximately 2.3 is not noticeable to the human eye. Pixels outside the
+// area shared by both images are considered to differ by MAX_DELTA_E.
+// Implements the MetricFn signature.
+func ciede2000DiffMetric(basic *DiffMetrics, one *image.NRGBA, two *image.NRGBA) float32 {
+	if basic.DimDiffer {
+		return MAX_DELTA_E
+	}
+	if basic.NumDiffPixels == 0 {
+		return 0
+	}
+	b := one.Bounds()
+	maxDelta := 0.0
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			p1, p2 := nrgbaAt(one, x, y), nrgbaAt(two, x, y)
+			if p1[0] == p2[0] && p1[1] == p2[1] && p1[2] == p2[2] && p1[3] == p2[3] {
+				continue
+			}
+			l1, a1, b1 := toLab(p1)
+			l2, a2, b2 := toLab(p2)
+			if d := ciede2000(l1, a1, b1, l2, a2, b2); d > maxDelta {
+				maxDelta = d
+			}
+		}
+	}
+	return float32(maxDelta)
+}
+
+// antiAliasPixelDiffMetric returns the number of different pixels, ignoring
+// pixels whose difference can be explained by anti-aliasing: a pixel is
+// ignored if, in every channel, its value in each image lies within the range
+// of values found in its 3x3 neighborhood in the other image. This tolerates
+// edges shifted by one pixel and different blending along edges, but not
+// changes in flat areas. Pixels outside the area shared by both images are
+// always counted. Implements the MetricFn signature.
+func antiAliasPixelDiffMetric(basic *DiffMetrics, one *image.NRGBA, two *image.NRGBA) float32 {
+	if basic.NumDiffPixels == 0 {
+		return 0
+	}
+	b1, b2 := one.Bounds(), two.Bounds()
+	w, h := util.MinInt(b1.Dx(), b2.Dx()), util.MinInt(b1.Dy(), b2.Dy())
+	total := util.MaxInt(b1.Dx(), b2.Dx()) * util.MaxInt(b1.Dy(), b2.Dy())
+
+	count := total - w*h
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			p1, p2 := nrgbaAt(one, x, y), nrgbaAt(two, x, y)
+			if p1[0] == p2[0] && p1[1] == p2[1] && p1[2] == p2[2] && p1[3] == p2[3] {
+				continue
+			}
+			if !inNeighborhood(p1, two, x, y, w, h) || !inNeighborhood(p2, one, x, y, w, h) {
+				count++
+			}
+		}
+	}
+	return float32(count)
+}
+
+// inNeighborhood returns true if every channel of the pixel p lies within the
+// range of values of that channel in the 3x3 neighborhood of (x, y) in img.
+// The neighborhood is clipped to the w x h area.
+func inNeighborhood(p []uint8, img *image.NRGBA, x, y, w, h int) bool {
+	lo := [4]uint8{255, 255, 255, 255}
+	hi := [4]uint8{0, 0, 0, 0}
+	for ny := y - 1; ny <= y+1; ny++ {
+		for nx := x - 1; nx <= x+1; nx++ {
+			if nx < 0 || ny < 0 || nx >= w || ny >= h {
+				continue
+			}
+			q := nrgbaAt(img, nx, ny)
+			for c := 0; c < 4; c++ {
+				if q[c] < lo[c] {
+					lo[c] = q[c]
+				}
+				if q[c] > hi[c] {
+					hi[c] = q[c]
+				}
+			}
+		}
+	}
+	for c := 0; c < 4; c++ {
+		if p[c] < lo[c] || p[c] > hi[c] {
+			return false
+		}
+	}
+	return true
+}
+
+// nrgbaAt returns the four channels of the pixel at (x, y), relative to the
+// origin of the image bounds.
+func nrgbaAt(img *image.NRGBA, x, y int) []uint8 {
+	b := img.Bounds()
+	offset := img.PixOffset(b.Min.X+x, b.Min.Y+y)
+	return img.Pix[offset : offset+4]
+}
+
+// composite returns the color channels of the non-premultiplied pixel p
+// composited over a white background.
+func composite(p []uint8) (uint8, uint8, uint8) {
+	a := uint32(p[3])
+	over := func(c uint8) uint8 {
+		return uint8((uint32(c)*a + 255*(255-a) + 127) / 255)
+	}
+	return over(p[0]), over(p[1]), over(p[2])
+}
+
+// luminance returns the luma values of all pixels in the image, composited
+// over a white background.
+func luminance(img *image.NRGBA) []float64 {
+	b := img.Bounds()
+	ret := make([]float64, 0, b.Dx()*b.Dy())
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			r, g, bl := composite(nrgbaAt(img, x, y))
+			ret = append(ret, 0.299*float64(r)+0.587*float64(g)+0.114*float64(bl))
+		}
+	}
+	return ret
+}
+
+// ssim returns the mean structural similarity of the two images, which must
+// have the same dimensions. It is computed over SSIM_WINDOW x SSIM_WINDOW
+// windows spaced SSIM_STEP pixels apart. Images smaller than a window are
+// treated as a single window.
+func ssim(one, two *image.NRGBA) float64 {
+	b := one.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return 1.0
+	}
+	l1, l2 := luminance(one), luminance(two)
+	ww, wh := util.MinInt(SSIM_WINDOW, w), util.MinInt(SSIM_WINDOW, h)
+
+	sum := 0.0
+	n := 0
+	for y0 := 0; y0+wh <= h; y0 += SSIM_STEP {
+		for x0 := 0; x0+ww <= w; x0 += SSIM_STEP {
+			var s1, s2, s11, s22, s12 float64
+			for y := y0; y < y0+wh; y++ {
+				for x := x0; x < x0+ww; x++ {
+					v1, v2 := l1[y*w+x], l2[y*w+x]
+					s1 += v1
+					s2 += v2
+					s11 += v1 * v1
+					s22 += v2 * v2
+					s12 += v1 * v2
+				}
+			}
+			count := float64(ww * wh)
+			mu1, mu2 := s1/count, s2/count
+			var1 := s11/count - mu1*mu1
+			var2 := s22/count - mu2*mu2
+			cov := s12/count - mu1*mu2
+			sum += ((2*mu1*mu2 + ssimC1) * (2*cov + ssimC2)) /
+				((mu1*mu1 + mu2*mu2 + ssimC1) * (var1 + var2 + ssimC2))
+			n++
+		}
+	}
+	return sum / float64(n)
+}
+
+// toLab converts a non-premultiplied sRGB pixel, composited over a white
+// background, to the CIE L*a*b* color space using the D65 white point.
+func toLab(p []uint8) (float64, float64, float64) {
+	r8, g8, b8 := composite(p)
+	r, g, b := srgbToLinear[r8], srgbToLinear[g8], srgbToLinear[b8]
+	x := (0.4124564*r + 0.3575761*g + 0.1804375*b) / 0.95047
+	y := 0.2126729*r + 0.7151522*g + 0.0721750*b
+	z := (0.0193339*r + 0.1191920*g + 0.9503041*b) / 1.08883
+
+	f := func(t float64) float64 {
+		const delta = 6.0 / 29.0
+		if t > delta*delta*delta {
+			return math.Cbrt(t)
+		}
+		return t/(3*delta*delta) + 4.0/29.0
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
+}
+
+// ciede2000 returns the CIEDE2000 color difference between two colors in the
+// CIE L*a*b* color space. See "The CIEDE2000 Color-Difference Formula:
+// Implementation Notes, Supplementary Test Data, and Mathematical
+// Observations" by Sharma, Wu and Dalal.
+func ciede2000(l1, a1, b1, l2, a2, b2 float64) float64 {
+	const pow25_7 = 6103515625.0 // 25^7
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	deg := func(rad float64) float64 { return rad * 180 / math.Pi }
+	hue := func(b, a float64) float64 {
+		if a == 0 && b == 0 {
+			return 0
+		}
+		h := deg(math.Atan2(b, a))
+		if h < 0 {
+			h += 360
+		}
+		return h
+	}
+
+	cBar := (math.Hypot(a1, b1) + math.Hypot(a2, b2)) / 2
+	cBar7 := math.Pow(cBar, 7)
+	g := 0.5 * (1 - math.Sqrt(cBar7/(cBar7+pow25_7)))
+	a1p, a2p := (1+g)*a1, (1+g)*a2
+	c1p, c2p := math.Hypot(a1p, b1), math.Hypot(a2p, b2)
+	h1p, h2p := hue(b1, a1p), hue(b2, a2p)
+
+	dLp := l2 - l1
+	dCp := c2p - c1p
+	dhp := 0.0
+	if c1p*c2p != 0 {
+		dhp = h2p - h1p
+		if dhp > 180 {
+			dhp -= 360
+		} else if dhp < -180 {
+			dhp += 360
+		}
+	}
+	dHp := 2 * math.Sqrt(c1p*c2p) * math.Sin(rad(dhp/2))
+
+	lBarP := (l1 + l2) / 2
+	cBarP := (c1p + c2p) / 2
+	hBarP := h1p + h2p
+	if c1p*c2p != 0 {
+		if math.Abs(h1p-h2p) <= 180 {
+			hBarP /= 2
+		} else if hBarP < 360 {
+			hBarP = (hBarP + 360) / 2
+		} else {
+			hBarP = (hBarP - 360) / 2
+		}
+	}
+
+	t := 1 - 0.17*math.Cos(rad(hBarP-30)) +
+		0.24*math.Cos(rad(2*hBarP)) +
+		0.32*math.Cos(rad(3*hBarP+6)) -
+		0.20*math.Cos(rad(4*hBarP-63))
+	dTheta := 30 * math.Exp(-math.Pow((hBarP-275)/25, 2))
+	cBarP7 := math.Pow(cBarP, 7)
+	rc := 2 * math.Sqrt(cBarP7/(cBarP7+pow25_7))
+	lTerm := (lBarP - 50) * (lBarP - 50)
+	sl := 1 + 0.015*lTerm/math.Sqrt(20+lTerm)
+	sc := 1 + 0.045*cBarP
+	sh := 1 + 0.015*cBarP*t
+	rt := -math.Sin(rad(2*dTheta)) * rc
+
+	dl, dc, dh := dLp/sl, dCp/sc, dHp/sh
+	return math.Sqrt(dl*dl + dc*dc + dh*dh + rt*dc*dh)
+}
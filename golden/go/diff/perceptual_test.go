@@ -0,0 +1,119 @@
+package diff
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.skia.org/infra/go/testutils"
+)
+
+// edgeImage returns a w x h white image with a black vertical bar starting at
+// column x0. If blend is non-zero, the column just left of the bar is gray
+// with that value.
+func edgeImage(w, h, x0 int, blend uint8) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{255, 255, 255, 255}
+			if x >= x0 {
+				c = color.NRGBA{0, 0, 0, 255}
+			} else if x == x0-1 && blend != 0 {
+				c = color.NRGBA{blend, blend, blend, 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func computeMetrics(one, two *image.NRGBA) *DiffMetrics {
+	ret, _ := DefaultDiffFn(one, two)
+	return ret.(*DiffMetrics)
+}
+
+func TestCIEDE2000(t *testing.T) {
+	testutils.SmallTest(t)
+	// Test data from Sharma, Wu and Dalal.
+	assert.InDelta(t, 2.0425, ciede2000(50.0, 2.6772, -79.7751, 50.0, 0.0, -82.7485), 0.0001)
+	assert.InDelta(t, 2.3669, ciede2000(50.0, 0.0, 0.0, 50.0, -1.0, 2.0), 0.0001)
+	assert.InDelta(t, 1.2644, ciede2000(60.2574, -34.0099, 36.2677, 60.4626, -34.1751, 39.4387), 0.0001)
+
+	// Black and white are as far apart as possible.
+	l1, a1, b1 := toLab([]uint8{0, 0, 0, 255})
+	l2, a2, b2 := toLab([]uint8{255, 255, 255, 255})
+	assert.InDelta(t, MAX_DELTA_E, ciede2000(l1, a1, b1, l2, a2, b2), 0.01)
+
+	// Fully transparent pixels are white.
+	l1, a1, b1 = toLab([]uint8{0, 0, 0, 0})
+	assert.InDelta(t, 0.0, ciede2000(l1, a1, b1, l2, a2, b2), 0.0001)
+}
+
+func TestPerceptualMetrics(t *testing.T) {
+	testutils.SmallTest(t)
+
+	// Identical images.
+	dm := computeMetrics(edgeImage(16, 16, 8, 0), edgeImage(16, 16, 8, 0))
+	assert.Equal(t, float32(0), dm.Diffs[METRIC_SSIM])
+	assert.Equal(t, float32(0), dm.Diffs[METRIC_CIEDE2000])
+	assert.Equal(t, float32(0), dm.Diffs[METRIC_AA_PIXEL])
+
+	// Different anti-aliasing along the edge is tolerated, and is barely
+	// noticeable.
+	dm = computeMetrics(edgeImage(16, 16, 8, 0), edgeImage(16, 16, 8, 250))
+	assert.Equal(t, 16, dm.NumDiffPixels)
+	assert.Equal(t, float32(0), dm.Diffs[METRIC_AA_PIXEL])
+	assert.True(t, dm.Diffs[METRIC_CIEDE2000] < 2.3)
+	assert.True(t, dm.Diffs[METRIC_SSIM] < 0.05)
+
+	// An edge moved by one pixel is tolerated, but is noticeable.
+	dm = computeMetrics(edgeImage(16, 16, 8, 0), edgeImage(16, 16, 9, 0))
+	assert.Equal(t, 16, dm.NumDiffPixels)
+	assert.Equal(t, float32(0), dm.Diffs[METRIC_AA_PIXEL])
+	assert.InDelta(t, MAX_DELTA_E, dm.Diffs[METRIC_CIEDE2000], 0.01)
+	assert.True(t, dm.Diffs[METRIC_SSIM] > 0.1)
+
+	// An edge moved by two pixels is not tolerated.
+	dm = computeMetrics(edgeImage(16, 16, 8, 0), edgeImage(16, 16, 10, 0))
+	assert.Equal(t, 32, dm.NumDiffPixels)
+	assert.Equal(t, float32(32), dm.Diffs[METRIC_AA_PIXEL])
+
+	// A change in a flat area is not tolerated.
+	two := edgeImage(16, 16, 8, 0)
+	two.SetNRGBA(2, 2, color.NRGBA{250, 250, 250, 255})
+	dm = computeMetrics(edgeImage(16, 16, 8, 0), two)
+	assert.Equal(t, float32(1), dm.Diffs[METRIC_AA_PIXEL])
+
+	// Half of the image changes from white to black.
+	dm = computeMetrics(edgeImage(16, 16, 8, 0), edgeImage(16, 16, 0, 0))
+	assert.InDelta(t, MAX_DELTA_E, dm.Diffs[METRIC_CIEDE2000], 0.01)
+	assert.True(t, dm.Diffs[METRIC_SSIM] > 0.5)
+
+	// Images with different dimensions.
+	dm = computeMetrics(edgeImage(16, 16, 8, 0), edgeImage(16, 8, 8, 0))
+	assert.Equal(t, float32(1), dm.Diffs[METRIC_SSIM])
+	assert.Equal(t, float32(MAX_DELTA_E), dm.Diffs[METRIC_CIEDE2000])
+	assert.Equal(t, float32(128), dm.Diffs[METRIC_AA_PIXEL])
+	assert.True(t, HasAllMetrics(dm))
+	assert.False(t, HasAllMetrics(&DiffMetrics{}))
+}
+
+func TestAddMissingMetrics(t *testing.T) {
+	testutils.SmallTest(t)
+	one, two := edgeImage(16, 16, 8, 0), edgeImage(16, 16, 6, 0)
+	expected := computeMetrics(one, two)
+
+	// Simulate diff metrics stored before the perceptual metrics existed.
+	stored := computeMetrics(one, two)
+	delete(stored.Diffs, METRIC_SSIM)
+	delete(stored.Diffs, METRIC_CIEDE2000)
+	delete(stored.Diffs, METRIC_AA_PIXEL)
+	assert.False(t, HasAllMetrics(stored))
+
+	backfilled := AddMissingMetrics(stored, one, two)
+	assert.True(t, HasAllMetrics(backfilled))
+	assert.Equal(t, expected, backfilled)
+	// The stored diff metrics are not modified.
+	assert.False(t, HasAllMetrics(stored))
+}
@@ -39,6 +39,10 @@ const (
 	// BYTES_PER_DIFF_METRIC is the estimated number of bytes per diff metric.
 	// Used to conservatively estimate the maximum number of items in the cache.
 	BYTES_PER_DIFF_METRIC = 100
+
+	// BACKFILL_QUEUE_SIZE is the maximum number of stored diff metrics that
+	// wait for missing metrics to be added.
+	BACKFILL_QUEUE_SIZE = 10000
 )
 
 // DiffStoreMapper is the interface to customize the specific behavior of MemDiffStore.
@@ -100,6 +104,14 @@ type MemDiffStore struct {
 	// wg is used to synchronize background operations like saving files. Used for testing.
 	wg sync.WaitGroup
 
+	// backfillCh contains the IDs of stored diff metrics that lack some of
+	// the current metrics. See backfillWorker.
+	backfillCh chan string
+
+	// backfilling contains the IDs in backfillCh or being backfilled.
+	backfilling    util.StringSet
+	backfillingMtx sync.Mutex
+
 	// mapper contains various functions for creating image IDs, paths and diff metrics.
 	mapper DiffStoreMapper
 }
@@ -132,11 +144,14 @@ func NewMemDiffStore(client *http.Client, baseDir string, gsBucketNames []string
 		imgLoader:    imgLoader,
 		metricsStore: mStore,
 		mapper:       mapper,
+		backfillCh:   make(chan string, BACKFILL_QUEUE_SIZE),
+		backfilling:  util.StringSet{},
 	}
 
 	if ret.diffMetricsCache, err = rtcache.New(ret.diffMetricsWorker, diffCacheCount, runtime.NumCPU()); err != nil {
 		return nil, err
 	}
+	go ret.backfillWorker()
 	return ret, nil
 }
 
@@ -179,6 +194,13 @@ func (d *MemDiffStore) WarmDiffs(priority int64, leftDigests []string, rightDige
 	}
 }
 
+// GetImages returns the decoded images for the given digests. It implements
+// the phash.ImageSource interface.
+func (d *MemDiffStore) GetImages(priority int64, digests []string) ([]*image.NRGBA, error) {
+	imgs, _, err := d.imgLoader.Get(rtcache.PriorityTimeCombined(priority), digests)
+	return imgs, err
+}
+
 func (d *MemDiffStore) sync() {
 	d.wg.Wait()
 }
@@ -343,6 +365,12 @@ func (d *MemDiffStore) diffMetricsWorker(priority int64, id string) (interface{}
 	if dm, err := d.metricsStore.loadDiffMetrics(id); err != nil {
 		sklog.Errorf("Error trying to load diff metric: %s", err)
 	} else if dm != nil {
+		// Diff metrics that were stored before all current metrics existed
+		// are returned as they are, and the missing metrics are added in
+		// the background.
+		if m, ok := dm.(*diff.DiffMetrics); ok && !diff.HasAllMetrics(m) {
+			d.enqueueBackfill(id)
+		}
 		return dm, nil
 	}
 
@@ -368,6 +396,63 @@ func (d *MemDiffStore) diffMetricsWorker(priority int64, id string) (interface{}
 	return diffMetrics, nil
 }
 
+// enqueueBackfill queues the stored diff metrics with the given ID to have
+// their missing metrics added by backfillWorker. If the queue is full, they are
+// queued again the next time they are loaded.
+func (d *MemDiffStore) enqueueBackfill(id string) {
+	d.backfillingMtx.Lock()
+	defer d.backfillingMtx.Unlock()
+	if d.backfilling[id] {
+		return
+	}
+	d.wg.Add(1)
+	select {
+	case d.backfillCh <- id:
+		d.backfilling[id] = true
+	default:
+		d.wg.Done()
+	}
+}
+
+// backfillWorker adds the missing metrics to the stored diff metrics queued
+// by enqueueBackfill, one at a time so that it doesn't compete with diffs that
+// are being requested.
+func (d *MemDiffStore) backfillWorker() {
+	for id := range d.backfillCh {
+		if err := d.backfillDiffMetrics(id); err != nil {
+			sklog.Errorf("Error adding missing diff metrics for %s: %s", id, err)
+		}
+		d.backfillingMtx.Lock()
+		delete(d.backfilling, id)
+		d.backfillingMtx.Unlock()
+		d.wg.Done()
+	}
+}
+
+// backfillDiffMetrics adds the missing metrics to the stored diff metrics with
+// the given ID and removes the outdated metrics from the cache.
+func (d *MemDiffStore) backfillDiffMetrics(id string) error {
+	dm, err := d.metricsStore.loadDiffMetrics(id)
+	if err != nil {
+		return err
+	}
+	m, ok := dm.(*diff.DiffMetrics)
+	if !ok || diff.HasAllMetrics(m) {
+		return nil
+	}
+
+	leftDigest, rightDigest := d.mapper.SplitDiffID(id)
+	imgs, _, err := d.imgLoader.Get(diff.PRIORITY_BACKGROUND, []string{leftDigest, rightDigest})
+	if err != nil {
+		return err
+	}
+	if err := d.metricsStore.saveDiffMetrics(id, diff.AddMissingMetrics(m, imgs[0], imgs[1])); err != nil {
+		return err
+	}
+	d.diffMetricsCache.Remove([]string{id})
+	return nil
+}
+
 // saveDiffInfoAsync saves the given diff information to disk asynchronously.
 func (d *MemDiffStore) saveDiffInfoAsync(diffID, leftDigest, rightDigest string, diffMetrics interface{}, imgBytes []byte) {
 	d.wg.Add(2)
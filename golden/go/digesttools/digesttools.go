@@ -7,6 +7,7 @@ import (
 	"go.skia.org/infra/go/sklog"
 	"go.skia.org/infra/golden/go/diff"
 	"go.skia.org/infra/golden/go/expstorage"
+	"go.skia.org/infra/golden/go/phash"
 	"go.skia.org/infra/golden/go/tally"
 	"go.skia.org/infra/golden/go/types"
 )
@@ -31,6 +32,14 @@ func newClosest() *Closest {
 //
 // If no digest of type 'label' is found then Closest.Digest is the empty string.
 func ClosestDigest(test string, digest string, exp *expstorage.Expectations, tallies tally.Tally, diffStore diff.DiffStore, label types.Label) *Closest {
+	return ClosestDigestByMetric(test, digest, exp, tallies, diffStore, label, diff.METRIC_COMBINED, nil)
+}
+
+// ClosestDigestByMetric is like ClosestDigest, but measures the distance
+// between digests with the given diff metric, e.g. diff.METRIC_SSIM. Closest.Diff
+// contains the value of that metric. If hashIndex is not nil, only the
+// phash.MAX_CANDIDATES digests with the nearest perceptual hashes are diffed.
+func ClosestDigestByMetric(test string, digest string, exp *expstorage.Expectations, tallies tally.Tally, diffStore diff.DiffStore, label types.Label, metric string, hashIndex *phash.Index) *Closest {
 	ret := newClosest()
 	unavailableDigests := diffStore.UnavailableDigests()
 
@@ -48,6 +57,7 @@ func ClosestDigest(test string, digest string, exp *expstorage.Expectations, tal
 	if len(selected) == 0 {
 		return ret
 	}
+	selected = hashIndex.Nearest(test, digest, selected, phash.MAX_CANDIDATES)
 
 	if diffMetrics, err := diffStore.Get(diff.PRIORITY_NOW, digest, selected); err != nil {
 		sklog.Errorf("ClosestDigest: Failed to get diff: %s", err)
@@ -55,7 +65,12 @@ func ClosestDigest(test string, digest string, exp *expstorage.Expectations, tal
 	} else {
 		for digest, diffs := range diffMetrics {
 			dm := diffs.(*diff.DiffMetrics)
-			if delta := combinedDiffMetric(dm.PixelDiffPercent, dm.MaxRGBADiffs); delta < ret.Diff {
+			delta, ok := metricValue(dm, metric)
+			if !ok {
+				sklog.Errorf("ClosestDigest: Diff metric %q not available for %s", metric, digest)
+				continue
+			}
+			if delta < ret.Diff {
 				ret.Digest = digest
 				ret.Diff = delta
 				ret.DiffPixels = dm.PixelDiffPercent
@@ -76,6 +91,18 @@ func ClosestFromDiffMetrics(diff *diff.DiffMetrics) *Closest {
 	}
 }
 
+// metricValue returns the value of the given metric in dm. Returns false if
+// the metric isn't available.
+func metricValue(dm *diff.DiffMetrics, metric string) (float32, bool) {
+	if delta, ok := dm.Diffs[metric]; ok {
+		return delta, true
+	}
+	if metric == diff.METRIC_COMBINED {
+		return combinedDiffMetric(dm.PixelDiffPercent, dm.MaxRGBADiffs), true
+	}
+	return 0, false
+}
+
 // combinedDiffMetric returns a value in [0, 1] that represents how large
 // the diff is between two images.
 func combinedDiffMetric(pixelDiffPercent float32, maxRGBA []int) float32 {
@@ -21,7 +21,8 @@ func (m MockDiffStore) WarmDiffs(priority int64, leftDigests []string, rightDige
 func (m MockDiffStore) UnavailableDigests() map[string]*diff.DigestFailure                    { return nil }
 func (m MockDiffStore) PurgeDigests(digests []string, purgeGCS bool) error                    { return nil }
 
-// Get always finds that digest "eee" is closest to dMain.
+// Get always finds that digest "eee" is closest to dMain, unless the SSIM
+// metric is used, in which case "aaa" is closest.
 func (m MockDiffStore) Get(priority int64, dMain string, dRest []string) (map[string]interface{}, error) {
 	result := map[string]interface{}{}
 	for i, d := range dRest {
@@ -29,9 +30,16 @@ func (m MockDiffStore) Get(priority int64, dMain string, dRest []string) (map[st
 		if d == "eee" {
 			diffPercent = 0.1
 		}
+		ssim := float32(0.5)
+		if d == "aaa" {
+			ssim = 0.01
+		}
 		result[d] = &diff.DiffMetrics{
 			PixelDiffPercent: diffPercent,
 			MaxRGBADiffs:     []int{5, 3, 4, 0},
+			Diffs: map[string]float32{
+				diff.METRIC_SSIM: ssim,
+			},
 		}
 	}
 	return result, nil
@@ -79,6 +87,38 @@ func TestClosestDigest(t *testing.T) {
 	assert.Equal(t, []int{5, 3, 4, 0}, c.MaxRGBA)
 }
 
+func TestClosestDigestByMetric(t *testing.T) {
+	testutils.SmallTest(t)
+	diffStore := MockDiffStore{}
+	exp := &expstorage.Expectations{
+		Tests: map[string]types.TestClassification{
+			"foo": map[string]types.Label{
+				"aaa": types.POSITIVE,
+				"bbb": types.NEGATIVE,
+				"eee": types.POSITIVE,
+			},
+		},
+	}
+	tallies := tally.Tally{
+		"aaa": 2,
+		"bbb": 2,
+		"eee": 2,
+	}
+
+	c := ClosestDigestByMetric("foo", "fff", exp, tallies, diffStore, types.POSITIVE, diff.METRIC_SSIM, nil)
+	assert.Equal(t, "aaa", c.Digest)
+	assert.InDelta(t, 0.01, float64(c.Diff), 0.000001)
+
+	// The combined metric is computed if it wasn't stored.
+	c = ClosestDigestByMetric("foo", "fff", exp, tallies, diffStore, types.POSITIVE, diff.METRIC_COMBINED, nil)
+	assert.Equal(t, "eee", c.Digest)
+
+	// Digests without the requested metric are skipped.
+	c = ClosestDigestByMetric("foo", "fff", exp, tallies, diffStore, types.POSITIVE, diff.METRIC_CIEDE2000, nil)
+	assert.Equal(t, "", c.Digest)
+	assert.Equal(t, float32(math.MaxFloat32), c.Diff)
+}
+
 func TestCombinedDiffMetric(t *testing.T) {
 	testutils.SmallTest(t)
 	assert.InDelta(t, 1.0, combinedDiffMetric(0.0, []int{}), 0.000001)
@@ -0,0 +1,268 @@
+package expstorage
+
+import (
+	"sort"
+
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/golden/go/types"
+)
+
+// logPageSize is the number of log entries that are fetched at once when
+// paging through the triage logs of master and of a branch.
+const logPageSize = 500
+
+// BranchStore stores the expectation branches of changelists. Each branch is
+// keyed by the Gerrit issue id of the changelist and only contains the
+// changes made for that changelist. tryjobstore.TryjobStore implements this
+// interface.
+type BranchStore interface {
+	// GetExpectations returns the expectations that were triaged for the
+	// given issue.
+	GetExpectations(issueID int64) (*Expectations, error)
+
+	// QueryLog allows to paginate through the changes made to the
+	// expectations of the given issue. The order of the entries is not
+	// significant, but if details is true each entry has to contain the
+	// individual triage operations of the change.
+	QueryLog(issueID int64, offset, size int, details bool) ([]*TriageLogEntry, int, error)
+}
+
+// MergeConflict describes a test/digest pair that was triaged in a branch and
+// was changed to a different label in master after it was first triaged in
+// the branch.
+type MergeConflict struct {
+	TestName    string      `json:"test_name"`
+	Digest      string      `json:"digest"`
+	BranchLabel types.Label `json:"branch_label"`
+	BranchUser  string      `json:"branch_user"`
+	MasterLabel types.Label `json:"master_label"`
+	MasterUser  string      `json:"master_user"`
+}
+
+// MergeReport is the outcome of merging a branch into master.
+type MergeReport struct {
+	IssueID int64 `json:"issue_id"`
+
+	// Applied contains the changes that were written to master.
+	Applied map[string]types.TestClassification `json:"applied"`
+
+	// Conflicts contains the changes of the branch that were not written to
+	// master because master was changed concurrently. Master wins in all
+	// of these cases.
+	Conflicts []*MergeConflict `json:"conflicts"`
+}
+
+// ExpBranches combines the expectations of master with the expectation
+// branches of changelists.
+type ExpBranches struct {
+	master   ExpectationsStore
+	branches BranchStore
+}
+
+// NewExpBranches returns a new instance of ExpBranches that overlays the
+// branches in the given BranchStore over the master expectations.
+func NewExpBranches(master ExpectationsStore, branches BranchStore) *ExpBranches {
+	return &ExpBranches{
+		master:   master,
+		branches: branches,
+	}
+}
+
+// Get returns the expectations as seen by the given issue, i.e. the master
+// expectations with the changes of the branch applied on top. If issueID is
+// not larger than 0 the master expectations are returned.
+func (e *ExpBranches) Get(issueID int64) (*Expectations, error) {
+	masterExp, err := e.master.Get()
+	if err != nil {
+		return nil, sklog.FmtErrorf("Unable to load expectations for master: %s", err)
+	}
+
+	if issueID <= 0 {
+		return masterExp, nil
+	}
+
+	branchExp, err := e.branches.GetExpectations(issueID)
+	if err != nil {
+		return nil, sklog.FmtErrorf("Unable to load expectations for issue %d: %s", issueID, err)
+	}
+
+	ret := masterExp.DeepCopy()
+	ret.AddDigests(branchExp.Tests)
+	return ret, nil
+}
+
+// branchChange captures the final state of a test/digest pair in a log.
+type branchChange struct {
+	label types.Label
+	user  string
+	// firstTS is the time the pair was first changed in the branch.
+	firstTS int64
+}
+
+// Merge merges the branch of the given issue into master. Every test/digest
+// pair is written to master via AddChange with the user that triaged it in
+// the branch. Pairs that were changed to a different label in master after
+// they were first triaged in the branch are not written and are returned as
+// conflicts instead.
+func (e *ExpBranches) Merge(issueID int64) (*MergeReport, error) {
+	ret := &MergeReport{
+		IssueID:   issueID,
+		Applied:   map[string]types.TestClassification{},
+		Conflicts: []*MergeConflict{},
+	}
+
+	branchLog, err := e.branchLog(issueID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Replay the branch log chronologically to find the final label of
+	// each test/digest pair and who assigned it.
+	sort.SliceStable(branchLog, func(i, j int) bool { return branchLog[i].TS < branchLog[j].TS })
+	branchChanges := map[string]map[string]*branchChange{}
+	var since int64 = -1
+	for _, entry := range branchLog {
+		if since < 0 {
+			since = entry.TS
+		}
+		for _, d := range entry.Details {
+			if _, ok := branchChanges[d.TestName]; !ok {
+				branchChanges[d.TestName] = map[string]*branchChange{}
+			}
+			if found, ok := branchChanges[d.TestName][d.Digest]; ok {
+				found.label = types.LabelFromString(d.Label)
+				found.user = entry.Name
+			} else {
+				branchChanges[d.TestName][d.Digest] = &branchChange{
+					label:   types.LabelFromString(d.Label),
+					user:    entry.Name,
+					firstTS: entry.TS,
+				}
+			}
+		}
+	}
+
+	if len(branchChanges) == 0 {
+		return ret, nil
+	}
+
+	masterChanges, err := e.masterChangesSince(since)
+	if err != nil {
+		return nil, err
+	}
+
+	masterExp, err := e.master.Get()
+	if err != nil {
+		return nil, sklog.FmtErrorf("Unable to load expectations for master: %s", err)
+	}
+
+	byUser := map[string]map[string]types.TestClassification{}
+	for testName, digests := range branchChanges {
+		for digest, bc := range digests {
+			if mc, ok := masterChanges[testName][digest]; ok && (mc.firstTS > bc.firstTS) && (mc.label != bc.label) {
+				ret.Conflicts = append(ret.Conflicts, &MergeConflict{
+					TestName:    testName,
+					Digest:      digest,
+					BranchLabel: bc.label,
+					BranchUser:  bc.user,
+					MasterLabel: mc.label,
+					MasterUser:  mc.user,
+				})
+				continue
+			}
+
+			if masterExp.Classification(testName, digest) == bc.label {
+				continue
+			}
+
+			if _, ok := byUser[bc.user]; !ok {
+				byUser[bc.user] = map[string]types.TestClassification{}
+			}
+			if _, ok := byUser[bc.user][testName]; !ok {
+				byUser[bc.user][testName] = types.TestClassification{}
+			}
+			byUser[bc.user][testName][digest] = bc.label
+		}
+	}
+
+	users := make([]string, 0, len(byUser))
+	for user := range byUser {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	for _, user := range users {
+		if err := e.master.AddChange(byUser[user], user); err != nil {
+			return nil, sklog.FmtErrorf("Unable to merge changes of %s in issue %d: %s", user, issueID, err)
+		}
+		for testName, digests := range byUser[user] {
+			if _, ok := ret.Applied[testName]; !ok {
+				ret.Applied[testName] = types.TestClassification{}
+			}
+			for digest, label := range digests {
+				ret.Applied[testName][digest] = label
+			}
+		}
+	}
+
+	sort.Slice(ret.Conflicts, func(i, j int) bool {
+		if ret.Conflicts[i].TestName != ret.Conflicts[j].TestName {
+			return ret.Conflicts[i].TestName < ret.Conflicts[j].TestName
+		}
+		return ret.Conflicts[i].Digest < ret.Conflicts[j].Digest
+	})
+	return ret, nil
+}
+
+// branchLog returns all log entries of the given issue including details.
+func (e *ExpBranches) branchLog(issueID int64) ([]*TriageLogEntry, error) {
+	ret := []*TriageLogEntry{}
+	for {
+		entries, total, err := e.branches.QueryLog(issueID, len(ret), logPageSize, true)
+		if err != nil {
+			return nil, sklog.FmtErrorf("Unable to retrieve triage log for issue %d: %s", issueID, err)
+		}
+		ret = append(ret, entries...)
+		if (len(entries) == 0) || (len(ret) >= total) {
+			return ret, nil
+		}
+	}
+}
+
+// masterChangesSince returns the latest change of each test/digest pair that
+// was changed in master at or after the given timestamp. firstTS of the
+// returned changes is the time of that latest change.
+func (e *ExpBranches) masterChangesSince(since int64) (map[string]map[string]*branchChange, error) {
+	ret := map[string]map[string]*branchChange{}
+	offset := 0
+	for {
+		// The master log is sorted in reverse chronological order.
+		entries, total, err := e.master.QueryLog(offset, logPageSize, true)
+		if err != nil {
+			return nil, sklog.FmtErrorf("Unable to retrieve triage log for master: %s", err)
+		}
+
+		for _, entry := range entries {
+			if entry.TS < since {
+				return ret, nil
+			}
+			for _, d := range entry.Details {
+				if _, ok := ret[d.TestName]; !ok {
+					ret[d.TestName] = map[string]*branchChange{}
+				}
+				// Only the latest change counts.
+				if _, ok := ret[d.TestName][d.Digest]; !ok {
+					ret[d.TestName][d.Digest] = &branchChange{
+						label:   types.LabelFromString(d.Label),
+						user:    entry.Name,
+						firstTS: entry.TS,
+					}
+				}
+			}
+		}
+
+		offset += len(entries)
+		if (len(entries) == 0) || (offset >= total) {
+			return ret, nil
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package expstorage
+
+import (
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/golden/go/types"
+)
+
+// logExpStore is an in-memory ExpectationsStore that also keeps a triage log.
+// The timestamp of the next change is set via ts.
+type logExpStore struct {
+	*MemExpectationsStore
+	ts  int64
+	log []*TriageLogEntry
+}
+
+func newLogExpStore() *logExpStore {
+	return &logExpStore{
+		MemExpectationsStore: NewMemExpectationsStore(nil).(*MemExpectationsStore),
+	}
+}
+
+func (l *logExpStore) AddChange(changes map[string]types.TestClassification, userId string) error {
+	if err := l.MemExpectationsStore.AddChange(changes, userId); err != nil {
+		return err
+	}
+	// The log is sorted in reverse chronological order.
+	l.log = append([]*TriageLogEntry{logEntry(l.ts, userId, changes)}, l.log...)
+	return nil
+}
+
+func (l *logExpStore) QueryLog(offset, size int, details bool) ([]*TriageLogEntry, int, error) {
+	return page(l.log, offset, size), len(l.log), nil
+}
+
+// mockBranchStore implements BranchStore with a log of changes per issue.
+type mockBranchStore map[int64][]*TriageLogEntry
+
+func (m mockBranchStore) GetExpectations(issueID int64) (*Expectations, error) {
+	ret := NewExpectations()
+	for _, entry := range m[issueID] {
+		for testName, digests := range entry.GetChanges() {
+			for digest, label := range digests {
+				ret.SetTestExpectation(testName, digest, label)
+			}
+		}
+	}
+	return ret, nil
+}
+
+func (m mockBranchStore) QueryLog(issueID int64, offset, size int, details bool) ([]*TriageLogEntry, int, error) {
+	return page(m[issueID], offset, size), len(m[issueID]), nil
+}
+
+func page(entries []*TriageLogEntry, offset, size int) []*TriageLogEntry {
+	if offset >= len(entries) {
+		return []*TriageLogEntry{}
+	}
+	end := offset + size
+	if end > len(entries) {
+		end = len(entries)
+	}
+	return entries[offset:end]
+}
+
+func logEntry(ts int64, user string, changes map[string]types.TestClassification) *TriageLogEntry {
+	ret := &TriageLogEntry{Name: user, TS: ts}
+	for testName, digests := range changes {
+		for digest, label := range digests {
+			ret.Details = append(ret.Details, &TriageDetail{TestName: testName, Digest: digest, Label: label.String()})
+		}
+	}
+	ret.ChangeCount = len(ret.Details)
+	return ret
+}
+
+func TestExpBranches(t *testing.T) {
+	testutils.SmallTest(t)
+
+	master := newLogExpStore()
+	master.ts = 1
+	assert.NoError(t, master.AddChange(map[string]types.TestClassification{
+		"test": {"a": types.POSITIVE},
+	}, "bob@example.com"))
+
+	const issueID = 10
+	branches := mockBranchStore{
+		issueID: {
+			logEntry(2, "alice@example.com", map[string]types.TestClassification{
+				"test": {"a": types.NEGATIVE, "b": types.POSITIVE, "c": types.NEGATIVE, "e": types.POSITIVE},
+			}),
+			logEntry(3, "carol@example.com", map[string]types.TestClassification{
+				"test": {"c": types.POSITIVE, "d": types.POSITIVE},
+			}),
+		},
+	}
+	expBranches := NewExpBranches(master, branches)
+
+	// Reads overlay the branch on master.
+	exp, err := expBranches.Get(0)
+	assert.NoError(t, err)
+	assert.Equal(t, types.POSITIVE, exp.Classification("test", "a"))
+	assert.Equal(t, types.UNTRIAGED, exp.Classification("test", "b"))
+
+	exp, err = expBranches.Get(issueID)
+	assert.NoError(t, err)
+	assert.Equal(t, types.NEGATIVE, exp.Classification("test", "a"))
+	assert.Equal(t, types.POSITIVE, exp.Classification("test", "b"))
+	assert.Equal(t, types.POSITIVE, exp.Classification("test", "c"))
+
+	// Master changes concurrently: d conflicts, e agrees with the branch.
+	master.ts = 4
+	assert.NoError(t, master.AddChange(map[string]types.TestClassification{
+		"test": {"d": types.NEGATIVE, "e": types.POSITIVE},
+	}, "dave@example.com"))
+
+	master.ts = 5
+	report, err := expBranches.Merge(issueID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]types.TestClassification{
+		"test": {"a": types.NEGATIVE, "b": types.POSITIVE, "c": types.POSITIVE},
+	}, report.Applied)
+	assert.Equal(t, []*MergeConflict{{
+		TestName:    "test",
+		Digest:      "d",
+		BranchLabel: types.POSITIVE,
+		BranchUser:  "carol@example.com",
+		MasterLabel: types.NEGATIVE,
+		MasterUser:  "dave@example.com",
+	}}, report.Conflicts)
+
+	// The merged changes are recorded with the original triagers.
+	assert.Len(t, master.log, 4)
+	assert.Equal(t, "carol@example.com", master.log[0].Name)
+	assert.Equal(t, map[string]types.TestClassification{"test": {"c": types.POSITIVE}}, master.log[0].GetChanges())
+	assert.Equal(t, "alice@example.com", master.log[1].Name)
+	assert.Equal(t, map[string]types.TestClassification{"test": {"a": types.NEGATIVE, "b": types.POSITIVE}}, master.log[1].GetChanges())
+
+	exp, err = master.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, types.NEGATIVE, exp.Classification("test", "d"))
+
+	// An empty branch is a no-op.
+	report, err = expBranches.Merge(issueID + 1)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Applied)
+	assert.Empty(t, report.Conflicts)
+	assert.Len(t, master.log, 4)
+}
@@ -168,6 +168,49 @@ func (c *cloudIgnoreStore) Delete(id int64) (int, error) {
 	return 1, nil
 }
 
+// Archive implements the IgnoreStore interface.
+func (c *cloudIgnoreStore) Archive(id int64) (int, error) {
+	if id <= 0 {
+		return 0, sklog.FmtErrorf("Given id does not exist: %d", id)
+	}
+
+	archiveFn := func(tx *datastore.Transaction) error {
+		key := ds.NewKey(ds.IGNORE_RULE)
+		key.ID = id
+
+		ignoreRule := &IgnoreRule{}
+		if err := tx.Get(key, ignoreRule); err != nil {
+			return err
+		}
+
+		// Keep the id of the rule in the archive.
+		archiveKey := ds.NewKey(ds.IGNORE_RULE_ARCHIVE)
+		archiveKey.ID = id
+		if _, err := tx.Put(archiveKey, ignoreRule); err != nil {
+			return err
+		}
+
+		if err := tx.Delete(key); err != nil {
+			return err
+		}
+
+		return c.recentKeysList.Delete(tx, key)
+	}
+
+	// Run the relevant updates in a transaction.
+	_, err := c.client.RunInTransaction(context.TODO(), archiveFn)
+	if err != nil {
+		// Don't report an error if the item did not exist.
+		if err == datastore.ErrNoSuchEntity {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	atomic.AddInt64(&c.revision, 1)
+	return 1, nil
+}
+
 // Revision implements the IgnoreStore interface.
 func (c *cloudIgnoreStore) Revision() int64 {
 	return atomic.LoadInt64(&c.revision)
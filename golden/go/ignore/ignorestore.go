@@ -28,6 +28,11 @@ type IgnoreStore interface {
 	// records that were deleted (either 0 or 1).
 	Delete(id int64) (int, error)
 
+	// Archive moves an IgnoreRule from the active rules into the archive of
+	// the store. Archived rules are no longer returned by List. The return
+	// value is the number of records that were archived (either 0 or 1).
+	Archive(id int64) (int, error)
+
 	// Revision returns a monotonically increasing int64 that goes up each time
 	// the ignores have been changed. It will not persist nor will it be the same
 	// between different instances of IgnoreStore. I.e. it will probably start at
@@ -77,6 +82,7 @@ func NewIgnoreRule(name string, expires time.Time, queryStr string, note string)
 // MemIgnoreStore is an in-memory implementation of IgnoreStore.
 type MemIgnoreStore struct {
 	rules    []*IgnoreRule
+	archived []*IgnoreRule
 	mutex    sync.Mutex
 	nextId   int64
 	revision int64
@@ -84,7 +90,8 @@ type MemIgnoreStore struct {
 
 func NewMemIgnoreStore() IgnoreStore {
 	return &MemIgnoreStore{
-		rules: []*IgnoreRule{},
+		rules:    []*IgnoreRule{},
+		archived: []*IgnoreRule{},
 	}
 }
 
@@ -147,6 +154,23 @@ func (m *MemIgnoreStore) Delete(id int64) (int, error) {
 	return 0, nil
 }
 
+// Archive, see IgnoreStore interface.
+func (m *MemIgnoreStore) Archive(id int64) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for idx, rule := range m.rules {
+		if rule.ID == id {
+			m.rules = append(m.rules[:idx], m.rules[idx+1:]...)
+			m.archived = append(m.archived, rule)
+			m.inc()
+			return 1, nil
+		}
+	}
+
+	return 0, nil
+}
+
 func (m *MemIgnoreStore) Revision() int64 {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
@@ -160,6 +184,8 @@ func (m *MemIgnoreStore) expire() {
 	for _, rule := range m.rules {
 		if rule.Expires.After(now) {
 			newrules = append(newrules, rule)
+		} else {
+			m.archived = append(m.archived, rule)
 		}
 	}
 	m.rules = newrules
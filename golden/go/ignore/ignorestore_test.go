@@ -42,6 +42,7 @@ func TestCloudIgnoreStore(t *testing.T) {
 	// Run to the locally running emulator.
 	cleanup := ds_testutil.InitDatastore(t,
 		ds.IGNORE_RULE,
+		ds.IGNORE_RULE_ARCHIVE,
 		ds.HELPER_RECENT_KEYS)
 	defer cleanup()
 
@@ -149,6 +150,22 @@ func testIgnoreStore(t *testing.T, store IgnoreStore) {
 	assert.NoError(t, err)
 	assert.Equal(t, 0, len(allRules))
 	assert.Equal(t, int64(9), store.Revision())
+
+	// Archive a rule.
+	r5 := NewIgnoreRule("jon@example.com", time.Now().Add(time.Hour), "config=565", "To be archived.")
+	assert.NoError(t, store.Create(r5))
+	archiveCount, err := store.Archive(r5.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, archiveCount)
+	allRules, err = store.List(false)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(allRules))
+	assert.Equal(t, int64(11), store.Revision())
+
+	archiveCount, err = store.Archive(1000000)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, archiveCount)
+	assert.Equal(t, int64(11), store.Revision())
 }
 
 func TestToQuery(t *testing.T) {
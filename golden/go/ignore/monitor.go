@@ -1,7 +1,9 @@
 package ignore
 
 import (
+	"bytes"
 	"fmt"
+	"html/template"
 	"time"
 
 	"go.skia.org/infra/go/metrics2"
@@ -9,35 +11,89 @@ import (
 	"go.skia.org/infra/go/sklog"
 )
 
-func oneStep(store IgnoreStore, metric metrics2.Int64Metric) error {
+const (
+	// EXPIRED_EMAIL_SENDER is the display name used for notifications about
+	// expired ignore rules.
+	EXPIRED_EMAIL_SENDER = "Skia Gold"
+
+	expiredEmail = `<b>Expired ignore rule</b><br><br>
+<p>
+	The following ignore rule has expired and was archived:
+</p>
+<p style="padding: 1em;">
+	{{.Rule.Query}}<br>
+	Note: {{.Rule.Note}}<br>
+	Expired: {{.Rule.Expires}}
+</p>
+<p>
+	If the affected traces should still be ignored, please add a new rule at
+	<a href="{{.SiteURL}}/ignores">{{.SiteURL}}/ignores</a>.
+</p>`
+)
+
+var expiredEmailTemplate = template.Must(template.New("expired").Parse(expiredEmail))
+
+// Email sending interface. Note that email.GMail implements this interface.
+type Email interface {
+	Send(from string, to []string, subject string, body string) error
+}
+
+func oneStep(store IgnoreStore, emailAuth Email, siteURL string, metric metrics2.Int64Metric) error {
 	list, err := store.List(false)
 	if err != nil {
 		return err
 	}
 	n := 0
 	for _, rule := range list {
-		if time.Now().After(rule.Expires) {
+		if !time.Now().After(rule.Expires) {
+			continue
+		}
+
+		if _, err := store.Archive(rule.ID); err != nil {
+			sklog.Errorf("Unable to archive expired ignore rule %d: %s", rule.ID, err)
 			n += 1
+			continue
+		}
+		sklog.Infof("Archived expired ignore rule %d: %s", rule.ID, rule.Query)
+
+		if err := notifyExpired(emailAuth, siteURL, rule); err != nil {
+			sklog.Errorf("Unable to notify %s about expired ignore rule %d: %s", rule.UpdatedBy, rule.ID, err)
 		}
 	}
 	metric.Update(int64(n))
 	return nil
 }
 
-// StartMonitoring starts a new monitoring routine for the given
-// ignore store that counts expired ignore rules and pushes
-// that info into a metric.
-func Init(store IgnoreStore) error {
-	numExpired := metrics2.GetInt64Metric("gold_num_expired_ignore_rules", nil)
+// notifyExpired sends an email to the user that last updated the given rule.
+// It does nothing if emailAuth is nil.
+func notifyExpired(emailAuth Email, siteURL string, rule *IgnoreRule) error {
+	if (emailAuth == nil) || (rule.UpdatedBy == "") {
+		return nil
+	}
+
+	var b bytes.Buffer
+	if err := expiredEmailTemplate.Execute(&b, map[string]interface{}{"Rule": rule, "SiteURL": siteURL}); err != nil {
+		return fmt.Errorf("Failed to format email body: %s", err)
+	}
+	return emailAuth.Send(EXPIRED_EMAIL_SENDER, []string{rule.UpdatedBy}, "Gold ignore rule expired", b.String())
+}
+
+// Init starts a new monitoring routine for the given ignore store that
+// archives expired ignore rules and notifies the user that last updated them
+// via emailAuth, which may be nil. siteURL is the base URL of the Gold
+// instance. The number of expired rules that could not be archived is pushed
+// into a metric.
+func Init(store IgnoreStore, emailAuth Email, siteURL string) error {
+	numExpired := metrics2.GetInt64Metric("gold_num_unarchived_expired_ignore_rules", nil)
 	liveness := metrics2.NewLiveness("gold_expired_ignore_rules_monitoring")
 
-	err := oneStep(store, numExpired)
+	err := oneStep(store, emailAuth, siteURL, numExpired)
 	if err != nil {
 		return fmt.Errorf("Unable to start monitoring ignore rules: %s", err)
 	}
 	go func() {
 		for range time.Tick(time.Minute) {
-			err = oneStep(store, numExpired)
+			err = oneStep(store, emailAuth, siteURL, numExpired)
 			if err != nil {
 				sklog.Errorf("Failed one step of monitoring ignore rules: %s", err)
 				continue
@@ -0,0 +1,67 @@
+package ignore
+
+import (
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/metrics2"
+	"go.skia.org/infra/go/testutils"
+)
+
+// keepExpiredIgnoreStore is a MemIgnoreStore that also lists expired rules,
+// like the SQL and Cloud Datastore implementations.
+type keepExpiredIgnoreStore struct {
+	*MemIgnoreStore
+}
+
+func (k keepExpiredIgnoreStore) List(addCounts bool) ([]*IgnoreRule, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return append([]*IgnoreRule{}, k.rules...), nil
+}
+
+type sentEmail struct {
+	to   []string
+	body string
+}
+
+type mockEmail []*sentEmail
+
+func (m *mockEmail) Send(from string, to []string, subject string, body string) error {
+	*m = append(*m, &sentEmail{to: to, body: body})
+	return nil
+}
+
+func TestOneStep(t *testing.T) {
+	testutils.SmallTest(t)
+
+	store := keepExpiredIgnoreStore{NewMemIgnoreStore().(*MemIgnoreStore)}
+	expired := NewIgnoreRule("jon@example.com", time.Now().Add(-time.Hour), "config=gpu", "flaky")
+	active := NewIgnoreRule("jim@example.com", time.Now().Add(time.Hour), "config=8888", "")
+	assert.NoError(t, store.Create(expired))
+	assert.NoError(t, store.Create(active))
+
+	emails := &mockEmail{}
+	metric := metrics2.GetInt64Metric("gold_test_num_expired_ignore_rules", nil)
+	assert.NoError(t, oneStep(store, emails, "https://gold.example.com", metric))
+
+	rules, err := store.List(false)
+	assert.NoError(t, err)
+	assert.Equal(t, []*IgnoreRule{active}, rules)
+	assert.Equal(t, []*IgnoreRule{expired}, store.archived)
+
+	assert.Len(t, *emails, 1)
+	assert.Equal(t, []string{"jon@example.com"}, (*emails)[0].to)
+	assert.Contains(t, (*emails)[0].body, "config=gpu")
+	assert.Contains(t, (*emails)[0].body, "https://gold.example.com/ignores")
+
+	// Nothing left to archive.
+	assert.NoError(t, oneStep(store, emails, "https://gold.example.com", metric))
+	assert.Len(t, *emails, 1)
+
+	// Without email the rules are still archived.
+	assert.NoError(t, store.Create(NewIgnoreRule("jon@example.com", time.Now().Add(-time.Minute), "config=565", "")))
+	assert.NoError(t, oneStep(store, nil, "", metric))
+	assert.Len(t, store.archived, 2)
+}
@@ -0,0 +1,136 @@
+package ignore
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+
+	"go.skia.org/infra/go/tiling"
+	"go.skia.org/infra/golden/go/expstorage"
+	"go.skia.org/infra/golden/go/types"
+)
+
+// RulePreview describes how adding an ignore rule would change the current
+// tile. It is computed without saving the rule.
+type RulePreview struct {
+	Query string `json:"query"`
+
+	// TraceIDs are the ids of the traces that would become ignored. Traces
+	// that are already ignored by an existing rule are not included.
+	TraceIDs []string `json:"traceIDs"`
+
+	// Digests maps test names to the digests that would become ignored, i.e.
+	// digests that only appear in traces that would become ignored.
+	Digests map[string][]string `json:"digests"`
+
+	// Untriaged maps each corpus to the number of untriaged digests at head
+	// before and after adding the rule.
+	Untriaged map[string]*UntriagedChange `json:"untriaged"`
+}
+
+// UntriagedChange captures the number of untriaged digests of a corpus
+// before and after adding an ignore rule.
+type UntriagedChange struct {
+	Before int `json:"before"`
+	After  int `json:"after"`
+}
+
+// PreviewRule returns a preview of adding an ignore rule with the given query
+// to the given existing rules. tile must contain all traces, including the
+// ones that are currently ignored.
+func PreviewRule(query string, rules []*IgnoreRule, tile *tiling.Tile, exp *expstorage.Expectations) (*RulePreview, error) {
+	candidate, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid query %q: %s", query, err)
+	}
+	if len(candidate) == 0 {
+		return nil, fmt.Errorf("Query must not be empty.")
+	}
+
+	ignoreQueries, err := ToQuery(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &RulePreview{
+		Query:     query,
+		TraceIDs:  []string{},
+		Digests:   map[string][]string{},
+		Untriaged: map[string]*UntriagedChange{},
+	}
+
+	// untriagedBefore and untriagedAfter map corpus -> test:digest.
+	untriagedBefore := map[string]map[string]bool{}
+	untriagedAfter := map[string]map[string]bool{}
+	// ignoredDigests and visibleDigests map test -> digest.
+	ignoredDigests := map[string]map[string]bool{}
+	visibleDigests := map[string]map[string]bool{}
+
+	for id, trace := range tile.Traces {
+		if matchesAny(trace, ignoreQueries) {
+			continue
+		}
+
+		gTrace := trace.(*types.GoldenTrace)
+		testName := gTrace.Params_[types.PRIMARY_KEY_FIELD]
+		corpus := gTrace.Params_[types.CORPUS_FIELD]
+		if _, ok := ret.Untriaged[corpus]; !ok {
+			ret.Untriaged[corpus] = &UntriagedChange{}
+			untriagedBefore[corpus] = map[string]bool{}
+			untriagedAfter[corpus] = map[string]bool{}
+		}
+
+		ignored := tiling.Matches(trace, candidate)
+		if ignored {
+			ret.TraceIDs = append(ret.TraceIDs, id)
+		}
+
+		digests := visibleDigests
+		if ignored {
+			digests = ignoredDigests
+		}
+		if _, ok := digests[testName]; !ok {
+			digests[testName] = map[string]bool{}
+		}
+		for _, digest := range gTrace.Values {
+			if digest != types.MISSING_DIGEST {
+				digests[testName][digest] = true
+			}
+		}
+
+		if digest := gTrace.LastDigest(); (digest != "") && (digest != types.MISSING_DIGEST) && (exp.Classification(testName, digest) == types.UNTRIAGED) {
+			k := testName + ":" + digest
+			untriagedBefore[corpus][k] = true
+			if !ignored {
+				untriagedAfter[corpus][k] = true
+			}
+		}
+	}
+
+	for testName, digests := range ignoredDigests {
+		for digest := range digests {
+			if !visibleDigests[testName][digest] {
+				ret.Digests[testName] = append(ret.Digests[testName], digest)
+			}
+		}
+		sort.Strings(ret.Digests[testName])
+	}
+
+	for corpus, change := range ret.Untriaged {
+		change.Before = len(untriagedBefore[corpus])
+		change.After = len(untriagedAfter[corpus])
+	}
+
+	sort.Strings(ret.TraceIDs)
+	return ret, nil
+}
+
+// matchesAny returns true if the given trace matches any of the queries.
+func matchesAny(trace tiling.Trace, queries []url.Values) bool {
+	for _, q := range queries {
+		if tiling.Matches(trace, q) {
+			return true
+		}
+	}
+	return false
+}
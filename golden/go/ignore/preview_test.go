@@ -0,0 +1,62 @@
+package ignore
+
+import (
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/go/tiling"
+	"go.skia.org/infra/golden/go/expstorage"
+	"go.skia.org/infra/golden/go/types"
+)
+
+func TestPreviewRule(t *testing.T) {
+	testutils.SmallTest(t)
+
+	trace := func(corpus, config, test string, values ...string) *types.GoldenTrace {
+		return &types.GoldenTrace{
+			Params_: map[string]string{types.CORPUS_FIELD: corpus, "config": config, types.PRIMARY_KEY_FIELD: test},
+			Values:  values,
+		}
+	}
+	tile := tiling.NewTile()
+	tile.Traces = map[string]tiling.Trace{
+		"a": trace("gm", "8888", "foo", "d1", "d2"),
+		"b": trace("gm", "gpu", "foo", "d2", "d3", types.MISSING_DIGEST),
+		"c": trace("gm", "gpu", "bar", "d4"),
+		"d": trace("svg", "gpu", "baz", "d5"),
+		// Already ignored by an existing rule.
+		"e": trace("svg", "565", "baz", "d6"),
+	}
+
+	exp := expstorage.NewExpectations()
+	exp.SetTestExpectation("bar", "d4", types.POSITIVE)
+
+	rules := []*IgnoreRule{NewIgnoreRule("jon@example.com", time.Now().Add(time.Hour), "config=565", "")}
+	preview, err := PreviewRule("config=gpu&config=565", rules, tile, exp)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "c", "d"}, preview.TraceIDs)
+	// d2 is still produced by trace a.
+	assert.Equal(t, map[string][]string{
+		"foo": {"d3"},
+		"bar": {"d4"},
+		"baz": {"d5"},
+	}, preview.Digests)
+	assert.Equal(t, map[string]*UntriagedChange{
+		"gm":  {Before: 2, After: 1},
+		"svg": {Before: 1, After: 0},
+	}, preview.Untriaged)
+
+	// A rule that matches nothing has no impact.
+	preview, err = PreviewRule("config=pdf", rules, tile, exp)
+	assert.NoError(t, err)
+	assert.Empty(t, preview.TraceIDs)
+	assert.Empty(t, preview.Digests)
+	assert.Equal(t, 2, preview.Untriaged["gm"].After)
+
+	_, err = PreviewRule("", rules, tile, exp)
+	assert.Error(t, err)
+	_, err = PreviewRule("config=%zz", rules, tile, exp)
+	assert.Error(t, err)
+}
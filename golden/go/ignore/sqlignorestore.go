@@ -127,6 +127,40 @@ func (m *SQLIgnoreStore) Delete(id int64) (int, error) {
 	return int(rowsAffected), nil
 }
 
+// Archive, see IgnoreStore interface.
+func (m *SQLIgnoreStore) Archive(id int64) (n int, retErr error) {
+	const (
+		archiveStmt = `INSERT INTO ignorerule_archive (id, userid, updated_by, expires, query, note, archived)
+		               SELECT id, userid, updated_by, expires, query, note, ? FROM ignorerule WHERE id=?`
+		deleteStmt = `DELETE FROM ignorerule WHERE id=?`
+	)
+
+	// start a transaction
+	tx, err := m.vdb.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() { retErr = database.CommitOrRollback(tx, retErr) }()
+
+	if _, err := tx.Exec(archiveStmt, time.Now().Unix(), id); err != nil {
+		return 0, err
+	}
+
+	ret, err := tx.Exec(deleteStmt, id)
+	if err != nil {
+		return 0, err
+	}
+	rowsAffected, err := ret.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if rowsAffected > 0 {
+		m.inc()
+	}
+	return int(rowsAffected), nil
+}
+
 // Revision, see IngoreStore interface.
 func (m *SQLIgnoreStore) Revision() int64 {
 	m.mutex.Lock()
@@ -21,6 +21,7 @@ import (
 	"go.skia.org/infra/golden/go/expstorage"
 	"go.skia.org/infra/golden/go/paramsets"
 	"go.skia.org/infra/golden/go/pdag"
+	"go.skia.org/infra/golden/go/phash"
 	"go.skia.org/infra/golden/go/storage"
 	"go.skia.org/infra/golden/go/summary"
 	"go.skia.org/infra/golden/go/tally"
@@ -51,6 +52,10 @@ type SearchIndex struct {
 	blamer               *blame.Blamer
 	warmer               *warmer.Warmer
 
+	// hashIndex contains the perceptual hashes of the digests. It is shared
+	// by all instances of SearchIndex and may be nil.
+	hashIndex *phash.Index
+
 	// This is set by the indexing pipeline when we just want to update
 	// individual tests that have changed.
 	testNames []string
@@ -60,7 +65,7 @@ type SearchIndex struct {
 // newSearchIndex creates a new instance of SearchIndex. It is not intended to
 // be used outside of this package. SearchIndex instances are created by the
 // Indexer and retrieved via GetIndex().
-func newSearchIndex(storages *storage.Storage, tilePair *types.TilePair) *SearchIndex {
+func newSearchIndex(storages *storage.Storage, tilePair *types.TilePair, hashIndex *phash.Index) *SearchIndex {
 	return &SearchIndex{
 		tilePair:             tilePair,
 		tallies:              tally.New(),
@@ -70,6 +75,7 @@ func newSearchIndex(storages *storage.Storage, tilePair *types.TilePair) *Search
 		paramsetSummary:      paramsets.New(),
 		blamer:               blame.New(storages),
 		warmer:               warmer.New(storages),
+		hashIndex:            hashIndex,
 		storages:             storages,
 	}
 }
@@ -148,6 +154,13 @@ func (idx *SearchIndex) GetBlame(test, digest string, commits []*tiling.Commit)
 	return idx.blamer.GetBlame(test, digest, commits)
 }
 
+// NearestDigests returns the subset of candidates that are most likely to be
+// closest to the given digest of the given test, according to their perceptual
+// hashes. Only these need to be compared with a full pixel diff.
+func (idx *SearchIndex) NearestDigests(test, digest string, candidates []string) []string {
+	return idx.hashIndex.Nearest(test, digest, candidates, phash.MAX_CANDIDATES)
+}
+
 // Indexer is the type that drive continously indexing as the underlying
 // data change. It uses a DAG that encodes the dependencies of the
 // different components of an index and creates a processing pipeline on top
@@ -157,6 +170,7 @@ type Indexer struct {
 	pipeline       *pdag.Node
 	indexTestsNode *pdag.Node
 	lastIndex      *SearchIndex
+	hashIndex      *phash.Index
 	testNames      []string
 	mutex          sync.RWMutex
 }
@@ -169,6 +183,11 @@ func New(storages *storage.Storage, interval time.Duration) (*Indexer, error) {
 		storages: storages,
 	}
 
+	// Maintain perceptual hashes if the images are available locally.
+	if src, ok := storages.DiffStore.(phash.ImageSource); ok {
+		ret.hashIndex = phash.NewIndex(src)
+	}
+
 	// Set up the processing pipeline.
 	root := pdag.NewNode(pdag.NoOp)
 
@@ -189,6 +208,10 @@ func New(storages *storage.Storage, interval time.Duration) (*Indexer, error) {
 	// parameters depend on tallies.
 	paramsNode := pdag.NewNode(calcParamsets, tallyNode, tallyIgnoresNode)
 	pdag.NewNode(writeKnownHashesList, tallyIgnoresNode)
+	pdag.NewNode(updateHashIndex, tallyIgnoresNode)
+
+	// Auto-triage the digests of every new tile.
+	root.Child(runAutoTriage)
 
 	// summaries depend on tallies and blamer.
 	summaryNode := pdag.NewNode(calcSummaries, tallyNode, blamerNode)
@@ -286,7 +309,7 @@ func (ixr *Indexer) start(interval time.Duration) error {
 func (ixr *Indexer) indexTilePair(tilePair *types.TilePair) error {
 	defer timer.New("indexTilePair").Stop()
 	// Create a new index from the given tile.
-	return ixr.pipeline.Trigger(newSearchIndex(ixr.storages, tilePair))
+	return ixr.pipeline.Trigger(newSearchIndex(ixr.storages, tilePair, ixr.hashIndex))
 }
 
 // indexTest creates an updated index by indexing the given list of expectation changes.
@@ -310,6 +333,7 @@ func (ixr *Indexer) indexTests(testChanges []map[string]types.TestClassification
 		paramsetSummary:      lastIdx.paramsetSummary,
 		blamer:               blame.New(ixr.storages),
 		warmer:               warmer.New(ixr.storages),
+		hashIndex:            lastIdx.hashIndex,
 		testNames:            testNames.Keys(),
 		storages:             lastIdx.storages,
 	}
@@ -436,6 +460,29 @@ func writeKnownHashesList(state interface{}) error {
 	return nil
 }
 
+// updateHashIndex asynchronously updates the perceptual hashes to cover the
+// digests in the tile, including ignored traces.
+func updateHashIndex(state interface{}) error {
+	idx := state.(*SearchIndex)
+	if idx.hashIndex == nil {
+		return nil
+	}
+
+	byTest := idx.TalliesByTest(true)
+	digestsByTest := make(map[string][]string, len(byTest))
+	for test, t := range byTest {
+		digests := make([]string, 0, len(t))
+		for digest := range t {
+			if digest != types.MISSING_DIGEST {
+				digests = append(digests, digest)
+			}
+		}
+		digestsByTest[test] = digests
+	}
+	go idx.hashIndex.Update(digestsByTest)
+	return nil
+}
+
 // writeMasterBaseline asynchronously writes the master baseline to GCS.
 func writeMasterBaseline(state interface{}) error {
 	idx := state.(*SearchIndex)
@@ -454,6 +501,23 @@ func writeMasterBaseline(state interface{}) error {
 	return nil
 }
 
+// runAutoTriage is the pipeline function to auto-triage untriaged digests. It
+// runs asynchronously since it may have to compute many diffs. The resulting
+// expectation changes trigger re-indexing of the affected tests.
+func runAutoTriage(state interface{}) error {
+	idx := state.(*SearchIndex)
+	if idx.storages.AutoTriager == nil {
+		return nil
+	}
+
+	go func() {
+		if err := idx.storages.AutoTriager.Run(idx.tilePair.Tile, idx.NearestDigests); err != nil {
+			sklog.Errorf("Error auto-triaging digests: %s", err)
+		}
+	}()
+	return nil
+}
+
 // runWamer is the pipeline function to run the wamer. It runs it
 // asynchronously since its results are not relevant for the searchIndex.
 func runWarmer(state interface{}) error {
@@ -461,6 +525,6 @@ func runWarmer(state interface{}) error {
 
 	// TODO (stephana): Instead of warming everything we should warm non-ignored
 	// traces with higher priority.
-	go idx.warmer.Run(idx.tilePair.TileWithIgnores, idx.summariesWithIgnores, idx.talliesWithIgnores)
+	go idx.warmer.Run(idx.tilePair.TileWithIgnores, idx.summariesWithIgnores, idx.talliesWithIgnores, idx.hashIndex)
 	return nil
 }
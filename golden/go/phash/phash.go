@@ -0,0 +1,263 @@
+// Package phash computes perceptual hashes of images and maintains an index
+// of them that allows to quickly find the digests that are most likely to be
+// closest to a given digest.
+//
+// Perceptual hashes of similar images differ in few bits, so the Hamming
+// distance between hashes can be used to pre-filter the digests that are
+// compared with a full pixel diff.
+package phash
+
+import (
+	"image"
+	"image/color"
+	"math/bits"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/timer"
+	"go.skia.org/infra/golden/go/diff"
+)
+
+const (
+	// MAX_CANDIDATES is the number of digests with the closest hashes that
+	// should be compared with a full pixel diff.
+	MAX_CANDIDATES = 10
+
+	// hashWidth and hashHeight are the dimensions of the thumbnail that is
+	// used to compute a dHash. Each row yields hashWidth-1 bits.
+	hashWidth  = 9
+	hashHeight = 8
+
+	// loadBatchSize is the number of images that are loaded at once when the
+	// index is updated.
+	loadBatchSize = 100
+)
+
+// Hash is a 64 bit perceptual hash of an image.
+type Hash uint64
+
+// Distance returns the Hamming distance between two hashes, i.e. the number
+// of bits in which they differ.
+func Distance(a, b Hash) int {
+	return bits.OnesCount64(uint64(a ^ b))
+}
+
+// DHash computes the difference hash of the given image: The image is reduced
+// to a 9x8 grayscale thumbnail and each bit of the hash indicates whether a
+// pixel of the thumbnail is brighter than its right neighbor.
+func DHash(img image.Image) Hash {
+	thumb := thumbnail(img)
+	var ret Hash
+	for y := 0; y < hashHeight; y++ {
+		for x := 0; x < hashWidth-1; x++ {
+			ret <<= 1
+			if thumb[y][x] > thumb[y][x+1] {
+				ret |= 1
+			}
+		}
+	}
+	return ret
+}
+
+// thumbnail reduces the image to a hashWidth x hashHeight grid of average
+// luminance values.
+func thumbnail(img image.Image) [hashHeight][hashWidth]float64 {
+	var sums [hashHeight][hashWidth]float64
+	var counts [hashHeight][hashWidth]int
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	for y := 0; y < h; y++ {
+		ty := y * hashHeight / h
+		for x := 0; x < w; x++ {
+			tx := x * hashWidth / w
+			gray := color.Gray16Model.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.Gray16)
+			sums[ty][tx] += float64(gray.Y)
+			counts[ty][tx]++
+		}
+	}
+
+	// Images smaller than the thumbnail leave some cells empty, which
+	// then stay at zero.
+	for y := range sums {
+		for x := range sums[y] {
+			if counts[y][x] > 0 {
+				sums[y][x] /= float64(counts[y][x])
+			}
+		}
+	}
+	return sums
+}
+
+// ImageSource provides the decoded images of digests, e.g. a DiffStore that
+// holds the images locally.
+type ImageSource interface {
+	// GetImages returns the images for the given digests in the same order
+	// or an error if any of them cannot be loaded.
+	GetImages(priority int64, digests []string) ([]*image.NRGBA, error)
+}
+
+// Index holds the perceptual hashes of the digests of each test. It is safe
+// for concurrent use.
+type Index struct {
+	src ImageSource
+
+	// byTest maps test names to the hashes of their digests.
+	byTest map[string]map[string]Hash
+	mutex  sync.RWMutex
+
+	// updating is 1 while Update is in progress.
+	updating int32
+}
+
+// NewIndex returns an empty index that loads images from the given source.
+func NewIndex(src ImageSource) *Index {
+	return &Index{
+		src:    src,
+		byTest: map[string]map[string]Hash{},
+	}
+}
+
+// Update sets the digests of each test to the given ones. Hashes of digests
+// that are already in the index are reused, missing hashes are computed and
+// hashes of digests that are no longer listed are removed. Digests whose
+// images cannot be loaded are left out. If a previous call to Update is still
+// in progress, Update returns immediately.
+func (i *Index) Update(digestsByTest map[string][]string) {
+	if !atomic.CompareAndSwapInt32(&i.updating, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&i.updating, 0)
+	defer timer.New("phash index update").Stop()
+
+	// Collect the known hashes and the digests we need to hash.
+	known := map[string]Hash{}
+	i.mutex.RLock()
+	for _, hashes := range i.byTest {
+		for digest, h := range hashes {
+			known[digest] = h
+		}
+	}
+	i.mutex.RUnlock()
+
+	missing := []string{}
+	for _, digests := range digestsByTest {
+		for _, digest := range digests {
+			if _, ok := known[digest]; !ok {
+				missing = append(missing, digest)
+			}
+		}
+	}
+	for digest, h := range i.hashImages(missing) {
+		known[digest] = h
+	}
+
+	byTest := make(map[string]map[string]Hash, len(digestsByTest))
+	for test, digests := range digestsByTest {
+		hashes := make(map[string]Hash, len(digests))
+		for _, digest := range digests {
+			if h, ok := known[digest]; ok {
+				hashes[digest] = h
+			}
+		}
+		byTest[test] = hashes
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.byTest = byTest
+}
+
+// hashImages computes the hashes of the given digests. Digests whose images
+// cannot be loaded are omitted from the result.
+func (i *Index) hashImages(digests []string) map[string]Hash {
+	ret := make(map[string]Hash, len(digests))
+	seen := make(map[string]bool, len(digests))
+	batch := make([]string, 0, loadBatchSize)
+	flush := func() {
+		imgs, err := i.src.GetImages(diff.PRIORITY_IDLE, batch)
+		if err == nil {
+			for idx, img := range imgs {
+				ret[batch[idx]] = DHash(img)
+			}
+		} else {
+			// Retry the images individually to skip only the failing ones.
+			for _, digest := range batch {
+				imgs, err := i.src.GetImages(diff.PRIORITY_IDLE, []string{digest})
+				if err != nil {
+					sklog.Warningf("Unable to load image %s for perceptual hash: %s", digest, err)
+					continue
+				}
+				ret[digest] = DHash(imgs[0])
+			}
+		}
+		batch = batch[:0]
+	}
+
+	for _, digest := range digests {
+		if seen[digest] {
+			continue
+		}
+		seen[digest] = true
+		batch = append(batch, digest)
+		if len(batch) == loadBatchSize {
+			flush()
+		}
+	}
+	if len(batch) > 0 {
+		flush()
+	}
+	return ret
+}
+
+// Get returns the hash of a digest of the given test.
+func (i *Index) Get(test, digest string) (Hash, bool) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	h, ok := i.byTest[test][digest]
+	return h, ok
+}
+
+// Nearest returns the subset of candidates that should be diffed against
+// digest to find the closest candidate: the k candidates whose hashes are
+// closest to the hash of digest, plus all candidates that have not been hashed
+// yet. If digest has not been hashed, or if i is nil, all candidates are
+// returned.
+func (i *Index) Nearest(test, digest string, candidates []string, k int) []string {
+	if i == nil || len(candidates) <= k {
+		return candidates
+	}
+
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	hashes := i.byTest[test]
+	h, ok := hashes[digest]
+	if !ok {
+		return candidates
+	}
+
+	type candidate struct {
+		digest string
+		dist   int
+	}
+	ret := []string{}
+	hashed := make([]candidate, 0, len(candidates))
+	for _, c := range candidates {
+		if ch, ok := hashes[c]; ok {
+			hashed = append(hashed, candidate{digest: c, dist: Distance(h, ch)})
+		} else {
+			ret = append(ret, c)
+		}
+	}
+	sort.Slice(hashed, func(a, b int) bool {
+		if hashed[a].dist != hashed[b].dist {
+			return hashed[a].dist < hashed[b].dist
+		}
+		return hashed[a].digest < hashed[b].digest
+	})
+	for idx := 0; idx < k && idx < len(hashed); idx++ {
+		ret = append(ret, hashed[idx].digest)
+	}
+	return ret
+}
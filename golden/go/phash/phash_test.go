@@ -0,0 +1,172 @@
+package phash
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/golden/go/diff"
+)
+
+// mapImageSource is an ImageSource backed by a map.
+type mapImageSource map[string]*image.NRGBA
+
+func (m mapImageSource) GetImages(priority int64, digests []string) ([]*image.NRGBA, error) {
+	ret := make([]*image.NRGBA, 0, len(digests))
+	for _, d := range digests {
+		img, ok := m[d]
+		if !ok {
+			return nil, fmt.Errorf("Unknown digest %s", d)
+		}
+		ret = append(ret, img)
+	}
+	return ret, nil
+}
+
+// syntheticImage returns a size x size image with a random arrangement of
+// rectangles, determined by seed. noise pixels are changed randomly.
+func syntheticImage(size int, seed int64, noise int) *image.NRGBA {
+	r := rand.New(rand.NewSource(seed))
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for i := 0; i < 6; i++ {
+		x0, y0 := r.Intn(size), r.Intn(size)
+		x1, y1 := x0+r.Intn(size-x0)+1, y0+r.Intn(size-y0)+1
+		c := color.NRGBA{uint8(r.Intn(256)), uint8(r.Intn(256)), uint8(r.Intn(256)), 255}
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				img.SetNRGBA(x, y, c)
+			}
+		}
+	}
+
+	nr := rand.New(rand.NewSource(int64(noise)))
+	for i := 0; i < noise; i++ {
+		img.SetNRGBA(nr.Intn(size), nr.Intn(size), color.NRGBA{uint8(nr.Intn(256)), 0, 0, 255})
+	}
+	return img
+}
+
+func TestDHash(t *testing.T) {
+	testutils.SmallTest(t)
+
+	base := DHash(syntheticImage(64, 1, 0))
+	assert.Equal(t, base, DHash(syntheticImage(64, 1, 0)))
+	assert.Equal(t, 0, Distance(base, base))
+
+	// Small changes yield similar hashes, different images don't.
+	similar := DHash(syntheticImage(64, 1, 5))
+	different := DHash(syntheticImage(64, 2, 0))
+	assert.True(t, Distance(base, similar) < Distance(base, different))
+
+	assert.Equal(t, 64, Distance(Hash(0), ^Hash(0)))
+}
+
+func TestIndex(t *testing.T) {
+	testutils.SmallTest(t)
+
+	src := mapImageSource{
+		"base":  syntheticImage(32, 1, 0),
+		"close": syntheticImage(32, 1, 3),
+		"far1":  syntheticImage(32, 2, 0),
+		"far2":  syntheticImage(32, 3, 0),
+	}
+	idx := NewIndex(src)
+
+	// Without hashes, all candidates are returned.
+	candidates := []string{"far1", "close", "far2"}
+	assert.Equal(t, candidates, idx.Nearest("test", "base", candidates, 1))
+
+	idx.Update(map[string][]string{
+		"test":  {"base", "close", "far1", "far2", "missing"},
+		"other": {"far1"},
+	})
+	_, ok := idx.Get("test", "missing")
+	assert.False(t, ok)
+	h, ok := idx.Get("other", "far1")
+	assert.True(t, ok)
+	assert.Equal(t, DHash(src["far1"]), h)
+
+	assert.Equal(t, []string{"close"}, idx.Nearest("test", "base", candidates, 1))
+	assert.Len(t, idx.Nearest("test", "base", candidates, 2), 2)
+	assert.Equal(t, candidates, idx.Nearest("test", "base", candidates, 3))
+
+	// Unhashed candidates are always returned.
+	assert.Equal(t, []string{"missing", "close"}, idx.Nearest("test", "base", []string{"missing", "far1", "close"}, 1))
+
+	// Digests of other tests are not considered.
+	assert.Equal(t, candidates, idx.Nearest("other", "base", candidates, 1))
+
+	// Digests that are no longer listed are removed.
+	idx.Update(map[string][]string{"test": {"base"}})
+	_, ok = idx.Get("test", "close")
+	assert.False(t, ok)
+	_, ok = idx.Get("other", "far1")
+	assert.False(t, ok)
+
+	var nilIndex *Index
+	assert.Equal(t, candidates, nilIndex.Nearest("test", "base", candidates, 1))
+}
+
+func TestNearestContainsClosest(t *testing.T) {
+	testutils.SmallTest(t)
+	src, digests, idx := syntheticCorpus(200)
+	expected := closest(src, "target", digests)
+	assert.Equal(t, expected, closest(src, "target", idx.Nearest("test", "target", digests, MAX_CANDIDATES)))
+}
+
+const (
+	benchCorpusSize = 1000
+	benchImageSize  = 64
+)
+
+// syntheticCorpus returns a synthetic corpus of n digests of a single test,
+// which consists of groups of similar images, and an index over it. The
+// digest "target" is not part of the returned digests.
+func syntheticCorpus(n int) (mapImageSource, []string, *Index) {
+	src := make(mapImageSource, n+1)
+	digests := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		digest := fmt.Sprintf("digest-%d", i)
+		src[digest] = syntheticImage(benchImageSize, int64(i%20), i)
+		digests = append(digests, digest)
+	}
+	src["target"] = syntheticImage(benchImageSize, 7, 1)
+	idx := NewIndex(src)
+	idx.Update(map[string][]string{"test": append([]string{"target"}, digests...)})
+	return src, digests, idx
+}
+
+// closest returns the candidate with the smallest combined diff to target.
+func closest(src mapImageSource, target string, candidates []string) string {
+	ret := ""
+	minDiff := float32(math.MaxFloat32)
+	for _, c := range candidates {
+		dm, _ := diff.DefaultDiffFn(src[target], src[c])
+		if d := dm.(*diff.DiffMetrics).Diffs[diff.METRIC_COMBINED]; d < minDiff {
+			minDiff = d
+			ret = c
+		}
+	}
+	return ret
+}
+
+func BenchmarkClosestFullDiff(b *testing.B) {
+	src, digests, _ := syntheticCorpus(benchCorpusSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		closest(src, "target", digests)
+	}
+}
+
+func BenchmarkClosestPHash(b *testing.B) {
+	src, digests, idx := syntheticCorpus(benchCorpusSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		closest(src, "target", idx.Nearest("test", "target", digests, MAX_CANDIDATES))
+	}
+}
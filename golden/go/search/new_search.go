@@ -270,26 +270,20 @@ func (s *SearchAPI) GetDigestDetails(test, digest string) (*SRDigestDetails, err
 }
 
 // getExpectationsFromQuery returns a slice of expectations that should be
-// used in the given query. It will add the issue expectations if this is
-// querying tryjob results. If query is nil the expectations of the master
-// tile are returned.
+// used in the given query. If this is querying tryjob results the
+// expectations of the issue are overlaid on the expectations of master.
+// If query is nil the expectations of the master tile are returned.
 func (s *SearchAPI) getExpectationsFromQuery(q *Query) (ExpSlice, error) {
-	ret := make(ExpSlice, 0, 2)
-
-	if (q != nil) && (q.Issue > 0) {
-		tjExp, err := s.storages.TryjobStore.GetExpectations(q.Issue)
-		if err != nil {
-			return nil, sklog.FmtErrorf("Unable to load expectations from tryjobstore: %s", err)
-		}
-		ret = append(ret, tjExp)
+	issueID := int64(0)
+	if q != nil {
+		issueID = q.Issue
 	}
 
-	exp, err := s.storages.ExpectationsStore.Get()
+	exp, err := s.storages.ExpBranches().Get(issueID)
 	if err != nil {
-		return nil, sklog.FmtErrorf("Unable to load expectations for master: %s", err)
+		return nil, sklog.FmtErrorf("Unable to load expectations: %s", err)
 	}
-	ret = append(ret, exp)
-	return ret, nil
+	return ExpSlice{exp}, nil
 }
 
 // query issue returns the digest related to this issues.
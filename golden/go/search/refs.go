@@ -59,8 +59,8 @@ func (r *RefDiffer) GetRefDiffs(metric string, match []string, test, digest stri
 	negDigests := r.getDigestsWithLabel(test, match, params, paramsByDigest, unavailableDigests, rhsQuery, types.NEGATIVE)
 
 	ret := make(map[string]*SRDiffDigest, 3)
-	ret[REF_CLOSEST_POSTIVE] = r.getClosestDiff(metric, digest, posDigests)
-	ret[REF_CLOSEST_NEGATIVE] = r.getClosestDiff(metric, digest, negDigests)
+	ret[REF_CLOSEST_POSTIVE] = r.getClosestDiff(metric, digest, r.idx.NearestDigests(test, digest, posDigests))
+	ret[REF_CLOSEST_NEGATIVE] = r.getClosestDiff(metric, digest, r.idx.NearestDigests(test, digest, negDigests))
 
 	// TODO(stephana): Add a diff to the previous digest in the trace.
 
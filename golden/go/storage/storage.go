@@ -19,6 +19,7 @@ import (
 	"go.skia.org/infra/go/tiling"
 	tracedb "go.skia.org/infra/go/trace/db"
 	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/golden/go/autotriage"
 	"go.skia.org/infra/golden/go/baseline"
 	"go.skia.org/infra/golden/go/diff"
 	"go.skia.org/infra/golden/go/digeststore"
@@ -46,6 +47,10 @@ type Storage struct {
 	Git               *gitinfo.GitInfo
 	WhiteListQuery    paramtools.ParamSet
 
+	// AutoTriager marks untriaged digests as positive whenever a new tile is
+	// indexed. It is nil if no auto-triage rules are configured.
+	AutoTriager *autotriage.AutoTriager
+
 	// NCommits is the number of commits we should consider. If NCommits is
 	// 0 or smaller all commits in the last tile will be considered.
 	NCommits int
@@ -58,6 +63,12 @@ type Storage struct {
 	mutex                  sync.Mutex
 }
 
+// ExpBranches returns the master expectations combined with the expectation
+// branches of Gerrit issues, which are kept in the TryjobStore.
+func (s *Storage) ExpBranches() *expstorage.ExpBranches {
+	return expstorage.NewExpBranches(s.ExpectationsStore, s.TryjobStore)
+}
+
 // CanWriteBaseline returns true if this instance was configured to write baseline files.
 func (s *Storage) CanWriteBaseline() bool {
 	return (s.GStorageClient != nil) && (s.GStorageClient.options.BaselineGSPath != "")
@@ -390,8 +401,8 @@ func (s *Storage) checkCommitableIssues(tile *tiling.Tile) {
 						return sklog.FmtErrorf("Unable to extract gerrit issue from commit %s. Got error: %s", commit.Hash, err)
 					}
 
-					if err := baseline.CommitIssueBaseline(issueID, longCommit.Author, s.TryjobStore, s.ExpectationsStore); err != nil {
-						return sklog.FmtErrorf("Error retrieving details for commit %s. Got error: %s", commit.Hash, err)
+					if err := baseline.CommitIssueBaseline(issueID, s.TryjobStore, s.ExpBranches()); err != nil {
+						return sklog.FmtErrorf("Error merging expectations for commit %s. Got error: %s", commit.Hash, err)
 					}
 					return nil
 				})
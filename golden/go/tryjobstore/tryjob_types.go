@@ -10,6 +10,7 @@ import (
 	"cloud.google.com/go/datastore"
 	"go.skia.org/infra/go/buildbucket"
 	"go.skia.org/infra/go/paramtools"
+	"go.skia.org/infra/golden/go/expstorage"
 )
 
 // TODO(stephana): Move the UNKNOWN status to the first spot, so that we can
@@ -100,6 +101,11 @@ type Issue struct {
 	QueryPatchsets  []int64           `json:"queryPatchsets"    datastore:"-"`
 	CommentAdded    bool              `json:"-"                 datastore:",noindex"`
 
+	// MergeConflicts are the expectations of the issue that were not merged
+	// into master when the issue was committed, because they conflicted with
+	// concurrent changes in master.
+	MergeConflicts []*expstorage.MergeConflict `json:"mergeConflicts" datastore:",noindex"`
+
 	clean bool
 }
 
@@ -66,9 +66,11 @@ type TryjobStore interface {
 	UpdateIssue(details *Issue, updateFn NewValueFn) error
 
 	// CommitIssueExp commits the expecations of the given issue. The writeFn
-	// is expected to make the changes to the master baseline. An issue is
-	// marked as committed if the writeFn runs without error.
-	CommitIssueExp(issueID int64, writeFn func() error) error
+	// is expected to make the changes to the master baseline and return the
+	// changes that could not be made because of conflicts. An issue is
+	// marked as committed if the writeFn runs without error and the returned
+	// conflicts are stored in the issue.
+	CommitIssueExp(issueID int64, writeFn func() ([]*expstorage.MergeConflict, error)) error
 
 	// DeleteIssue deletes the given issue and related information.
 	DeleteIssue(issueID int64) error
@@ -109,7 +111,8 @@ type TryjobStore interface {
 	// UndoChange reverts a previous expectations change for this issue.
 	UndoChange(issueID int64, changeID int64, userID string) (map[string]types.TestClassification, error)
 
-	// QueryLog returns a list of expectation changes for the given issue.
+	// QueryLog returns a list of expectation changes for the given issue. If
+	// details is true each entry contains the individual triage operations.
 	QueryLog(issueID int64, offset, size int, details bool) ([]*expstorage.TriageLogEntry, int, error)
 }
 
@@ -207,7 +210,7 @@ func (c *cloudTryjobStore) UpdateIssue(details *Issue, updateFn NewValueFn) erro
 }
 
 // CommitIssueExp implements the TryjobStore interface.
-func (c *cloudTryjobStore) CommitIssueExp(issueID int64, commitFn func() error) error {
+func (c *cloudTryjobStore) CommitIssueExp(issueID int64, commitFn func() ([]*expstorage.MergeConflict, error)) error {
 	// setCommittedFn is executed in a transaction below
 	setCommittedFn := func(tx *datastore.Transaction) error {
 		issue := &Issue{}
@@ -227,11 +230,13 @@ func (c *cloudTryjobStore) CommitIssueExp(issueID int64, commitFn func() error)
 		}
 
 		// Execute the commit function to commit the actual expectations.
-		if err := commitFn(); err != nil {
+		conflicts, err := commitFn()
+		if err != nil {
 			return err
 		}
 
 		issue.Committed = true
+		issue.MergeConflicts = conflicts
 		_, err = c.updateEntity(key, issue, tx, true, nil)
 		return err
 	}
@@ -473,8 +478,8 @@ func (c *cloudTryjobStore) GetExpectations(issueID int64) (exp *expstorage.Expec
 	return ret, nil
 }
 
-// TODO(stephana): Implement the UndoChange and QueryLog methods once the corresponding
-// endpoints in skiacorrectness exist.
+// TODO(stephana): Implement the UndoChange method once the corresponding
+// endpoint in skiacorrectness exists.
 
 // UndoChange implements the TryjobStore interface.
 func (c *cloudTryjobStore) UndoChange(issueID int64, changeID int64, userID string) (map[string]types.TestClassification, error) {
@@ -506,6 +511,34 @@ func (c *cloudTryjobStore) QueryLog(issueID int64, offset, size int, details boo
 		})
 	}
 
+	if details {
+		var egroup errgroup.Group
+		for idx, change := range expChanges {
+			func(entry *expstorage.TriageLogEntry, changeKey *datastore.Key) {
+				egroup.Go(func() error {
+					_, exps, err := c.getTestDigestExps(changeKey, false)
+					if err != nil {
+						return err
+					}
+					entry.Details = make([]*expstorage.TriageDetail, 0, len(exps))
+					for _, exp := range exps {
+						entry.Details = append(entry.Details, &expstorage.TriageDetail{
+							TestName: exp.Name,
+							Digest:   exp.Digest,
+							Label:    exp.Label,
+						})
+					}
+					entry.ChangeCount = len(entry.Details)
+					return nil
+				})
+			}(ret[idx], change.ChangeID)
+		}
+
+		if err := egroup.Wait(); err != nil {
+			return nil, 0, sklog.FmtErrorf("Error retrieving details of expectation changes: %s", err)
+		}
+	}
+
 	return ret, len(allKeys), nil
 }
 
@@ -213,6 +213,15 @@ func testTryjobStore(t *testing.T, store TryjobStore) {
 	assert.Equal(t, 5, total)
 	assert.Equal(t, 5, len(logEntries))
 
+	logEntries, total, err = store.QueryLog(issueID, 0, -1, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, total)
+	assert.Equal(t, 5, len(logEntries))
+	for idx, entry := range logEntries {
+		assert.Equal(t, expLogEntries[idx].ChangeCount, entry.ChangeCount)
+		assert.Equal(t, expLogEntries[idx].GetChanges(), entry.GetChanges())
+	}
+
 	// Flip all expectations to untriaged.
 	for _, digests := range foundExp.Tests {
 		for digest := range digests {
@@ -227,22 +236,31 @@ func testTryjobStore(t *testing.T, store TryjobStore) {
 	assert.Equal(t, foundExp, untriagedExp)
 
 	// Test commiting where the commit fails.
-	assert.Error(t, store.CommitIssueExp(issueID, func() error {
-		return errors.New("Write failed")
+	assert.Error(t, store.CommitIssueExp(issueID, func() ([]*expstorage.MergeConflict, error) {
+		return nil, errors.New("Write failed")
 	}))
 	foundIssue, err = store.GetIssue(issueID, false)
 	assert.NoError(t, err)
 	assert.False(t, foundIssue.Committed)
 
 	// Test commiting the changes.
-	assert.NoError(t, store.CommitIssueExp(issueID, func() error {
+	conflicts := []*expstorage.MergeConflict{{
+		TestName:    "test-1",
+		Digest:      "digest-1",
+		BranchLabel: types.POSITIVE,
+		BranchUser:  userName,
+		MasterLabel: types.NEGATIVE,
+		MasterUser:  "other@example.com",
+	}}
+	assert.NoError(t, store.CommitIssueExp(issueID, func() ([]*expstorage.MergeConflict, error) {
 		// Assume that writing the master baseline works.
-		return nil
+		return conflicts, nil
 	}))
 
 	foundIssue, err = store.GetIssue(issueID, false)
 	assert.NoError(t, err)
 	assert.True(t, foundIssue.Committed)
+	assert.Equal(t, conflicts, foundIssue.MergeConflicts)
 }
 
 func checkEqualIssue(t *testing.T, exp *Issue, actual *Issue) {
@@ -11,6 +11,7 @@ import (
 	"go.skia.org/infra/go/util"
 	"go.skia.org/infra/golden/go/diff"
 	"go.skia.org/infra/golden/go/digesttools"
+	"go.skia.org/infra/golden/go/phash"
 	"go.skia.org/infra/golden/go/storage"
 	"go.skia.org/infra/golden/go/summary"
 	"go.skia.org/infra/golden/go/tally"
@@ -33,7 +34,9 @@ func New(storages *storage.Storage) *Warmer {
 }
 
 // Run prefetches the digests in tile and calculates differences we'll need.
-func (w *Warmer) Run(tile *tiling.Tile, summaries *summary.Summaries, tallies *tally.Tallies) {
+// If hashIndex is not nil, only the diffs to the digests with the nearest
+// perceptual hashes are calculated.
+func (w *Warmer) Run(tile *tiling.Tile, summaries *summary.Summaries, tallies *tally.Tallies, hashIndex *phash.Index) {
 	exp, err := w.storages.ExpectationsStore.Get()
 	if err != nil {
 		sklog.Errorf("warmer: Failed to get expectations: %s", err)
@@ -45,8 +48,8 @@ func (w *Warmer) Run(tile *tiling.Tile, summaries *summary.Summaries, tallies *t
 			t := tallies.ByTest()[test]
 			if t != nil {
 				// Calculate the closest digest for the side effect of filling in the filediffstore cache.
-				digesttools.ClosestDigest(test, digest, exp, t, w.storages.DiffStore, types.POSITIVE)
-				digesttools.ClosestDigest(test, digest, exp, t, w.storages.DiffStore, types.NEGATIVE)
+				digesttools.ClosestDigestByMetric(test, digest, exp, t, w.storages.DiffStore, types.POSITIVE, diff.METRIC_COMBINED, hashIndex)
+				digesttools.ClosestDigestByMetric(test, digest, exp, t, w.storages.DiffStore, types.NEGATIVE, diff.METRIC_COMBINED, hashIndex)
 			}
 		}
 	}
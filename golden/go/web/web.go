@@ -279,6 +279,36 @@ func (wh *WebHandlers) JsonTryjobSummaryHandler(w http.ResponseWriter, r *http.R
 	sendJsonResponse(w, resp)
 }
 
+// JsonTryjobMergeConflictsHandler returns the expectations of a committed
+// issue that were not merged into master because they conflicted with
+// concurrent changes in master.
+func (wh *WebHandlers) JsonTryjobMergeConflictsHandler(w http.ResponseWriter, r *http.Request) {
+	issueID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		httputils.ReportError(w, r, err, "ID must be valid integer.")
+		return
+	}
+
+	issue, err := wh.Storages.TryjobStore.GetIssue(issueID, false)
+	if err != nil {
+		httputils.ReportError(w, r, err, "Unable to retrieve issue.")
+		return
+	}
+	if issue == nil {
+		httputils.ReportError(w, r, fmt.Errorf("Unknown issue %d", issueID), "Issue not found.")
+		return
+	}
+
+	conflicts := issue.MergeConflicts
+	if conflicts == nil {
+		conflicts = []*expstorage.MergeConflict{}
+	}
+	sendJsonResponse(w, map[string]interface{}{
+		"committed": issue.Committed,
+		"conflicts": conflicts,
+	})
+}
+
 // JsonSearchHandler is the endpoint for all searches.
 func (wh *WebHandlers) JsonSearchHandler(w http.ResponseWriter, r *http.Request) {
 	query, ok := parseSearchQuery(w, r)
@@ -521,6 +551,46 @@ func (wh *WebHandlers) JsonIgnoresAddHandler(w http.ResponseWriter, r *http.Requ
 	wh.JsonIgnoresHandler(w, r)
 }
 
+// JsonIgnoresPreviewHandler returns the impact a new ignore rule would have
+// on the current tile without saving the rule.
+func (wh *WebHandlers) JsonIgnoresPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	req := &IgnoresRequest{}
+	if err := parseJson(r, req); err != nil {
+		httputils.ReportError(w, r, err, "Failed to parse submitted data.")
+		return
+	}
+	if req.Filter == "" {
+		httputils.ReportError(w, r, fmt.Errorf("Invalid Filter: %q", req.Filter), "Filters can't be empty.")
+		return
+	}
+
+	tilePair, err := wh.Storages.GetLastTileTrimmed()
+	if err != nil {
+		httputils.ReportError(w, r, err, "Failed to load tile")
+		return
+	}
+
+	rules, err := wh.Storages.IgnoreStore.List(false)
+	if err != nil {
+		httputils.ReportError(w, r, err, "Failed to retrieve ignore rules.")
+		return
+	}
+
+	exp, err := wh.Storages.ExpectationsStore.Get()
+	if err != nil {
+		httputils.ReportError(w, r, err, "Failed to load expectations.")
+		return
+	}
+
+	preview, err := ignore.PreviewRule(req.Filter, rules, tilePair.TileWithIgnores, exp)
+	if err != nil {
+		httputils.ReportError(w, r, err, "Failed to preview ignore rule.")
+		return
+	}
+
+	sendJsonResponse(w, preview)
+}
+
 // TriageRequest is the form of the JSON posted to jsonTriageHandler.
 type TriageRequest struct {
 	// TestDigestStatus maps status to test name and digests as: map[testName][digest]status
@@ -22,7 +22,7 @@ type Config struct {
 	ID             int64                   `json:"id"               datastore:",noindex"`
 	DisplayName    string                  `json:"display_name"     datastore:",noindex"`
 	Query          string                  `json:"query"            datastore:",noindex"` // The query to perform on the trace store to select the traces to alert on.
-	Alert          string                  `json:"alert"            datastore:",noindex"` // Email address or id of a chat room to send alerts to.
+	Alert          string                  `json:"alert"            datastore:",noindex"` // Comma separated list of targets to send alerts to, see notify.Notifier.
 	Interesting    float32                 `json:"interesting"      datastore:",noindex"` // The regression interestingness threshold.
 	BugURITemplate string                  `json:"bug_uri_template" datastore:",noindex"` // URI Template used for reporting bugs. Format TBD.
 	Algo           clustering2.ClusterAlgo `json:"algo"             datastore:",noindex"` // Which clustering algorithm to use.
@@ -35,6 +35,8 @@ type Config struct {
 	GroupBy        string                  `json:"group_by"         datastore:",noindex"` // A key in the paramset that all Clustering should be broken up across. Key must not appear in Query.
 	Sparse         bool                    `json:"sparse"           datastore:",noindex"` // Data is sparse, so only include commits that have data.
 	MinimumNum     int                     `json:"minimum_num"      datastore:",noindex"` // How many traces need to be found interesting before an alert is fired.
+	MaxPValue      float64                 `json:"max_p_value"      datastore:",noindex"` // If > 0 then only clusters with a step that is statistically significant at this level will trigger an alert.
+	Snoozes        []Snooze                `json:"snoozes"          datastore:",noindex"` // Windows during which notifications are suppressed.
 }
 
 func (c *Config) IdAsString() string {
@@ -59,6 +61,14 @@ func (c *Config) Validate() error {
 			return fmt.Errorf("Invalid Config: GroupBy must not appear in Query: %q %q ", c.GroupBy, c.Query)
 		}
 	}
+	if c.MaxPValue < 0 || c.MaxPValue > 1 {
+		return fmt.Errorf("Invalid Config: MaxPValue must be in [0, 1]: %g", c.MaxPValue)
+	}
+	for i := range c.Snoozes {
+		if err := c.Snoozes[i].Validate(); err != nil {
+			return fmt.Errorf("Invalid Config: %s", err)
+		}
+	}
 	if c.StepUpOnly {
 		c.StepUpOnly = false
 		c.Direction = UP
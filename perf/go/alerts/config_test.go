@@ -36,4 +36,11 @@ func TestValidate(t *testing.T) {
 	a.Query = "bar=baz&foo=quux"
 	assert.Error(t, a.Validate())
 
+	a = NewConfig()
+	a.MaxPValue = 0.05
+	assert.NoError(t, a.Validate())
+	a.MaxPValue = 1.5
+	assert.Error(t, a.Validate())
+	a.MaxPValue = -0.1
+	assert.Error(t, a.Validate())
 }
@@ -8,6 +8,7 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"time"
 
 	"cloud.google.com/go/datastore"
 	"go.skia.org/infra/go/ds"
@@ -58,6 +59,51 @@ func (s *Store) Delete(id int) error {
 	return err
 }
 
+// Snooze adds the Snooze to the Config with the given id, and drops any of
+// its Snoozes that have expired. It returns the updated Config.
+func (s *Store) Snooze(id int, snooze Snooze) (*Config, error) {
+	if err := snooze.Validate(); err != nil {
+		return nil, fmt.Errorf("Failed to snooze: %s", err)
+	}
+	return s.updateSnoozes(id, func(cfg *Config) {
+		cfg.RemoveExpiredSnoozes(time.Now())
+		cfg.Snoozes = append(cfg.Snoozes, snooze)
+	})
+}
+
+// Unsnooze removes all the Snoozes from the Config with the given id. It
+// returns the updated Config.
+func (s *Store) Unsnooze(id int) (*Config, error) {
+	return s.updateSnoozes(id, func(cfg *Config) {
+		cfg.Snoozes = []Snooze{}
+	})
+}
+
+// updateSnoozes applies the change to the Config with the given id in a
+// transaction.
+func (s *Store) updateSnoozes(id int, change func(cfg *Config)) (*Config, error) {
+	key := ds.NewKey(ds.ALERT)
+	key.ID = int64(id)
+
+	cfg := NewConfig()
+	_, err := ds.DS.RunInTransaction(context.TODO(), func(tx *datastore.Transaction) error {
+		cfg = NewConfig()
+		if err := tx.Get(key, cfg); err != nil {
+			return fmt.Errorf("Failed to retrieve from datastore: %s", err)
+		}
+		change(cfg)
+		if _, err := tx.Put(key, cfg); err != nil {
+			return fmt.Errorf("Failed to write to database: %s", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	cfg.ID = int64(id)
+	return cfg, nil
+}
+
 // ConfigSlice is a utility type for sorting Configs by DisplayName.
 type ConfigSlice []*Config
 
@@ -60,3 +60,43 @@ func TestDS(t *testing.T) {
 	assert.Equal(t, "bar", cfgs[0].DisplayName)
 	assert.Equal(t, "foo", cfgs[1].DisplayName)
 }
+
+func TestSnooze(t *testing.T) {
+	testutils.LargeTest(t)
+	testutils.LocalOnlyTest(t)
+
+	cleanup := testutil.InitDatastore(t, ds.ALERT)
+	defer cleanup()
+
+	a := NewStore()
+	cfg := NewConfig()
+	cfg.Query = "source_type=svg"
+	err := a.Save(cfg)
+	assert.NoError(t, err)
+	cfgs, err := a.List(false)
+	assert.NoError(t, err)
+	assert.Len(t, cfgs, 1)
+	id := int(cfgs[0].ID)
+
+	// Invalid snoozes are rejected.
+	_, err = a.Snooze(id, Snooze{})
+	assert.Error(t, err)
+
+	now := time.Now().Unix()
+	expired := Snooze{Begin: now - 20, End: now - 10, Owner: "fred@example.com"}
+	active := Snooze{End: now + 3600, Query: "config=8888", Owner: "barney@example.com"}
+	_, err = a.Snooze(id, expired)
+	assert.NoError(t, err)
+	updated, err := a.Snooze(id, active)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(id), updated.ID)
+	assert.Equal(t, []Snooze{active}, updated.Snoozes)
+
+	cfgs, err = a.List(false)
+	assert.NoError(t, err)
+	assert.Equal(t, []Snooze{active}, cfgs[0].Snoozes)
+
+	updated, err = a.Unsnooze(id)
+	assert.NoError(t, err)
+	assert.Len(t, updated.Snoozes, 0)
+}
@@ -0,0 +1,134 @@
+package alerts
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"go.skia.org/infra/go/query"
+)
+
+// Snooze is a window during which notifications for an alert are suppressed.
+// Regressions found during the window are still recorded.
+//
+// A Snooze is bounded by time, by commit, or both, and it is only active while
+// within all of its bounds.
+type Snooze struct {
+	// Query restricts the Snooze to clusters where every trace matches the
+	// query, in the same format as Config.Query. If empty the Snooze applies
+	// to every cluster the alert finds.
+	Query string `json:"query" datastore:",noindex"`
+
+	// Begin and End are the time bounds of the Snooze in seconds since the
+	// epoch. An End of 0 means the Snooze is not bounded by time.
+	Begin int64 `json:"begin" datastore:",noindex"`
+	End   int64 `json:"end" datastore:",noindex"`
+
+	// EndCommit is the offset of the first commit that isn't covered by the
+	// Snooze, i.e. regressions at commits before it are snoozed. 0 means the
+	// Snooze is not bounded by commit.
+	EndCommit int `json:"end_commit" datastore:",noindex"`
+
+	Owner   string `json:"owner" datastore:",noindex"`   // Email address of the person that created the Snooze.
+	Reason  string `json:"reason" datastore:",noindex"`  // Why the alert was snoozed.
+	Created int64  `json:"created" datastore:",noindex"` // When the Snooze was created, in seconds since the epoch.
+}
+
+// Validate returns an error if the Snooze isn't valid.
+func (s *Snooze) Validate() error {
+	if s.End == 0 && s.EndCommit == 0 {
+		return fmt.Errorf("Invalid Snooze: Must be bounded by time or by commit.")
+	}
+	if s.End != 0 && s.End <= s.Begin {
+		return fmt.Errorf("Invalid Snooze: End must come after Begin: %d %d", s.Begin, s.End)
+	}
+	if s.EndCommit < 0 {
+		return fmt.Errorf("Invalid Snooze: Invalid EndCommit: %d", s.EndCommit)
+	}
+	if _, err := s.parseQuery(); err != nil {
+		return fmt.Errorf("Invalid Snooze: %s", err)
+	}
+	return nil
+}
+
+// parseQuery returns the parsed Query, or nil if the Snooze has no query.
+func (s *Snooze) parseQuery() (*query.Query, error) {
+	if s.Query == "" {
+		return nil, nil
+	}
+	values, err := url.ParseQuery(s.Query)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid Query: %s", err)
+	}
+	q, err := query.New(values)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid Query: %s", err)
+	}
+	return q, nil
+}
+
+// Expired returns true if the time bound of the Snooze has passed. Snoozes
+// that are only bounded by commit never expire.
+func (s *Snooze) Expired(now time.Time) bool {
+	return s.End != 0 && now.Unix() >= s.End
+}
+
+// Active returns true if the Snooze applies at the given time to a
+// regression at the given commit offset.
+func (s *Snooze) Active(now time.Time, offset int) bool {
+	if now.Unix() < s.Begin {
+		return false
+	}
+	if s.Expired(now) {
+		return false
+	}
+	if s.EndCommit != 0 && offset >= s.EndCommit {
+		return false
+	}
+	return true
+}
+
+// Matches returns true if the Snooze applies to a cluster with the given
+// trace ids.
+func (s *Snooze) Matches(keys []string) bool {
+	q, err := s.parseQuery()
+	if err != nil {
+		return false
+	}
+	if q == nil {
+		return true
+	}
+	if len(keys) == 0 {
+		return false
+	}
+	for _, key := range keys {
+		if !q.Matches(key) {
+			return false
+		}
+	}
+	return true
+}
+
+// Snoozed returns the first Snooze of the Config that suppresses
+// notifications at the given time for a cluster with the given trace ids
+// at the given commit offset, or nil if notifications should be sent.
+func (c *Config) Snoozed(now time.Time, offset int, keys []string) *Snooze {
+	for i := range c.Snoozes {
+		if c.Snoozes[i].Active(now, offset) && c.Snoozes[i].Matches(keys) {
+			return &c.Snoozes[i]
+		}
+	}
+	return nil
+}
+
+// RemoveExpiredSnoozes removes the Snoozes that have expired at the given
+// time.
+func (c *Config) RemoveExpiredSnoozes(now time.Time) {
+	snoozes := []Snooze{}
+	for _, s := range c.Snoozes {
+		if !s.Expired(now) {
+			snoozes = append(snoozes, s)
+		}
+	}
+	c.Snoozes = snoozes
+}
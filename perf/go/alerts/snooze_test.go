@@ -0,0 +1,85 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.skia.org/infra/go/testutils"
+)
+
+func TestSnoozeValidate(t *testing.T) {
+	testutils.SmallTest(t)
+	assert.Error(t, (&Snooze{}).Validate())
+	assert.Error(t, (&Snooze{Begin: 20, End: 10}).Validate())
+	assert.Error(t, (&Snooze{EndCommit: -1}).Validate())
+	assert.Error(t, (&Snooze{End: 10, Query: "config=%zz"}).Validate())
+	assert.Error(t, (&Snooze{End: 10, Query: "config=~("}).Validate())
+	assert.NoError(t, (&Snooze{End: 10}).Validate())
+	assert.NoError(t, (&Snooze{EndCommit: 10}).Validate())
+	assert.NoError(t, (&Snooze{Begin: 5, End: 10, EndCommit: 10, Query: "config=8888"}).Validate())
+
+	cfg := NewConfig()
+	cfg.Snoozes = []Snooze{{End: 10}, {}}
+	assert.Error(t, cfg.Validate())
+	cfg.Snoozes = []Snooze{{End: 10}}
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestSnoozeActive(t *testing.T) {
+	testutils.SmallTest(t)
+	s := &Snooze{Begin: 100, End: 200}
+	assert.False(t, s.Active(time.Unix(99, 0), 1))
+	assert.True(t, s.Active(time.Unix(100, 0), 1))
+	assert.True(t, s.Active(time.Unix(199, 0), 1000))
+	assert.False(t, s.Active(time.Unix(200, 0), 1))
+	assert.False(t, s.Expired(time.Unix(199, 0)))
+	assert.True(t, s.Expired(time.Unix(200, 0)))
+
+	s = &Snooze{EndCommit: 50}
+	assert.True(t, s.Active(time.Unix(1000, 0), 49))
+	assert.False(t, s.Active(time.Unix(1000, 0), 50))
+	assert.False(t, s.Expired(time.Unix(1000000, 0)))
+
+	// Both bounds must hold.
+	s = &Snooze{End: 200, EndCommit: 50}
+	assert.True(t, s.Active(time.Unix(100, 0), 49))
+	assert.False(t, s.Active(time.Unix(100, 0), 50))
+	assert.False(t, s.Active(time.Unix(200, 0), 49))
+}
+
+func TestSnoozeMatches(t *testing.T) {
+	testutils.SmallTest(t)
+	s := &Snooze{End: 200}
+	assert.True(t, s.Matches([]string{",config=8888,"}))
+	assert.True(t, s.Matches([]string{}))
+
+	s = &Snooze{End: 200, Query: "config=8888&arch=x86"}
+	assert.True(t, s.Matches([]string{",arch=x86,config=8888,"}))
+	assert.True(t, s.Matches([]string{",arch=x86,config=8888,", ",arch=x86,config=8888,os=linux,"}))
+	assert.False(t, s.Matches([]string{",arch=x86,config=8888,", ",arch=x86,config=565,"}))
+	assert.False(t, s.Matches([]string{}))
+}
+
+func TestConfigSnoozed(t *testing.T) {
+	testutils.SmallTest(t)
+	cfg := NewConfig()
+	now := time.Unix(150, 0)
+	keys := []string{",arch=x86,config=8888,"}
+	assert.Nil(t, cfg.Snoozed(now, 10, keys))
+
+	cfg.Snoozes = []Snooze{
+		{End: 100},
+		{End: 200, Query: "config=565"},
+		{End: 200, Query: "config=8888", Reason: "noisy"},
+	}
+	assert.Equal(t, "noisy", cfg.Snoozed(now, 10, keys).Reason)
+	assert.Nil(t, cfg.Snoozed(now, 10, []string{",arch=x86,config=gpu,"}))
+	assert.Nil(t, cfg.Snoozed(time.Unix(200, 0), 10, keys))
+
+	cfg.RemoveExpiredSnoozes(now)
+	assert.Len(t, cfg.Snoozes, 2)
+	cfg.RemoveExpiredSnoozes(time.Unix(200, 0))
+	assert.Len(t, cfg.Snoozes, 0)
+}
@@ -61,13 +61,14 @@ type ClusterAlgo string
 //
 // Update algo-select-sk if this enum is changed.
 const (
-	KMEANS_ALGO  ClusterAlgo = "kmeans"  // Cluster traces using k-means clustering on their shapes.
-	STEPFIT_ALGO ClusterAlgo = "stepfit" // Look at each trace individually and determing if it steps up or down.
-	TAIL_ALGO    ClusterAlgo = "tail"    // Whether a trace has a jumping tail (a step in the end)
+	KMEANS_ALGO      ClusterAlgo = "kmeans"      // Cluster traces using k-means clustering on their shapes.
+	STEPFIT_ALGO     ClusterAlgo = "stepfit"     // Look at each trace individually and determing if it steps up or down.
+	TAIL_ALGO        ClusterAlgo = "tail"        // Whether a trace has a jumping tail (a step in the end)
+	CHANGEPOINT_ALGO ClusterAlgo = "changepoint" // Look at each trace individually and find the best turning point anywhere in the trace.
 )
 
 var (
-	allClusterAlgos = []ClusterAlgo{KMEANS_ALGO, STEPFIT_ALGO, TAIL_ALGO}
+	allClusterAlgos = []ClusterAlgo{KMEANS_ALGO, STEPFIT_ALGO, TAIL_ALGO, CHANGEPOINT_ALGO}
 )
 
 func ToClusterAlgo(s string) (ClusterAlgo, error) {
@@ -91,6 +92,7 @@ type ClusterRequest struct {
 	Algo        ClusterAlgo `json:"algo"`
 	Interesting float32     `json:"interesting"`
 	Sparse      bool        `json:"sparse"`
+	MaxPValue   float64     `json:"max_p_value"` // If > 0 then drop clusters that aren't statistically significant at this level.
 }
 
 func (c *ClusterRequest) Id() string {
@@ -460,7 +462,7 @@ func (p *ClusterRequestProcess) Run(ctx context.Context) {
 		k = int(math.Floor((40.0/30000.0)*float64(n) + 10))
 	}
 	sklog.Infof("Clustering with K=%d", k)
-	summary, err := CalculateClusterSummaries(df, k, config.MIN_STDDEV, p.clusterProgress, p.request.Interesting, p.request.Algo)
+	summary, err := CalculateClusterSummaries(df, k, config.MIN_STDDEV, p.clusterProgress, p.request.Interesting, p.request.Algo, p.request.MaxPValue)
 	if err != nil {
 		p.reportError(err, "Invalid clustering.")
 		return
@@ -13,6 +13,7 @@ import (
 	"go.skia.org/infra/perf/go/ctrace2"
 	"go.skia.org/infra/perf/go/dataframe"
 	"go.skia.org/infra/perf/go/kmeans"
+	"go.skia.org/infra/perf/go/significance"
 	"go.skia.org/infra/perf/go/stepfit"
 )
 
@@ -59,6 +60,23 @@ type ClusterSummary struct {
 
 	// Num is the number of observations that are in this cluster.
 	Num int `json:"num"`
+
+	// Significance is the result of the significance stage, and is nil if
+	// significance testing wasn't requested.
+	Significance *Significance `json:"significance,omitempty"`
+}
+
+// Significance describes how statistically significant the step in a cluster
+// is. Used in ClusterSummary.
+type Significance struct {
+	// PValue is the median of TracePValues. The smaller the value the less
+	// likely it is that the step is just noise.
+	PValue float64 `json:"p_value"`
+
+	// TracePValues maps each trace id in ClusterSummary.Keys to the p-value of
+	// a Mann-Whitney U test comparing the trace values before and after the
+	// StepPoint.
+	TracePValues map[string]float64 `json:"trace_p_values"`
 }
 
 // newClusterSummary returns a new ClusterSummary.
@@ -261,8 +279,115 @@ func FilterTail(trace []float32, quantile float64, multiplier float64, slack flo
 	}
 }
 
-// CalculateClusterSummaries runs k-means clustering over the trace shapes.
-func CalculateClusterSummaries(df *dataframe.DataFrame, k int, stddevThreshold float32, progress Progress, interesting float32, algo ClusterAlgo) (*ClusterSummaries, error) {
+// changePointKey identifies a cluster found by CHANGEPOINT_ALGO.
+type changePointKey struct {
+	status       string
+	turningPoint int
+}
+
+// calculateChangePointSummaries looks for the best turning point in each
+// trace individually via stepfit.GetStepFitBest.
+//
+// Interesting traces are grouped into one cluster for each direction and
+// turning point, so traces that step at different commits are never reported
+// together. Within a cluster the trace with the highest Confidence is used as
+// the centroid.
+func calculateChangePointSummaries(df *dataframe.DataFrame, k int, stddevThreshold float32, interesting float32) *ClusterSummaries {
+	clusters := map[changePointKey]*ClusterSummary{}
+	count := 0
+	for key, trace := range df.TraceSet {
+		count++
+		if count%10000 == 0 {
+			sklog.Infof("changepoint count: %d", count)
+		}
+		t := vec32.Dup(trace)
+		vec32.Norm(t, stddevThreshold)
+		sf := stepfit.GetStepFitBest(t, interesting)
+		if sf.Status != stepfit.LOW && sf.Status != stepfit.HIGH {
+			continue
+		}
+		cpKey := changePointKey{status: sf.Status, turningPoint: sf.TurningPoint}
+		summary, ok := clusters[cpKey]
+		if !ok {
+			summary = newClusterSummary()
+			summary.StepPoint = df.Header[sf.TurningPoint]
+			clusters[cpKey] = summary
+		}
+		if summary.StepFit.Status == "" || sf.Confidence > summary.StepFit.Confidence {
+			summary.StepFit = sf
+			summary.Centroid = vec32.Dup(trace)
+		}
+		summary.Num++
+		if summary.Num < config.MAX_SAMPLE_TRACES_PER_CLUSTER {
+			summary.Keys = append(summary.Keys, key)
+		}
+	}
+	ret := &ClusterSummaries{
+		Clusters:        []*ClusterSummary{},
+		K:               k,
+		StdDevThreshold: stddevThreshold,
+	}
+	for _, summary := range clusters {
+		summary.ParamSummaries = getParamSummariesForKeys(summary.Keys)
+		ret.Clusters = append(ret.Clusters, summary)
+	}
+	sort.Sort(sortableClusterSummarySlice(ret.Clusters))
+	sklog.Infof("Found %d changepoint clusters.", len(ret.Clusters))
+	return ret
+}
+
+// calculateSignificance fills in the Significance of each cluster in
+// 'summaries' and removes the clusters with a PValue larger than 'maxPValue'.
+//
+// Only the traces in ClusterSummary.Keys are tested, i.e. the traces closest
+// to the centroid for k-means, which keeps the cost bounded by
+// config.MAX_SAMPLE_TRACES_PER_CLUSTER regardless of the cluster size.
+func calculateSignificance(df *dataframe.DataFrame, summaries *ClusterSummaries, maxPValue float64) {
+	clusters := []*ClusterSummary{}
+	for _, cl := range summaries.Clusters {
+		sig := &Significance{
+			TracePValues: map[string]float64{},
+		}
+		pValues := make([]float64, 0, len(cl.Keys))
+		for _, key := range cl.Keys {
+			trace, ok := df.TraceSet[key]
+			if !ok {
+				continue
+			}
+			p := significance.StepPValue(trace, cl.StepFit.TurningPoint)
+			sig.TracePValues[key] = p
+			pValues = append(pValues, p)
+		}
+		sig.PValue = significance.Median(pValues)
+		cl.Significance = sig
+		if sig.PValue <= maxPValue {
+			clusters = append(clusters, cl)
+		}
+	}
+	sklog.Infof("Significance stage kept %d of %d clusters.", len(clusters), len(summaries.Clusters))
+	summaries.Clusters = clusters
+}
+
+// CalculateClusterSummaries runs clustering over the trace shapes using the
+// given algo.
+//
+// If maxPValue is greater than zero then a significance stage is run after
+// clustering, which drops every cluster whose step isn't statistically
+// significant at that level. See calculateSignificance. The significance stage
+// doesn't apply to TAIL_ALGO, which only has a single point after the step.
+func CalculateClusterSummaries(df *dataframe.DataFrame, k int, stddevThreshold float32, progress Progress, interesting float32, algo ClusterAlgo, maxPValue float64) (*ClusterSummaries, error) {
+	ret, err := calculateClusterSummaries(df, k, stddevThreshold, progress, interesting, algo)
+	if err != nil {
+		return nil, err
+	}
+	if maxPValue > 0 && algo != TAIL_ALGO {
+		calculateSignificance(df, ret, maxPValue)
+	}
+	return ret, nil
+}
+
+// calculateClusterSummaries runs the clustering for CalculateClusterSummaries.
+func calculateClusterSummaries(df *dataframe.DataFrame, k int, stddevThreshold float32, progress Progress, interesting float32, algo ClusterAlgo) (*ClusterSummaries, error) {
 	if algo == KMEANS_ALGO {
 		// Convert the DataFrame to a slice of kmeans.Clusterable.
 		observations := make([]kmeans.Clusterable, 0, len(df.TraceSet))
@@ -360,6 +485,8 @@ func CalculateClusterSummaries(df *dataframe.DataFrame, k int, stddevThreshold f
 			ret.Clusters = append(ret.Clusters, high)
 		}
 		return ret, nil
+	} else if algo == CHANGEPOINT_ALGO {
+		return calculateChangePointSummaries(df, k, stddevThreshold, interesting), nil
 	} else {
 		return nil, fmt.Errorf("Unknown clustering algorithm: %s", algo)
 	}
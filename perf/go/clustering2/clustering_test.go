@@ -82,7 +82,7 @@ func TestCalcCusterSummaries(t *testing.T) {
 	for key := range df.TraceSet {
 		df.ParamSet.AddParamsFromKey(key)
 	}
-	sum, err := CalculateClusterSummaries(df, 4, 0.01, nil, 50, KMEANS_ALGO)
+	sum, err := CalculateClusterSummaries(df, 4, 0.01, nil, 50, KMEANS_ALGO, 0)
 	assert.NoError(t, err)
 	assert.NotNil(t, sum)
 	assert.Equal(t, 2, len(sum.Clusters))
@@ -90,12 +90,34 @@ func TestCalcCusterSummaries(t *testing.T) {
 	assert.Equal(t, 2, len(sum.Clusters[0].Keys))
 	assert.Equal(t, 2, len(sum.Clusters[1].Keys))
 
-	sum, err = CalculateClusterSummaries(df, 4, 0.01, nil, 50, STEPFIT_ALGO)
+	sum, err = CalculateClusterSummaries(df, 4, 0.01, nil, 50, STEPFIT_ALGO, 0)
 	assert.NoError(t, err)
 	assert.NotNil(t, sum)
 	assert.Equal(t, 1, len(sum.Clusters))
 	assert.Equal(t, df.Header[2], sum.Clusters[0].StepPoint)
 	assert.Equal(t, 2, len(sum.Clusters[0].Keys))
+
+	sum, err = CalculateClusterSummaries(df, 4, 0.01, nil, 50, CHANGEPOINT_ALGO, 0)
+	assert.NoError(t, err)
+	assert.NotNil(t, sum)
+	assert.Equal(t, 1, len(sum.Clusters))
+	assert.Equal(t, df.Header[2], sum.Clusters[0].StepPoint)
+	assert.Equal(t, 2, len(sum.Clusters[0].Keys))
+	assert.Equal(t, float32(1), sum.Clusters[0].StepFit.Confidence)
+	assert.Nil(t, sum.Clusters[0].Significance)
+
+	// With only two points before the step no single trace is significant at
+	// the 0.05 level, so the cluster is dropped.
+	sum, err = CalculateClusterSummaries(df, 4, 0.01, nil, 50, STEPFIT_ALGO, 0.05)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(sum.Clusters))
+
+	sum, err = CalculateClusterSummaries(df, 4, 0.01, nil, 50, STEPFIT_ALGO, 0.5)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(sum.Clusters))
+	assert.NotNil(t, sum.Clusters[0].Significance)
+	assert.Equal(t, 2, len(sum.Clusters[0].Significance.TracePValues))
+	assert.InDelta(t, 0.0956, sum.Clusters[0].Significance.PValue, 0.001)
 }
 
 func TestCalcCusterSummariesDegenerate(t *testing.T) {
@@ -107,7 +129,7 @@ func TestCalcCusterSummariesDegenerate(t *testing.T) {
 		ParamSet: paramtools.ParamSet{},
 		Skip:     0,
 	}
-	_, err := CalculateClusterSummaries(df, 4, 0.01, nil, 50, KMEANS_ALGO)
+	_, err := CalculateClusterSummaries(df, 4, 0.01, nil, 50, KMEANS_ALGO, 0)
 	assert.Error(t, err)
 }
 
@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"html/template"
 	"regexp"
+	"sort"
+	"strings"
+	textTemplate "text/template"
 
 	"go.skia.org/infra/perf/go/alerts"
 	"go.skia.org/infra/perf/go/cid"
@@ -30,10 +33,12 @@ const (
 <p>
 	With {{.Cluster.Num}} matching traces.
 </p>`
+	CHAT = `Perf Regression found at https://{{.SubDomain}}.skia.org/g/t/{{.Commit.Hash}} for {{.Commit.URL}} with {{.Cluster.Num}} matching traces.`
 )
 
 var (
 	emailTemplate = template.Must(template.New("email").Parse(EMAIL))
+	chatTemplate  = textTemplate.Must(textTemplate.New("chat").Parse(CHAT))
 
 	emailAddressSplitter = regexp.MustCompile("[, ]+")
 )
@@ -44,17 +49,38 @@ type Email interface {
 }
 
 // Notifier sends notifications.
+//
+// Where notifications are sent is determined by the targets in
+// alerts.Config.Alert, which are routed to a Transport by scheme, see
+// parseTarget.
 type Notifier struct {
-	email     Email
-	subdomain string
+	subdomain  string
+	transports map[string]Transport
 }
 
-// New returns a new Notifier.
-func New(email Email, subdomain string) *Notifier {
-	return &Notifier{
-		email:     email,
-		subdomain: subdomain,
+// New returns a new Notifier that sends email via the given Email, which may
+// be nil if email isn't supported, and sends chat messages and webhooks using
+// the default Transports. Webhooks may only target the given hosts, see
+// NewWebhookTransport.
+func New(email Email, subdomain string, webhookHosts []string) *Notifier {
+	n := &Notifier{
+		subdomain:  subdomain,
+		transports: map[string]Transport{},
 	}
+	if email != nil {
+		n.AddTransport(EMAIL_SCHEME, NewEmailTransport(email))
+	}
+	n.AddTransport(CHAT_SCHEME, NewChatTransport(nil))
+	webhook := NewWebhookTransport(nil, webhookHosts)
+	n.AddTransport(WEBHOOK_SCHEME, webhook)
+	n.AddTransport(WEBHOOK_HTTP_SCHEME, webhook)
+	return n
+}
+
+// AddTransport sets the Transport used for targets with the given scheme,
+// replacing any existing Transport for that scheme.
+func (n *Notifier) AddTransport(scheme string, t Transport) {
+	n.transports[scheme] = t
 }
 
 type context struct {
@@ -79,6 +105,21 @@ func (n *Notifier) formatEmail(c *cid.CommitDetail, alert *alerts.Config, cl *cl
 	return b.String(), nil
 }
 
+func (n *Notifier) formatChat(c *cid.CommitDetail, alert *alerts.Config, cl *clustering2.ClusterSummary) (string, error) {
+	templateContext := &context{
+		SubDomain: n.subdomain,
+		Commit:    c,
+		Alert:     alert,
+		Cluster:   cl,
+	}
+
+	var b bytes.Buffer
+	if err := chatTemplate.Execute(&b, templateContext); err != nil {
+		return "", fmt.Errorf("Failed to format chat message: %s", err)
+	}
+	return b.String(), nil
+}
+
 func splitEmails(s string) []string {
 	ret := []string{}
 	for _, e := range emailAddressSplitter.Split(s, -1) {
@@ -92,15 +133,48 @@ func splitEmails(s string) []string {
 // Send a notification for the given cluster found at the given commit. Where to send it is defined in the alerts.Config.
 func (n *Notifier) Send(c *cid.CommitDetail, alert *alerts.Config, cl *clustering2.ClusterSummary) error {
 	if alert.Alert == "" {
-		return fmt.Errorf("No notification sent. No email address set for alert #%d", alert.ID)
+		return fmt.Errorf("No notification sent. No destination set for alert #%d", alert.ID)
+	}
+	html, err := n.formatEmail(c, alert, cl)
+	if err != nil {
+		return err
 	}
-	body, err := n.formatEmail(c, alert, cl)
+	text, err := n.formatChat(c, alert, cl)
 	if err != nil {
 		return err
 	}
-	subject := fmt.Sprintf("Regression found for %q", c.Message)
-	if err := n.email.Send(FROM_ADDRESS, splitEmails(alert.Alert), subject, body); err != nil {
-		return fmt.Errorf("Failed to send email: %s", err)
+	msg := &Message{
+		Subject: fmt.Sprintf("Regression found for %q", c.Message),
+		HTML:    html,
+		Text:    text,
+		Link:    fmt.Sprintf("https://%s.skia.org/g/t/%s", n.subdomain, c.Hash),
+		Commit:  c,
+		Alert:   alert,
+		Cluster: cl,
+	}
+
+	// Send to every target, even if some fail, and report all the failures.
+	routes := route(alert.Alert)
+	schemes := []string{}
+	for scheme := range routes {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	errs := []string{}
+	for _, scheme := range schemes {
+		t, ok := n.transports[scheme]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("No transport for %q targets: %q", scheme, routes[scheme]))
+			continue
+		}
+		for _, target := range routes[scheme] {
+			if err := t.Send(target, msg); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("Failed to send notification for alert #%d: %s", alert.ID, strings.Join(errs, "; "))
 	}
 
 	return nil
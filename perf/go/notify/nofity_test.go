@@ -1,12 +1,17 @@
 package notify
 
 import (
+	"encoding/json"
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
+	"go.skia.org/infra/go/mockhttpclient"
 	"go.skia.org/infra/go/testutils"
 	"go.skia.org/infra/perf/go/alerts"
+	"go.skia.org/infra/perf/go/cid"
+	"go.skia.org/infra/perf/go/clustering2"
 )
 
 type emailMock struct {
@@ -28,7 +33,7 @@ func TestExampleSend(t *testing.T) {
 	testutils.SmallTest(t)
 
 	e := &emailMock{}
-	n := New(e, "perf")
+	n := New(e, "perf", nil)
 	alert := &alerts.Config{
 		Alert: "someone@example.org, someother@example.com ",
 	}
@@ -39,3 +44,125 @@ func TestExampleSend(t *testing.T) {
 	assert.Equal(t, "Regression found for \"Re-enable opList dependency tracking\"", e.subject)
 	assert.Equal(t, "<b>Alert</b><br><br>\n<p>\n\tA Perf Regression has been found at:\n</p>\n<p style=\"padding: 1em;\">\n\t<a href=\"https://perf.skia.org/g/t/d261e1075a93677442fdf7fe72aba7e583863664\">https://perf.skia.org/g/t/d261e1075a93677442fdf7fe72aba7e583863664</a>\n</p>\n<p>\n  For:\n</p>\n<p style=\"padding: 1em;\">\n  <a href=\"https://skia.googlesource.com/skia/&#43;/d261e1075a93677442fdf7fe72aba7e583863664\">https://skia.googlesource.com/skia/&#43;/d261e1075a93677442fdf7fe72aba7e583863664</a>\n</p>\n<p>\n\tWith 10 matching traces.\n</p>", e.body)
 }
+
+func TestRoute(t *testing.T) {
+	testutils.SmallTest(t)
+
+	assert.Equal(t, map[string][]string{}, route(""))
+	assert.Equal(t, map[string][]string{
+		EMAIL_SCHEME:   {"someone@example.org,other@example.org"},
+		CHAT_SCHEME:    {"perf-room"},
+		WEBHOOK_SCHEME: {"https://example.org/hook?key=1"},
+	}, route("someone@example.org, chat:perf-room https://example.org/hook?key=1,mailto:other@example.org"))
+}
+
+func TestSendRoutesToTransports(t *testing.T) {
+	testutils.SmallTest(t)
+
+	e := &emailMock{}
+	n := New(e, "perf", nil)
+	chat := &MockTransport{}
+	webhook := &MockTransport{}
+	n.AddTransport(CHAT_SCHEME, chat)
+	n.AddTransport(WEBHOOK_SCHEME, webhook)
+
+	alert := &alerts.Config{
+		Alert: "someone@example.org, chat:perf-room, https://example.org/hook",
+	}
+	err := n.ExampleSend(alert)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"someone@example.org"}, e.to)
+	assert.Equal(t, []string{"perf-room"}, chat.Targets)
+	assert.Equal(t, "Perf Regression found at https://perf.skia.org/g/t/d261e1075a93677442fdf7fe72aba7e583863664 for https://skia.googlesource.com/skia/+/d261e1075a93677442fdf7fe72aba7e583863664 with 10 matching traces.", chat.Messages[0].Text)
+	assert.Equal(t, []string{"https://example.org/hook"}, webhook.Targets)
+	assert.Equal(t, "https://perf.skia.org/g/t/d261e1075a93677442fdf7fe72aba7e583863664", webhook.Messages[0].Link)
+
+	// A failing transport doesn't stop delivery to the others.
+	chat.Err = fmt.Errorf("Room not found.")
+	e.to = nil
+	err = n.ExampleSend(alert)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Room not found.")
+	assert.Equal(t, []string{"someone@example.org"}, e.to)
+	assert.Len(t, webhook.Targets, 2)
+
+	// Unknown schemes are reported.
+	err = n.ExampleSend(&alerts.Config{Alert: "sms:555-1212"})
+	assert.Error(t, err)
+
+	// No email transport if no Email was supplied.
+	n = New(nil, "perf", nil)
+	err = n.ExampleSend(&alerts.Config{Alert: "someone@example.org"})
+	assert.Error(t, err)
+}
+
+func TestChatTransport(t *testing.T) {
+	testutils.SmallTest(t)
+
+	var body, room string
+	tr := NewChatTransport(func(b, r, thread string) error {
+		body = b
+		room = r
+		return nil
+	})
+	err := tr.Send("perf-room", &Message{Text: "Hello."})
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello.", body)
+	assert.Equal(t, "perf-room", room)
+}
+
+func TestWebhookTransport(t *testing.T) {
+	testutils.SmallTest(t)
+
+	msg := &Message{
+		Subject: "Regression found",
+		Link:    "https://perf.skia.org/g/t/abc",
+		Text:    "Hello.",
+		Commit: &cid.CommitDetail{
+			Hash: "abc",
+		},
+		Alert: &alerts.Config{
+			ID:          2,
+			DisplayName: "Memory",
+			Query:       "config=8888",
+		},
+		Cluster: &clustering2.ClusterSummary{
+			Num: 10,
+		},
+	}
+	body, err := json.Marshal(WebhookPayload{
+		Subject:     msg.Subject,
+		Link:        msg.Link,
+		Text:        msg.Text,
+		Commit:      msg.Commit,
+		AlertID:     "2",
+		Alert:       "Memory",
+		Query:       "config=8888",
+		ClusterSize: 10,
+	})
+	assert.NoError(t, err)
+
+	m := mockhttpclient.NewURLMock()
+	m.MockOnce("https://example.org/hook", mockhttpclient.MockPostDialogue(WEBHOOK_CONTENT_TYPE, body, []byte("")))
+	tr := NewWebhookTransport(m.Client(), []string{"Example.org"})
+	err = tr.Send("https://example.org/hook", msg)
+	assert.NoError(t, err)
+	assert.True(t, m.Empty())
+
+	m.MockOnce("https://example.org/hook", mockhttpclient.MockPostError(WEBHOOK_CONTENT_TYPE, body, "Not Found", 404))
+	err = tr.Send("https://example.org/hook", msg)
+	assert.Error(t, err)
+
+	// Only the allowed hosts can be targeted.
+	for _, target := range []string{
+		"https://example.com/hook",
+		"https://sub.example.org/hook",
+		"http://169.254.169.254/computeMetadata/v1/",
+		"http://localhost:8000/",
+		"%zz",
+	} {
+		assert.Error(t, tr.Send(target, msg), target)
+	}
+	assert.Error(t, NewWebhookTransport(m.Client(), nil).Send("https://example.org/hook", msg))
+	assert.True(t, m.Empty())
+}
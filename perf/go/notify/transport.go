@@ -0,0 +1,235 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.skia.org/infra/go/chatbot"
+	"go.skia.org/infra/go/httputils"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/perf/go/alerts"
+	"go.skia.org/infra/perf/go/cid"
+	"go.skia.org/infra/perf/go/clustering2"
+	"go.skia.org/infra/perf/go/stepfit"
+)
+
+// The schemes that can prefix a target in alerts.Config.Alert, which
+// determines the Transport used to deliver the notification.
+//
+// Targets without a scheme are treated as email addresses.
+const (
+	EMAIL_SCHEME         = "mailto"
+	CHAT_SCHEME          = "chat"
+	WEBHOOK_SCHEME       = "https"
+	WEBHOOK_HTTP_SCHEME  = "http"
+	WEBHOOK_CONTENT_TYPE = "application/json"
+)
+
+// Message is a notification formatted for delivery, it is passed to each Transport.
+type Message struct {
+	Subject string
+	HTML    string // The body of the notification formatted as HTML.
+	Text    string // The body of the notification formatted as plain text.
+	Link    string // Link to the regression in the Perf UI.
+	Commit  *cid.CommitDetail
+	Alert   *alerts.Config
+	Cluster *clustering2.ClusterSummary
+}
+
+// Transport delivers a Message to a single target, such as a list of email
+// addresses, a chat room, or a URL.
+type Transport interface {
+	Send(target string, msg *Message) error
+}
+
+// emailTransport is a Transport that sends email.
+type emailTransport struct {
+	email Email
+}
+
+// NewEmailTransport returns a Transport that sends the HTML body of a Message
+// as email. The target is a comma or space separated list of email addresses.
+func NewEmailTransport(email Email) Transport {
+	return &emailTransport{
+		email: email,
+	}
+}
+
+// See Transport.
+func (e *emailTransport) Send(target string, msg *Message) error {
+	if err := e.email.Send(FROM_ADDRESS, splitEmails(target), msg.Subject, msg.HTML); err != nil {
+		return fmt.Errorf("Failed to send email: %s", err)
+	}
+	return nil
+}
+
+// ChatSender sends the body to the given chat room. Note that chatbot.Send
+// implements this func.
+type ChatSender func(body, room, thread string) error
+
+// chatTransport is a Transport that sends chat messages.
+type chatTransport struct {
+	send ChatSender
+}
+
+// NewChatTransport returns a Transport that sends the plain text body of a
+// Message to a chat room via the given ChatSender. The target is the name of
+// the chat room. If send is nil then chatbot.Send is used.
+func NewChatTransport(send ChatSender) Transport {
+	if send == nil {
+		send = chatbot.Send
+	}
+	return &chatTransport{
+		send: send,
+	}
+}
+
+// See Transport.
+func (c *chatTransport) Send(target string, msg *Message) error {
+	if err := c.send(msg.Text, target, ""); err != nil {
+		return fmt.Errorf("Failed to send chat message: %s", err)
+	}
+	return nil
+}
+
+// WebhookPayload is the JSON body that the webhook Transport POSTs.
+type WebhookPayload struct {
+	Subject     string            `json:"subject"`
+	Link        string            `json:"link"`
+	Text        string            `json:"text"`
+	Commit      *cid.CommitDetail `json:"commit"`
+	AlertID     string            `json:"alert_id"`
+	Alert       string            `json:"alert"` // The display name of the alert.
+	Query       string            `json:"query"`
+	ClusterSize int               `json:"cluster_size"`
+	StepFit     *stepfit.StepFit  `json:"step_fit"`
+}
+
+// webhookTransport is a Transport that POSTs JSON to a URL.
+type webhookTransport struct {
+	client       *http.Client
+	allowedHosts util.StringSet
+}
+
+// NewWebhookTransport returns a Transport that POSTs a WebhookPayload
+// serialized as JSON to the target URL. If client is nil then a client with
+// timeouts is used.
+//
+// Since any logged in user can add webhook targets to an alert, only targets
+// whose host is in allowedHosts are accepted, and redirects are not followed,
+// so that webhooks can't be used to reach internal services. If allowedHosts
+// is empty then every webhook is rejected.
+func NewWebhookTransport(client *http.Client, allowedHosts []string) Transport {
+	if client == nil {
+		client = httputils.NewTimeoutClient()
+	}
+	noRedirects := *client
+	noRedirects.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	hosts := util.StringSet{}
+	for _, h := range allowedHosts {
+		hosts[strings.ToLower(h)] = true
+	}
+	return &webhookTransport{
+		client:       &noRedirects,
+		allowedHosts: hosts,
+	}
+}
+
+// See Transport.
+func (w *webhookTransport) Send(target string, msg *Message) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("Invalid webhook URL: %s", err)
+	}
+	if !w.allowedHosts[strings.ToLower(u.Hostname())] {
+		return fmt.Errorf("Webhook host %q is not allowed.", u.Hostname())
+	}
+	payload := WebhookPayload{
+		Subject:     msg.Subject,
+		Link:        msg.Link,
+		Text:        msg.Text,
+		Commit:      msg.Commit,
+		AlertID:     msg.Alert.IdAsString(),
+		Alert:       msg.Alert.DisplayName,
+		Query:       msg.Alert.Query,
+		ClusterSize: msg.Cluster.Num,
+		StepFit:     msg.Cluster.StepFit,
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("Failed to encode webhook payload: %s", err)
+	}
+	resp, err := w.client.Post(target, WEBHOOK_CONTENT_TYPE, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("Failed to send webhook: %s", err)
+	}
+	defer util.Close(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Wrong status code sending webhook: %d %s", resp.StatusCode, resp.Status)
+	}
+	return nil
+}
+
+// MockTransport is a Transport that records every Message it is asked to
+// send, for testing delivery without network access.
+type MockTransport struct {
+	Targets  []string
+	Messages []*Message
+
+	// Err, if not nil, is returned from every call to Send.
+	Err error
+}
+
+// See Transport.
+func (m *MockTransport) Send(target string, msg *Message) error {
+	m.Targets = append(m.Targets, target)
+	m.Messages = append(m.Messages, msg)
+	return m.Err
+}
+
+// parseTarget splits a single target from alerts.Config.Alert into a scheme
+// and the destination to pass to the Transport for that scheme.
+//
+// For example:
+//
+//    "someone@example.org"             => ("mailto", "someone@example.org")
+//    "mailto:someone@example.org"      => ("mailto", "someone@example.org")
+//    "chat:perf-room"                  => ("chat", "perf-room")
+//    "https://example.org/hook?key=1"  => ("https", "https://example.org/hook?key=1")
+func parseTarget(target string) (string, string) {
+	parts := strings.SplitN(target, ":", 2)
+	if len(parts) != 2 {
+		return EMAIL_SCHEME, target
+	}
+	scheme := strings.ToLower(parts[0])
+	if scheme == WEBHOOK_SCHEME || scheme == WEBHOOK_HTTP_SCHEME {
+		return scheme, target
+	}
+	return scheme, parts[1]
+}
+
+// route groups the targets in alerts.Config.Alert by scheme. All the email
+// addresses are grouped into a single comma separated target so that only
+// one email is sent.
+func route(alert string) map[string][]string {
+	ret := map[string][]string{}
+	emails := []string{}
+	for _, t := range splitEmails(alert) {
+		scheme, dest := parseTarget(t)
+		if scheme == EMAIL_SCHEME {
+			emails = append(emails, dest)
+			continue
+		}
+		ret[scheme] = append(ret[scheme], dest)
+	}
+	if len(emails) > 0 {
+		ret[EMAIL_SCHEME] = []string{strings.Join(emails, ",")}
+	}
+	return ret
+}
@@ -0,0 +1,48 @@
+// A command line tool for migrating ptracestore tiles from BoltDB into the
+// columnar backend.
+package main
+
+import (
+	"flag"
+
+	"go.skia.org/infra/go/common"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/perf/go/cid"
+	"go.skia.org/infra/perf/go/ptracestore"
+)
+
+// Command line flags.
+var (
+	srcDir  = flag.String("src_dir", "/tmp/ptracestore", "The directory where the BoltDB ptracestore tiles are stored.")
+	destDir = flag.String("dest_dir", "/tmp/ptracestore_column", "The directory where the columnar ptracestore tiles will be written.")
+)
+
+func main() {
+	common.Init()
+
+	src, err := ptracestore.New(*srcDir)
+	if err != nil {
+		sklog.Fatalf("Failed to open source ptracestore: %s", err)
+	}
+	dest, err := ptracestore.NewColumnTraceStore(*destDir)
+	if err != nil {
+		sklog.Fatalf("Failed to open destination ptracestore: %s", err)
+	}
+	tiles, err := src.Tiles()
+	if err != nil {
+		sklog.Fatalf("Failed to list tiles: %s", err)
+	}
+	for i, tile := range tiles {
+		sklog.Infof("Migrating tile %d of %d: %s", i+1, len(tiles), tile.Filename())
+		if err := src.Export(tile, func(commitID *cid.CommitID, values map[string]float32, sourceFile string) error {
+			return dest.Add(commitID, values, sourceFile)
+		}); err != nil {
+			sklog.Fatalf("Failed to migrate tile %s: %s", tile.Filename(), err)
+		}
+	}
+	sklog.Info("Compacting.")
+	if err := dest.Compact(); err != nil {
+		sklog.Fatalf("Failed to compact: %s", err)
+	}
+	sklog.Infof("Migrated %d tiles.", len(tiles))
+}
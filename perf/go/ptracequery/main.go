@@ -27,13 +27,14 @@ const (
 
 // Command line flags.
 var (
-	begin          = flag.String("begin", "1w", "Select the commit ids for the range beginning this long ago.")
-	end            = flag.String("end", "0s", "Select the commit ids for the range ending this long ago.")
-	gitRepoDir     = flag.String("git_repo_dir", "../../../skia", "Directory location for the Skia repo.")
-	gitRepoURL     = flag.String("git_repo_url", "https://skia.googlesource.com/skia", "The URL to pass to git clone for the source repository.")
-	ptraceStoreDir = flag.String("ptrace_store_dir", "/tmp/ptracestore", "The directory where the ptracestore tiles are stored.")
-	queryStr       = flag.String("query", "", "A URL encoded query to filter traces against.")
-	verbose        = flag.Bool("verbose", false, "Verbose.")
+	begin              = flag.String("begin", "1w", "Select the commit ids for the range beginning this long ago.")
+	end                = flag.String("end", "0s", "Select the commit ids for the range ending this long ago.")
+	gitRepoDir         = flag.String("git_repo_dir", "../../../skia", "Directory location for the Skia repo.")
+	gitRepoURL         = flag.String("git_repo_url", "https://skia.googlesource.com/skia", "The URL to pass to git clone for the source repository.")
+	ptraceStoreBackend = flag.String("ptrace_store_backend", "bolt", "The storage backend for ptracestore tiles, either \"bolt\" or \"column\".")
+	ptraceStoreDir     = flag.String("ptrace_store_dir", "/tmp/ptracestore", "The directory where the ptracestore tiles are stored.")
+	queryStr           = flag.String("query", "", "A URL encoded query to filter traces against.")
+	verbose            = flag.Bool("verbose", false, "Verbose.")
 )
 
 var Usage = func() {
@@ -174,7 +175,11 @@ func main() {
 		sklog.Fatal(err)
 	}
 
-	ptracestore.Init(*ptraceStoreDir)
+	backend, err := ptracestore.ToBackend(*ptraceStoreBackend)
+	if err != nil {
+		sklog.Fatalf("The --ptrace_store_backend flag value is invalid: %s", err)
+	}
+	ptracestore.Init(backend, *ptraceStoreDir)
 
 	switch cmd {
 	case "count":
@@ -0,0 +1,594 @@
+package ptracestore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/groupcache/lru"
+	"go.skia.org/infra/go/metrics2"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/timer"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/go/vec32"
+	"go.skia.org/infra/perf/go/cid"
+	"go.skia.org/infra/perf/go/constants"
+)
+
+const (
+	// COLUMN_TILE_SUFFIX is the suffix of the directory that holds a single
+	// tile in a ColumnTraceStore.
+	COLUMN_TILE_SUFFIX = ".col"
+
+	// COLUMN_TILE_FILENAME is the name of the compacted columnar file in each
+	// tile directory.
+	COLUMN_TILE_FILENAME = "tile"
+
+	// COLUMN_LOG_FILENAME is the name of the append-only log in each tile
+	// directory.
+	COLUMN_LOG_FILENAME = "log"
+
+	// MIN_COMPACT_LOG_SIZE is the smallest size in bytes that a tile log must
+	// reach before it is automatically compacted.
+	MIN_COMPACT_LOG_SIZE = 1024 * 1024
+
+	// columnMagic is written at the start of every compacted tile file.
+	columnMagic uint32 = 0x50434f4c // "PCOL"
+
+	// columnVersion is the version of the compacted tile file format.
+	columnVersion uint32 = 1
+
+	// Record types in the tile log.
+	logSourceRecord byte = 'S'
+	logValueRecord  byte = 'V'
+
+	// noSource is the source index stored for points that have no value.
+	noSource int32 = -1
+)
+
+var (
+	// errTileClosed is returned when writing to a tile that has been evicted
+	// from the cache.
+	errTileClosed = errors.New("Tile has been closed.")
+)
+
+// columnTrace holds the values and the source indices for a single trace in
+// a single tile.
+type columnTrace struct {
+	values  [constants.COMMITS_PER_TILE]float32
+	sources [constants.COMMITS_PER_TILE]int32
+}
+
+func newColumnTrace() *columnTrace {
+	ret := &columnTrace{}
+	for i := range ret.values {
+		ret.values[i] = vec32.MISSING_DATA_SENTINEL
+		ret.sources[i] = noSource
+	}
+	return ret
+}
+
+// logValue is used to encode/decode value records in the tile log.
+type logValue struct {
+	Index  int32
+	Value  float32
+	Source int32
+}
+
+// columnTile is the in-memory form of a single tile of a ColumnTraceStore.
+type columnTile struct {
+	// dir is the directory that holds the tile files.
+	dir string
+
+	// mutex protects all the members below. Readers only take a read lock
+	// so Match and Details can run concurrently.
+	mutex   sync.RWMutex
+	sources []string
+	traces  map[string]*columnTrace
+	log     *os.File
+	logSize int64
+	size    int64 // The size of the compacted tile file.
+	closed  bool
+}
+
+// ColumnTraceStore is an implementation of PTraceStore that stores each tile
+// as a compacted columnar file plus an append-only log of the values added
+// since the last compaction. See docs.go for a description of the formats.
+type ColumnTraceStore struct {
+	// mutex protects access to cache.
+	mutex sync.Mutex
+
+	// cache is an LRU cache of opened *columnTile's.
+	cache *lru.Cache
+
+	// metrics
+	cacheLen metrics2.Int64Metric
+
+	// dir is the directory where tiles are stored.
+	dir string
+}
+
+// NewColumnTraceStore creates a new ColumnTraceStore that stores tiles in the
+// given directory.
+func NewColumnTraceStore(dir string) (*ColumnTraceStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Failed to create %q for ptracestore: %s", dir, err)
+	}
+	c := &ColumnTraceStore{
+		dir:      dir,
+		cache:    lru.New(MAX_CACHED_TILES),
+		cacheLen: metrics2.GetInt64Metric("perf_ptracestore_column_cache_len", nil),
+	}
+	c.cache.OnEvicted = func(key lru.Key, value interface{}) {
+		if err := value.(*columnTile).close(); err != nil {
+			sklog.Errorf("Failed to close tile %q: %s", key, err)
+		}
+	}
+	return c, nil
+}
+
+// columnTileDir returns the name of the directory for the tile that contains
+// the given commitID.
+func columnTileDir(commitID *cid.CommitID) string {
+	return strings.TrimSuffix(commitID.Filename(), filepath.Ext(commitID.Filename())) + COLUMN_TILE_SUFFIX
+}
+
+// getTile returns a new/existing *columnTile. Opened tiles are cached.
+//
+// If 'readonly' is true then getTile will fail with a tileNotExist error
+// instead of creating a new tile at that location.
+func (c *ColumnTraceStore) getTile(commitID *cid.CommitID, readonly bool) (*columnTile, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	name := columnTileDir(commitID)
+	if t, ok := c.cache.Get(name); ok {
+		return t.(*columnTile), nil
+	}
+	dir := filepath.Join(c.dir, name)
+	if _, err := os.Stat(dir); os.IsNotExist(err) && readonly {
+		return nil, tileNotExist
+	}
+	sklog.Infof("Opening %q for the first time.", name)
+	t, err := openColumnTile(dir)
+	if err != nil {
+		return nil, err
+	}
+	c.cache.Add(name, t)
+	c.cacheLen.Update(int64(c.cache.Len()))
+	return t, nil
+}
+
+// openColumnTile loads the tile stored in 'dir', creating it if necessary.
+func openColumnTile(dir string) (*columnTile, error) {
+	defer timer.New("openColumnTile time").Stop()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Failed to create tile directory %q: %s", dir, err)
+	}
+	t := &columnTile{
+		dir:     dir,
+		sources: []string{},
+		traces:  map[string]*columnTrace{},
+	}
+	if err := t.readTile(); err != nil {
+		return nil, err
+	}
+	logFilename := filepath.Join(dir, COLUMN_LOG_FILENAME)
+	f, err := os.OpenFile(logFilename, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open log %q: %s", logFilename, err)
+	}
+	t.log = f
+	if err := t.replayLog(); err != nil {
+		util.Close(f)
+		return nil, err
+	}
+	return t, nil
+}
+
+// readTile loads the compacted tile file, if it exists.
+func (t *columnTile) readTile() error {
+	filename := filepath.Join(t.dir, COLUMN_TILE_FILENAME)
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to read tile %q: %s", filename, err)
+	}
+	t.size = int64(len(b))
+	r := bytes.NewReader(b)
+	var magic, version, numSources, numTraces uint32
+	if err := binary.Read(r, binary.LittleEndian, &magic); err != nil || magic != columnMagic {
+		return fmt.Errorf("Not a valid tile file %q.", filename)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil || version != columnVersion {
+		return fmt.Errorf("Unsupported tile version in %q: %d", filename, version)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &numSources); err != nil {
+		return fmt.Errorf("Failed to read number of sources from %q: %s", filename, err)
+	}
+	t.sources = make([]string, numSources)
+	for i := range t.sources {
+		if t.sources[i], err = readString(r); err != nil {
+			return fmt.Errorf("Failed to read source from %q: %s", filename, err)
+		}
+	}
+	if err := binary.Read(r, binary.LittleEndian, &numTraces); err != nil {
+		return fmt.Errorf("Failed to read number of traces from %q: %s", filename, err)
+	}
+	traces := make([]*columnTrace, numTraces)
+	for i := range traces {
+		key, err := readString(r)
+		if err != nil {
+			return fmt.Errorf("Failed to read trace id from %q: %s", filename, err)
+		}
+		traces[i] = &columnTrace{}
+		t.traces[key] = traces[i]
+	}
+	// The values and then the sources are stored column by column.
+	column := make([]float32, numTraces)
+	for i := 0; i < constants.COMMITS_PER_TILE; i++ {
+		if err := binary.Read(r, binary.LittleEndian, column); err != nil {
+			return fmt.Errorf("Failed to read value column from %q: %s", filename, err)
+		}
+		for j, tr := range traces {
+			tr.values[i] = column[j]
+		}
+	}
+	sourceColumn := make([]int32, numTraces)
+	for i := 0; i < constants.COMMITS_PER_TILE; i++ {
+		if err := binary.Read(r, binary.LittleEndian, sourceColumn); err != nil {
+			return fmt.Errorf("Failed to read source column from %q: %s", filename, err)
+		}
+		for j, tr := range traces {
+			tr.sources[i] = sourceColumn[j]
+		}
+	}
+	return nil
+}
+
+// replayLog applies all the records in the log to the in-memory tile.
+//
+// A partially written record at the end of the log, for example from a crash
+// in the middle of Add, is discarded and the log is truncated to the last
+// complete record.
+func (t *columnTile) replayLog() error {
+	if _, err := t.log.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("Failed to seek log: %s", err)
+	}
+	r := bufio.NewReader(t.log)
+	var good int64
+	for {
+		n, err := t.applyRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			sklog.Warningf("Truncating log in %q at offset %d: %s", t.dir, good, err)
+			if err := t.log.Truncate(good); err != nil {
+				return fmt.Errorf("Failed to truncate log: %s", err)
+			}
+			break
+		}
+		good += n
+	}
+	t.logSize = good
+	if _, err := t.log.Seek(good, io.SeekStart); err != nil {
+		return fmt.Errorf("Failed to seek log: %s", err)
+	}
+	return nil
+}
+
+// applyRecord reads a single record from the log and applies it to the tile.
+// It returns the number of bytes read.
+func (t *columnTile) applyRecord(r *bufio.Reader) (int64, error) {
+	recordType, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	n, err := t.applyRecordBody(recordType, r)
+	if err == io.EOF {
+		// Only a log that ends on a record boundary is cleanly terminated.
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// applyRecordBody reads the rest of a record of the given type and applies it
+// to the tile.
+func (t *columnTile) applyRecordBody(recordType byte, r *bufio.Reader) (int64, error) {
+	switch recordType {
+	case logSourceRecord:
+		source, err := readString(r)
+		if err != nil {
+			return 0, err
+		}
+		t.sources = append(t.sources, source)
+		return 1 + 4 + int64(len(source)), nil
+	case logValueRecord:
+		key, err := readString(r)
+		if err != nil {
+			return 0, err
+		}
+		var rec logValue
+		if err := binary.Read(r, binary.LittleEndian, &rec); err != nil {
+			return 0, err
+		}
+		if rec.Index < 0 || rec.Index >= constants.COMMITS_PER_TILE || int(rec.Source) >= len(t.sources) {
+			return 0, fmt.Errorf("Invalid value record: %#v", rec)
+		}
+		t.set(key, int(rec.Index), rec.Value, rec.Source)
+		return 1 + 4 + int64(len(key)) + 12, nil
+	default:
+		return 0, fmt.Errorf("Unknown record type: %d", recordType)
+	}
+}
+
+// set stores the value and source index for the given trace. The caller must
+// hold the write lock.
+func (t *columnTile) set(traceID string, index int, value float32, source int32) {
+	tr, ok := t.traces[traceID]
+	if !ok {
+		tr = newColumnTrace()
+		t.traces[traceID] = tr
+	}
+	tr.values[index] = value
+	tr.sources[index] = source
+}
+
+// add appends the values to the log and applies them to the in-memory tile.
+func (t *columnTile) add(index int, values map[string]float32, sourceFile string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closed {
+		return errTileClosed
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteByte(logSourceRecord)
+	writeString(buf, sourceFile)
+	source := int32(len(t.sources))
+	for traceID, value := range values {
+		buf.WriteByte(logValueRecord)
+		writeString(buf, traceID)
+		if err := binary.Write(buf, binary.LittleEndian, logValue{Index: int32(index), Value: value, Source: source}); err != nil {
+			return fmt.Errorf("binary.Write of value failed: %s", err)
+		}
+	}
+	if _, err := t.log.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("Failed to append to log: %s", err)
+	}
+	if err := t.log.Sync(); err != nil {
+		return fmt.Errorf("Failed to sync log: %s", err)
+	}
+	t.logSize += int64(buf.Len())
+	t.sources = append(t.sources, sourceFile)
+	for traceID, value := range values {
+		t.set(traceID, index, value, source)
+	}
+	if t.logSize > MIN_COMPACT_LOG_SIZE && t.logSize > t.size {
+		if err := t.compactLocked(); err != nil {
+			return fmt.Errorf("Failed to compact tile: %s", err)
+		}
+	}
+	return nil
+}
+
+// compact rewrites the compacted tile file with everything in the log and
+// empties the log.
+func (t *columnTile) compact() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closed {
+		return errTileClosed
+	}
+	return t.compactLocked()
+}
+
+// compactLocked does the work of compact. The caller must hold the write lock.
+func (t *columnTile) compactLocked() error {
+	defer timer.New("compact time").Stop()
+	keys := make([]string, 0, len(t.traces))
+	for key := range t.traces {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	buf := &bytes.Buffer{}
+	if err := binary.Write(buf, binary.LittleEndian, []uint32{columnMagic, columnVersion, uint32(len(t.sources))}); err != nil {
+		return err
+	}
+	for _, source := range t.sources {
+		writeString(buf, source)
+	}
+	if err := binary.Write(buf, binary.LittleEndian, uint32(len(keys))); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		writeString(buf, key)
+	}
+	column := make([]float32, len(keys))
+	for i := 0; i < constants.COMMITS_PER_TILE; i++ {
+		for j, key := range keys {
+			column[j] = t.traces[key].values[i]
+		}
+		if err := binary.Write(buf, binary.LittleEndian, column); err != nil {
+			return err
+		}
+	}
+	sourceColumn := make([]int32, len(keys))
+	for i := 0; i < constants.COMMITS_PER_TILE; i++ {
+		for j, key := range keys {
+			sourceColumn[j] = t.traces[key].sources[i]
+		}
+		if err := binary.Write(buf, binary.LittleEndian, sourceColumn); err != nil {
+			return err
+		}
+	}
+
+	// WithWriteFile writes to a temp file and then renames it, so a crash never
+	// leaves a partial tile file behind.
+	filename := filepath.Join(t.dir, COLUMN_TILE_FILENAME)
+	if err := util.WithWriteFile(filename, func(w io.Writer) error {
+		_, err := w.Write(buf.Bytes())
+		return err
+	}); err != nil {
+		return fmt.Errorf("Failed to write %q: %s", filename, err)
+	}
+	if err := t.log.Truncate(0); err != nil {
+		return fmt.Errorf("Failed to truncate log: %s", err)
+	}
+	if _, err := t.log.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("Failed to seek log: %s", err)
+	}
+	t.size = int64(buf.Len())
+	t.logSize = 0
+	return nil
+}
+
+// close closes the log file. The tile can not be written to after close is
+// called.
+func (t *columnTile) close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.closed = true
+	return t.log.Close()
+}
+
+// readString reads a length prefixed string.
+func readString(r io.Reader) (string, error) {
+	var n uint32
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return "", err
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// writeString writes a length prefixed string.
+func writeString(buf *bytes.Buffer, s string) {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, uint32(len(s)))
+	buf.Write(b)
+	buf.WriteString(s)
+}
+
+func (c *ColumnTraceStore) Add(commitID *cid.CommitID, values map[string]float32, sourceFile string) error {
+	sklog.Infof("Ingesting source file: %q", sourceFile)
+	index := commitID.Offset % constants.COMMITS_PER_TILE
+	for {
+		t, err := c.getTile(commitID, false)
+		if err != nil {
+			return fmt.Errorf("Unable to open datastore: %s", err)
+		}
+		err = t.add(index, values, sourceFile)
+		if err == errTileClosed {
+			// The tile was evicted from the cache between getTile and add, so
+			// try again with a freshly opened tile.
+			continue
+		}
+		return err
+	}
+}
+
+func (c *ColumnTraceStore) Details(commitID *cid.CommitID, traceID string) (string, float32, error) {
+	t, err := c.getTile(commitID, true)
+	if err != nil {
+		return "", 0, fmt.Errorf("Unable to open datastore: %s", err)
+	}
+	index := commitID.Offset % constants.COMMITS_PER_TILE
+
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	tr, ok := t.traces[traceID]
+	if !ok || tr.sources[index] == noSource {
+		return "", 0, fmt.Errorf("Value not found: %q in %q", traceID, columnTileDir(commitID))
+	}
+	return t.sources[tr.sources[index]], tr.values[index], nil
+}
+
+func (c *ColumnTraceStore) Match(commitIDs []*cid.CommitID, matches KeyMatches, progress Progress) (TraceSet, error) {
+	ret := TraceSet{}
+	mapper := buildMapper(commitIDs)
+	i := 0
+	for _, tm := range mapper {
+		i++
+		if progress != nil {
+			progress(i, len(mapper))
+		}
+		t, err := c.getTile(tm.commitID, true)
+		if err == tileNotExist {
+			sklog.Infof("Skipped non-existent tile: %s", columnTileDir(tm.commitID))
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed to open tile from %s: %s", columnTileDir(tm.commitID), err)
+		}
+		t.mutex.RLock()
+		for traceID, tr := range t.traces {
+			if !matches(traceID) {
+				continue
+			}
+			trace := ret[traceID]
+			if trace == nil {
+				trace = NewTrace(len(commitIDs))
+				ret[traceID] = trace
+			}
+			for index, offset := range tm.idxmap {
+				if tr.sources[index] != noSource {
+					trace[offset] = tr.values[index]
+				}
+			}
+		}
+		t.mutex.RUnlock()
+	}
+	if progress != nil {
+		progress(len(mapper), len(mapper))
+	}
+	return ret, nil
+}
+
+// Compact compacts every tile in the store, folding each tile's log into its
+// columnar file.
+func (c *ColumnTraceStore) Compact() error {
+	names, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return fmt.Errorf("Failed to list tiles in %q: %s", c.dir, err)
+	}
+	for _, fi := range names {
+		if !fi.IsDir() || !strings.HasSuffix(fi.Name(), COLUMN_TILE_SUFFIX) {
+			continue
+		}
+		c.mutex.Lock()
+		var t *columnTile
+		if cached, ok := c.cache.Get(fi.Name()); ok {
+			t = cached.(*columnTile)
+		} else {
+			t, err = openColumnTile(filepath.Join(c.dir, fi.Name()))
+			if err != nil {
+				c.mutex.Unlock()
+				return err
+			}
+			c.cache.Add(fi.Name(), t)
+		}
+		c.mutex.Unlock()
+		if err := t.compact(); err != nil && err != errTileClosed {
+			return fmt.Errorf("Failed to compact %q: %s", fi.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Ensure that *ColumnTraceStore implements PTraceStore.
+var _ PTraceStore = &ColumnTraceStore{}
@@ -67,5 +67,50 @@
 
   The largest sourceIndex used is stored at the key 'lastSourceIndex' and is incremented
   when new sourceFullname's are added.
+
+  Column Backend
+  --------------
+
+  ColumnTraceStore is an alternate backend, selected with the
+  --ptrace_store_backend=column flag, that stores each tile in its own
+  directory, e.g. 'master-000001.col', which contains two files:
+
+    tile - The compacted tile, a columnar file.
+    log  - An append-only log of all the values added since the last compaction.
+
+  The 'tile' file is structured as, with all integers little endian:
+
+    magic       uint32
+    version     uint32
+    numSources  uint32
+    sources     [len uint32, sourceFullname]*numSources
+    numTraces   uint32
+    traceids    [len uint32, traceid]*numTraces, sorted.
+    values      [float32*numTraces]*COMMITS_PER_TILE
+    sourceIdx   [int32*numTraces]*COMMITS_PER_TILE
+
+  I.e. after the header all the values for a single commit are stored
+  contiguously, followed by all the source indices for a single commit. A
+  sourceIdx of -1 means there is no value for that trace at that commit.
+
+  The 'log' file is a sequence of records, each starting with a one byte type:
+
+    'S' [len uint32, sourceFullname]
+    'V' [len uint32, traceid] [index int32, value float32, sourceIdx int32]
+
+  Each call to Add appends one 'S' record followed by one 'V' record per value,
+  and the source index of a new 'S' record is the number of sources already in
+  the tile. When a tile is opened the 'tile' file is loaded and then the 'log'
+  is replayed on top of it, with later values overwriting earlier ones. A
+  partial record at the end of the log, for example from a crash during Add, is
+  truncated away.
+
+  Once the log grows larger than the tile it is compacted, i.e. the whole tile
+  is rewritten to a new 'tile' file and the log is emptied. Opened tiles are
+  held in memory in an LRU cache, so Match and Details only need a read lock
+  on a tile and can run concurrently with each other.
+
+  Existing BoltDB tiles can be converted with the ptracemigrate command line
+  tool.
 */
 package ptracestore
@@ -6,8 +6,12 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
@@ -29,6 +33,9 @@ const (
 )
 
 var (
+	// tileFilenameRe matches the filenames of BoltDB tiles, see cid.CommitID.Filename().
+	tileFilenameRe = regexp.MustCompile(`^(.+)-([0-9]+)\.bdb$`)
+
 	// tileNotExist is returned from getBoltDB only if 'readonly' is true and
 	// the tile doesn't exist.
 	tileNotExist = errors.New("Tile does not exist.")
@@ -345,6 +352,128 @@ func (b *BoltTraceStore) Details(commitID *cid.CommitID, traceID string) (string
 	return sourceRet, valueRet, nil
 }
 
+// Tiles returns a CommitID for each tile stored in the BoltTraceStore. The
+// returned CommitID's point at the first commit in each tile.
+func (b *BoltTraceStore) Tiles() ([]*cid.CommitID, error) {
+	fis, err := ioutil.ReadDir(b.dir)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list tiles in %q: %s", b.dir, err)
+	}
+	ret := []*cid.CommitID{}
+	for _, fi := range fis {
+		match := tileFilenameRe.FindStringSubmatch(fi.Name())
+		if fi.IsDir() || match == nil {
+			continue
+		}
+		tile, err := strconv.Atoi(match[2])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid tile filename %q: %s", fi.Name(), err)
+		}
+		ret = append(ret, &cid.CommitID{
+			Source: match[1],
+			Offset: tile * constants.COMMITS_PER_TILE,
+		})
+	}
+	return ret, nil
+}
+
+// ExportFunc is called by Export once per commit and source file, with all
+// the values that were added from that source file.
+type ExportFunc func(commitID *cid.CommitID, values map[string]float32, sourceFile string) error
+
+// Export calls 'fn' with the current contents of the tile that contains
+// 'commitID', in a form that can be passed to PTraceStore.Add.
+//
+// Only the last value written for each point is exported, and the calls are
+// made in the order the source files were originally added, so adding the
+// exported values to another PTraceStore reproduces the contents of the tile.
+func (b *BoltTraceStore) Export(commitID *cid.CommitID, fn ExportFunc) error {
+	bdb, err := b.getBoltDB(commitID, true)
+	if err != nil {
+		return fmt.Errorf("Unable to open datastore: %s", err)
+	}
+	tileStart := commitID.Offset - commitID.Offset%constants.COMMITS_PER_TILE
+
+	type point struct {
+		index   int64
+		traceID string
+	}
+	type batch struct {
+		index  int64
+		source uint64
+	}
+	values := map[point]float32{}
+	sources := map[point]uint64{}
+	sourceNames := map[uint64]string{}
+
+	get := func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(TRACE_VALUES_BUCKET_NAME))
+		s := tx.Bucket([]byte(TRACE_SOURCES_BUCKET_NAME))
+		sl := tx.Bucket([]byte(SOURCE_LIST_BUCKET_NAME))
+		if v == nil || s == nil || sl == nil {
+			// The tile has never been written to.
+			return nil
+		}
+		value := traceValue{}
+		if err := v.ForEach(func(k, raw []byte) error {
+			buf := bytes.NewBuffer(raw)
+			for binary.Read(buf, binary.LittleEndian, &value) == nil {
+				values[point{index: value.Index, traceID: string(k)}] = value.Value
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		source := sourceValue{}
+		if err := s.ForEach(func(k, raw []byte) error {
+			buf := bytes.NewBuffer(raw)
+			for binary.Read(buf, binary.LittleEndian, &source) == nil {
+				sources[point{index: source.Index, traceID: string(k)}] = source.Source
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		return sl.ForEach(func(k, name []byte) error {
+			sourceNames[binary.LittleEndian.Uint64(k)] = string(name)
+			return nil
+		})
+	}
+	if err := bdb.View(get); err != nil {
+		return fmt.Errorf("Error while reading tile: %s", err)
+	}
+
+	// Regroup the points by the commit and source they were added with.
+	batches := map[batch]map[string]float32{}
+	for p, value := range values {
+		bt := batch{index: p.index, source: sources[p]}
+		if _, ok := batches[bt]; !ok {
+			batches[bt] = map[string]float32{}
+		}
+		batches[bt][p.traceID] = value
+	}
+	keys := make([]batch, 0, len(batches))
+	for bt := range batches {
+		keys = append(keys, bt)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].source != keys[j].source {
+			return keys[i].source < keys[j].source
+		}
+		return keys[i].index < keys[j].index
+	})
+	for _, bt := range keys {
+		c := &cid.CommitID{
+			Source: commitID.Source,
+			Offset: tileStart + int(bt.index),
+		}
+		if err := fn(c, batches[bt], sourceNames[bt.source]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type tileMap struct {
 	commitID *cid.CommitID
 	idxmap   map[int]int
@@ -500,14 +629,52 @@ func (b *BoltTraceStore) Match(commitIDs []*cid.CommitID, matches KeyMatches, pr
 	return ret, nil
 }
 
-var Default *BoltTraceStore
+// Backend is the name of a PTraceStore implementation.
+type Backend string
+
+// Backend constants.
+const (
+	BOLT_BACKEND   Backend = "bolt"   // BoltTraceStore, one BoltDB file per tile.
+	COLUMN_BACKEND Backend = "column" // ColumnTraceStore, a columnar file plus an append-only log per tile.
+)
+
+var (
+	allBackends = []Backend{BOLT_BACKEND, COLUMN_BACKEND}
+)
+
+// ToBackend converts a string into a Backend, returning an error if the
+// string isn't a known backend.
+func ToBackend(s string) (Backend, error) {
+	ret := Backend(s)
+	for _, b := range allBackends {
+		if b == ret {
+			return ret, nil
+		}
+	}
+	return ret, fmt.Errorf("%q is not a valid Backend, must be a value in %v", s, allBackends)
+}
+
+// NewFromBackend creates a new PTraceStore of the given backend type that
+// stores tiles in the given directory.
+func NewFromBackend(backend Backend, dir string) (PTraceStore, error) {
+	switch backend {
+	case BOLT_BACKEND:
+		return New(dir)
+	case COLUMN_BACKEND:
+		return NewColumnTraceStore(dir)
+	default:
+		return nil, fmt.Errorf("Unknown ptracestore backend: %q", backend)
+	}
+}
+
+var Default PTraceStore
 
-func Init(dir string) {
+func Init(backend Backend, dir string) {
 	if Default != nil {
 		sklog.Fatalf("ptracestore should only be initialized once.")
 	}
 	var err error
-	Default, err = New(dir)
+	Default, err = NewFromBackend(backend, dir)
 	if err != nil {
 		sklog.Fatalf("ptracestore failed to init: %s", err)
 	}
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"net/url"
 	"os"
+	"path/filepath"
 	"sort"
 	"testing"
 
@@ -33,13 +34,27 @@ func cleanup() {
 	}
 }
 
+// forEachBackend runs 'f' against a freshly created PTraceStore of each
+// Backend.
+func forEachBackend(t *testing.T, f func(t *testing.T, d PTraceStore)) {
+	for _, backend := range allBackends {
+		t.Run(string(backend), func(t *testing.T) {
+			setupStoreDir(t)
+			defer cleanup()
+
+			d, err := NewFromBackend(backend, tmpDir)
+			assert.NoError(t, err)
+			f(t, d)
+		})
+	}
+}
+
 func TestAdd(t *testing.T) {
 	testutils.MediumTest(t)
-	setupStoreDir(t)
-	defer cleanup()
+	forEachBackend(t, testAdd)
+}
 
-	d, err := New(tmpDir)
-	assert.NoError(t, err)
+func testAdd(t *testing.T, d PTraceStore) {
 	commitID := &cid.CommitID{
 		Offset: constants.COMMITS_PER_TILE + 1,
 		Source: "master",
@@ -48,7 +63,7 @@ func TestAdd(t *testing.T) {
 		",config=565,test=foo,":  1.23,
 		",config=8888,test=foo,": 3.21,
 	}
-	err = d.Add(commitID, values, "gs://skia-perf/nano-json-v1/blah/blah.json")
+	err := d.Add(commitID, values, "gs://skia-perf/nano-json-v1/blah/blah.json")
 	assert.NoError(t, err)
 
 	source, value, err := d.Details(commitID, ",config=565,test=foo,")
@@ -64,7 +79,9 @@ func TestAdd(t *testing.T) {
 	source, value, err = d.Details(commitID, ",something=unknown,")
 	assert.Error(t, err)
 
-	assert.Equal(t, 1, len(d.cache))
+	if b, ok := d.(*BoltTraceStore); ok {
+		assert.Equal(t, 1, len(b.cache))
+	}
 
 	// Add new values that would go into a different tile.
 	commitID2 := &cid.CommitID{
@@ -78,7 +95,9 @@ func TestAdd(t *testing.T) {
 	err = d.Add(commitID2, values2, "gs://skia-perf/nano-json-v1/blah2/blah.json")
 	assert.NoError(t, err)
 
-	assert.Equal(t, 2, len(d.cache))
+	if b, ok := d.(*BoltTraceStore); ok {
+		assert.Equal(t, 2, len(b.cache))
+	}
 
 	source, value, err = d.Details(commitID2, ",config=565,test=foo,")
 	assert.NoError(t, err)
@@ -152,11 +171,10 @@ func TestBuildMapper(t *testing.T) {
 
 func TestMatch(t *testing.T) {
 	testutils.MediumTest(t)
-	setupStoreDir(t)
-	defer cleanup()
+	forEachBackend(t, testMatch)
+}
 
-	d, err := New(tmpDir)
-	assert.NoError(t, err)
+func testMatch(t *testing.T, d PTraceStore) {
 	commitID1 := &cid.CommitID{
 		Offset: 1,
 		Source: "master",
@@ -166,7 +184,7 @@ func TestMatch(t *testing.T) {
 		",config=8888,test=foo,":       3.21,
 		",arch=x86,source_type=image,": 5.55,
 	}
-	err = d.Add(commitID1, values, "gs://foo")
+	err := d.Add(commitID1, values, "gs://foo")
 	assert.NoError(t, err)
 
 	commitID2 := &cid.CommitID{
@@ -277,3 +295,109 @@ func TestMatch(t *testing.T) {
 	assert.Equal(t, Trace{1.23, 2.34, 3.45, vec32.MISSING_DATA_SENTINEL}, traces[",config=565,test=foo,"])
 	assert.Equal(t, Trace{3.21, 5.43, 9.10, vec32.MISSING_DATA_SENTINEL}, traces[",config=8888,test=foo,"])
 }
+
+func TestColumnReopen(t *testing.T) {
+	testutils.MediumTest(t)
+	setupStoreDir(t)
+	defer cleanup()
+
+	d, err := NewColumnTraceStore(tmpDir)
+	assert.NoError(t, err)
+	commitID := &cid.CommitID{
+		Offset: 1,
+		Source: "master",
+	}
+	err = d.Add(commitID, map[string]float32{",config=565,": 1.23}, "gs://foo")
+	assert.NoError(t, err)
+
+	// Fold the log into the tile file, then add more values to the log.
+	assert.NoError(t, d.Compact())
+	commitID2 := &cid.CommitID{
+		Offset: 2,
+		Source: "master",
+	}
+	err = d.Add(commitID2, map[string]float32{",config=565,": 2.34}, "gs://bar")
+	assert.NoError(t, err)
+
+	// Simulate a crash in the middle of a write by appending a partial record
+	// to the log.
+	f, err := os.OpenFile(filepath.Join(tmpDir, "master-000000"+COLUMN_TILE_SUFFIX, COLUMN_LOG_FILENAME), os.O_WRONLY|os.O_APPEND, 0600)
+	assert.NoError(t, err)
+	_, err = f.Write([]byte{byte(logValueRecord), 0xff})
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	// A new store should see both the compacted and the logged values.
+	d, err = NewColumnTraceStore(tmpDir)
+	assert.NoError(t, err)
+	source, value, err := d.Details(commitID, ",config=565,")
+	assert.NoError(t, err)
+	assert.Equal(t, "gs://foo", source)
+	assert.Equal(t, float32(1.23), value)
+	source, value, err = d.Details(commitID2, ",config=565,")
+	assert.NoError(t, err)
+	assert.Equal(t, "gs://bar", source)
+	assert.Equal(t, float32(2.34), value)
+
+	// And the truncated log can be appended to again.
+	commitID3 := &cid.CommitID{
+		Offset: 3,
+		Source: "master",
+	}
+	err = d.Add(commitID3, map[string]float32{",config=565,": 3.45}, "gs://baz")
+	assert.NoError(t, err)
+	d, err = NewColumnTraceStore(tmpDir)
+	assert.NoError(t, err)
+	traces, err := d.Match([]*cid.CommitID{commitID, commitID2, commitID3}, func(string) bool { return true }, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, TraceSet{",config=565,": Trace{1.23, 2.34, 3.45}}, traces)
+}
+
+func TestBoltExport(t *testing.T) {
+	testutils.MediumTest(t)
+	setupStoreDir(t)
+	defer cleanup()
+
+	b, err := New(filepath.Join(tmpDir, "bolt"))
+	assert.NoError(t, err)
+	commitID1 := &cid.CommitID{
+		Offset: constants.COMMITS_PER_TILE + 1,
+		Source: "master",
+	}
+	commitID2 := &cid.CommitID{
+		Offset: constants.COMMITS_PER_TILE + 2,
+		Source: "master",
+	}
+	assert.NoError(t, b.Add(commitID1, map[string]float32{",config=565,": 1.0, ",config=8888,": 2.0}, "gs://foo"))
+	assert.NoError(t, b.Add(commitID2, map[string]float32{",config=565,": 3.0}, "gs://bar"))
+	// Overwrite a single value, only the last value should be migrated.
+	assert.NoError(t, b.Add(commitID1, map[string]float32{",config=8888,": 4.0}, "gs://baz"))
+
+	tiles, err := b.Tiles()
+	assert.NoError(t, err)
+	assert.Equal(t, []*cid.CommitID{{Source: "master", Offset: constants.COMMITS_PER_TILE}}, tiles)
+
+	c, err := NewColumnTraceStore(filepath.Join(tmpDir, "column"))
+	assert.NoError(t, err)
+	err = b.Export(tiles[0], func(commitID *cid.CommitID, values map[string]float32, sourceFile string) error {
+		return c.Add(commitID, values, sourceFile)
+	})
+	assert.NoError(t, err)
+
+	all := func(string) bool { return true }
+	commitIDs := []*cid.CommitID{commitID1, commitID2}
+	want, err := b.Match(commitIDs, all, nil)
+	assert.NoError(t, err)
+	got, err := c.Match(commitIDs, all, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	source, value, err := c.Details(commitID1, ",config=8888,")
+	assert.NoError(t, err)
+	assert.Equal(t, "gs://baz", source)
+	assert.Equal(t, float32(4.0), value)
+	source, value, err = c.Details(commitID1, ",config=565,")
+	assert.NoError(t, err)
+	assert.Equal(t, "gs://foo", source)
+	assert.Equal(t, float32(1.0), value)
+}
@@ -86,6 +86,19 @@ func (c *Continuous) reportUntriaged(newClustersGauge metrics2.Int64Metric) {
 	}()
 }
 
+// sendNotification sends a notification for a newly found regression, unless
+// the alert is snoozed for the regression, in which case the regression is
+// only recorded.
+func (c *Continuous) sendNotification(details *cid.CommitDetail, cfg *alerts.Config, cl *clustering2.ClusterSummary, offset int) {
+	if snooze := cfg.Snoozed(time.Now(), offset, cl.Keys); snooze != nil {
+		sklog.Infof("Notification for alert %d at %s suppressed by snooze from %s: %q", cfg.ID, details.Message, snooze.Owner, snooze.Reason)
+		return
+	}
+	if err := c.notifier.Send(details, cfg, cl); err != nil {
+		sklog.Errorf("Failed to send notification: %s", err)
+	}
+}
+
 // Run starts the continuous running of clustering over the last numCommits
 // commits.
 //
@@ -164,6 +177,7 @@ func (c *Continuous) Run(ctx context.Context) {
 						Interesting: cfg.Interesting,
 						K:           cfg.K,
 						Sparse:      cfg.Sparse,
+						MaxPValue:   cfg.MaxPValue,
 					}
 					sklog.Infof("Continuous: Clustering at %s for %q", details[0].Message, q)
 					resp, err := clustering2.Run(ctx, req, c.git, c.cidl)
@@ -184,9 +198,7 @@ func (c *Continuous) Run(ctx context.Context) {
 									continue
 								}
 								if isNew {
-									if err := c.notifier.Send(details[0], cfg, cl); err != nil {
-										sklog.Errorf("Failed to send notification: %s", err)
-									}
+									c.sendNotification(details[0], cfg, cl, commit.Index)
 								}
 							}
 							if cl.StepFit.Status == stepfit.HIGH && len(cl.Keys) >= cfg.MinimumNum && (cfg.Direction == alerts.UP || cfg.Direction == alerts.BOTH) {
@@ -197,9 +209,7 @@ func (c *Continuous) Run(ctx context.Context) {
 									continue
 								}
 								if isNew {
-									if err := c.notifier.Send(details[0], cfg, cl); err != nil {
-										sklog.Errorf("Failed to send notification: %s", err)
-									}
+									c.sendNotification(details[0], cfg, cl, commit.Index)
 								}
 							}
 						}
@@ -212,3 +212,96 @@ func (s *Store) TriageHigh(cid *cid.CommitDetail, alertID string, tr TriageStatu
 	})
 	return err
 }
+
+// MAX_BULK_TRIAGE is the maximum number of commits that BulkTriage will touch,
+// since a single Cloud Datastore transaction is limited in the number of
+// entity groups it can operate on.
+const MAX_BULK_TRIAGE = 25
+
+// BulkTriage sets the triage status of every untriaged low and high cluster for
+// the given alertID on commits in the time range [begin, end). All the
+// changes are made in a single transaction. The status of tr must be POSITIVE
+// or NEGATIVE.
+//
+// Returns the number of clusters that were triaged.
+func (s *Store) BulkTriage(begin, end int64, alertID string, tr TriageStatus) (int, error) {
+	if tr.Status != POSITIVE && tr.Status != NEGATIVE {
+		return 0, fmt.Errorf("Invalid triage status for bulk triage: %q", tr.Status)
+	}
+	q := ds.NewQuery(ds.REGRESSION).Filter("TS >=", begin).Filter("TS <", end)
+	keys := []*datastore.Key{}
+	it := ds.DS.Run(context.TODO(), q)
+	for {
+		dsRegression := &DSRegression{}
+		key, err := it.Next(dsRegression)
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			return 0, fmt.Errorf("Failed to read from database: %s", err)
+		}
+		if dsRegression.Triaged {
+			continue
+		}
+		// Only commits with untriaged clusters for this alert count towards
+		// MAX_BULK_TRIAGE.
+		reg := New()
+		if err := json.Unmarshal([]byte(dsRegression.Body), reg); err != nil {
+			return 0, fmt.Errorf("Failed to decode JSON body: %s", err)
+		}
+		if !reg.HasUntriaged(alertID) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	if len(keys) > MAX_BULK_TRIAGE {
+		return 0, fmt.Errorf("Too many commits with untriaged regressions in range, found %d, the maximum is %d.", len(keys), MAX_BULK_TRIAGE)
+	}
+
+	total := 0
+	_, err := ds.DS.RunInTransaction(context.TODO(), func(tx *datastore.Transaction) error {
+		// The transaction may be retried, so reset the count on each attempt.
+		total = 0
+		dsRegressions := make([]*DSRegression, len(keys))
+		for i := range dsRegressions {
+			dsRegressions[i] = &DSRegression{}
+		}
+		if err := tx.GetMulti(keys, dsRegressions); err != nil {
+			return fmt.Errorf("Failed to load Regressions: %s", err)
+		}
+		changedKeys := []*datastore.Key{}
+		changed := []*DSRegression{}
+		for i, dsRegression := range dsRegressions {
+			reg := New()
+			if err := json.Unmarshal([]byte(dsRegression.Body), reg); err != nil {
+				return fmt.Errorf("Failed to decode JSON body: %s", err)
+			}
+			n := reg.TriageUntriaged(alertID, tr)
+			if n == 0 {
+				continue
+			}
+			body, err := reg.JSON()
+			if err != nil {
+				return fmt.Errorf("Failed to encode Regressions to JSON: %s", err)
+			}
+			dsRegression.Body = string(body)
+			dsRegression.Triaged = reg.Triaged()
+			changedKeys = append(changedKeys, keys[i])
+			changed = append(changed, dsRegression)
+			total += n
+		}
+		if len(changed) == 0 {
+			return nil
+		}
+		if _, err := tx.PutMulti(changedKeys, changed); err != nil {
+			return fmt.Errorf("Failed to write to database: %s", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
@@ -118,3 +118,72 @@ func TestDS(t *testing.T) {
 	_, ok = ranges["master-000002"]
 	assert.True(t, ok)
 }
+
+func TestBulkTriage(t *testing.T) {
+	testutils.LargeTest(t)
+	testutils.LocalOnlyTest(t)
+
+	cleanup := testutil.InitDatastore(t, ds.REGRESSION)
+	defer cleanup()
+
+	st := NewStore()
+	df := &dataframe.FrameResponse{}
+	cl := &clustering2.ClusterSummary{}
+	for i := 1; i <= 3; i++ {
+		c := &cid.CommitDetail{
+			CommitID: cid.CommitID{
+				Source: "master",
+				Offset: i,
+			},
+			Timestamp: 1479235651 + int64(i),
+		}
+		_, err := st.SetLow(c, "foo", df, cl)
+		assert.NoError(t, err)
+		_, err = st.SetHigh(c, "bar", df, cl)
+		assert.NoError(t, err)
+	}
+
+	tr := TriageStatus{
+		Status:  POSITIVE,
+		Message: "Expected.",
+	}
+	// Only the first two commits are in range.
+	count, err := st.BulkTriage(1479235651, 1479235651+3, "foo", tr)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	ranges, err := st.Range(1479235651, 1479235651+10, ALL_SUBSET)
+	assert.NoError(t, err)
+	assert.Equal(t, tr, ranges["master-000001"].ByAlertID["foo"].LowStatus)
+	assert.Equal(t, UNTRIAGED, ranges["master-000001"].ByAlertID["bar"].HighStatus.Status)
+	assert.Equal(t, UNTRIAGED, ranges["master-000003"].ByAlertID["foo"].LowStatus.Status)
+
+	// Triaging again finds nothing to do.
+	count, err = st.BulkTriage(1479235651, 1479235651+3, "foo", tr)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	// Clusters can't be bulk triaged back to untriaged.
+	_, err = st.BulkTriage(1479235651, 1479235651+10, "foo", TriageStatus{Status: UNTRIAGED})
+	assert.Error(t, err)
+
+	// Untriaged regressions of other alerts don't count towards
+	// MAX_BULK_TRIAGE.
+	for i := 4; i <= MAX_BULK_TRIAGE+10; i++ {
+		c := &cid.CommitDetail{
+			CommitID: cid.CommitID{
+				Source: "master",
+				Offset: i,
+			},
+			Timestamp: 1479235651 + int64(i),
+		}
+		_, err := st.SetHigh(c, "bar", df, cl)
+		assert.NoError(t, err)
+	}
+	count, err = st.BulkTriage(1479235651, 1479235651+int64(MAX_BULK_TRIAGE)+11, "foo", tr)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	_, err = st.BulkTriage(1479235651, 1479235651+int64(MAX_BULK_TRIAGE)+11, "bar", tr)
+	assert.Error(t, err)
+}
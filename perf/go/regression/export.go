@@ -0,0 +1,126 @@
+package regression
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"go.skia.org/infra/perf/go/clustering2"
+)
+
+// Direction constants used in ExportRow.
+const (
+	LOW_DIRECTION  = "low"
+	HIGH_DIRECTION = "high"
+)
+
+// ExportRow is a single cluster of a Regression flattened for reporting.
+type ExportRow struct {
+	CommitID    string  `json:"commit_id"` // cid.CommitID.ID()
+	URL         string  `json:"url"`       // Link to the commit, if known.
+	AlertID     string  `json:"alert_id"`
+	Alert       string  `json:"alert"` // The display name of the alert, if known.
+	Direction   string  `json:"direction"`
+	ClusterSize int     `json:"cluster_size"`
+	StepSize    float32 `json:"step_size"`
+	Regression  float32 `json:"regression"`
+	Status      Status  `json:"status"`
+	Message     string  `json:"message"`
+}
+
+// exportHeader is the header row of the CSV output, in the same order as the
+// values emitted by ExportRow.csv().
+var exportHeader = []string{
+	"commit_id",
+	"url",
+	"alert_id",
+	"alert",
+	"direction",
+	"cluster_size",
+	"step_size",
+	"regression",
+	"status",
+	"message",
+}
+
+func (e *ExportRow) csv() []string {
+	return []string{
+		e.CommitID,
+		e.URL,
+		e.AlertID,
+		e.Alert,
+		e.Direction,
+		fmt.Sprintf("%d", e.ClusterSize),
+		fmt.Sprintf("%g", e.StepSize),
+		fmt.Sprintf("%g", e.Regression),
+		string(e.Status),
+		e.Message,
+	}
+}
+
+func newExportRow(commitID, alertID, direction string, cl *clustering2.ClusterSummary, tr TriageStatus) *ExportRow {
+	ret := &ExportRow{
+		CommitID:    commitID,
+		AlertID:     alertID,
+		Direction:   direction,
+		ClusterSize: cl.Num,
+		Status:      tr.Status,
+		Message:     tr.Message,
+	}
+	if cl.StepFit != nil {
+		ret.StepSize = cl.StepFit.StepSize
+		ret.Regression = cl.StepFit.Regression
+	}
+	return ret
+}
+
+// ToExportRows flattens the results of Store.Range into a slice of
+// ExportRow's, one for each low or high cluster found, sorted by commit, alert
+// and then direction.
+func ToExportRows(regMap map[string]*Regressions) []*ExportRow {
+	ret := []*ExportRow{}
+	for commitID, regs := range regMap {
+		regs.mutex.Lock()
+		for alertID, reg := range regs.ByAlertID {
+			if reg.Low != nil {
+				ret = append(ret, newExportRow(commitID, alertID, LOW_DIRECTION, reg.Low, reg.LowStatus))
+			}
+			if reg.High != nil {
+				ret = append(ret, newExportRow(commitID, alertID, HIGH_DIRECTION, reg.High, reg.HighStatus))
+			}
+		}
+		regs.mutex.Unlock()
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].CommitID != ret[j].CommitID {
+			return ret[i].CommitID < ret[j].CommitID
+		}
+		if ret[i].AlertID != ret[j].AlertID {
+			return ret[i].AlertID < ret[j].AlertID
+		}
+		return ret[i].Direction > ret[j].Direction
+	})
+	return ret
+}
+
+// WriteCSV writes the rows as CSV, including a header row.
+func WriteCSV(w io.Writer, rows []*ExportRow) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(exportHeader); err != nil {
+		return fmt.Errorf("Failed to write CSV header: %s", err)
+	}
+	for _, row := range rows {
+		if err := cw.Write(row.csv()); err != nil {
+			return fmt.Errorf("Failed to write CSV row: %s", err)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes the rows as a JSON array.
+func WriteJSON(w io.Writer, rows []*ExportRow) error {
+	return json.NewEncoder(w).Encode(rows)
+}
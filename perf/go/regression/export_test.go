@@ -0,0 +1,60 @@
+package regression
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/perf/go/clustering2"
+	"go.skia.org/infra/perf/go/dataframe"
+	"go.skia.org/infra/perf/go/stepfit"
+)
+
+func TestExport(t *testing.T) {
+	testutils.SmallTest(t)
+	df := &dataframe.FrameResponse{}
+	low := &clustering2.ClusterSummary{
+		Num: 10,
+		StepFit: &stepfit.StepFit{
+			StepSize:   1.5,
+			Regression: 20,
+		},
+	}
+	high := &clustering2.ClusterSummary{
+		Num: 3,
+	}
+
+	r1 := New()
+	r1.SetLow("1", df, low)
+	r1.SetHigh("1", df, high)
+	err := r1.TriageLow("1", TriageStatus{Status: NEGATIVE, Message: "See bug, \"foo\"."})
+	assert.NoError(t, err)
+	r2 := New()
+	r2.SetHigh("2", df, high)
+
+	rows := ToExportRows(map[string]*Regressions{
+		"master-000002": r2,
+		"master-000001": r1,
+	})
+	assert.Len(t, rows, 3)
+	assert.Equal(t, "master-000001", rows[0].CommitID)
+	assert.Equal(t, LOW_DIRECTION, rows[0].Direction)
+	assert.Equal(t, 10, rows[0].ClusterSize)
+	assert.Equal(t, float32(1.5), rows[0].StepSize)
+	assert.Equal(t, NEGATIVE, rows[0].Status)
+	assert.Equal(t, HIGH_DIRECTION, rows[1].Direction)
+	assert.Equal(t, UNTRIAGED, rows[1].Status)
+	assert.Equal(t, "master-000002", rows[2].CommitID)
+	assert.Equal(t, "2", rows[2].AlertID)
+
+	var b bytes.Buffer
+	err = WriteCSV(&b, rows[:1])
+	assert.NoError(t, err)
+	assert.Equal(t, "commit_id,url,alert_id,alert,direction,cluster_size,step_size,regression,status,message\nmaster-000001,,1,,low,10,1.5,20,negative,\"See bug, \"\"foo\"\".\"\n", b.String())
+
+	b.Reset()
+	err = WriteJSON(&b, rows[2:])
+	assert.NoError(t, err)
+	assert.Equal(t, "[{\"commit_id\":\"master-000002\",\"url\":\"\",\"alert_id\":\"2\",\"alert\":\"\",\"direction\":\"high\",\"cluster_size\":3,\"step_size\":0,\"regression\":0,\"status\":\"untriaged\",\"message\":\"\"}]\n", b.String())
+}
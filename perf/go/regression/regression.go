@@ -145,6 +145,41 @@ func (r *Regressions) TriageHigh(alertid string, tr TriageStatus) error {
 	return nil
 }
 
+// HasUntriaged returns true if the low or high cluster of the given alertid is
+// untriaged.
+func (r *Regressions) HasUntriaged(alertid string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	reg, ok := r.ByAlertID[alertid]
+	if !ok {
+		return false
+	}
+	return (reg.Low != nil && reg.LowStatus.Status == UNTRIAGED) || (reg.High != nil && reg.HighStatus.Status == UNTRIAGED)
+}
+
+// TriageUntriaged sets the triage status for both the low and high clusters
+// of the given alertid, but only for clusters that are currently untriaged.
+//
+// Returns the number of clusters that were triaged.
+func (r *Regressions) TriageUntriaged(alertid string, tr TriageStatus) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	reg, ok := r.ByAlertID[alertid]
+	if !ok {
+		return 0
+	}
+	count := 0
+	if reg.Low != nil && reg.LowStatus.Status == UNTRIAGED {
+		reg.LowStatus = tr
+		count += 1
+	}
+	if reg.High != nil && reg.HighStatus.Status == UNTRIAGED {
+		reg.HighStatus = tr
+		count += 1
+	}
+	return count
+}
+
 // Triaged returns true if all clusters are triaged.
 func (r *Regressions) Triaged() bool {
 	ret := true
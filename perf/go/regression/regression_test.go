@@ -58,3 +58,39 @@ func TestRegressions(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "{\"by_query\":{\"source_type=skp\":{\"low\":{\"centroid\":null,\"keys\":null,\"param_summaries\":null,\"step_fit\":null,\"step_point\":null,\"num\":0},\"high\":{\"centroid\":null,\"keys\":null,\"param_summaries\":null,\"step_fit\":null,\"step_point\":null,\"num\":0},\"frame\":{\"dataframe\":null,\"ticks\":null,\"skps\":null,\"msg\":\"\"},\"low_status\":{\"status\":\"positive\",\"message\":\"SKP Update\"},\"high_status\":{\"status\":\"negative\",\"message\":\"See bug #foo.\"}}}}", string(b))
 }
+
+func TestTriageUntriaged(t *testing.T) {
+	testutils.SmallTest(t)
+	r := New()
+	df := &dataframe.FrameResponse{}
+	cl := &clustering2.ClusterSummary{}
+	r.SetLow("1", df, cl)
+	r.SetHigh("1", df, cl)
+	r.SetLow("2", df, cl)
+
+	tr := TriageStatus{
+		Status:  POSITIVE,
+		Message: "SKP Update",
+	}
+	// Triage the high cluster of alert 1 so only the low cluster is untriaged.
+	err := r.TriageHigh("1", TriageStatus{Status: NEGATIVE, Message: "bug"})
+	assert.NoError(t, err)
+
+	assert.True(t, r.HasUntriaged("1"))
+	assert.Equal(t, 1, r.TriageUntriaged("1", tr))
+	assert.False(t, r.HasUntriaged("1"))
+	assert.Equal(t, tr, r.ByAlertID["1"].LowStatus)
+	assert.Equal(t, NEGATIVE, r.ByAlertID["1"].HighStatus.Status)
+	assert.False(t, r.Triaged())
+
+	// Already triaged, so nothing changes.
+	assert.Equal(t, 0, r.TriageUntriaged("1", tr))
+
+	// Unknown alert.
+	assert.False(t, r.HasUntriaged("3"))
+	assert.Equal(t, 0, r.TriageUntriaged("3", tr))
+
+	assert.Equal(t, 1, r.TriageUntriaged("2", tr))
+	assert.Equal(t, NONE, r.ByAlertID["2"].HighStatus.Status)
+	assert.True(t, r.Triaged())
+}
@@ -0,0 +1,175 @@
+// Package significance provides statistical tests for deciding if a step in
+// a trace is real or just noise.
+package significance
+
+import (
+	"math"
+	"sort"
+
+	"go.skia.org/infra/go/vec32"
+)
+
+const (
+	// MIN_SAMPLES is the smallest number of non-missing values needed on each
+	// side of a step to run a test. With fewer samples MannWhitneyU always
+	// returns a p-value of 1.
+	MIN_SAMPLES = 2
+
+	// MAX_EXACT_SAMPLES is the largest total number of samples for which the
+	// exact distribution of U is used. Larger samples, or samples with ties,
+	// use the normal approximation.
+	MAX_EXACT_SAMPLES = 30
+)
+
+// rank is a value and which sample it came from.
+type rank struct {
+	value float32
+	first bool
+}
+
+type rankSlice []rank
+
+func (p rankSlice) Len() int           { return len(p) }
+func (p rankSlice) Less(i, j int) bool { return p[i].value < p[j].value }
+func (p rankSlice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// MannWhitneyU runs a two-sided Mann-Whitney U test to determine if the values
+// in 'x' and the values in 'y' come from the same distribution, and returns
+// the p-value. The smaller the p-value the less likely it is that the
+// difference between 'x' and 'y' is just noise.
+//
+// The test is non-parametric, i.e. it only looks at the relative ordering of
+// the values, so it works with both normalized and raw trace values.
+// vec32.MISSING_DATA_SENTINEL values are ignored.
+func MannWhitneyU(x, y []float32) float64 {
+	ranks := make([]rank, 0, len(x)+len(y))
+	for _, v := range x {
+		if v != vec32.MISSING_DATA_SENTINEL {
+			ranks = append(ranks, rank{value: v, first: true})
+		}
+	}
+	n1 := len(ranks)
+	for _, v := range y {
+		if v != vec32.MISSING_DATA_SENTINEL {
+			ranks = append(ranks, rank{value: v, first: false})
+		}
+	}
+	n2 := len(ranks) - n1
+	if n1 < MIN_SAMPLES || n2 < MIN_SAMPLES {
+		return 1
+	}
+	sort.Sort(rankSlice(ranks))
+
+	// Sum the ranks of the values in 'x', giving tied values the average of
+	// the ranks they span, and accumulate the tie correction term.
+	r1 := 0.0
+	ties := 0.0
+	for i := 0; i < len(ranks); {
+		j := i + 1
+		for j < len(ranks) && ranks[j].value == ranks[i].value {
+			j++
+		}
+		avgRank := float64(i+j+1) / 2.0
+		for k := i; k < j; k++ {
+			if ranks[k].first {
+				r1 += avgRank
+			}
+		}
+		if t := float64(j - i); t > 1 {
+			ties += t*t*t - t
+		}
+		i = j
+	}
+	u := r1 - float64(n1*(n1+1))/2.0
+
+	if ties == 0 && n1+n2 <= MAX_EXACT_SAMPLES {
+		return exactP(int(u), n1, n2)
+	}
+	return normalP(u, n1, n2, ties)
+}
+
+// exactP returns the two-sided p-value of the statistic 'u' using the exact
+// distribution of U for samples of size n1 and n2 with no ties.
+func exactP(u, n1, n2 int) float64 {
+	// counts[m][n][k] is the number of orderings of m values from the first
+	// sample and n values from the second sample that produce U=k. Only the
+	// current m is kept.
+	maxU := n1 * n2
+	prev := make([][]float64, n2+1)
+	for n := range prev {
+		prev[n] = make([]float64, maxU+1)
+		prev[n][0] = 1
+	}
+	for m := 1; m <= n1; m++ {
+		cur := make([][]float64, n2+1)
+		for n := range cur {
+			cur[n] = make([]float64, maxU+1)
+			for k := 0; k <= maxU; k++ {
+				// The largest value either comes from the first sample, which
+				// adds n to U, or from the second sample.
+				if k-n >= 0 {
+					cur[n][k] += prev[n][k-n]
+				}
+				if n > 0 {
+					cur[n][k] += cur[n-1][k]
+				}
+			}
+		}
+		prev = cur
+	}
+	dist := prev[n2]
+	total := 0.0
+	for _, c := range dist {
+		total += c
+	}
+	lower := 0.0
+	for k := 0; k <= u; k++ {
+		lower += dist[k]
+	}
+	upper := 0.0
+	for k := u; k <= maxU; k++ {
+		upper += dist[k]
+	}
+	return math.Min(1, 2*math.Min(lower, upper)/total)
+}
+
+// normalP returns the two-sided p-value of the statistic 'u' using the normal
+// approximation, corrected for ties and continuity.
+func normalP(u float64, n1, n2 int, ties float64) float64 {
+	n := float64(n1 + n2)
+	mean := float64(n1*n2) / 2.0
+	variance := float64(n1*n2) / 12.0 * ((n + 1) - ties/(n*(n-1)))
+	if variance <= 0 {
+		// All the values are the same.
+		return 1
+	}
+	z := (math.Abs(u-mean) - 0.5) / math.Sqrt(variance)
+	if z < 0 {
+		z = 0
+	}
+	return math.Min(1, math.Erfc(z/math.Sqrt2))
+}
+
+// StepPValue returns the p-value of the step in 'trace' at index 'turn', i.e.
+// the result of MannWhitneyU on the values before and after 'turn'.
+func StepPValue(trace []float32, turn int) float64 {
+	if turn <= 0 || turn >= len(trace) {
+		return 1
+	}
+	return MannWhitneyU(trace[:turn], trace[turn:])
+}
+
+// Median returns the median of the given p-values, or 1 if there are none.
+func Median(pValues []float64) float64 {
+	if len(pValues) == 0 {
+		return 1
+	}
+	sorted := make([]float64, len(pValues))
+	copy(sorted, pValues)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
+	}
+	return (sorted[mid-1] + sorted[mid]) / 2
+}
@@ -0,0 +1,101 @@
+package significance
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/go/vec32"
+)
+
+func TestMannWhitneyU(t *testing.T) {
+	testutils.SmallTest(t)
+	e := vec32.MISSING_DATA_SENTINEL
+	testCases := []struct {
+		x       []float32
+		y       []float32
+		pValue  float64
+		message string
+	}{
+		{
+			x:       []float32{1, 2, 3},
+			y:       []float32{4, 5, 6},
+			pValue:  0.1,
+			message: "Exact, complete separation",
+		},
+		{
+			x:       []float32{6, 5, 4, 3, 2},
+			y:       []float32{11, 10, 9, 8, 7},
+			pValue:  2.0 / 252.0,
+			message: "Exact, order of values doesn't matter",
+		},
+		{
+			x:       []float32{1, 2, 3, e, e},
+			y:       []float32{e, 4, 5, 6},
+			pValue:  0.1,
+			message: "Missing values are ignored",
+		},
+		{
+			x:       []float32{1, 3, 5},
+			y:       []float32{2, 4, 6},
+			pValue:  0.7,
+			message: "Exact, interleaved",
+		},
+		{
+			x:       []float32{1, 1, 1},
+			y:       []float32{1, 1, 1},
+			pValue:  1,
+			message: "All the same",
+		},
+		{
+			x:       []float32{1},
+			y:       []float32{2, 3, 4},
+			pValue:  1,
+			message: "Too few samples",
+		},
+		{
+			x:       []float32{},
+			y:       []float32{},
+			pValue:  1,
+			message: "Empty",
+		},
+	}
+	for _, tc := range testCases {
+		assert.InDelta(t, tc.pValue, MannWhitneyU(tc.x, tc.y), 1e-9, tc.message)
+	}
+}
+
+func TestMannWhitneyUNormal(t *testing.T) {
+	testutils.SmallTest(t)
+	// Ties force the use of the normal approximation.
+	p := MannWhitneyU([]float32{0, 0, 0, 0, 0, 0, 0}, []float32{1, 1, 1, 1, 1, 1, 1, 1})
+	assert.True(t, p < 0.001, "p: %g", p)
+	p = MannWhitneyU([]float32{0, 1, 0, 1, 0, 1, 0}, []float32{1, 0, 1, 0, 1, 0, 1, 0})
+	assert.True(t, p > 0.5, "p: %g", p)
+
+	// Large samples use the normal approximation.
+	x := []float32{}
+	y := []float32{}
+	for i := 0; i < 20; i++ {
+		x = append(x, float32(i))
+		y = append(y, float32(i)+100)
+	}
+	p = MannWhitneyU(x, y)
+	assert.True(t, p < 0.0001, "p: %g", p)
+}
+
+func TestStepPValue(t *testing.T) {
+	testutils.SmallTest(t)
+	trace := []float32{1, 2, 3, 4, 5, 6}
+	assert.InDelta(t, 0.1, StepPValue(trace, 3), 1e-9)
+	assert.Equal(t, 1.0, StepPValue(trace, 0))
+	assert.Equal(t, 1.0, StepPValue(trace, 6))
+	assert.Equal(t, 1.0, StepPValue([]float32{}, 0))
+}
+
+func TestMedian(t *testing.T) {
+	testutils.SmallTest(t)
+	assert.Equal(t, 1.0, Median(nil))
+	assert.Equal(t, 0.2, Median([]float64{0.5, 0.2, 0.1}))
+	assert.InDelta(t, 0.3, Median([]float64{0.5, 0.2, 0.4, 0.1}), 1e-9)
+}
@@ -23,6 +23,7 @@ import (
 
 	storage "cloud.google.com/go/storage"
 	"github.com/gorilla/mux"
+	"go.skia.org/infra/go/chatbot"
 	"go.skia.org/infra/go/ds"
 	"go.skia.org/infra/go/email"
 	"go.skia.org/infra/go/metadata"
@@ -98,11 +99,13 @@ var (
 	port                  = flag.String("port", ":8000", "HTTP service address (e.g., ':8000')")
 	projectName           = flag.String("project_name", "google.com:skia-buildbots", "The Google Cloud project name.")
 	promPort              = flag.String("prom_port", ":20000", "Metrics service address (e.g., ':10110')")
+	ptraceStoreBackend    = flag.String("ptrace_store_backend", "bolt", "The storage backend for ptracestore tiles, either \"bolt\" or \"column\".")
 	ptraceStoreDir        = flag.String("ptrace_store_dir", "/tmp/ptracestore", "The directory where the ptracestore tiles are stored.")
 	radius                = flag.Int("radius", 7, "The number of commits to include on either side of a commit when clustering.")
 	resourcesDir          = flag.String("resources_dir", "", "The directory to find templates, JS, and CSS files. If blank the current directory will be used.")
 	stepUpOnly            = flag.Bool("step_up_only", false, "Only regressions that look like a step up will be reported.")
 	subdomain             = flag.String("subdomain", "perf", "The public subdomain of the server, i.e. 'perf' for perf.skia.org.")
+	webhookHosts          = common.NewMultiStringFlag("webhook_host", nil, "Host that alerts may send webhooks to, may be repeated. Webhooks are rejected if none are given.")
 )
 
 var (
@@ -222,7 +225,11 @@ func Init() {
 	if err != nil {
 		sklog.Fatal(err)
 	}
-	ptracestore.Init(*ptraceStoreDir)
+	backend, err := ptracestore.ToBackend(*ptraceStoreBackend)
+	if err != nil {
+		sklog.Fatalf("The --ptrace_store_backend flag value is invalid: %s", err)
+	}
+	ptracestore.Init(backend, *ptraceStoreDir)
 
 	freshDataFrame, err = dataframe.NewRefresher(ctx, git, ptracestore.Default, time.Minute, *dataFrameSize)
 	if err != nil {
@@ -258,17 +265,19 @@ func Init() {
 		}
 	}
 
+	var emailAuth notify.Email
 	if !*noemail {
 		if *local && (emailClientId == "" || emailClientSecret == "") {
 			sklog.Fatal("If -local, you must provide -email_clientid and -email_clientsecret")
 		}
-		emailAuth, err := email.NewGMail(emailClientId, emailClientSecret, tokenFile)
+		gmail, err := email.NewGMail(emailClientId, emailClientSecret, tokenFile)
 		if err != nil {
 			sklog.Fatalf("Failed to create email auth: %v", err)
 		}
-
-		notifier = notify.New(emailAuth, *subdomain)
+		emailAuth = gmail
 	}
+	chatbot.Init(fmt.Sprintf("Perf (%s)", *subdomain))
+	notifier = notify.New(emailAuth, *subdomain, *webhookHosts)
 
 	frameRequests = dataframe.NewRunningFrameRequests(git)
 	clusterRequests = clustering2.NewRunningClusterRequests(git, cidl, float32(*interesting))
@@ -824,6 +833,143 @@ func triageHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// BulkTriageRequest is used in bulkTriageHandler.
+//
+// Begin and End are Unix timestamps in seconds.
+type BulkTriageRequest struct {
+	Begin  int64                   `json:"begin"`
+	End    int64                   `json:"end"`
+	Alert  alerts.Config           `json:"alert"`
+	Triage regression.TriageStatus `json:"triage"`
+}
+
+// BulkTriageResponse is used in bulkTriageHandler.
+type BulkTriageResponse struct {
+	Count int `json:"count"` // The number of clusters triaged.
+}
+
+// bulkTriageHandler takes a POST'd BulkTriageRequest serialized as JSON and
+// triages all the untriaged regressions for the given alert in the given time
+// range.
+//
+// If succesful it returns a 200, or an HTTP status code of 500 otherwise.
+func bulkTriageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if login.LoggedInAs(r) == "" {
+		httputils.ReportError(w, r, fmt.Errorf("Not logged in."), "You must be logged in to triage.")
+		return
+	}
+	btr := &BulkTriageRequest{}
+	if err := json.NewDecoder(r.Body).Decode(btr); err != nil {
+		httputils.ReportError(w, r, err, "Failed to decode JSON.")
+		return
+	}
+	count, err := regStore.BulkTriage(btr.Begin, btr.End, btr.Alert.IdAsString(), btr.Triage)
+	if err != nil {
+		httputils.ReportError(w, r, err, "Failed to triage.")
+		return
+	}
+
+	link := fmt.Sprintf("%s/t/?begin=%d&end=%d&subset=all", r.Header.Get("Origin"), btr.Begin, btr.End)
+	a := &activitylog.Activity{
+		UserID: login.LoggedInAs(r),
+		Action: fmt.Sprintf("Perf Bulk Triage: %q %d clusters %q %q", btr.Alert.Query, count, btr.Triage.Status, btr.Triage.Message),
+		URL:    link,
+	}
+	if err := activitylog.Write(a); err != nil {
+		sklog.Errorf("Failed to log activity: %s", err)
+	}
+
+	if err := json.NewEncoder(w).Encode(BulkTriageResponse{Count: count}); err != nil {
+		sklog.Errorf("Failed to write or encode output: %s", err)
+	}
+}
+
+// regressionExportHandler returns the regressions found by Store.Range as
+// either CSV or JSON. The query parameters are:
+//
+//    begin  - Unix timestamp in seconds.
+//    end    - Unix timestamp in seconds.
+//    subset - A regression.Subset, defaults to "all".
+//    format - Either "csv" or "json", defaults to "csv".
+func regressionExportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	begin, err := strconv.ParseInt(r.FormValue("begin"), 10, 64)
+	if err != nil {
+		httputils.ReportError(w, r, err, "Invalid value for begin.")
+		return
+	}
+	end, err := strconv.ParseInt(r.FormValue("end"), 10, 64)
+	if err != nil {
+		httputils.ReportError(w, r, err, "Invalid value for end.")
+		return
+	}
+	subset := regression.Subset(r.FormValue("subset"))
+	if subset == "" {
+		subset = regression.ALL_SUBSET
+	}
+	format := r.FormValue("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		httputils.ReportError(w, r, fmt.Errorf("Unknown format: %q", format), "Format must be csv or json.")
+		return
+	}
+
+	regMap, err := regStore.Range(begin, end, subset)
+	if err != nil {
+		httputils.ReportError(w, r, err, "Failed to load regressions.")
+		return
+	}
+	rows := regression.ToExportRows(regMap)
+
+	// Fill in the alert names and commit URLs.
+	cfgs, err := configProvider()
+	if err != nil {
+		httputils.ReportError(w, r, err, "Failed to retrieve alert configs.")
+		return
+	}
+	names := map[string]string{}
+	for _, c := range cfgs {
+		names[c.IdAsString()] = c.DisplayName
+	}
+	ids := []*cid.CommitID{}
+	for k, _ := range regMap {
+		c, err := cid.FromID(k)
+		if err != nil {
+			httputils.ReportError(w, r, err, "Got an invalid commit id.")
+			return
+		}
+		ids = append(ids, c)
+	}
+	details, err := cidl.Lookup(ctx, ids)
+	if err != nil {
+		httputils.ReportError(w, r, err, "Failed to look up commit details")
+		return
+	}
+	urls := map[string]string{}
+	for _, d := range details {
+		urls[d.ID()] = d.URL
+	}
+	for _, row := range rows {
+		row.Alert = names[row.AlertID]
+		row.URL = urls[row.CommitID]
+	}
+
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		err = regression.WriteJSON(w, rows)
+	} else {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=regressions-%d-%d.csv", begin, end))
+		err = regression.WriteCSV(w, rows)
+	}
+	if err != nil {
+		sklog.Errorf("Failed to write or encode output: %s", err)
+	}
+}
+
 func regressionCountHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	rr := &RegressionRangeRequest{
@@ -1189,6 +1335,77 @@ func alertDeleteHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func alertSnoozeHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	user := login.LoggedInAs(r)
+	if user == "" {
+		httputils.ReportError(w, r, fmt.Errorf("Not logged in."), "You must be logged in to snooze alerts.")
+		return
+	}
+
+	sid := mux.Vars(r)["id"]
+	id, err := strconv.ParseInt(sid, 10, 64)
+	if err != nil {
+		httputils.ReportError(w, r, err, "Failed to parse alert id.")
+		return
+	}
+	snooze := alerts.Snooze{}
+	if err := json.NewDecoder(r.Body).Decode(&snooze); err != nil {
+		httputils.ReportError(w, r, err, "Failed to decode JSON.")
+		return
+	}
+	snooze.Owner = user
+	snooze.Created = time.Now().Unix()
+	cfg, err := alertStore.Snooze(int(id), snooze)
+	if err != nil {
+		httputils.ReportError(w, r, err, "Failed to snooze the alerts.Config.")
+		return
+	}
+	a := &activitylog.Activity{
+		UserID: user,
+		Action: fmt.Sprintf("Snooze Alert: %d, %#v", id, snooze),
+		URL:    fmt.Sprintf("/a/?%d", id),
+	}
+	if err := activitylog.Write(a); err != nil {
+		sklog.Errorf("Failed to log activity: %s", err)
+	}
+	if err := json.NewEncoder(w).Encode(cfg); err != nil {
+		sklog.Errorf("Failed to write JSON response: %s", err)
+	}
+}
+
+func alertUnsnoozeHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	user := login.LoggedInAs(r)
+	if user == "" {
+		httputils.ReportError(w, r, fmt.Errorf("Not logged in."), "You must be logged in to unsnooze alerts.")
+		return
+	}
+
+	sid := mux.Vars(r)["id"]
+	id, err := strconv.ParseInt(sid, 10, 64)
+	if err != nil {
+		httputils.ReportError(w, r, err, "Failed to parse alert id.")
+		return
+	}
+	cfg, err := alertStore.Unsnooze(int(id))
+	if err != nil {
+		httputils.ReportError(w, r, err, "Failed to unsnooze the alerts.Config.")
+		return
+	}
+	a := &activitylog.Activity{
+		UserID: user,
+		Action: fmt.Sprintf("Unsnooze Alert: %d", id),
+		URL:    fmt.Sprintf("/a/?%d", id),
+	}
+	if err := activitylog.Write(a); err != nil {
+		sklog.Errorf("Failed to log activity: %s", err)
+	}
+	if err := json.NewEncoder(w).Encode(cfg); err != nil {
+		sklog.Errorf("Failed to write JSON response: %s", err)
+	}
+}
+
 type TryBugRequest struct {
 	BugURITemplate string `json:"bug_uri_template"`
 }
@@ -1231,7 +1448,7 @@ func alertNotifyTryHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := notifier.ExampleSend(req); err != nil {
-		httputils.ReportError(w, r, err, fmt.Sprintf("Failed to send email: %s", err))
+		httputils.ReportError(w, r, err, fmt.Sprintf("Failed to send notification: %s", err))
 	}
 }
 
@@ -1347,7 +1564,9 @@ func main() {
 	router.HandleFunc("/_/reg/", regressionRangeHandler).Methods("POST")
 	router.HandleFunc("/_/reg/count", regressionCountHandler).Methods("GET")
 	router.HandleFunc("/_/reg/current", regressionCurrentHandler).Methods("GET")
+	router.HandleFunc("/_/reg/export", regressionExportHandler).Methods("GET")
 	router.HandleFunc("/_/triage/", triageHandler).Methods("POST")
+	router.HandleFunc("/_/triage/bulk", bulkTriageHandler).Methods("POST")
 	router.HandleFunc("/_/alerts/", alertsHandler)
 	router.HandleFunc("/_/details/", detailsHandler).Methods("POST")
 	router.HandleFunc("/_/shift/", shiftHandler).Methods("POST")
@@ -1355,6 +1574,8 @@ func main() {
 	router.HandleFunc("/_/alert/new", alertNewHandler).Methods("GET")
 	router.HandleFunc("/_/alert/update", alertUpdateHandler).Methods("POST")
 	router.HandleFunc("/_/alert/delete/{id:[0-9]+}", alertDeleteHandler).Methods("POST")
+	router.HandleFunc("/_/alert/snooze/{id:[0-9]+}", alertSnoozeHandler).Methods("POST")
+	router.HandleFunc("/_/alert/unsnooze/{id:[0-9]+}", alertUnsnoozeHandler).Methods("POST")
 	router.HandleFunc("/_/alert/bug/try", alertBugTryHandler).Methods("POST")
 	router.HandleFunc("/_/alert/notify/try", alertNotifyTryHandler).Methods("POST")
 
@@ -7,6 +7,10 @@ import (
 )
 
 const (
+	// MIN_SEGMENT_LENGTH is the smallest number of points allowed on either
+	// side of a turning point found by GetStepFitBest.
+	MIN_SEGMENT_LENGTH = 2
+
 	// The possible values for StepFit.Status are:
 
 	LOW           = "Low"
@@ -41,6 +45,13 @@ type StepFit struct {
 	//
 	// Values can be "High", "Low", and "Uninteresting"
 	Status string `json:"status"`
+
+	// Confidence is a value in [0, 1] that describes how much better a step
+	// function at TurningPoint fits the trace than a flat line, i.e. it is the
+	// fraction of the total sum squared error that the step explains.
+	//
+	// Only populated by GetStepFitBest.
+	Confidence float32 `json:"confidence"`
 }
 
 // GetStepFitAtMid takes one []float32 trace and calculates and returns a StepFit.
@@ -79,3 +90,86 @@ func GetStepFitAtMid(trace []float32, interesting float32) *StepFit {
 		Status:       status,
 	}
 }
+
+// GetStepFitBest takes one []float32 trace and calculates and returns the
+// StepFit for the turning point that best fits the trace.
+//
+// Unlike GetStepFitAtMid, every index that leaves at least MIN_SEGMENT_LENGTH
+// points on each side is considered as a turning point, and the one with the
+// smallest sum squared error is chosen. All candidates are evaluated in a
+// single pass over the trace using running sums. MISSING_DATA_SENTINEL values
+// are ignored.
+//
+// See StepFit for a description of the values being calculated.
+func GetStepFitBest(trace []float32, interesting float32) *StepFit {
+	n := len(trace)
+
+	// sum[i], sumSq[i], and count[i] hold the sum, the sum of squares, and the
+	// number of non-missing points in trace[:i].
+	sum := make([]float64, n+1)
+	sumSq := make([]float64, n+1)
+	count := make([]int, n+1)
+	for i, x := range trace {
+		sum[i+1] = sum[i]
+		sumSq[i+1] = sumSq[i]
+		count[i+1] = count[i]
+		if x != vec32.MISSING_DATA_SENTINEL {
+			v := float64(x)
+			sum[i+1] += v
+			sumSq[i+1] += v * v
+			count[i+1]++
+		}
+	}
+
+	// sse returns the mean and the sum squared error about the mean of
+	// trace[begin:end].
+	sse := func(begin, end int) (float64, float64) {
+		c := count[end] - count[begin]
+		if c == 0 {
+			return 0, 0
+		}
+		s := sum[end] - sum[begin]
+		mean := s / float64(c)
+		return mean, math.Max(0, (sumSq[end]-sumSq[begin])-s*mean)
+	}
+
+	lse := float32(math.MaxFloat32)
+	stepSize := float32(-1.0)
+	turn := 0
+	confidence := float32(0.0)
+
+	_, total := sse(0, n)
+	best := math.MaxFloat64
+	for i := MIN_SEGMENT_LENGTH; i <= n-MIN_SEGMENT_LENGTH; i++ {
+		y0, d0 := sse(0, i)
+		y1, d1 := sse(i, n)
+		if y0 == y1 {
+			continue
+		}
+		if d := d0 + d1; d < best {
+			best = d
+			lse = float32(d)
+			stepSize = float32(y0 - y1)
+			turn = i
+			if total > 0 {
+				confidence = float32(1 - d/total)
+			}
+		}
+	}
+	lse = float32(math.Sqrt(float64(lse))) / float32(n)
+	regression := stepSize / lse
+	status := UNINTERESTING
+	if regression > interesting {
+		status = LOW
+	} else if regression < -interesting {
+		status = HIGH
+	}
+	return &StepFit{
+		LeastSquares: lse,
+		StepSize:     stepSize,
+		TurningPoint: turn,
+		Regression:   regression,
+		Status:       status,
+		Confidence:   confidence,
+	}
+}
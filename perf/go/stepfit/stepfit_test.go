@@ -56,3 +56,59 @@ func TestStepFit(t *testing.T) {
 		}
 	}
 }
+
+func TestStepFitBest(t *testing.T) {
+	testutils.SmallTest(t)
+	testCases := []struct {
+		value    []float32
+		expected *StepFit
+		message  string
+	}{
+		{
+			value:    []float32{0, 0, 1, 1, 1},
+			expected: &StepFit{TurningPoint: 2, StepSize: -1, Status: HIGH, Confidence: 1},
+			message:  "Simple Step Up",
+		},
+		{
+			value:    []float32{0, 0, 0, 0, 1, 1},
+			expected: &StepFit{TurningPoint: 4, StepSize: -1, Status: HIGH, Confidence: 1},
+			message:  "Off Center Step Up",
+		},
+		{
+			value:    []float32{1, 1, 0, 0, 0, 0, 0},
+			expected: &StepFit{TurningPoint: 2, StepSize: 1, Status: LOW, Confidence: 1},
+			message:  "Off Center Step Down",
+		},
+		{
+			value:    []float32{1, 1, 1, 1, 1},
+			expected: &StepFit{TurningPoint: 0, StepSize: -1, Status: UNINTERESTING, Confidence: 0},
+			message:  "No step",
+		},
+		{
+			value:    []float32{0, 1, 0},
+			expected: &StepFit{TurningPoint: 0, StepSize: -1, Status: UNINTERESTING, Confidence: 0},
+			message:  "Too short",
+		},
+		{
+			value:    []float32{},
+			expected: &StepFit{TurningPoint: 0, StepSize: -1, Status: UNINTERESTING, Confidence: 0},
+			message:  "Empty",
+		},
+	}
+
+	for _, tc := range testCases {
+		got, want := GetStepFitBest(tc.value, 50), tc.expected
+		if got.StepSize != want.StepSize {
+			t.Errorf("Failed StepFit Got %#v Want %#v: %s", got.StepSize, want.StepSize, tc.message)
+		}
+		if got.Status != want.Status {
+			t.Errorf("Failed StepFit Got %#v Want %#v: %s", got.Status, want.Status, tc.message)
+		}
+		if got.TurningPoint != want.TurningPoint {
+			t.Errorf("Failed StepFit Got %#v Want %#v: %s", got.TurningPoint, want.TurningPoint, tc.message)
+		}
+		if got.Confidence != want.Confidence {
+			t.Errorf("Failed StepFit Got %#v Want %#v: %s", got.Confidence, want.Confidence, tc.message)
+		}
+	}
+}
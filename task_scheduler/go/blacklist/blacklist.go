@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"strings"
 	"sync"
+	"time"
 
 	"go.skia.org/infra/go/sklog"
 
@@ -16,6 +18,19 @@ import (
 
 const (
 	MAX_NAME_CHARS = 50
+
+	// AUDIT_LOG_SUFFIX is appended to the name of the Blacklist's backing
+	// file to obtain the name of its audit log.
+	AUDIT_LOG_SUFFIX = ".audit"
+
+	// Actions recorded in the audit log.
+	AUDIT_ACTION_ADD    = "add"
+	AUDIT_ACTION_REMOVE = "remove"
+	AUDIT_ACTION_EXPIRE = "expire"
+
+	// AUDIT_USER_EXPIRY is the user recorded in the audit log when an
+	// expired Rule is removed automatically.
+	AUDIT_USER_EXPIRY = "task-scheduler"
 )
 
 var (
@@ -27,25 +42,37 @@ var (
 // Blacklist is a struct which contains rules specifying tasks which should
 // not be scheduled.
 type Blacklist struct {
+	auditFile   string
 	backingFile string
 	Rules       map[string]*Rule `json:"rules"`
 	mtx         sync.RWMutex
 }
 
-// Match determines whether the given taskSpec/commit pair matches one of the
-// Rules in the Blacklist.
-func (b *Blacklist) Match(taskSpec, commit string) bool {
-	return b.MatchRule(taskSpec, commit) != ""
+// AuditEntry records the addition or removal of a Rule.
+type AuditEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Action    string    `json:"action"`
+	User      string    `json:"user"`
+	Reason    string    `json:"reason"`
+	Rule      *Rule     `json:"rule"`
 }
 
-// MatchRule determines whether the given taskSpec/commit pair matches one of the
-// Rules in the Blacklist. Returns the name of the matched Rule or the empty
-// string if no Rules match.
-func (b *Blacklist) MatchRule(taskSpec, commit string) string {
+// Match determines whether the given taskSpec/commit pair, running on a bot
+// with the given dimensions, matches one of the Rules in the Blacklist.
+func (b *Blacklist) Match(taskSpec, commit string, dimensions []string) bool {
+	return b.MatchRule(taskSpec, commit, dimensions) != ""
+}
+
+// MatchRule determines whether the given taskSpec/commit pair, running on a
+// bot with the given dimensions, matches one of the Rules in the Blacklist.
+// Returns the name of the matched Rule or the empty string if no Rules match.
+// Expired Rules never match.
+func (b *Blacklist) MatchRule(taskSpec, commit string, dimensions []string) string {
+	now := time.Now()
 	b.mtx.RLock()
 	defer b.mtx.RUnlock()
 	for _, rule := range b.Rules {
-		if rule.Match(taskSpec, commit) {
+		if !rule.Expired(now) && rule.Match(taskSpec, commit, dimensions) {
 			return rule.Name
 		}
 	}
@@ -55,12 +82,12 @@ func (b *Blacklist) MatchRule(taskSpec, commit string) string {
 // ensureDefaults adds the necessary default blacklist rules if necessary.
 func (b *Blacklist) ensureDefaults() error {
 	for _, rule := range DEFAULT_RULES {
-		if err := b.removeRule(rule.Name); err != nil {
+		if err := b.removeRule(rule.Name, nil); err != nil {
 			if err.Error() != ERR_NO_SUCH_RULE.Error() {
 				return err
 			}
 		}
-		if err := b.addRule(rule); err != nil {
+		if err := b.addRule(rule, nil); err != nil {
 			return err
 		}
 	}
@@ -78,16 +105,59 @@ func (b *Blacklist) writeOut() error {
 	return json.NewEncoder(f).Encode(b)
 }
 
-// Add adds a new Rule to the Blacklist.
+// writeAudit appends the given entry to the audit log. Assumes that the
+// caller holds a write lock.
+func (b *Blacklist) writeAudit(e *AuditEntry) error {
+	f, err := os.OpenFile(b.auditFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("Failed to open blacklist audit log: %s", err)
+	}
+	defer util.Close(f)
+	if err := json.NewEncoder(f).Encode(e); err != nil {
+		return fmt.Errorf("Failed to write blacklist audit log: %s", err)
+	}
+	return nil
+}
+
+// AuditLog returns every entry in the audit log, oldest first.
+func (b *Blacklist) AuditLog() ([]*AuditEntry, error) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	rv := []*AuditEntry{}
+	f, err := os.Open(b.auditFile)
+	if os.IsNotExist(err) {
+		return rv, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Failed to read blacklist audit log: %s", err)
+	}
+	defer util.Close(f)
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var e AuditEntry
+		if err := dec.Decode(&e); err != nil {
+			return nil, fmt.Errorf("Failed to decode blacklist audit log: %s", err)
+		}
+		rv = append(rv, &e)
+	}
+	return rv, nil
+}
+
+// Add adds a new Rule to the Blacklist. The Rule's AddedBy user and
+// Description are recorded in the audit log.
 func (b *Blacklist) AddRule(r *Rule, repos repograph.Map) error {
 	if err := ValidateRule(r, repos); err != nil {
 		return err
 	}
-	return b.addRule(r)
+	return b.addRule(r, &AuditEntry{
+		Action: AUDIT_ACTION_ADD,
+		User:   r.AddedBy,
+		Reason: r.Description,
+	})
 }
 
-// addRule adds a new Rule to the Blacklist.
-func (b *Blacklist) addRule(r *Rule) error {
+// addRule adds a new Rule to the Blacklist. If the given AuditEntry is not nil,
+// it is completed and appended to the audit log.
+func (b *Blacklist) addRule(r *Rule, audit *AuditEntry) error {
 	b.mtx.Lock()
 	defer b.mtx.Unlock()
 	if _, ok := b.Rules[r.Name]; ok {
@@ -98,6 +168,17 @@ func (b *Blacklist) addRule(r *Rule) error {
 		delete(b.Rules, r.Name)
 		return err
 	}
+	if audit != nil {
+		audit.Timestamp = time.Now().UTC()
+		audit.Rule = r
+		if err := b.writeAudit(audit); err != nil {
+			delete(b.Rules, r.Name)
+			if err2 := b.writeOut(); err2 != nil {
+				sklog.Errorf("Failed to roll back blacklist rule %q: %s", r.Name, err2)
+			}
+			return err
+		}
+	}
 	return nil
 }
 
@@ -153,10 +234,17 @@ func NewCommitRangeRule(ctx context.Context, name, user, description string, tas
 	return rule, nil
 }
 
-// removeRule removes the Rule from the Blacklist.
-func (b *Blacklist) removeRule(name string) error {
+// removeRule removes the Rule from the Blacklist. If the given AuditEntry is
+// not nil, it is completed and appended to the audit log.
+func (b *Blacklist) removeRule(name string, audit *AuditEntry) error {
 	b.mtx.Lock()
 	defer b.mtx.Unlock()
+	return b.removeRuleLocked(name, audit)
+}
+
+// removeRuleLocked removes the Rule from the Blacklist. Assumes that the caller
+// holds a write lock.
+func (b *Blacklist) removeRuleLocked(name string, audit *AuditEntry) error {
 	r, ok := b.Rules[name]
 	if !ok {
 		return ERR_NO_SUCH_RULE
@@ -166,17 +254,60 @@ func (b *Blacklist) removeRule(name string) error {
 		b.Rules[name] = r
 		return err
 	}
+	if audit != nil {
+		audit.Timestamp = time.Now().UTC()
+		audit.Rule = r
+		if err := b.writeAudit(audit); err != nil {
+			b.Rules[name] = r
+			if err2 := b.writeOut(); err2 != nil {
+				sklog.Errorf("Failed to roll back removal of blacklist rule %q: %s", name, err2)
+			}
+			return err
+		}
+	}
 	return nil
 }
 
-// RemoveRule removes the Rule from the Blacklist.
-func (b *Blacklist) RemoveRule(name string) error {
+// RemoveRule removes the Rule from the Blacklist, recording the given user
+// and reason in the audit log.
+func (b *Blacklist) RemoveRule(name, user, reason string) error {
 	for _, r := range DEFAULT_RULES {
 		if r.Name == name {
 			return fmt.Errorf("Cannot remove built-in rule %q", name)
 		}
 	}
-	return b.removeRule(name)
+	if user == "" {
+		return fmt.Errorf("Removal of a rule must have a user.")
+	}
+	return b.removeRule(name, &AuditEntry{
+		Action: AUDIT_ACTION_REMOVE,
+		User:   user,
+		Reason: reason,
+	})
+}
+
+// RemoveExpiredRules removes the Rules which expired before the given time,
+// recording each removal in the audit log. Rules which fail to be removed are
+// kept, and the last error is returned after attempting every Rule.
+func (b *Blacklist) RemoveExpiredRules(now time.Time) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	var rv error
+	for name, r := range b.Rules {
+		if !r.Expired(now) {
+			continue
+		}
+		sklog.Infof("Removing expired blacklist rule %q", name)
+		if err := b.removeRuleLocked(name, &AuditEntry{
+			Action: AUDIT_ACTION_EXPIRE,
+			User:   AUDIT_USER_EXPIRY,
+			Reason: fmt.Sprintf("Rule expired at %s", r.Expires.UTC().Format(time.RFC3339)),
+		}); err != nil {
+			sklog.Errorf("Failed to remove expired blacklist rule %q: %s", name, err)
+			rv = err
+		}
+	}
+	return rv
 }
 
 // Rule is a struct which indicates a specific task or set of tasks which
@@ -188,13 +319,23 @@ func (b *Blacklist) RemoveRule(name string) error {
 // Commits are simply commit hashes for which the rule applies. If the list is
 // empty, the Rule applies for all commits.
 //
-// A Rule should specify TaskSpecPatterns or Commits or both.
+// Dimensions are Swarming dimensions in "key:value" form. The Rule applies to
+// tasks which require all of them. If the list is empty, the Rule applies for
+// all tasks.
+//
+// Expires is the time after which the Rule no longer applies and is removed
+// from the Blacklist. If it is zero, the Rule never expires.
+//
+// A Rule should specify at least one of TaskSpecPatterns, Commits or
+// Dimensions.
 type Rule struct {
-	AddedBy          string   `json:"added_by"`
-	TaskSpecPatterns []string `json:"task_spec_patterns"`
-	Commits          []string `json:"commits"`
-	Description      string   `json:"description"`
-	Name             string   `json:"name"`
+	AddedBy          string    `json:"added_by"`
+	TaskSpecPatterns []string  `json:"task_spec_patterns"`
+	Commits          []string  `json:"commits"`
+	Dimensions       []string  `json:"dimensions"`
+	Description      string    `json:"description"`
+	Expires          time.Time `json:"expires"`
+	Name             string    `json:"name"`
 }
 
 // ValidateRule returns an error if the given Rule is not valid.
@@ -208,8 +349,17 @@ func ValidateRule(r *Rule, repos repograph.Map) error {
 	if r.AddedBy == "" {
 		return fmt.Errorf("Rules must have an AddedBy user.")
 	}
-	if len(r.TaskSpecPatterns) == 0 && len(r.Commits) == 0 {
-		return fmt.Errorf("Rules must include a taskSpec pattern and/or a commit/range.")
+	if len(r.TaskSpecPatterns) == 0 && len(r.Commits) == 0 && len(r.Dimensions) == 0 {
+		return fmt.Errorf("Rules must include a taskSpec pattern, a commit/range and/or a dimension.")
+	}
+	for _, d := range r.Dimensions {
+		split := strings.SplitN(d, ":", 2)
+		if len(split) != 2 || split[0] == "" || split[1] == "" {
+			return fmt.Errorf("Invalid dimension %q; dimensions must be of the form \"key:value\".", d)
+		}
+	}
+	if !util.TimeIsZero(r.Expires) && !r.Expires.After(time.Now()) {
+		return fmt.Errorf("Rule expiration must be in the future.")
 	}
 	for _, c := range r.Commits {
 		if _, _, _, err := repos.FindCommit(c); err != nil {
@@ -255,9 +405,29 @@ func (r *Rule) matchCommit(commit string) bool {
 	return false
 }
 
-// Match returns true iff the Rule matches the given taskSpec and commit.
-func (r *Rule) Match(taskSpec, commit string) bool {
-	return r.matchTaskSpec(taskSpec) && r.matchCommit(commit)
+// matchDimensions determines whether the dimensions portion of the Rule
+// matches.
+func (r *Rule) matchDimensions(dimensions []string) bool {
+	// If no dimensions are specified, then the rule applies for ALL tasks.
+	for _, d := range r.Dimensions {
+		if !util.In(d, dimensions) {
+			return false
+		}
+	}
+	return true
+}
+
+// Match returns true iff the Rule matches the given taskSpec and commit, and
+// the given dimensions include all of the Rule's Dimensions. Match does not
+// take the expiration of the Rule into account.
+func (r *Rule) Match(taskSpec, commit string, dimensions []string) bool {
+	return r.matchTaskSpec(taskSpec) && r.matchCommit(commit) && r.matchDimensions(dimensions)
+}
+
+// Expired returns true iff the Rule has an expiration which is not after the
+// given time.
+func (r *Rule) Expired(now time.Time) bool {
+	return !util.TimeIsZero(r.Expires) && !r.Expires.After(now)
 }
 
 // FromFile returns a Blacklist instance based on the given file. If the file
@@ -265,6 +435,7 @@ func (r *Rule) Match(taskSpec, commit string) bool {
 // for writing.
 func FromFile(file string) (*Blacklist, error) {
 	b := &Blacklist{
+		auditFile:   file + AUDIT_LOG_SUFFIX,
 		backingFile: file,
 		mtx:         sync.RWMutex{},
 	}
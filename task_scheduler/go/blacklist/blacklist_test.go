@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"path"
 	"testing"
+	"time"
 
 	"go.skia.org/infra/go/deepequal"
 	"go.skia.org/infra/go/git/repograph"
@@ -34,12 +35,12 @@ func TestAddRemove(t *testing.T) {
 		TaskSpecPatterns: []string{".*"},
 		Name:             "My Rule",
 	}
-	assert.NoError(t, b1.addRule(r1))
+	assert.NoError(t, b1.addRule(r1, nil))
 	b2, err := FromFile(f)
 	assert.NoError(t, err)
 	deepequal.AssertDeepEqual(t, b1, b2)
 
-	assert.NoError(t, b1.RemoveRule(r1.Name))
+	assert.NoError(t, b1.RemoveRule(r1.Name, "test@google.com", "Done"))
 	b2, err = FromFile(f)
 	assert.NoError(t, err)
 	deepequal.AssertDeepEqual(t, b1, b2)
@@ -50,6 +51,7 @@ func TestRules(t *testing.T) {
 	type testCase struct {
 		taskSpec    string
 		commit      string
+		dimensions  []string
 		expectMatch bool
 		msg         string
 	}
@@ -154,10 +156,51 @@ func TestRules(t *testing.T) {
 				},
 			},
 		},
+		{
+			rule: Rule{
+				AddedBy:          "test@google.com",
+				Name:             "Dimensions",
+				TaskSpecPatterns: []string{"^Test-"},
+				Dimensions: []string{
+					"os:Android",
+					"device_os:O",
+				},
+			},
+			cases: []testCase{
+				{
+					taskSpec:    "Test-Android",
+					commit:      "abc123",
+					dimensions:  []string{"device_os:O", "os:Android", "pool:Skia"},
+					expectMatch: true,
+					msg:         "All dimensions match",
+				},
+				{
+					taskSpec:    "Test-Android",
+					commit:      "abc123",
+					dimensions:  []string{"device_os:N", "os:Android", "pool:Skia"},
+					expectMatch: false,
+					msg:         "One dimension does not match",
+				},
+				{
+					taskSpec:    "Test-Android",
+					commit:      "abc123",
+					dimensions:  nil,
+					expectMatch: false,
+					msg:         "No dimensions",
+				},
+				{
+					taskSpec:    "Perf-Android",
+					commit:      "abc123",
+					dimensions:  []string{"device_os:O", "os:Android", "pool:Skia"},
+					expectMatch: false,
+					msg:         "TaskSpec does not match",
+				},
+			},
+		},
 	}
 	for _, test := range tests {
 		for _, c := range test.cases {
-			assert.Equal(t, c.expectMatch, test.rule.Match(c.taskSpec, c.commit), c.msg)
+			assert.Equal(t, c.expectMatch, test.rule.Match(c.taskSpec, c.commit, c.dimensions), c.msg)
 		}
 	}
 }
@@ -297,9 +340,47 @@ func TestValidation(t *testing.T) {
 				TaskSpecPatterns: []string{},
 				Commits:          []string{},
 			},
-			expect: fmt.Errorf("Rules must include a taskSpec pattern and/or a commit/range."),
+			expect: fmt.Errorf("Rules must include a taskSpec pattern, a commit/range and/or a dimension."),
 			msg:    "No taskSpecs or commits",
 		},
+		{
+			rule: Rule{
+				AddedBy:    "test@google.com",
+				Name:       "My rule",
+				Dimensions: []string{"os:Android"},
+			},
+			expect: nil,
+			msg:    "One dimension",
+		},
+		{
+			rule: Rule{
+				AddedBy:    "test@google.com",
+				Name:       "My rule",
+				Dimensions: []string{"os"},
+			},
+			expect: fmt.Errorf("Invalid dimension \"os\"; dimensions must be of the form \"key:value\"."),
+			msg:    "Invalid dimension",
+		},
+		{
+			rule: Rule{
+				AddedBy:          "test@google.com",
+				Name:             "My rule",
+				TaskSpecPatterns: []string{".*"},
+				Expires:          time.Now().Add(time.Hour),
+			},
+			expect: nil,
+			msg:    "Expires in the future",
+		},
+		{
+			rule: Rule{
+				AddedBy:          "test@google.com",
+				Name:             "My rule",
+				TaskSpecPatterns: []string{".*"},
+				Expires:          time.Now().Add(-time.Hour),
+			},
+			expect: fmt.Errorf("Rule expiration must be in the future."),
+			msg:    "Expired",
+		},
 		{
 			rule: Rule{
 				AddedBy:          "test@google.com",
@@ -432,6 +513,104 @@ func TestCommitRange(t *testing.T) {
 		},
 	}
 	for _, c := range tc {
-		assert.Equal(t, c.expect, b.Match("", c.commit))
+		assert.Equal(t, c.expect, b.Match("", c.commit, nil))
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	testutils.SmallTest(t)
+	tmp, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer testutils.RemoveAll(t, tmp)
+	f := path.Join(tmp, "blacklist.json")
+	b, err := FromFile(f)
+	assert.NoError(t, err)
+
+	now := time.Now()
+	forever := &Rule{
+		AddedBy:          "test@google.com",
+		TaskSpecPatterns: []string{"^Build-"},
+		Name:             "Forever",
 	}
+	later := &Rule{
+		AddedBy:          "test@google.com",
+		TaskSpecPatterns: []string{"^Test-"},
+		Expires:          now.Add(time.Hour),
+		Name:             "Later",
+	}
+	assert.NoError(t, b.AddRule(forever, repograph.Map{}))
+	assert.NoError(t, b.AddRule(later, repograph.Map{}))
+	assert.False(t, forever.Expired(now.Add(24*time.Hour)))
+	assert.False(t, later.Expired(now))
+	assert.True(t, later.Expired(now.Add(time.Hour)))
+	assert.Equal(t, "Later", b.MatchRule("Test-Android", "abc123", nil))
+
+	// Nothing has expired yet.
+	assert.NoError(t, b.RemoveExpiredRules(now))
+	assert.Equal(t, 2, len(b.Rules))
+
+	// Expired rules don't match, even before they are removed.
+	later.Expires = now.Add(-time.Minute)
+	assert.Equal(t, "", b.MatchRule("Test-Android", "abc123", nil))
+	assert.Equal(t, "Forever", b.MatchRule("Build-Android", "abc123", nil))
+
+	assert.NoError(t, b.RemoveExpiredRules(now))
+	assert.Equal(t, 1, len(b.Rules))
+	assert.NotNil(t, b.Rules["Forever"])
+
+	// The removal was persisted and audited.
+	b2, err := FromFile(f)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(b2.Rules))
+	log, err := b2.AuditLog()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(log))
+	assert.Equal(t, AUDIT_ACTION_EXPIRE, log[2].Action)
+	assert.Equal(t, AUDIT_USER_EXPIRY, log[2].User)
+	assert.Equal(t, "Later", log[2].Rule.Name)
+}
+
+func TestAuditLog(t *testing.T) {
+	testutils.SmallTest(t)
+	tmp, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer testutils.RemoveAll(t, tmp)
+	f := path.Join(tmp, "blacklist.json")
+	b, err := FromFile(f)
+	assert.NoError(t, err)
+
+	log, err := b.AuditLog()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(log))
+
+	r := &Rule{
+		AddedBy:     "me@google.com",
+		Dimensions:  []string{"os:Android-8"},
+		Description: "Android 8 bots are broken.",
+		Expires:     time.Now().Add(7 * 24 * time.Hour).UTC().Round(time.Second),
+		Name:        "Android 8",
+	}
+	assert.NoError(t, b.AddRule(r, repograph.Map{}))
+	assert.Error(t, b.RemoveRule(r.Name, "", "No user"))
+	assert.Equal(t, ERR_NO_SUCH_RULE, b.RemoveRule("bogus", "you@google.com", "No such rule"))
+	assert.NoError(t, b.RemoveRule(r.Name, "you@google.com", "Bots are fixed."))
+
+	// Only successful operations are logged, and the log survives
+	// reloading the Blacklist.
+	b, err = FromFile(f)
+	assert.NoError(t, err)
+	log, err = b.AuditLog()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(log))
+
+	assert.Equal(t, AUDIT_ACTION_ADD, log[0].Action)
+	assert.Equal(t, "me@google.com", log[0].User)
+	assert.Equal(t, "Android 8 bots are broken.", log[0].Reason)
+	deepequal.AssertDeepEqual(t, r, log[0].Rule)
+
+	assert.Equal(t, AUDIT_ACTION_REMOVE, log[1].Action)
+	assert.Equal(t, "you@google.com", log[1].User)
+	assert.Equal(t, "Bots are fixed.", log[1].Reason)
+	deepequal.AssertDeepEqual(t, r, log[1].Rule)
+	assert.False(t, log[1].Timestamp.Before(log[0].Timestamp))
 }
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"time"
+)
+
+const (
+	// CHANGE_TYPE_TASK indicates that a Task was inserted or updated.
+	CHANGE_TYPE_TASK ChangeType = "task"
+
+	// CHANGE_TYPE_JOB indicates that a Job was inserted or updated.
+	CHANGE_TYPE_JOB ChangeType = "job"
+
+	// CHANGE_TYPE_COMMENTS indicates that a comment was added or deleted.
+	CHANGE_TYPE_COMMENTS ChangeType = "comments"
+
+	// MAX_CHANGES_PER_REQUEST is the maximum number of Changes returned by
+	// a single call to ChangeStream.GetChanges.
+	MAX_CHANGES_PER_REQUEST = 1000
+)
+
+// ChangeType indicates which kind of data was modified by a Change.
+type ChangeType string
+
+// Change is an entry in the change stream of a DB.
+type Change struct {
+	// Seq is the position of the Change in the stream. Seq increases
+	// monotonically, with no gaps, as changes are made to the DB.
+	Seq uint64 `json:"seq"`
+
+	// Timestamp is the time at which the change was made.
+	Timestamp time.Time `json:"timestamp"`
+
+	// Type indicates which of the following fields is set.
+	Type ChangeType `json:"type"`
+
+	// Task is the new value of the Task, for CHANGE_TYPE_TASK.
+	Task *Task `json:"task,omitempty"`
+
+	// Job is the new value of the Job, for CHANGE_TYPE_JOB.
+	Job *Job `json:"job,omitempty"`
+
+	// Comments are all of the comments in the DB after the change, keyed by
+	// repo, for CHANGE_TYPE_COMMENTS.
+	Comments map[string]*RepoComments `json:"comments,omitempty"`
+}
+
+// ChangeStream provides a durable, resumable stream of the changes made to the
+// tasks, jobs and comments in a DB. Unlike GetModifiedTasks and
+// GetModifiedJobs, the position in the stream is kept by the consumer, so it
+// survives restarts of both the consumer and the DB.
+//
+// A consumer typically calls GetLatestChangeSeq, loads the data it needs, and
+// then repeatedly calls GetChanges with the Seq of the last Change it
+// processed.
+type ChangeStream interface {
+	// GetLatestChangeSeq returns the Seq of the most recent Change, or zero
+	// if no changes have been made.
+	GetLatestChangeSeq() (uint64, error)
+
+	// GetChanges returns the Changes with Seq greater than the given value,
+	// in order, up to the given limit. If limit is not positive or exceeds
+	// MAX_CHANGES_PER_REQUEST, at most MAX_CHANGES_PER_REQUEST Changes are
+	// returned. Returns ErrUnknownId if the given Seq is newer than the
+	// latest Change, or if Changes following it have been discarded; the
+	// consumer must then reload its data.
+	GetChanges(after uint64, limit int) ([]*Change, error)
+}
+
+// ChangeStreamDB is a DB which provides a ChangeStream.
+type ChangeStreamDB interface {
+	DB
+	ChangeStream
+}
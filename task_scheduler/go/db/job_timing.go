@@ -0,0 +1,244 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"go.skia.org/infra/go/util"
+)
+
+// StepTiming describes the time spent on one TaskSpec of a Job, over all
+// attempts at the TaskSpec.
+type StepTiming struct {
+	// Name is the name of the TaskSpec.
+	Name string `json:"name"`
+
+	// TaskIds are the IDs of the attempts at the TaskSpec, in order.
+	TaskIds []string `json:"task_ids"`
+
+	// Created is the time at which the first attempt was created.
+	Created time.Time `json:"created"`
+
+	// Started is the time at which the first attempt started running.
+	Started time.Time `json:"started"`
+
+	// Finished is the time at which the last attempt finished, or zero if
+	// it has not finished.
+	Finished time.Time `json:"finished"`
+
+	// PendingSecs is the total time the attempts spent waiting for a bot.
+	PendingSecs float64 `json:"pending_secs"`
+
+	// RunningSecs is the total time the attempts spent running, which is
+	// also the number of bot-seconds consumed by the TaskSpec.
+	RunningSecs float64 `json:"running_secs"`
+
+	// Critical indicates whether the TaskSpec is on the Job's critical path.
+	Critical bool `json:"critical"`
+}
+
+// JobTiming describes where the time went in a Job.
+type JobTiming struct {
+	JobId    string    `json:"job_id"`
+	JobName  string    `json:"job_name"`
+	Created  time.Time `json:"created"`
+	Finished time.Time `json:"finished"`
+
+	// DurationSecs is the time between the creation of the Job and the time
+	// it finished, or the time of the analysis if it has not finished.
+	DurationSecs float64 `json:"duration_secs"`
+
+	// BotSecs is the total number of bot-seconds consumed by the Job's
+	// tasks, including retries.
+	BotSecs float64 `json:"bot_secs"`
+
+	// CriticalPath is the chain of TaskSpecs which determined the duration
+	// of the Job, in the order in which they ran. Each TaskSpec on the path
+	// was the last of its dependencies to finish.
+	CriticalPath []string `json:"critical_path"`
+
+	// Steps describe each of the Job's TaskSpecs, sorted by name.
+	Steps []*StepTiming `json:"steps"`
+}
+
+// stepFinished returns the time at which the step finished, or now if it is
+// still in progress.
+func stepFinished(s *StepTiming, now time.Time) time.Time {
+	if util.TimeIsZero(s.Finished) {
+		return now
+	}
+	return s.Finished
+}
+
+// ComputeJobTiming analyzes the given Job using its TaskSpec DAG and the given
+// tasks, keyed by ID, which must include every task listed in the Job. Tasks
+// which have not finished are treated as though they finish at the given
+// time.
+func ComputeJobTiming(j *Job, tasks map[string]*Task, now time.Time) (*JobTiming, error) {
+	rv := &JobTiming{
+		JobId:        j.Id,
+		JobName:      j.Name,
+		Created:      j.Created,
+		Finished:     j.Finished,
+		CriticalPath: []string{},
+		Steps:        make([]*StepTiming, 0, len(j.Dependencies)),
+	}
+	end := j.Finished
+	if !j.Done() || util.TimeIsZero(end) {
+		end = now
+	}
+	rv.DurationSecs = end.Sub(j.Created).Seconds()
+
+	steps := make(map[string]*StepTiming, len(j.Dependencies))
+	for name := range j.Dependencies {
+		s := &StepTiming{
+			Name:    name,
+			TaskIds: []string{},
+		}
+		steps[name] = s
+		rv.Steps = append(rv.Steps, s)
+		summaries := j.Tasks[name]
+		for i, summary := range summaries {
+			t, ok := tasks[summary.Id]
+			if !ok {
+				return nil, fmt.Errorf("Missing task %s for %s in job %s", summary.Id, name, j.Id)
+			}
+			s.TaskIds = append(s.TaskIds, t.Id)
+			if util.TimeIsZero(s.Created) || t.Created.Before(s.Created) {
+				s.Created = t.Created
+			}
+			if util.TimeIsZero(s.Started) && !util.TimeIsZero(t.Started) {
+				s.Started = t.Started
+			}
+			started, finished := t.Started, t.Finished
+			if util.TimeIsZero(finished) {
+				finished = now
+			}
+			if util.TimeIsZero(started) {
+				// Mishaps may finish without ever running.
+				started = finished
+			}
+			s.PendingSecs += started.Sub(t.Created).Seconds()
+			s.RunningSecs += finished.Sub(started).Seconds()
+			if i == len(summaries)-1 && t.Done() {
+				s.Finished = t.Finished
+			}
+		}
+		rv.BotSecs += s.RunningSecs
+	}
+	sort.Slice(rv.Steps, func(i, k int) bool {
+		return rv.Steps[i].Name < rv.Steps[k].Name
+	})
+
+	// Walk backward from the step which finished last, following the
+	// dependency which finished last, since that is the one which allowed
+	// the step to be triggered.
+	var last *StepTiming
+	for _, s := range rv.Steps {
+		if len(s.TaskIds) == 0 {
+			continue
+		}
+		if last == nil || stepFinished(s, now).After(stepFinished(last, now)) {
+			last = s
+		}
+	}
+	path := []string{}
+	for last != nil {
+		last.Critical = true
+		path = append(path, last.Name)
+		var next *StepTiming
+		for _, dep := range j.Dependencies[last.Name] {
+			s, ok := steps[dep]
+			if !ok || len(s.TaskIds) == 0 || s.Critical {
+				continue
+			}
+			if next == nil || stepFinished(s, now).After(stepFinished(next, now)) || (stepFinished(s, now).Equal(stepFinished(next, now)) && s.Name < next.Name) {
+				next = s
+			}
+		}
+		last = next
+	}
+	for i := len(path) - 1; i >= 0; i-- {
+		rv.CriticalPath = append(rv.CriticalPath, path[i])
+	}
+	return rv, nil
+}
+
+// GetJobTiming loads the tasks for the given Job from the TaskReader and
+// returns the result of ComputeJobTiming.
+func GetJobTiming(d TaskReader, j *Job, now time.Time) (*JobTiming, error) {
+	tasks := map[string]*Task{}
+	for _, summaries := range j.Tasks {
+		for _, summary := range summaries {
+			t, err := d.GetTaskById(summary.Id)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to retrieve task %s: %s", summary.Id, err)
+			}
+			if t == nil {
+				return nil, fmt.Errorf("No such task %s in job %s", summary.Id, j.Id)
+			}
+			tasks[t.Id] = t
+		}
+	}
+	return ComputeJobTiming(j, tasks, now)
+}
+
+// CriticalPathStat summarizes how often a TaskSpec was on the critical path
+// of the Jobs which included it.
+type CriticalPathStat struct {
+	// Name is the name of the TaskSpec.
+	Name string `json:"name"`
+
+	// Jobs is the number of Jobs which included the TaskSpec.
+	Jobs int `json:"jobs"`
+
+	// Critical is the number of Jobs for which the TaskSpec was on the
+	// critical path.
+	Critical int `json:"critical"`
+
+	// CriticalSecs is the total time the TaskSpec spent pending and running
+	// while on a critical path.
+	CriticalSecs float64 `json:"critical_secs"`
+
+	// BotSecs is the total number of bot-seconds consumed by the TaskSpec.
+	BotSecs float64 `json:"bot_secs"`
+}
+
+// CriticalPathStats aggregates the given JobTimings, returning a
+// CriticalPathStat for each TaskSpec, sorted so that the TaskSpecs which are
+// most often on critical paths come first.
+func CriticalPathStats(timings []*JobTiming) []*CriticalPathStat {
+	byName := map[string]*CriticalPathStat{}
+	for _, jt := range timings {
+		for _, s := range jt.Steps {
+			stat, ok := byName[s.Name]
+			if !ok {
+				stat = &CriticalPathStat{
+					Name: s.Name,
+				}
+				byName[s.Name] = stat
+			}
+			stat.Jobs++
+			stat.BotSecs += s.RunningSecs
+			if s.Critical {
+				stat.Critical++
+				stat.CriticalSecs += s.PendingSecs + s.RunningSecs
+			}
+		}
+	}
+	rv := make([]*CriticalPathStat, 0, len(byName))
+	for _, stat := range byName {
+		rv = append(rv, stat)
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		if rv[i].Critical != rv[j].Critical {
+			return rv[i].Critical > rv[j].Critical
+		}
+		if rv[i].CriticalSecs != rv[j].CriticalSecs {
+			return rv[i].CriticalSecs > rv[j].CriticalSecs
+		}
+		return rv[i].Name < rv[j].Name
+	})
+	return rv
+}
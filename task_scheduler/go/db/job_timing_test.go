@@ -0,0 +1,154 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+
+	"go.skia.org/infra/go/testutils"
+)
+
+// makeTimingJob returns a Job with the DAG
+//
+//	Test -> Build -> Prep
+//	Perf -> Build
+//	Upload -> Test
+//
+// and Tasks with the given timings, in minutes after the Job was created.
+func makeTimingJob(now time.Time) (*Job, map[string]*Task) {
+	at := func(min int) time.Time {
+		return now.Add(time.Duration(min) * time.Minute)
+	}
+	tasks := map[string]*Task{}
+	j := &Job{
+		Created: now,
+		Dependencies: map[string][]string{
+			"Build":  {"Prep"},
+			"Perf":   {"Build"},
+			"Prep":   {},
+			"Test":   {"Build"},
+			"Upload": {"Test"},
+		},
+		Finished: at(100),
+		Id:       "job",
+		Name:     "Upload",
+		Status:   JOB_STATUS_SUCCESS,
+		Tasks:    map[string][]*TaskSummary{},
+	}
+	add := func(name string, created, started, finished int, status TaskStatus) {
+		t := &Task{
+			Created:  at(created),
+			Finished: at(finished),
+			Id:       name + "-" + at(created).Format(time.Kitchen),
+			Started:  at(started),
+			Status:   status,
+			TaskKey: TaskKey{
+				Name: name,
+			},
+		}
+		tasks[t.Id] = t
+		j.Tasks[name] = append(j.Tasks[name], t.MakeTaskSummary())
+	}
+	add("Prep", 0, 1, 5, TASK_STATUS_SUCCESS)
+	// Build is retried after a failure.
+	add("Build", 5, 10, 20, TASK_STATUS_FAILURE)
+	add("Build", 20, 25, 40, TASK_STATUS_SUCCESS)
+	add("Perf", 40, 70, 90, TASK_STATUS_SUCCESS)
+	add("Test", 40, 45, 60, TASK_STATUS_SUCCESS)
+	add("Upload", 60, 90, 100, TASK_STATUS_SUCCESS)
+	return j, tasks
+}
+
+func TestComputeJobTiming(t *testing.T) {
+	testutils.SmallTest(t)
+
+	now := time.Unix(1513000000, 0)
+	j, tasks := makeTimingJob(now)
+	jt, err := ComputeJobTiming(j, tasks, now.Add(time.Hour))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "job", jt.JobId)
+	assert.Equal(t, 6000.0, jt.DurationSecs)
+	// Perf finished before Upload, so it isn't on the critical path.
+	assert.Equal(t, []string{"Prep", "Build", "Test", "Upload"}, jt.CriticalPath)
+	// 4 + 10 + 15 + 20 + 15 + 10 minutes.
+	assert.Equal(t, 74.0*60, jt.BotSecs)
+
+	assert.Equal(t, 5, len(jt.Steps))
+	build := jt.Steps[0]
+	assert.Equal(t, "Build", build.Name)
+	assert.Equal(t, 2, len(build.TaskIds))
+	assert.Equal(t, now.Add(5*time.Minute), build.Created)
+	assert.Equal(t, now.Add(10*time.Minute), build.Started)
+	assert.Equal(t, now.Add(40*time.Minute), build.Finished)
+	assert.Equal(t, 10.0*60, build.PendingSecs)
+	assert.Equal(t, 25.0*60, build.RunningSecs)
+	assert.True(t, build.Critical)
+
+	perf := jt.Steps[1]
+	assert.Equal(t, "Perf", perf.Name)
+	assert.Equal(t, 30.0*60, perf.PendingSecs)
+	assert.Equal(t, 20.0*60, perf.RunningSecs)
+	assert.False(t, perf.Critical)
+
+	// Missing tasks are an error.
+	delete(tasks, j.Tasks["Prep"][0].Id)
+	_, err = ComputeJobTiming(j, tasks, now)
+	assert.EqualError(t, err, "Missing task "+j.Tasks["Prep"][0].Id+" for Prep in job job")
+}
+
+func TestComputeJobTimingInProgress(t *testing.T) {
+	testutils.SmallTest(t)
+
+	now := time.Unix(1513000000, 0)
+	j, tasks := makeTimingJob(now)
+	j.Status = JOB_STATUS_IN_PROGRESS
+	j.Finished = time.Time{}
+
+	// Perf is still running and Upload hasn't been triggered.
+	perf := tasks[j.Tasks["Perf"][0].Id]
+	perf.Status = TASK_STATUS_RUNNING
+	perf.Finished = time.Time{}
+	delete(tasks, j.Tasks["Upload"][0].Id)
+	delete(j.Tasks, "Upload")
+
+	jt, err := ComputeJobTiming(j, tasks, now.Add(80*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 80.0*60, jt.DurationSecs)
+	assert.Equal(t, []string{"Prep", "Build", "Perf"}, jt.CriticalPath)
+	assert.Equal(t, 10.0*60, jt.Steps[1].RunningSecs)
+	assert.True(t, jt.Steps[1].Finished.IsZero())
+	assert.Equal(t, "Upload", jt.Steps[4].Name)
+	assert.Equal(t, 0, len(jt.Steps[4].TaskIds))
+	assert.False(t, jt.Steps[4].Critical)
+}
+
+func TestCriticalPathStats(t *testing.T) {
+	testutils.SmallTest(t)
+
+	now := time.Unix(1513000000, 0)
+	j, tasks := makeTimingJob(now)
+	jt1, err := ComputeJobTiming(j, tasks, now)
+	assert.NoError(t, err)
+
+	// In the second job, Perf runs later than Upload.
+	j, tasks = makeTimingJob(now)
+	tasks[j.Tasks["Perf"][0].Id].Finished = now.Add(120 * time.Minute)
+	jt2, err := ComputeJobTiming(j, tasks, now)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Prep", "Build", "Perf"}, jt2.CriticalPath)
+
+	stats := CriticalPathStats([]*JobTiming{jt1, jt2})
+	names := []string{}
+	for _, s := range stats {
+		names = append(names, s.Name)
+		assert.Equal(t, 2, s.Jobs)
+	}
+	assert.Equal(t, []string{"Build", "Prep", "Perf", "Upload", "Test"}, names)
+	assert.Equal(t, 2, stats[0].Critical)
+	assert.Equal(t, 2*35.0*60, stats[0].CriticalSecs)
+	assert.Equal(t, 1, stats[2].Critical)
+	assert.Equal(t, 80.0*60, stats[2].CriticalSecs)
+	assert.Equal(t, 70.0*60, stats[2].BotSecs)
+}
@@ -65,6 +65,26 @@ const (
 	BUCKET_COMMENTS = "comments"
 	KEY_COMMENT_MAP = "comment-map"
 
+	// BUCKET_CHANGES is the name of the change stream bucket. Key is
+	// Change.Seq encoded as 8 bytes big endian, assigned from the bucket's
+	// sequence. Value is described in docs for BUCKET_CHANGES_VERSION.
+	// Entries are only appended, and deleted after CHANGES_RETENTION.
+	BUCKET_CHANGES = "changes"
+	// BUCKET_CHANGES_FILL_PERCENT is the value to set for
+	// bolt.Bucket.FillPercent for BUCKET_CHANGES, which is append-only.
+	BUCKET_CHANGES_FILL_PERCENT = 1.0
+	// BUCKET_CHANGES_VERSION indicates the format of the value of
+	// BUCKET_CHANGES. Retrieving Changes from the DB must support all previous
+	// versions. For all versions, the first byte is the version number.
+	//   Version 1: v[0] = 1; v[1:9] is the time of the change as UnixNano
+	//     encoded as big endian; v[9] is the change type as described in
+	//     changeTypeCodes; v[10:] is the GOB of the Task or Job, or of the
+	//     comment map as described in BUCKET_COMMENTS.
+	BUCKET_CHANGES_VERSION = 1
+
+	// CHANGES_RETENTION is how long entries are kept in BUCKET_CHANGES.
+	CHANGES_RETENTION = 14 * 24 * time.Hour
+
 	// BUCKET_BACKUP is the name of the backup bucket. Key is
 	// KEY_INCREMENTAL_BACKUP_TIME, value is time.Time.MarshalBinary. The value
 	// will be updated in place.
@@ -196,6 +216,80 @@ func unpackJob(value []byte) (time.Time, []byte, error) {
 	return unpackV1(value)
 }
 
+// changeTypeCodes maps db.ChangeType to the code stored in BUCKET_CHANGES.
+var changeTypeCodes = map[db.ChangeType]byte{
+	db.CHANGE_TYPE_TASK:     't',
+	db.CHANGE_TYPE_JOB:      'j',
+	db.CHANGE_TYPE_COMMENTS: 'c',
+}
+
+// packChange creates a value for the current value of BUCKET_CHANGES_VERSION.
+// t is the time of the change and serialized is the GOB of the changed data.
+func packChange(t time.Time, typ db.ChangeType, serialized []byte) []byte {
+	if BUCKET_CHANGES_VERSION != 1 {
+		panic(BUCKET_CHANGES_VERSION)
+	}
+	code, ok := changeTypeCodes[typ]
+	if !ok {
+		panic(typ)
+	}
+	rv := make([]byte, len(serialized)+1)
+	rv[0] = code
+	copy(rv[1:], serialized)
+	return packV1(t, rv)
+}
+
+// unpackChange decodes a value for any supported version of
+// BUCKET_CHANGES_VERSION.
+func unpackChange(seq uint64, value []byte) (*db.Change, error) {
+	if len(value) < 1 {
+		return nil, fmt.Errorf("unpackChange value is empty")
+	}
+	// Only one version currently supported.
+	if value[0] != 1 {
+		return nil, fmt.Errorf("unpackChange unrecognized version %d", value[0])
+	}
+	ts, data, err := unpackV1(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 1 {
+		return nil, fmt.Errorf("unpackChange value is missing the change type")
+	}
+	rv := &db.Change{
+		Seq:       seq,
+		Timestamp: ts,
+	}
+	dec := gob.NewDecoder(bytes.NewReader(data[1:]))
+	switch data[0] {
+	case changeTypeCodes[db.CHANGE_TYPE_TASK]:
+		rv.Type = db.CHANGE_TYPE_TASK
+		rv.Task = &db.Task{}
+		err = dec.Decode(rv.Task)
+	case changeTypeCodes[db.CHANGE_TYPE_JOB]:
+		rv.Type = db.CHANGE_TYPE_JOB
+		rv.Job = &db.Job{}
+		err = dec.Decode(rv.Job)
+	case changeTypeCodes[db.CHANGE_TYPE_COMMENTS]:
+		rv.Type = db.CHANGE_TYPE_COMMENTS
+		rv.Comments = map[string]*db.RepoComments{}
+		err = dec.Decode(&rv.Comments)
+	default:
+		return nil, fmt.Errorf("unpackChange unrecognized change type %q", data[0])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode change %d: %s", seq, err)
+	}
+	return rv, nil
+}
+
+// formatSeq returns the key in BUCKET_CHANGES for the given sequence number.
+func formatSeq(seq uint64) []byte {
+	rv := make([]byte, 8)
+	binary.BigEndian.PutUint64(rv, seq)
+	return rv
+}
+
 // localDB accesses a local BoltDB database containing tasks, jobs, and
 // comments.
 type localDB struct {
@@ -303,6 +397,24 @@ func jobsBucket(tx *bolt.Tx) *bolt.Bucket {
 	return b
 }
 
+// Returns the changes bucket with FillPercent set.
+func changesBucket(tx *bolt.Tx) *bolt.Bucket {
+	b := tx.Bucket([]byte(BUCKET_CHANGES))
+	b.FillPercent = BUCKET_CHANGES_FILL_PERCENT
+	return b
+}
+
+// appendChange adds an entry to BUCKET_CHANGES. tx must be an update
+// transaction.
+func appendChange(tx *bolt.Tx, t time.Time, typ db.ChangeType, serialized []byte) error {
+	bucket := changesBucket(tx)
+	seq, err := bucket.NextSequence()
+	if err != nil {
+		return err
+	}
+	return bucket.Put(formatSeq(seq), packChange(t, typ, serialized))
+}
+
 // NewDB returns a local DB instance.
 func NewDB(name, filename string) (db.BackupDBCloser, error) {
 	boltdb, err := bolt.Open(filename, 0600, nil)
@@ -335,6 +447,23 @@ func NewDB(name, filename string) (db.BackupDBCloser, error) {
 		}
 	}()
 
+	stopTrimChanges := make(chan bool)
+	d.notifyOnClose = append(d.notifyOnClose, stopTrimChanges)
+	go func() {
+		t := time.NewTicker(time.Hour)
+		for {
+			select {
+			case <-stopTrimChanges:
+				t.Stop()
+				return
+			case <-t.C:
+				if err := d.trimChanges(time.Now().Add(-CHANGES_RETENTION)); err != nil {
+					sklog.Errorf("Failed to trim changes: %s", err)
+				}
+			}
+		}
+	}()
+
 	comments := map[string]*db.RepoComments{}
 
 	if err := d.update("NewDB", func(tx *bolt.Tx) error {
@@ -348,6 +477,9 @@ func NewDB(name, filename string) (db.BackupDBCloser, error) {
 		if err != nil {
 			return err
 		}
+		if _, err := tx.CreateBucketIfNotExists([]byte(BUCKET_CHANGES)); err != nil {
+			return err
+		}
 		if _, err := tx.CreateBucketIfNotExists([]byte(BUCKET_BACKUP)); err != nil {
 			return err
 		}
@@ -366,7 +498,7 @@ func NewDB(name, filename string) (db.BackupDBCloser, error) {
 
 	d.CommentBox = db.NewCommentBoxWithPersistence(comments, d.writeCommentsMap)
 
-	if dbMetric, err := boltutil.NewDbMetric(boltdb, []string{BUCKET_TASKS, BUCKET_JOBS, BUCKET_COMMENTS}, map[string]string{"database": name}); err != nil {
+	if dbMetric, err := boltutil.NewDbMetric(boltdb, []string{BUCKET_TASKS, BUCKET_JOBS, BUCKET_COMMENTS, BUCKET_CHANGES}, map[string]string{"database": name}); err != nil {
 		return nil, err
 	} else {
 		d.dbMetric = dbMetric
@@ -589,6 +721,9 @@ func (d *localDB) PutTasks(tasks []*db.Task) error {
 			if err := bucket.Put([]byte(t.Id), value); err != nil {
 				return err
 			}
+			if err := appendChange(tx, now, db.CHANGE_TYPE_TASK, serialized); err != nil {
+				return err
+			}
 		}
 		return nil
 	})
@@ -763,6 +898,9 @@ func (d *localDB) PutJobs(jobs []*db.Job) error {
 			if err := bucket.Put([]byte(job.Id), value); err != nil {
 				return err
 			}
+			if err := appendChange(tx, now, db.CHANGE_TYPE_JOB, serialized); err != nil {
+				return err
+			}
 		}
 		return nil
 	})
@@ -783,10 +921,86 @@ func (d *localDB) writeCommentsMap(comments map[string]*db.RepoComments) error {
 		return err
 	}
 	return d.update("writeCommentsMap", func(tx *bolt.Tx) error {
-		return tx.Bucket([]byte(BUCKET_COMMENTS)).Put([]byte(KEY_COMMENT_MAP), buf.Bytes())
+		if err := tx.Bucket([]byte(BUCKET_COMMENTS)).Put([]byte(KEY_COMMENT_MAP), buf.Bytes()); err != nil {
+			return err
+		}
+		return appendChange(tx, time.Now().UTC(), db.CHANGE_TYPE_COMMENTS, buf.Bytes())
 	})
 }
 
+// See docs for db.ChangeStream interface.
+func (d *localDB) GetLatestChangeSeq() (uint64, error) {
+	var rv uint64
+	err := d.view("GetLatestChangeSeq", func(tx *bolt.Tx) error {
+		rv = changesBucket(tx).Sequence()
+		return nil
+	})
+	return rv, err
+}
+
+// See docs for db.ChangeStream interface.
+func (d *localDB) GetChanges(after uint64, limit int) ([]*db.Change, error) {
+	if limit <= 0 || limit > db.MAX_CHANGES_PER_REQUEST {
+		limit = db.MAX_CHANGES_PER_REQUEST
+	}
+	rv := []*db.Change{}
+	if err := d.view("GetChanges", func(tx *bolt.Tx) error {
+		bucket := changesBucket(tx)
+		if after > bucket.Sequence() {
+			return db.ErrUnknownId
+		}
+		c := bucket.Cursor()
+		k, v := c.Seek(formatSeq(after + 1))
+		if after < bucket.Sequence() && (k == nil || binary.BigEndian.Uint64(k) != after+1) {
+			// The changes following after have been trimmed.
+			return db.ErrUnknownId
+		}
+		for ; k != nil && len(rv) < limit; k, v = c.Next() {
+			change, err := unpackChange(binary.BigEndian.Uint64(k), v)
+			if err != nil {
+				return err
+			}
+			rv = append(rv, change)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+// trimChanges deletes the entries in BUCKET_CHANGES from before the given
+// time.
+func (d *localDB) trimChanges(before time.Time) error {
+	deleted := 0
+	if err := d.update("trimChanges", func(tx *bolt.Tx) error {
+		c := changesBucket(tx).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.First() {
+			if len(v) < 9 {
+				return fmt.Errorf("Invalid change %x", k)
+			}
+			ts, _, err := unpackV1(v)
+			if err != nil {
+				return err
+			}
+			if !ts.Before(before) {
+				return nil
+			}
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if deleted > 0 {
+		sklog.Infof("%s: deleted %d changes from before %s.", d.name, deleted, before)
+	}
+	return nil
+}
+
 // See docs for BackupDBCloser interface.
 func (d *localDB) WriteBackup(w io.Writer) error {
 	return d.view("WriteBackup", func(tx *bolt.Tx) error {
@@ -684,3 +684,70 @@ func TestLocalDBIncrementalBackupTime(t *testing.T) {
 	test(time.Date(2016, time.December, 31, 23, 59, 59, 999999999, time.UTC))
 	test(time.Date(2008, time.August, 8, 8, 8, 8, 8, time.UTC))
 }
+
+func TestLocalDBChangeStream(t *testing.T) {
+	testutils.MediumTest(t)
+	d, tmpdir := makeDB(t, "TestLocalDBChangeStream")
+	defer util.RemoveAll(tmpdir)
+	defer testutils.AssertCloses(t, d)
+	db.TestChangeStream(t, d.(db.ChangeStreamDB))
+}
+
+// Test that the change stream survives a restart and that trimmed changes are
+// reported.
+func TestLocalDBChangeStreamRestartAndTrim(t *testing.T) {
+	testutils.MediumTest(t)
+	tmpdir, err := ioutil.TempDir("", "TestLocalDBChangeStreamRestartAndTrim")
+	assert.NoError(t, err)
+	defer util.RemoveAll(tmpdir)
+	filename := filepath.Join(tmpdir, "task.db")
+	d, err := NewDB("TestLocalDBChangeStreamRestartAndTrim", filename)
+	assert.NoError(t, err)
+
+	now := time.Now()
+	t1 := &db.Task{Created: now}
+	assert.NoError(t, d.PutTask(t1))
+	j1 := &db.Job{Created: now}
+	assert.NoError(t, d.PutJob(j1))
+	assert.NoError(t, d.Close())
+
+	d, err = NewDB("TestLocalDBChangeStreamRestartAndTrim", filename)
+	assert.NoError(t, err)
+	defer testutils.AssertCloses(t, d)
+	cs := d.(*localDB)
+	seq, err := cs.GetLatestChangeSeq()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), seq)
+	changes, err := cs.GetChanges(0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(changes))
+	assert.Equal(t, t1.Id, changes[0].Task.Id)
+	assert.Equal(t, j1.Id, changes[1].Job.Id)
+
+	// Changes made after the restart continue the sequence.
+	t1.Status = db.TASK_STATUS_SUCCESS
+	assert.NoError(t, d.PutTask(t1))
+	changes, err = cs.GetChanges(2, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(changes))
+	assert.Equal(t, uint64(3), changes[0].Seq)
+
+	// Nothing is old enough to trim.
+	assert.NoError(t, cs.trimChanges(now.Add(-time.Hour)))
+	changes, err = cs.GetChanges(0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(changes))
+
+	// Consumers which fall behind the trimmed changes must reload.
+	assert.NoError(t, cs.trimChanges(time.Now().Add(time.Hour)))
+	_, err = cs.GetChanges(0, 0)
+	assert.True(t, db.IsUnknownId(err))
+	_, err = cs.GetChanges(2, 0)
+	assert.True(t, db.IsUnknownId(err))
+	changes, err = cs.GetChanges(3, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(changes))
+	seq, err = cs.GetLatestChangeSeq()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), seq)
+}
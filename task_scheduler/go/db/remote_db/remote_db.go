@@ -34,6 +34,8 @@ const (
 	TASK_COMMENTS_PATH      = "comments/task-comments"
 	TASK_SPEC_COMMENTS_PATH = "comments/task-spec-comments"
 	COMMIT_COMMENTS_PATH    = "comments/commit-comments"
+	CHANGES_PATH            = "changes"
+	LATEST_CHANGE_PATH      = "changes/latest"
 
 	// HTTP error codes used for defined DB errors. See reportDBError and
 	// interpretStatusCode for detail.
@@ -122,6 +124,8 @@ func (s *server) registerHandlers(r *mux.Router, emailWhitelist []string) {
 	r.HandleFunc("/"+TASK_SPEC_COMMENTS_PATH, restrict(s.DeleteTaskSpecCommentsHandler)).Methods(http.MethodDelete)
 	r.HandleFunc("/"+COMMIT_COMMENTS_PATH, restrict(s.PostCommitCommentsHandler)).Methods(http.MethodPost)
 	r.HandleFunc("/"+COMMIT_COMMENTS_PATH, restrict(s.DeleteCommitCommentsHandler)).Methods(http.MethodDelete)
+	r.HandleFunc("/"+CHANGES_PATH, restrict(s.GetChangesHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/"+LATEST_CHANGE_PATH, restrict(s.GetLatestChangeSeqHandler)).Methods(http.MethodGet)
 }
 
 // client translates db.RemoteDB method calls to HTTP requests.
@@ -131,7 +135,8 @@ type client struct {
 }
 
 // NewClient returns a db.RemoteDB that connects to the server created by
-// NewServer. serverRoot should end with a slash.
+// NewServer. serverRoot should end with a slash. The returned value also
+// implements db.ChangeStream if the server's DB does.
 func NewClient(serverRoot string, c *http.Client) (db.RemoteDB, error) {
 	return &client{
 		serverRoot: serverRoot,
@@ -951,3 +956,136 @@ func (c *client) DeleteCommitComment(cc *db.CommitComment) error {
 
 // Compile-time assert that client is a db.RemoteDB.
 var _ db.RemoteDB = &client{}
+
+// changeStream returns the server's DB as a db.ChangeStream, or writes an error
+// response and returns nil if it is not supported.
+func (s *server) changeStream(w http.ResponseWriter, r *http.Request) db.ChangeStream {
+	cs, ok := s.d.(db.ChangeStream)
+	if !ok {
+		httputils.ReportError(w, r, nil, "DB does not provide a change stream.")
+		return nil
+	}
+	return cs
+}
+
+// GetLatestChangeSeqHandler translates a GET request to GetLatestChangeSeq.
+//   - format: must be "gob"; default "gob"
+// Response is GOB of uint64 seq.
+func (s *server) GetLatestChangeSeqHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "gob" {
+		httputils.ReportError(w, r, nil, fmt.Sprintf("Unsupported format %q", format))
+		return
+	}
+	cs := s.changeStream(w, r)
+	if cs == nil {
+		return
+	}
+	seq, err := cs.GetLatestChangeSeq()
+	if err != nil {
+		reportDBError(w, r, err, "Unable to retrieve latest change")
+		return
+	}
+	w.Header().Set("Content-Type", "application/gob")
+	if err := gob.NewEncoder(w).Encode(seq); err != nil {
+		httputils.ReportError(w, r, err, "Unable to encode seq")
+		return
+	}
+}
+
+// See documentation for db.ChangeStream.
+func (c *client) GetLatestChangeSeq() (uint64, error) {
+	r, err := c.client.Get(c.serverRoot + LATEST_CHANGE_PATH + "?format=gob")
+	if err != nil {
+		return 0, err
+	}
+	defer util.Close(r.Body)
+	if err := interpretStatusCode(r); err != nil {
+		return 0, err
+	}
+	var seq uint64
+	if err := gob.NewDecoder(r.Body).Decode(&seq); err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
+
+// GetChangesHandler translates a GET request to GetChanges.
+//   - format: must be "gob"; default "gob"
+//   - after: Change.Seq after which to return changes (base-10 string)
+//   - limit (optional): maximum number of changes to return (base-10 string)
+// Response is GOB stream; first object is the number of changes, the remaining
+// objects are db.Changes.
+func (s *server) GetChangesHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "gob" {
+		httputils.ReportError(w, r, nil, fmt.Sprintf("Unsupported format %q", format))
+		return
+	}
+	afterStr := r.URL.Query().Get("after")
+	after, err := strconv.ParseUint(afterStr, 10, 64)
+	if err != nil {
+		httputils.ReportError(w, r, err, fmt.Sprintf("Invalid after param %q", afterStr))
+		return
+	}
+	limit := 0
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil {
+			httputils.ReportError(w, r, err, fmt.Sprintf("Invalid limit param %q", limitStr))
+			return
+		}
+	}
+	cs := s.changeStream(w, r)
+	if cs == nil {
+		return
+	}
+	changes, err := cs.GetChanges(after, limit)
+	if err != nil {
+		reportDBError(w, r, err, "Unable to retrieve changes")
+		return
+	}
+	w.Header().Set("Content-Type", "application/gob")
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(len(changes)); err != nil {
+		httputils.ReportError(w, r, err, "Unable to encode change count")
+		return
+	}
+	for _, change := range changes {
+		if err := enc.Encode(change); err != nil {
+			httputils.ReportError(w, r, err, "Unable to encode change")
+			return
+		}
+		flush(w)
+	}
+}
+
+// See documentation for db.ChangeStream.
+func (c *client) GetChanges(after uint64, limit int) ([]*db.Change, error) {
+	params := url.Values{}
+	params.Set("format", "gob")
+	params.Set("after", strconv.FormatUint(after, 10))
+	params.Set("limit", strconv.Itoa(limit))
+	r, err := c.client.Get(c.serverRoot + CHANGES_PATH + "?" + params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer util.Close(r.Body)
+	if err := interpretStatusCode(r); err != nil {
+		return nil, err
+	}
+	dec := gob.NewDecoder(r.Body)
+	var count int
+	if err := dec.Decode(&count); err != nil {
+		return nil, err
+	}
+	rv := make([]*db.Change, count)
+	for i := range rv {
+		var change db.Change
+		if err := dec.Decode(&change); err != nil {
+			return nil, err
+		}
+		rv[i] = &change
+	}
+	return rv, nil
+}
@@ -1,8 +1,10 @@
 package remote_db
 
 import (
+	"io/ioutil"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/gorilla/mux"
@@ -10,7 +12,9 @@ import (
 	"go.skia.org/infra/go/deepequal"
 	"go.skia.org/infra/go/httputils"
 	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/go/util"
 	"go.skia.org/infra/task_scheduler/go/db"
+	"go.skia.org/infra/task_scheduler/go/db/local_db"
 )
 
 func TestMain(m *testing.M) {
@@ -130,3 +134,58 @@ func TestRemoteDBCommentDB(t *testing.T) {
 	defer testutils.AssertCloses(t, d)
 	db.TestCommentDB(t, d)
 }
+
+// changeStreamClientWithBackdoor is a clientWithBackdoor which also implements
+// db.ChangeStream using the client.
+type changeStreamClientWithBackdoor struct {
+	*clientWithBackdoor
+	db.ChangeStream
+	tmpdir string
+}
+
+func (b *changeStreamClientWithBackdoor) Close() error {
+	b.httpserver.Close()
+	defer util.RemoveAll(b.tmpdir)
+	return b.backdoor.(db.DBCloser).Close()
+}
+
+// makeChangeStreamDB sets up a client/server pair backed by a local DB, which
+// provides a change stream.
+func makeChangeStreamDB(t *testing.T) *changeStreamClientWithBackdoor {
+	tmpdir, err := ioutil.TempDir("", "remote_db_changes")
+	assert.NoError(t, err)
+	baseDB, err := local_db.NewDB("remote_db_changes", filepath.Join(tmpdir, "task.db"))
+	assert.NoError(t, err)
+	r := mux.NewRouter()
+	assert.NoError(t, RegisterServer(baseDB, r.PathPrefix("/db").Subrouter(), nil))
+	ts := httptest.NewServer(r)
+	dbclient, err := NewClient(ts.URL+"/db/", httputils.NewTimeoutClient())
+	assert.NoError(t, err)
+	return &changeStreamClientWithBackdoor{
+		clientWithBackdoor: &clientWithBackdoor{
+			RemoteDB:   dbclient,
+			backdoor:   baseDB,
+			httpserver: ts,
+		},
+		ChangeStream: dbclient.(db.ChangeStream),
+		tmpdir:       tmpdir,
+	}
+}
+
+func TestRemoteDBChangeStream(t *testing.T) {
+	testutils.MediumTest(t)
+	d := makeChangeStreamDB(t)
+	defer testutils.AssertCloses(t, d)
+	db.TestChangeStream(t, d)
+}
+
+func TestRemoteDBChangeStreamNotSupported(t *testing.T) {
+	testutils.SmallTest(t)
+	d := makeDB(t)
+	defer testutils.AssertCloses(t, d)
+	cs := d.(*clientWithBackdoor).RemoteDB.(db.ChangeStream)
+	_, err := cs.GetLatestChangeSeq()
+	assert.Error(t, err)
+	_, err = cs.GetChanges(0, 0)
+	assert.Error(t, err)
+}
@@ -107,6 +107,10 @@ type Task struct {
 	// Attempt is the attempt number of this task, starting with zero.
 	Attempt int `json:"attempt"`
 
+	// AutoRetry indicates that the retry policy may adjust MaxAttempts
+	// based on the flake history of the TaskSpec. Copied from the TaskSpec.
+	AutoRetry bool `json:"auto_retry"`
+
 	// Commits are the commits which were tested in this Task. The list may
 	// change due to backfilling/bisecting.
 	Commits []string `json:"commits"`
@@ -123,6 +127,12 @@ type Task struct {
 	// zero if the task is pending or running.
 	Finished time.Time `json:"finished"`
 
+	// Flaky indicates that a failed Task is likely to have failed due to
+	// flakiness, either because a later attempt at the same TaskKey
+	// succeeded, or because the TaskSpec's recent history suggests so and
+	// the Task is being retried.
+	Flaky bool `json:"flaky"`
+
 	// Id is a generated unique identifier for this Task instance. Must be
 	// URL-safe.
 	Id string `json:"id"`
@@ -384,10 +394,12 @@ func (t *Task) Success() bool {
 func (t *Task) Copy() *Task {
 	return &Task{
 		Attempt:        t.Attempt,
+		AutoRetry:      t.AutoRetry,
 		Commits:        util.CopyStringSlice(t.Commits),
 		Created:        t.Created,
 		DbModified:     t.DbModified,
 		Finished:       t.Finished,
+		Flaky:          t.Flaky,
 		Id:             t.Id,
 		IsolatedOutput: t.IsolatedOutput,
 		Jobs:           util.CopyStringSlice(t.Jobs),
@@ -431,6 +443,7 @@ func (task *Task) Valid() bool {
 // TaskSummary is a subset of the information found in a Task.
 type TaskSummary struct {
 	Attempt        int        `json:"attempt"`
+	Flaky          bool       `json:"flaky"`
 	Id             string     `json:"id"`
 	MaxAttempts    int        `json:"max_attempts"`
 	Status         TaskStatus `json:"status"`
@@ -441,6 +454,7 @@ type TaskSummary struct {
 func (t *Task) MakeTaskSummary() *TaskSummary {
 	return &TaskSummary{
 		Attempt:        t.Attempt,
+		Flaky:          t.Flaky,
 		Id:             t.Id,
 		MaxAttempts:    t.MaxAttempts,
 		Status:         t.Status,
@@ -452,6 +466,7 @@ func (t *Task) MakeTaskSummary() *TaskSummary {
 func (t *TaskSummary) Copy() *TaskSummary {
 	return &TaskSummary{
 		Attempt:        t.Attempt,
+		Flaky:          t.Flaky,
 		Id:             t.Id,
 		MaxAttempts:    t.MaxAttempts,
 		Status:         t.Status,
@@ -654,10 +654,12 @@ func TestCopyTask(t *testing.T) {
 	now := time.Now()
 	v := &Task{
 		Attempt:        3,
+		AutoRetry:      true,
 		Commits:        []string{"a", "b"},
 		Created:        now.Add(time.Nanosecond),
 		DbModified:     now.Add(time.Millisecond),
 		Finished:       now.Add(time.Second),
+		Flaky:          true,
 		Id:             "42",
 		IsolatedOutput: "lonely-result",
 		Jobs:           []string{"123abc", "456def"},
@@ -858,6 +860,7 @@ func TestCopyTaskSummary(t *testing.T) {
 	testutils.SmallTest(t)
 	v := &TaskSummary{
 		Attempt:        1,
+		Flaky:          true,
 		Id:             "123",
 		MaxAttempts:    2,
 		Status:         TASK_STATUS_FAILURE,
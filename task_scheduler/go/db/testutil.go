@@ -1411,6 +1411,96 @@ func TestCommentDB(t assert.TestingT, db CommentDB) {
 	}
 }
 
+// TestChangeStream validates that db correctly implements the ChangeStream
+// interface.
+func TestChangeStream(t assert.TestingT, db ChangeStreamDB) {
+	start, err := db.GetLatestChangeSeq()
+	assert.NoError(t, err)
+
+	// No changes yet.
+	changes, err := db.GetChanges(start, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(changes))
+
+	// A Seq from the future is an error.
+	_, err = db.GetChanges(start+1, 0)
+	assert.True(t, IsUnknownId(err))
+
+	// Make some changes.
+	now := time.Now()
+	t1 := makeTask(now, []string{"a", "b"})
+	assert.NoError(t, db.PutTask(t1))
+	j1 := makeJob(now)
+	assert.NoError(t, db.PutJob(j1))
+	t1.Status = TASK_STATUS_RUNNING
+	assert.NoError(t, db.PutTask(t1))
+	tc := makeTaskComment(1, 1, 1, 1, now)
+	assert.NoError(t, db.PutTaskComment(tc))
+
+	latest, err := db.GetLatestChangeSeq()
+	assert.NoError(t, err)
+	assert.Equal(t, start+4, latest)
+
+	checkChanges := func(changes []*Change, after uint64) {
+		for i, c := range changes {
+			assert.Equal(t, after+uint64(i)+1, c.Seq)
+			assert.False(t, util.TimeIsZero(c.Timestamp))
+		}
+	}
+	changes, err = db.GetChanges(start, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(changes))
+	checkChanges(changes, start)
+
+	assert.Equal(t, CHANGE_TYPE_TASK, changes[0].Type)
+	assert.Equal(t, t1.Id, changes[0].Task.Id)
+	assert.Equal(t, TASK_STATUS_PENDING, changes[0].Task.Status)
+	assert.Nil(t, changes[0].Job)
+
+	assert.Equal(t, CHANGE_TYPE_JOB, changes[1].Type)
+	AssertDeepEqual(t, j1, changes[1].Job)
+	assert.Nil(t, changes[1].Task)
+
+	assert.Equal(t, CHANGE_TYPE_TASK, changes[2].Type)
+	AssertDeepEqual(t, t1, changes[2].Task)
+
+	assert.Equal(t, CHANGE_TYPE_COMMENTS, changes[3].Type)
+	rc, ok := changes[3].Comments[tc.Repo]
+	assert.True(t, ok)
+	AssertDeepEqual(t, []*TaskComment{tc}, rc.TaskComments[tc.Revision][tc.Name])
+
+	// Resume in the middle of the stream, with a limit.
+	changes, err = db.GetChanges(start+1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(changes))
+	checkChanges(changes, start+1)
+	assert.Equal(t, CHANGE_TYPE_JOB, changes[0].Type)
+	assert.Equal(t, CHANGE_TYPE_TASK, changes[1].Type)
+
+	changes, err = db.GetChanges(start+3, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(changes))
+	checkChanges(changes, start+3)
+
+	// Caught up.
+	changes, err = db.GetChanges(latest, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(changes))
+	_, err = db.GetChanges(latest+1, 0)
+	assert.True(t, IsUnknownId(err))
+
+	// Failed updates don't appear in the stream.
+	stale := t1.Copy()
+	t1.Status = TASK_STATUS_SUCCESS
+	assert.NoError(t, db.PutTask(t1))
+	assert.True(t, IsConcurrentUpdate(db.PutTask(stale)))
+	changes, err = db.GetChanges(latest, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(changes))
+	checkChanges(changes, latest)
+	AssertDeepEqual(t, t1, changes[0].Task)
+}
+
 func DummyGetRevisionTimestamp(ts time.Time) GetRevisionTimestamp {
 	return func(string, string) (time.Time, error) { return ts, nil }
 }
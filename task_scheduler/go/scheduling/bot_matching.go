@@ -0,0 +1,160 @@
+package scheduling
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	swarming_api "go.chromium.org/luci/common/api/swarming/swarming/v1"
+	"go.skia.org/infra/go/util"
+)
+
+// botMatcher assigns free bots to task candidates so that as many of the
+// highest-scoring candidates as possible can run.
+//
+// Candidates are added one at a time in decreasing order of score. A
+// candidate is accepted if it can be given a bot while every previously
+// accepted candidate keeps a bot, moving earlier candidates to other bots if
+// necessary, i.e. by finding an augmenting path in the bipartite graph of
+// candidates and bots. Adding candidates greedily by score this way gives a
+// matching with the maximum total score, so a generic task can't "steal" a
+// specialized bot which a later candidate needs, as long as the generic task
+// can run on some other free bot.
+//
+// When there is a choice, the least-specialized bot is used, i.e. the bot
+// with the fewest dimensions, which reduces the number of times an earlier
+// candidate has to be moved.
+type botMatcher struct {
+	// botsByDim maps "key:value" dimensions to the bots which have them.
+	botsByDim map[string]util.StringSet
+
+	// specialization is the number of dimensions of each bot.
+	specialization map[string]int
+
+	// numBots is the total number of bots.
+	numBots int
+
+	// candidates are the accepted candidates, in the order they were added,
+	// followed by the candidate currently being added, if any.
+	candidates []*taskCandidate
+
+	// eligible holds the bots which can run each entry in candidates,
+	// least-specialized first.
+	eligible [][]string
+
+	// botOf holds the index in candidates of the candidate assigned to each
+	// bot.
+	botOf map[string]int
+
+	// unmatchable holds the dimension sets of candidates which could not be
+	// added. Since accepted candidates are never removed, another candidate
+	// with the same dimensions can't be added either.
+	unmatchable map[string]bool
+}
+
+// newBotMatcher returns a botMatcher for the given free bots.
+func newBotMatcher(bots []*swarming_api.SwarmingRpcsBotInfo) *botMatcher {
+	m := &botMatcher{
+		botsByDim:      map[string]util.StringSet{},
+		specialization: map[string]int{},
+		numBots:        len(bots),
+		candidates:     []*taskCandidate{},
+		eligible:       [][]string{},
+		botOf:          map[string]int{},
+		unmatchable:    map[string]bool{},
+	}
+	for _, b := range bots {
+		for _, dim := range b.Dimensions {
+			for _, val := range dim.Value {
+				d := fmt.Sprintf("%s:%s", dim.Key, val)
+				if _, ok := m.botsByDim[d]; !ok {
+					m.botsByDim[d] = util.StringSet{}
+				}
+				m.botsByDim[d][b.BotId] = true
+				m.specialization[b.BotId]++
+			}
+		}
+	}
+	return m
+}
+
+// eligibleBots returns the bots which have all of the given dimensions,
+// least-specialized first, then sorted by ID so that the choice is
+// deterministic.
+func (m *botMatcher) eligibleBots(dims []string) []string {
+	matches := util.StringSet{}
+	for i, d := range dims {
+		if i == 0 {
+			matches = matches.Union(m.botsByDim[d])
+		} else {
+			matches = matches.Intersect(m.botsByDim[d])
+		}
+	}
+	rv := make([]string, 0, len(matches))
+	for botId := range matches {
+		rv = append(rv, botId)
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		if m.specialization[rv[i]] != m.specialization[rv[j]] {
+			return m.specialization[rv[i]] < m.specialization[rv[j]]
+		}
+		return rv[i] < rv[j]
+	})
+	return rv
+}
+
+// full returns true if every bot has been assigned a candidate.
+func (m *botMatcher) full() bool {
+	return len(m.botOf) >= m.numBots
+}
+
+// add tries to assign a bot to the candidate, moving previously accepted
+// candidates to other bots if needed. Returns true if the candidate was
+// accepted.
+func (m *botMatcher) add(c *taskCandidate) bool {
+	dims := util.CopyStringSlice(c.TaskSpec.Dimensions)
+	sort.Strings(dims)
+	dimsKey := strings.Join(dims, "\n")
+	if m.unmatchable[dimsKey] {
+		return false
+	}
+	eligible := m.eligibleBots(c.TaskSpec.Dimensions)
+	if len(eligible) == 0 {
+		m.unmatchable[dimsKey] = true
+		return false
+	}
+	m.candidates = append(m.candidates, c)
+	m.eligible = append(m.eligible, eligible)
+	if m.augment(len(m.candidates)-1, map[string]bool{}) {
+		return true
+	}
+	m.candidates = m.candidates[:len(m.candidates)-1]
+	m.eligible = m.eligible[:len(m.eligible)-1]
+	m.unmatchable[dimsKey] = true
+	return false
+}
+
+// augment tries to find a bot for the candidate at index idx, first from the
+// free bots and then by recursively moving the candidates assigned to its
+// eligible bots. visited holds the bots already considered during this
+// search.
+func (m *botMatcher) augment(idx int, visited map[string]bool) bool {
+	for _, bot := range m.eligible[idx] {
+		if _, taken := m.botOf[bot]; !taken {
+			visited[bot] = true
+			m.botOf[bot] = idx
+			return true
+		}
+	}
+	for _, bot := range m.eligible[idx] {
+		if visited[bot] {
+			continue
+		}
+		visited[bot] = true
+		if m.augment(m.botOf[bot], visited) {
+			m.botOf[bot] = idx
+			return true
+		}
+	}
+	return false
+}
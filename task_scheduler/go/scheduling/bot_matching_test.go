@@ -0,0 +1,173 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+	swarming_api "go.chromium.org/luci/common/api/swarming/swarming/v1"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/go/util"
+)
+
+// assertValidMatching asserts that each candidate accepted by the botMatcher
+// has a bot of its own which can run it.
+func assertValidMatching(t *testing.T, m *botMatcher) {
+	assert.Equal(t, len(m.candidates), len(m.botOf))
+	seen := map[int]bool{}
+	for bot, idx := range m.botOf {
+		assert.False(t, seen[idx])
+		seen[idx] = true
+		assert.True(t, util.In(bot, m.eligibleBots(m.candidates[idx].TaskSpec.Dimensions)))
+	}
+}
+
+func TestBotMatcher(t *testing.T) {
+	testutils.SmallTest(t)
+
+	gpu := []string{"pool:Skia", "os:Linux", "gpu:nvidia"}
+	device := []string{"pool:Skia", "os:Android", "device_type:sailfish"}
+	generic := []string{"pool:Skia"}
+	bots := []*swarming_api.SwarmingRpcsBotInfo{
+		makeSwarmingBot("a-gpu", gpu),
+		makeSwarmingBot("b-device", device),
+		makeSwarmingBot("c-linux", []string{"pool:Skia", "os:Linux"}),
+	}
+	m := newBotMatcher(bots)
+	assert.Equal(t, []string{"c-linux", "a-gpu", "b-device"}, m.eligibleBots(generic))
+	assert.Equal(t, []string{"a-gpu"}, m.eligibleBots(gpu))
+	assert.Equal(t, []string{}, m.eligibleBots([]string{"os:Mac"}))
+
+	// Each task takes the least-specialized free bot which can run it.
+	assert.True(t, m.add(makeTaskCandidate("generic", generic)))
+	assert.Equal(t, map[string]int{"c-linux": 0}, m.botOf)
+	assert.True(t, m.add(makeTaskCandidate("linux", []string{"os:Linux"})))
+	assert.Equal(t, map[string]int{"c-linux": 0, "a-gpu": 1}, m.botOf)
+	assert.False(t, m.full())
+
+	// The only bot which can run the GPU task is taken, so the linux task
+	// moves to c-linux, which means the generic task moves to b-device.
+	assert.True(t, m.add(makeTaskCandidate("gpu", gpu)))
+	assert.Equal(t, map[string]int{"b-device": 0, "c-linux": 1, "a-gpu": 2}, m.botOf)
+	assertValidMatching(t, m)
+	assert.True(t, m.full())
+
+	// There's no room for another task without dropping an earlier one.
+	assert.False(t, m.add(makeTaskCandidate("device", device)))
+	assert.False(t, m.add(makeTaskCandidate("gpu2", gpu)))
+	assert.Equal(t, 3, len(m.candidates))
+	assertValidMatching(t, m)
+}
+
+// greedyCandidatesToSchedule is the scheduling algorithm which was used
+// before botMatcher: each candidate takes the alphabetically first free bot
+// which can run it. It is used as a baseline in
+// TestGetCandidatesToScheduleSimulation.
+func greedyCandidatesToSchedule(bots []*swarming_api.SwarmingRpcsBotInfo, tasks []*taskCandidate) []*taskCandidate {
+	botsByDim := map[string]util.StringSet{}
+	for _, b := range bots {
+		for _, dim := range b.Dimensions {
+			for _, val := range dim.Value {
+				d := fmt.Sprintf("%s:%s", dim.Key, val)
+				if _, ok := botsByDim[d]; !ok {
+					botsByDim[d] = util.StringSet{}
+				}
+				botsByDim[d][b.BotId] = true
+			}
+		}
+	}
+	rv := []*taskCandidate{}
+	for _, c := range tasks {
+		if c.Score <= 0.0 {
+			continue
+		}
+		matches := util.StringSet{}
+		for i, d := range c.TaskSpec.Dimensions {
+			if i == 0 {
+				matches = matches.Union(botsByDim[d])
+			} else {
+				matches = matches.Intersect(botsByDim[d])
+			}
+		}
+		if len(matches) > 0 {
+			choices := matches.Keys()
+			sort.Strings(choices)
+			for _, subset := range botsByDim {
+				delete(subset, choices[0])
+			}
+			rv = append(rv, c)
+		}
+	}
+	return rv
+}
+
+// schedulingSnapshot is the state of the free bots and the queue at the
+// beginning of one scheduling tick.
+type schedulingSnapshot struct {
+	Bots  []*swarming_api.SwarmingRpcsBotInfo `json:"bots"`
+	Queue []*taskCandidate                    `json:"queue"`
+}
+
+// TestGetCandidatesToScheduleSimulation replays snapshots of free bots and
+// queues and compares the candidates scheduled by getCandidatesToSchedule to
+// those scheduled by the previous greedy algorithm.
+func TestGetCandidatesToScheduleSimulation(t *testing.T) {
+	testutils.SmallTest(t)
+
+	f, err := os.Open(filepath.Join("testdata", "scheduling_snapshots.json"))
+	assert.NoError(t, err)
+	defer testutils.AssertCloses(t, f)
+	snapshots := []*schedulingSnapshot{}
+	assert.NoError(t, json.NewDecoder(f).Decode(&snapshots))
+	assert.NotEqual(t, 0, len(snapshots))
+
+	// highScore returns the number of candidates in the upper half of the
+	// queue by score.
+	highScore := func(queue, scheduled []*taskCandidate) int {
+		threshold := queue[len(queue)/2].Score
+		n := 0
+		for _, c := range scheduled {
+			if c.Score > threshold {
+				n++
+			}
+		}
+		return n
+	}
+	totalScore := func(scheduled []*taskCandidate) float64 {
+		rv := 0.0
+		for _, c := range scheduled {
+			rv += c.Score
+		}
+		return rv
+	}
+
+	totalGreedy := 0
+	totalMatched := 0
+	for tick, s := range snapshots {
+		greedy := greedyCandidatesToSchedule(s.Bots, s.Queue)
+		matched := getCandidatesToSchedule(s.Bots, s.Queue)
+		assert.True(t, len(matched) <= len(s.Bots))
+
+		// The matching is valid, and never worse than the greedy algorithm.
+		m := newBotMatcher(s.Bots)
+		for _, c := range matched {
+			assert.True(t, m.add(c))
+		}
+		assertValidMatching(t, m)
+		assert.True(t, len(matched) >= len(greedy))
+		assert.True(t, totalScore(matched) >= totalScore(greedy))
+
+		g := highScore(s.Queue, greedy)
+		h := highScore(s.Queue, matched)
+		assert.True(t, h >= g)
+		t.Logf("Tick %d: %d bots, %d candidates; scheduled %d (%d high-score) vs %d (%d high-score) greedily.", tick, len(s.Bots), len(s.Queue), len(matched), h, len(greedy), g)
+		totalGreedy += g
+		totalMatched += h
+	}
+	t.Logf("Scheduled %d more high-score tasks over %d ticks (%.1f per tick).", totalMatched-totalGreedy, len(snapshots), float64(totalMatched-totalGreedy)/float64(len(snapshots)))
+	assert.True(t, totalMatched > totalGreedy)
+}
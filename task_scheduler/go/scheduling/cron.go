@@ -0,0 +1,176 @@
+package scheduling
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"go.skia.org/infra/go/git/repograph"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+
+	"go.skia.org/infra/task_scheduler/go/db"
+)
+
+const (
+	// CRON_TRIGGERS_JSON_FILE is the name of the JSON file in the workdir
+	// which holds the last time each cron job was triggered.
+	CRON_TRIGGERS_JSON_FILE = "cron-triggers.json"
+)
+
+// cronTriggers tracks the last time each job with a cron trigger ran.
+type cronTriggers struct {
+	jsonFile string
+	mtx      sync.Mutex
+
+	// LastTriggered maps cronKey(repo, job name) to the last time the job
+	// was triggered.
+	LastTriggered map[string]time.Time `json:"last_triggered"`
+}
+
+// newCronTriggers returns a cronTriggers instance, pre-filled with data from
+// a file in the given workdir.
+func newCronTriggers(workdir string) (*cronTriggers, error) {
+	rv := &cronTriggers{
+		jsonFile: path.Join(workdir, CRON_TRIGGERS_JSON_FILE),
+	}
+	f, err := os.Open(rv.jsonFile)
+	if err == nil {
+		defer util.Close(f)
+		if err := json.NewDecoder(f).Decode(rv); err != nil {
+			return nil, fmt.Errorf("Failed to decode %s: %s", rv.jsonFile, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("Failed to read %s: %s", rv.jsonFile, err)
+	}
+	if rv.LastTriggered == nil {
+		rv.LastTriggered = map[string]time.Time{}
+	}
+	return rv, nil
+}
+
+// cronKey returns the key for the given job in cronTriggers.LastTriggered.
+func cronKey(repo, name string) string {
+	return fmt.Sprintf("%s#%s", repo, name)
+}
+
+// write writes the last-triggered times to the JSON file.
+func (c *cronTriggers) write() error {
+	return util.WithWriteFile(c.jsonFile, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(c)
+	})
+}
+
+// triggerCronJobs triggers the jobs at HEAD of master in each repo whose cron
+// schedules have fired since they were last triggered. Failures are logged
+// per repo so that they don't prevent jobs in other repos from triggering.
+//
+// A job which hasn't been seen before is not triggered, but its schedule
+// starts from now. If the scheduler was down when a job should have fired,
+// the job is triggered once when the scheduler comes back, no matter how many
+// times it was missed.
+func (s *TaskScheduler) triggerCronJobs(ctx context.Context, now time.Time) error {
+	s.cronTriggers.mtx.Lock()
+	defer s.cronTriggers.mtx.Unlock()
+
+	changed := false
+	seen := map[string]bool{}
+	for url, repo := range s.repos {
+		repoChanged, err := s.triggerCronJobsForRepo(ctx, url, repo, now, seen)
+		if repoChanged {
+			changed = true
+		}
+		if err != nil {
+			sklog.Errorf("Failed to trigger cron jobs in %s: %s", url, err)
+			// Keep the last-triggered times of the repo's jobs, since
+			// we don't know whether they still exist.
+			prefix := cronKey(url, "")
+			for key := range s.cronTriggers.LastTriggered {
+				if strings.HasPrefix(key, prefix) {
+					seen[key] = true
+				}
+			}
+		}
+	}
+
+	// Forget about jobs which no longer exist or aren't cron jobs anymore,
+	// so that they start afresh if they come back.
+	for key := range s.cronTriggers.LastTriggered {
+		if !seen[key] {
+			delete(s.cronTriggers.LastTriggered, key)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return s.cronTriggers.write()
+}
+
+// triggerCronJobsForRepo triggers the cron jobs at HEAD of master in the given
+// repo, adding the keys of its cron jobs to seen. Returns true if the
+// last-triggered times were changed. Must be called with s.cronTriggers.mtx
+// held.
+func (s *TaskScheduler) triggerCronJobsForRepo(ctx context.Context, url string, repo *repograph.Graph, now time.Time, seen map[string]bool) (bool, error) {
+	head := repo.Get("master")
+	if head == nil {
+		return false, nil
+	}
+	rs := db.RepoState{
+		Repo:     url,
+		Revision: head.Hash,
+	}
+	cfg, err := s.taskCfgCache.ReadTasksCfg(ctx, rs)
+	if err != nil {
+		return false, err
+	}
+	changed := false
+	jobs := []*db.Job{}
+	triggered := []string{}
+	for name, spec := range cfg.Jobs {
+		sched, err := spec.CronSchedule()
+		if err != nil {
+			// This shouldn't happen, since the TasksCfg has been
+			// validated.
+			sklog.Errorf("Invalid cron trigger for %s in %s: %s", name, url, err)
+			continue
+		} else if sched == nil {
+			continue
+		}
+		key := cronKey(url, name)
+		seen[key] = true
+		last, ok := s.cronTriggers.LastTriggered[key]
+		if !ok {
+			s.cronTriggers.LastTriggered[key] = now
+			changed = true
+			continue
+		}
+		next := sched.Next(last)
+		if next.IsZero() || next.After(now) {
+			continue
+		}
+		sklog.Infof("Triggering cron job %s (%s) in %s", name, spec.Trigger, url)
+		j, err := s.taskCfgCache.MakeJob(ctx, rs, name)
+		if err != nil {
+			return changed, err
+		}
+		jobs = append(jobs, j)
+		triggered = append(triggered, key)
+	}
+	if len(jobs) == 0 {
+		return changed, nil
+	}
+	if err := s.db.PutJobs(jobs); err != nil {
+		return changed, err
+	}
+	for _, key := range triggered {
+		s.cronTriggers.LastTriggered[key] = now
+	}
+	return true, nil
+}
@@ -0,0 +1,390 @@
+package scheduling
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/swarming"
+	"go.skia.org/infra/go/util"
+
+	"go.skia.org/infra/task_scheduler/go/db"
+	"go.skia.org/infra/task_scheduler/go/specs"
+)
+
+const (
+	// DEFAULT_FAIR_SHARE_WINDOW is the sliding window over which bot time
+	// is counted if the FairShareConfig doesn't specify one.
+	DEFAULT_FAIR_SHARE_WINDOW = 4 * time.Hour
+)
+
+// FairShareGroup describes a set of tasks which may use at most a given share
+// of the bot time in a pool before its task candidates are penalized.
+//
+// A task belongs to the group if it matches all of Repo, JobPrefix and Pool.
+// Empty fields match every task.
+type FairShareGroup struct {
+	// Name identifies the group on the status page.
+	Name string `json:"name"`
+
+	// Repo is the URL of the repo the tasks run in.
+	Repo string `json:"repo,omitempty"`
+
+	// JobPrefix matches tasks which are part of a Job whose name starts
+	// with the prefix.
+	JobPrefix string `json:"job_prefix,omitempty"`
+
+	// Pool is the Swarming pool the tasks run in. The group's share is a
+	// fraction of the bot time used in this pool, or in all pools if
+	// empty.
+	Pool string `json:"pool,omitempty"`
+
+	// Share is the fraction of bot time, in (0, 1], which the group may
+	// use without penalty.
+	Share float64 `json:"share"`
+}
+
+// matches returns true if a task with the given properties belongs to the
+// group.
+func (g *FairShareGroup) matches(repo, pool string, jobNames []string) bool {
+	if g.Repo != "" && g.Repo != repo {
+		return false
+	}
+	if g.Pool != "" && g.Pool != pool {
+		return false
+	}
+	if g.JobPrefix != "" {
+		for _, name := range jobNames {
+			if strings.HasPrefix(name, g.JobPrefix) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// FairShareConfig describes the fair-share quotas used by the TaskScheduler.
+type FairShareConfig struct {
+	// Window is the duration, eg. "4h", over which bot time is counted.
+	// Defaults to DEFAULT_FAIR_SHARE_WINDOW.
+	Window string `json:"window,omitempty"`
+
+	Groups []*FairShareGroup `json:"groups"`
+
+	window time.Duration
+}
+
+// FairShareConfigFromFile reads the FairShareConfig from the given file.
+func FairShareConfigFromFile(file string) (*FairShareConfig, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read fair-share config: %s", err)
+	}
+	defer util.Close(f)
+	var cfg FairShareConfig
+	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("Failed to decode fair-share config: %s", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate returns an error if the FairShareConfig is not valid.
+func (c *FairShareConfig) Validate() error {
+	c.window = DEFAULT_FAIR_SHARE_WINDOW
+	if c.Window != "" {
+		w, err := time.ParseDuration(c.Window)
+		if err != nil {
+			return fmt.Errorf("Invalid fair-share window %q: %s", c.Window, err)
+		}
+		if w <= 0 {
+			return fmt.Errorf("Fair-share window must be positive, not %q", c.Window)
+		}
+		c.window = w
+	}
+	names := map[string]bool{}
+	for _, g := range c.Groups {
+		if g.Name == "" {
+			return fmt.Errorf("Fair-share groups must have a name.")
+		}
+		if names[g.Name] {
+			return fmt.Errorf("Duplicate fair-share group %q", g.Name)
+		}
+		names[g.Name] = true
+		if g.Repo == "" && g.JobPrefix == "" && g.Pool == "" {
+			return fmt.Errorf("Fair-share group %q must specify at least one of repo, job_prefix or pool.", g.Name)
+		}
+		if g.Share <= 0.0 || g.Share > 1.0 {
+			return fmt.Errorf("Fair-share group %q has share %f; must be in (0, 1].", g.Name, g.Share)
+		}
+	}
+	return nil
+}
+
+// fairShareUsage is the bot time used by a single task.
+type fairShareUsage struct {
+	repo     string
+	pool     string
+	jobNames []string
+	botTime  time.Duration
+}
+
+// FairShareStatus describes the recent consumption of a FairShareGroup.
+type FairShareStatus struct {
+	Name string `json:"name"`
+	Pool string `json:"pool"`
+
+	// Share is the configured share of the group.
+	Share float64 `json:"share"`
+
+	// Usage is the fraction of the bot time in the group's pool which was
+	// used by the group during the window.
+	Usage float64 `json:"usage"`
+
+	// BotSeconds is the bot time used by the group during the window.
+	BotSeconds float64 `json:"bot_seconds"`
+
+	// Multiplier is applied to the scores of the group's candidates. It is
+	// 1.0 unless the group has used more than its share, in which case it
+	// is Share / Usage.
+	Multiplier float64 `json:"multiplier"`
+}
+
+// fairShares holds the multipliers for each FairShareGroup, computed from
+// recent usage.
+type fairShares struct {
+	groups []*FairShareGroup
+	status []*FairShareStatus
+}
+
+// computeFairShares determines how much of its share each group has used.
+func computeFairShares(cfg *FairShareConfig, usage []*fairShareUsage) *fairShares {
+	totalByPool := map[string]time.Duration{}
+	total := time.Duration(0)
+	for _, u := range usage {
+		totalByPool[u.pool] += u.botTime
+		total += u.botTime
+	}
+	rv := &fairShares{
+		groups: cfg.Groups,
+		status: make([]*FairShareStatus, 0, len(cfg.Groups)),
+	}
+	for _, g := range cfg.Groups {
+		used := time.Duration(0)
+		for _, u := range usage {
+			if g.matches(u.repo, u.pool, u.jobNames) {
+				used += u.botTime
+			}
+		}
+		denom := total
+		if g.Pool != "" {
+			denom = totalByPool[g.Pool]
+		}
+		st := &FairShareStatus{
+			Name:       g.Name,
+			Pool:       g.Pool,
+			Share:      g.Share,
+			BotSeconds: used.Seconds(),
+			Multiplier: 1.0,
+		}
+		if denom > 0 {
+			st.Usage = float64(used) / float64(denom)
+		}
+		if st.Usage > g.Share {
+			st.Multiplier = g.Share / st.Usage
+		}
+		rv.status = append(rv.status, st)
+	}
+	return rv
+}
+
+// multiplier returns the amount by which to scale the score of a candidate
+// with the given properties, ie. the product of the multipliers of every
+// group it belongs to.
+func (f *fairShares) multiplier(repo, pool string, jobNames []string) float64 {
+	rv := 1.0
+	for i, g := range f.groups {
+		if g.matches(repo, pool, jobNames) {
+			rv *= f.status[i].Multiplier
+		}
+	}
+	return rv
+}
+
+// poolFromDimensions returns the Swarming pool from the given dimensions, or
+// the empty string if there is none.
+func poolFromDimensions(dims []string) string {
+	prefix := swarming.DIMENSION_POOL_KEY + ":"
+	for _, d := range dims {
+		if strings.HasPrefix(d, prefix) {
+			return strings.TrimPrefix(d, prefix)
+		}
+	}
+	return ""
+}
+
+// SetFairShareConfig sets the fair-share quotas used to adjust the scores of
+// task candidates. A nil config disables fair-share scheduling.
+func (s *TaskScheduler) SetFairShareConfig(cfg *FairShareConfig) {
+	s.fairSharesMtx.Lock()
+	defer s.fairSharesMtx.Unlock()
+	s.fairShareCfg = cfg
+	s.fairShares = nil
+}
+
+// getFairShares returns the most recently computed fairShares, or nil if
+// fair-share scheduling is disabled.
+func (s *TaskScheduler) getFairShares() *fairShares {
+	s.fairSharesMtx.RLock()
+	defer s.fairSharesMtx.RUnlock()
+	return s.fairShares
+}
+
+// jobNameCache looks up and caches the names of Jobs by ID.
+type jobNameCache struct {
+	jCache db.JobCache
+	names  map[string]string
+}
+
+// get returns the names of the given Jobs. Jobs which can't be found are
+// skipped.
+func (c *jobNameCache) get(ids []string) []string {
+	rv := make([]string, 0, len(ids))
+	for _, id := range ids {
+		name, ok := c.names[id]
+		if !ok {
+			j, err := c.jCache.GetJobMaybeExpired(id)
+			if err != nil {
+				sklog.Warningf("Failed to find job %s: %s", id, err)
+			} else {
+				name = j.Name
+			}
+			c.names[id] = name
+		}
+		if name != "" {
+			rv = append(rv, name)
+		}
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// updateFairShares computes the bot time used by recent tasks and updates the
+// fairShares accordingly. Only tasks created within the window are counted.
+func (s *TaskScheduler) updateFairShares(ctx context.Context, now time.Time) error {
+	s.fairSharesMtx.RLock()
+	cfg := s.fairShareCfg
+	s.fairSharesMtx.RUnlock()
+	if cfg == nil {
+		return nil
+	}
+
+	start := now.Add(-cfg.window)
+	tasks, err := s.tCache.GetTasksFromDateRange(start, now)
+	if err != nil {
+		return err
+	}
+	jobNames := &jobNameCache{
+		jCache: s.jCache,
+		names:  map[string]string{},
+	}
+	cfgs := map[db.RepoState]*specs.TasksCfg{}
+	usage := make([]*fairShareUsage, 0, len(tasks))
+	for _, t := range tasks {
+		if t.Fake() || util.TimeIsZero(t.Started) {
+			continue
+		}
+		began := t.Started
+		if began.Before(start) {
+			began = start
+		}
+		end := t.Finished
+		if util.TimeIsZero(end) || end.After(now) {
+			end = now
+		}
+		if !end.After(began) {
+			continue
+		}
+		// Find the pool from the TaskSpec.
+		tasksCfg, ok := cfgs[t.RepoState]
+		if !ok {
+			tasksCfg, err = s.taskCfgCache.ReadTasksCfg(ctx, t.RepoState)
+			if err != nil {
+				sklog.Warningf("Failed to read TasksCfg for %+v; not counting pool usage: %s", t.RepoState, err)
+			}
+			cfgs[t.RepoState] = tasksCfg
+		}
+		pool := ""
+		if tasksCfg != nil {
+			if spec, ok := tasksCfg.Tasks[t.Name]; ok {
+				pool = poolFromDimensions(spec.Dimensions)
+			}
+		}
+		usage = append(usage, &fairShareUsage{
+			repo:     t.Repo,
+			pool:     pool,
+			jobNames: jobNames.get(t.Jobs),
+			botTime:  end.Sub(began),
+		})
+	}
+	shares := computeFairShares(cfg, usage)
+
+	s.fairSharesMtx.Lock()
+	defer s.fairSharesMtx.Unlock()
+	// Don't clobber a config which changed in the meantime.
+	if s.fairShareCfg == cfg {
+		s.fairShares = shares
+	}
+	return nil
+}
+
+// FairShareStatus returns the current consumption of each FairShareGroup, or
+// nil if fair-share scheduling is disabled.
+func (s *TaskScheduler) FairShareStatus() []*FairShareStatus {
+	shares := s.getFairShares()
+	if shares == nil {
+		return nil
+	}
+	rv := make([]*FairShareStatus, 0, len(shares.status))
+	for _, st := range shares.status {
+		cp := *st
+		rv = append(rv, &cp)
+	}
+	return rv
+}
+
+// fairShareMultipliers returns the score multiplier of each of the given
+// candidates which belongs to a FairShareGroup that has used more than its
+// share. Forced jobs are never penalized.
+func (s *TaskScheduler) fairShareMultipliers(candidates map[string]map[string][]*taskCandidate) map[*taskCandidate]float64 {
+	rv := map[*taskCandidate]float64{}
+	shares := s.getFairShares()
+	if shares == nil {
+		return rv
+	}
+	jobNames := &jobNameCache{
+		jCache: s.jCache,
+		names:  map[string]string{},
+	}
+	for _, byName := range candidates {
+		for _, cs := range byName {
+			for _, c := range cs {
+				if c.IsForceRun() {
+					continue
+				}
+				if m := shares.multiplier(c.Repo, poolFromDimensions(c.TaskSpec.Dimensions), jobNames.get(c.Jobs)); m != 1.0 {
+					rv[c] = m
+				}
+			}
+		}
+	}
+	return rv
+}
@@ -0,0 +1,156 @@
+package scheduling
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+
+	"go.skia.org/infra/go/testutils"
+)
+
+func TestFairShareConfigValidate(t *testing.T) {
+	testutils.SmallTest(t)
+
+	cfg := &FairShareConfig{
+		Groups: []*FairShareGroup{
+			{Name: "skia", Repo: "skia.git", Share: 0.5},
+			{Name: "perf", JobPrefix: "Perf-", Pool: "Skia", Share: 1.0},
+		},
+	}
+	assert.NoError(t, cfg.Validate())
+	assert.Equal(t, DEFAULT_FAIR_SHARE_WINDOW, cfg.window)
+	cfg.Window = "90m"
+	assert.NoError(t, cfg.Validate())
+	assert.Equal(t, 90*time.Minute, cfg.window)
+
+	for _, tc := range []struct {
+		cfg *FairShareConfig
+		err string
+	}{
+		{&FairShareConfig{Window: "forever"}, "Invalid fair-share window"},
+		{&FairShareConfig{Window: "-1h"}, "must be positive"},
+		{&FairShareConfig{Groups: []*FairShareGroup{{Repo: "skia.git", Share: 0.5}}}, "must have a name"},
+		{&FairShareConfig{Groups: []*FairShareGroup{{Name: "a", Repo: "skia.git", Share: 0.5}, {Name: "a", Pool: "Skia", Share: 0.5}}}, "Duplicate"},
+		{&FairShareConfig{Groups: []*FairShareGroup{{Name: "a", Share: 0.5}}}, "must specify at least one"},
+		{&FairShareConfig{Groups: []*FairShareGroup{{Name: "a", Pool: "Skia"}}}, "must be in (0, 1]"},
+		{&FairShareConfig{Groups: []*FairShareGroup{{Name: "a", Pool: "Skia", Share: 1.5}}}, "must be in (0, 1]"},
+	} {
+		err := tc.cfg.Validate()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), tc.err)
+	}
+}
+
+func TestFairShareConfigFromFile(t *testing.T) {
+	testutils.SmallTest(t)
+	wd, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer testutils.RemoveAll(t, wd)
+
+	file := path.Join(wd, "fair_share.json")
+	assert.NoError(t, ioutil.WriteFile(file, []byte(`{
+  "window": "2h",
+  "groups": [
+    {"name": "skia", "repo": "skia.git", "pool": "Skia", "share": 0.6}
+  ]
+}`), os.ModePerm))
+	cfg, err := FairShareConfigFromFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Hour, cfg.window)
+	assert.Equal(t, 1, len(cfg.Groups))
+	assert.Equal(t, &FairShareGroup{Name: "skia", Repo: "skia.git", Pool: "Skia", Share: 0.6}, cfg.Groups[0])
+
+	assert.NoError(t, ioutil.WriteFile(file, []byte(`{"groups": [{"name": "skia", "share": 0.6}]}`), os.ModePerm))
+	_, err = FairShareConfigFromFile(file)
+	assert.Error(t, err)
+
+	_, err = FairShareConfigFromFile(path.Join(wd, "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestFairShareGroupMatches(t *testing.T) {
+	testutils.SmallTest(t)
+	g := &FairShareGroup{Repo: "skia.git", JobPrefix: "Perf-", Pool: "Skia"}
+	assert.True(t, g.matches("skia.git", "Skia", []string{"Build-Debian", "Perf-Android"}))
+	assert.False(t, g.matches("infra.git", "Skia", []string{"Perf-Android"}))
+	assert.False(t, g.matches("skia.git", "SkiaCT", []string{"Perf-Android"}))
+	assert.False(t, g.matches("skia.git", "Skia", []string{"Test-Android"}))
+	assert.False(t, g.matches("skia.git", "Skia", nil))
+
+	g = &FairShareGroup{Pool: "Skia"}
+	assert.True(t, g.matches("skia.git", "Skia", nil))
+	assert.True(t, g.matches("infra.git", "Skia", []string{"Housekeeper"}))
+	assert.False(t, g.matches("infra.git", "", nil))
+}
+
+func TestComputeFairShares(t *testing.T) {
+	testutils.SmallTest(t)
+	cfg := &FairShareConfig{
+		Groups: []*FairShareGroup{
+			{Name: "skia", Repo: "skia.git", Pool: "Skia", Share: 0.5},
+			{Name: "infra", Repo: "infra.git", Share: 0.5},
+			{Name: "perf", JobPrefix: "Perf-", Share: 0.25},
+			{Name: "ct", Pool: "SkiaCT", Share: 1.0},
+		},
+	}
+	assert.NoError(t, cfg.Validate())
+
+	// No usage; nobody is penalized.
+	f := computeFairShares(cfg, nil)
+	assert.Equal(t, 4, len(f.status))
+	for _, st := range f.status {
+		assert.Equal(t, 0.0, st.Usage)
+		assert.Equal(t, 1.0, st.Multiplier)
+	}
+	assert.Equal(t, 1.0, f.multiplier("skia.git", "Skia", []string{"Perf-Android"}))
+
+	usage := []*fairShareUsage{
+		// Skia uses 3 of the 4 hours in the Skia pool.
+		{repo: "skia.git", pool: "Skia", jobNames: []string{"Perf-Android"}, botTime: 2 * time.Hour},
+		{repo: "skia.git", pool: "Skia", jobNames: []string{"Test-Android"}, botTime: time.Hour},
+		{repo: "infra.git", pool: "Skia", jobNames: []string{"Infra-PerCommit"}, botTime: time.Hour},
+		// And all of the time in the SkiaCT pool.
+		{repo: "skia.git", pool: "SkiaCT", jobNames: []string{"Perf-CT"}, botTime: 4 * time.Hour},
+	}
+	f = computeFairShares(cfg, usage)
+	byName := map[string]*FairShareStatus{}
+	for _, st := range f.status {
+		byName[st.Name] = st
+	}
+
+	skia := byName["skia"]
+	assert.Equal(t, 0.75, skia.Usage)
+	assert.Equal(t, (3 * time.Hour).Seconds(), skia.BotSeconds)
+	assert.InDelta(t, 0.5/0.75, skia.Multiplier, 0.0001)
+
+	// Under its share, relative to all pools.
+	infra := byName["infra"]
+	assert.Equal(t, 0.125, infra.Usage)
+	assert.Equal(t, 1.0, infra.Multiplier)
+
+	perf := byName["perf"]
+	assert.Equal(t, 0.75, perf.Usage)
+	assert.InDelta(t, 0.25/0.75, perf.Multiplier, 0.0001)
+
+	// A group may use all of its pool.
+	ct := byName["ct"]
+	assert.Equal(t, 1.0, ct.Usage)
+	assert.Equal(t, 1.0, ct.Multiplier)
+
+	// Multipliers of every matching group are combined.
+	assert.InDelta(t, skia.Multiplier*perf.Multiplier, f.multiplier("skia.git", "Skia", []string{"Perf-Android"}), 0.0001)
+	assert.InDelta(t, skia.Multiplier, f.multiplier("skia.git", "Skia", []string{"Test-Android"}), 0.0001)
+	assert.InDelta(t, perf.Multiplier, f.multiplier("skia.git", "SkiaCT", []string{"Perf-CT"}), 0.0001)
+	assert.Equal(t, 1.0, f.multiplier("infra.git", "Skia", []string{"Infra-PerCommit"}))
+}
+
+func TestPoolFromDimensions(t *testing.T) {
+	testutils.SmallTest(t)
+	assert.Equal(t, "Skia", poolFromDimensions([]string{"os:Linux", "pool:Skia"}))
+	assert.Equal(t, "", poolFromDimensions([]string{"os:Linux"}))
+	assert.Equal(t, "", poolFromDimensions(nil))
+}
@@ -0,0 +1,245 @@
+package scheduling
+
+import (
+	"sort"
+	"time"
+
+	"go.skia.org/infra/go/metrics2"
+	"go.skia.org/infra/go/sklog"
+
+	"go.skia.org/infra/task_scheduler/go/db"
+)
+
+const (
+	// MIN_FLAKE_SAMPLES is the number of retried failures of a TaskSpec
+	// which are needed before its flake rate is used to decide whether to
+	// retry its failures.
+	MIN_FLAKE_SAMPLES = 5
+
+	// DETERMINISTIC_FLAKE_RATE is the flake rate below which failures of a
+	// TaskSpec are considered to be deterministic and are not retried.
+	DETERMINISTIC_FLAKE_RATE = 0.1
+
+	// LIKELY_FLAKE_RATE is the flake rate at or above which failures of a
+	// TaskSpec are considered likely to be flakes.
+	LIKELY_FLAKE_RATE = 0.5
+)
+
+// FlakeStats describes how often the failures of a TaskSpec turned out to be
+// flakes, ie. how often a failed Task was followed by a successful attempt at
+// the same TaskKey. Only failures which were retried are counted.
+type FlakeStats struct {
+	// Flakes is the number of failures which were followed by a success.
+	Flakes int `json:"flakes"`
+
+	// Failures is the number of failures where every retry also failed.
+	Failures int `json:"failures"`
+}
+
+// Samples returns the number of retried failures.
+func (s *FlakeStats) Samples() int {
+	return s.Flakes + s.Failures
+}
+
+// Rate returns the fraction of retried failures which were flakes.
+func (s *FlakeStats) Rate() float64 {
+	if s.Samples() == 0 {
+		return 0.0
+	}
+	return float64(s.Flakes) / float64(s.Samples())
+}
+
+// Deterministic returns true if there is enough history to say that failures
+// of the TaskSpec are very unlikely to be flakes.
+func (s *FlakeStats) Deterministic() bool {
+	return s.Samples() >= MIN_FLAKE_SAMPLES && s.Rate() < DETERMINISTIC_FLAKE_RATE
+}
+
+// LikelyFlaky returns true if there is enough history to say that failures of
+// the TaskSpec are likely to be flakes.
+func (s *FlakeStats) LikelyFlaky() bool {
+	return s.Samples() >= MIN_FLAKE_SAMPLES && s.Rate() >= LIKELY_FLAKE_RATE
+}
+
+// groupTasksByKey returns the non-fake tasks grouped by TaskKey, with each
+// group sorted by attempt.
+func groupTasksByKey(tasks []*db.Task) map[db.TaskKey][]*db.Task {
+	rv := map[db.TaskKey][]*db.Task{}
+	for _, t := range tasks {
+		if t.Fake() {
+			continue
+		}
+		rv[t.TaskKey] = append(rv[t.TaskKey], t)
+	}
+	for _, group := range rv {
+		sort.Sort(db.TaskSlice(group))
+	}
+	return rv
+}
+
+// isFlake returns true if a failure of the first Task in the group was
+// followed by a successful attempt, false if every later attempt failed, and
+// nil if the first Task didn't fail or the later attempts haven't finished.
+func isFlake(group []*db.Task) *bool {
+	if len(group) < 2 || group[0].Status != db.TASK_STATUS_FAILURE {
+		return nil
+	}
+	flake := false
+	for _, t := range group[1:] {
+		if t.Success() {
+			flake = true
+			return &flake
+		}
+	}
+	// Attempts run one at a time, so only the last may be unfinished.
+	if !group[len(group)-1].Done() {
+		return nil
+	}
+	return &flake
+}
+
+// computeFlakeStats returns the FlakeStats of each TaskSpec with retried
+// failures among the given Tasks, keyed by repo and TaskSpec name.
+func computeFlakeStats(groups map[db.TaskKey][]*db.Task) map[string]map[string]*FlakeStats {
+	rv := map[string]map[string]*FlakeStats{}
+	for k, group := range groups {
+		flake := isFlake(group)
+		if flake == nil {
+			continue
+		}
+		byName, ok := rv[k.Repo]
+		if !ok {
+			byName = map[string]*FlakeStats{}
+			rv[k.Repo] = byName
+		}
+		stats, ok := byName[k.Name]
+		if !ok {
+			stats = &FlakeStats{}
+			byName[k.Name] = stats
+		}
+		if *flake {
+			stats.Flakes++
+		} else {
+			stats.Failures++
+		}
+	}
+	return rv
+}
+
+// retryPolicy returns the Flaky and MaxAttempts values which the first attempt
+// in the given group should have, according to the flake history of its
+// TaskSpec.
+//
+// A failure which was followed by a successful attempt is flaky, and one
+// where every later attempt failed is not. A failure which hasn't been
+// retried yet is only considered flaky if the TaskSpec's failures are likely
+// to be flakes; without enough history there is no evidence either way.
+// MaxAttempts is only adjusted if the TaskSpec opted in via AutoRetry, in
+// which case deterministic failures are not retried, which also lets Jobs
+// which depend on the Task fail without waiting for retries, and likely
+// flakes are retried at least once, even if the TaskSpec doesn't usually
+// allow retries.
+func retryPolicy(group []*db.Task, stats *FlakeStats) (bool, int) {
+	first := group[0]
+	if first.Attempt != 0 || first.Status != db.TASK_STATUS_FAILURE {
+		return first.Flaky, first.MaxAttempts
+	}
+	if len(group) > 1 {
+		if flake := isFlake(group); flake != nil {
+			return *flake, first.MaxAttempts
+		}
+		// Retries are still in progress.
+		return first.Flaky, first.MaxAttempts
+	}
+	if stats == nil {
+		return first.Flaky, first.MaxAttempts
+	}
+	if !first.AutoRetry {
+		return stats.LikelyFlaky(), first.MaxAttempts
+	}
+	if stats.Deterministic() {
+		return false, 1
+	}
+	if !stats.LikelyFlaky() {
+		return first.Flaky, first.MaxAttempts
+	}
+	maxAttempts := first.MaxAttempts
+	if maxAttempts < db.DEFAULT_MAX_TASK_ATTEMPTS {
+		maxAttempts = db.DEFAULT_MAX_TASK_ATTEMPTS
+	}
+	return true, maxAttempts
+}
+
+// FlakeStats returns the most recently computed FlakeStats, keyed by repo and
+// TaskSpec name.
+func (s *TaskScheduler) FlakeStats() map[string]map[string]*FlakeStats {
+	s.flakeStatsMtx.RLock()
+	defer s.flakeStatsMtx.RUnlock()
+	rv := make(map[string]map[string]*FlakeStats, len(s.flakeStats))
+	for repo, byName := range s.flakeStats {
+		cp := make(map[string]*FlakeStats, len(byName))
+		for name, stats := range byName {
+			st := *stats
+			cp[name] = &st
+		}
+		rv[repo] = cp
+	}
+	return rv
+}
+
+// updateFlakyTasks computes the FlakeStats of each TaskSpec from the Tasks in
+// the scheduling window and applies the retry policy to the Tasks whose first
+// attempt failed. See retryPolicy.
+func (s *TaskScheduler) updateFlakyTasks(now time.Time) error {
+	defer metrics2.FuncTimer().Stop()
+
+	tasks, err := s.tCache.GetTasksFromDateRange(s.window.EarliestStart(), now)
+	if err != nil {
+		return err
+	}
+	groups := groupTasksByKey(tasks)
+	stats := computeFlakeStats(groups)
+	s.flakeStatsMtx.Lock()
+	s.flakeStats = stats
+	s.flakeStatsMtx.Unlock()
+
+	type update struct {
+		flaky       bool
+		maxAttempts int
+	}
+	updates := map[string]update{}
+	for k, group := range groups {
+		first := group[0]
+		flaky, maxAttempts := retryPolicy(group, stats[k.Repo][k.Name])
+		if flaky != first.Flaky || maxAttempts != first.MaxAttempts {
+			updates[first.Id] = update{flaky, maxAttempts}
+		}
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	sklog.Infof("Updating retry policy for %d tasks.", len(updates))
+	if _, err := db.UpdateTasksWithRetries(s.db, func() ([]*db.Task, error) {
+		rv := make([]*db.Task, 0, len(updates))
+		for id, u := range updates {
+			t, err := s.db.GetTaskById(id)
+			if err != nil {
+				return nil, err
+			}
+			if t == nil {
+				return nil, db.ErrNotFound
+			}
+			// The Task may have been updated concurrently.
+			if t.Flaky == u.flaky && t.MaxAttempts == u.maxAttempts {
+				continue
+			}
+			t.Flaky = u.flaky
+			t.MaxAttempts = u.maxAttempts
+			rv = append(rv, t)
+		}
+		return rv, nil
+	}); err != nil {
+		return err
+	}
+	return s.tCache.Update()
+}
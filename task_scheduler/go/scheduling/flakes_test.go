@@ -0,0 +1,175 @@
+package scheduling
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/task_scheduler/go/db"
+)
+
+// makeAttempts returns Tasks for consecutive attempts at the same TaskKey with
+// the given statuses.
+func makeAttempts(name, revision string, statuses ...db.TaskStatus) []*db.Task {
+	now := time.Unix(1513000000, 0)
+	rv := make([]*db.Task, 0, len(statuses))
+	for i, status := range statuses {
+		t := &db.Task{
+			Attempt:        i,
+			Created:        now.Add(time.Duration(i) * time.Minute),
+			Id:             fmt.Sprintf("%s@%s#%d", name, revision, i),
+			MaxAttempts:    db.DEFAULT_MAX_TASK_ATTEMPTS,
+			Status:         status,
+			SwarmingTaskId: fmt.Sprintf("swarm-%s@%s#%d", name, revision, i),
+			TaskKey: db.TaskKey{
+				RepoState: db.RepoState{
+					Repo:     "skia.git",
+					Revision: revision,
+				},
+				Name: name,
+			},
+		}
+		if i > 0 {
+			t.RetryOf = rv[i-1].Id
+		}
+		rv = append(rv, t)
+	}
+	return rv
+}
+
+func TestIsFlake(t *testing.T) {
+	testutils.SmallTest(t)
+	test := func(expect *bool, statuses ...db.TaskStatus) {
+		got := isFlake(makeAttempts("Test", "abc", statuses...))
+		if expect == nil {
+			assert.Nil(t, got, "%v", statuses)
+		} else {
+			assert.NotNil(t, got, "%v", statuses)
+			assert.Equal(t, *expect, *got, "%v", statuses)
+		}
+	}
+	yes := true
+	no := false
+	test(nil, db.TASK_STATUS_FAILURE)
+	test(nil, db.TASK_STATUS_SUCCESS)
+	test(nil, db.TASK_STATUS_MISHAP, db.TASK_STATUS_SUCCESS)
+	test(nil, db.TASK_STATUS_FAILURE, db.TASK_STATUS_RUNNING)
+	test(&yes, db.TASK_STATUS_FAILURE, db.TASK_STATUS_SUCCESS)
+	test(&yes, db.TASK_STATUS_FAILURE, db.TASK_STATUS_FAILURE, db.TASK_STATUS_SUCCESS)
+	test(&no, db.TASK_STATUS_FAILURE, db.TASK_STATUS_FAILURE)
+	test(&no, db.TASK_STATUS_FAILURE, db.TASK_STATUS_MISHAP)
+	test(nil, db.TASK_STATUS_FAILURE, db.TASK_STATUS_FAILURE, db.TASK_STATUS_PENDING)
+}
+
+func TestComputeFlakeStats(t *testing.T) {
+	testutils.SmallTest(t)
+	tasks := []*db.Task{}
+	tasks = append(tasks, makeAttempts("Flaky", "a", db.TASK_STATUS_FAILURE, db.TASK_STATUS_SUCCESS)...)
+	tasks = append(tasks, makeAttempts("Flaky", "b", db.TASK_STATUS_FAILURE, db.TASK_STATUS_SUCCESS)...)
+	tasks = append(tasks, makeAttempts("Flaky", "c", db.TASK_STATUS_FAILURE, db.TASK_STATUS_FAILURE)...)
+	tasks = append(tasks, makeAttempts("Flaky", "d", db.TASK_STATUS_SUCCESS)...)
+	tasks = append(tasks, makeAttempts("Broken", "a", db.TASK_STATUS_FAILURE, db.TASK_STATUS_FAILURE)...)
+	tasks = append(tasks, makeAttempts("Broken", "b", db.TASK_STATUS_FAILURE, db.TASK_STATUS_RUNNING)...)
+	tasks = append(tasks, makeAttempts("Broken", "c", db.TASK_STATUS_FAILURE)...)
+	// Fake tasks are ignored.
+	fake := makeAttempts("Fake", "a", db.TASK_STATUS_FAILURE, db.TASK_STATUS_SUCCESS)
+	for _, t := range fake {
+		t.SwarmingTaskId = ""
+	}
+	tasks = append(tasks, fake...)
+
+	// Shuffle the tasks a bit; groupTasksByKey sorts them.
+	tasks[0], tasks[1] = tasks[1], tasks[0]
+
+	stats := computeFlakeStats(groupTasksByKey(tasks))
+	assert.Equal(t, map[string]map[string]*FlakeStats{
+		"skia.git": {
+			"Flaky":  {Flakes: 2, Failures: 1},
+			"Broken": {Flakes: 0, Failures: 1},
+		},
+	}, stats)
+	assert.InDelta(t, 2.0/3.0, stats["skia.git"]["Flaky"].Rate(), 0.0001)
+	assert.Equal(t, 0.0, (&FlakeStats{}).Rate())
+}
+
+func TestFlakeStatsDeterministic(t *testing.T) {
+	testutils.SmallTest(t)
+	// Not enough samples.
+	assert.False(t, (&FlakeStats{Failures: MIN_FLAKE_SAMPLES - 1}).Deterministic())
+	assert.True(t, (&FlakeStats{Failures: MIN_FLAKE_SAMPLES}).Deterministic())
+	assert.True(t, (&FlakeStats{Flakes: 1, Failures: 19}).Deterministic())
+	assert.False(t, (&FlakeStats{Flakes: 1, Failures: 9}).Deterministic())
+	assert.False(t, (&FlakeStats{Flakes: 10}).Deterministic())
+}
+
+func TestFlakeStatsLikelyFlaky(t *testing.T) {
+	testutils.SmallTest(t)
+	// Not enough samples.
+	assert.False(t, (&FlakeStats{}).LikelyFlaky())
+	assert.False(t, (&FlakeStats{Flakes: MIN_FLAKE_SAMPLES - 1}).LikelyFlaky())
+	assert.True(t, (&FlakeStats{Flakes: MIN_FLAKE_SAMPLES}).LikelyFlaky())
+	assert.True(t, (&FlakeStats{Flakes: 5, Failures: 5}).LikelyFlaky())
+	assert.False(t, (&FlakeStats{Flakes: 4, Failures: 6}).LikelyFlaky())
+}
+
+func TestRetryPolicy(t *testing.T) {
+	testutils.SmallTest(t)
+	deterministic := &FlakeStats{Failures: 10}
+	flaky := &FlakeStats{Flakes: 5, Failures: 5}
+	unknown := &FlakeStats{Flakes: 1}
+	uncertain := &FlakeStats{Flakes: 3, Failures: 7}
+
+	test := func(group []*db.Task, stats *FlakeStats, expectFlaky bool, expectMaxAttempts int) {
+		gotFlaky, gotMaxAttempts := retryPolicy(group, stats)
+		assert.Equal(t, expectFlaky, gotFlaky)
+		assert.Equal(t, expectMaxAttempts, gotMaxAttempts)
+	}
+
+	// Successes and mishaps are left alone.
+	test(makeAttempts("Test", "a", db.TASK_STATUS_SUCCESS), deterministic, false, 2)
+	test(makeAttempts("Test", "a", db.TASK_STATUS_MISHAP), deterministic, false, 2)
+	test(makeAttempts("Test", "a", db.TASK_STATUS_RUNNING), deterministic, false, 2)
+
+	// Failures which haven't been retried are only flaky if the history
+	// of the TaskSpec says so. MaxAttempts is left alone unless the
+	// TaskSpec opted in to AutoRetry.
+	test(makeAttempts("Test", "a", db.TASK_STATUS_FAILURE), deterministic, false, 2)
+	test(makeAttempts("Test", "a", db.TASK_STATUS_FAILURE), flaky, true, 2)
+	test(makeAttempts("Test", "a", db.TASK_STATUS_FAILURE), uncertain, false, 2)
+	test(makeAttempts("Test", "a", db.TASK_STATUS_FAILURE), unknown, false, 2)
+	test(makeAttempts("Test", "a", db.TASK_STATUS_FAILURE), nil, false, 2)
+	group := makeAttempts("Test", "a", db.TASK_STATUS_FAILURE)
+	group[0].MaxAttempts = 1
+	test(group, flaky, true, 1)
+	test(group, nil, false, 1)
+
+	group = makeAttempts("Test", "a", db.TASK_STATUS_FAILURE)
+	group[0].AutoRetry = true
+	test(group, deterministic, false, 1)
+	test(group, flaky, true, 2)
+	test(group, uncertain, false, 2)
+	test(group, unknown, false, 2)
+	test(group, nil, false, 2)
+
+	// Suspected flakes are retried even if the TaskSpec doesn't normally
+	// allow it.
+	group[0].MaxAttempts = 1
+	test(group, flaky, true, 2)
+	test(group, unknown, false, 1)
+	group[0].MaxAttempts = 5
+	test(group, flaky, true, 5)
+
+	// Retried failures.
+	test(makeAttempts("Test", "a", db.TASK_STATUS_FAILURE, db.TASK_STATUS_SUCCESS), deterministic, true, 2)
+	test(makeAttempts("Test", "a", db.TASK_STATUS_FAILURE, db.TASK_STATUS_FAILURE), flaky, false, 2)
+	group = makeAttempts("Test", "a", db.TASK_STATUS_FAILURE, db.TASK_STATUS_RUNNING)
+	group[0].Flaky = true
+	test(group, deterministic, true, 2)
+
+	// Only the first attempt is considered.
+	group = makeAttempts("Test", "a", db.TASK_STATUS_FAILURE, db.TASK_STATUS_FAILURE)
+	test(group[1:], deterministic, false, 2)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	swarming_api "go.chromium.org/luci/common/api/swarming/swarming/v1"
+	"go.skia.org/infra/go/swarming"
+	"go.skia.org/infra/go/util"
+)
+
+// botGroup describes a number of identical bots in the simulated fleet.
+type botGroup struct {
+	// Prefix is used to generate the bot IDs, eg. "skia-gce-" results in
+	// bots "skia-gce-000", "skia-gce-001", etc.
+	Prefix string `json:"prefix"`
+
+	// Count is the number of bots in the group.
+	Count int `json:"count"`
+
+	// Dimensions are the Swarming dimensions of each bot. They must include
+	// a pool.
+	Dimensions map[string][]string `json:"dimensions"`
+}
+
+// readFleet reads the bot groups from the given JSON file.
+func readFleet(file string) ([]*botGroup, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read fleet config: %s", err)
+	}
+	defer util.Close(f)
+	var groups []*botGroup
+	if err := json.NewDecoder(f).Decode(&groups); err != nil {
+		return nil, fmt.Errorf("Failed to decode fleet config: %s", err)
+	}
+	return groups, nil
+}
+
+// makeBots returns the bots described by the given groups, sorted by ID.
+func makeBots(groups []*botGroup) ([]*swarming_api.SwarmingRpcsBotInfo, error) {
+	rv := []*swarming_api.SwarmingRpcsBotInfo{}
+	ids := map[string]bool{}
+	for _, g := range groups {
+		if g.Prefix == "" {
+			return nil, fmt.Errorf("Bot groups must have a prefix.")
+		}
+		if g.Count <= 0 {
+			return nil, fmt.Errorf("Bot group %q must have a positive count.", g.Prefix)
+		}
+		if len(g.Dimensions[swarming.DIMENSION_POOL_KEY]) == 0 {
+			return nil, fmt.Errorf("Bot group %q must have a %q dimension.", g.Prefix, swarming.DIMENSION_POOL_KEY)
+		}
+		keys := make([]string, 0, len(g.Dimensions))
+		for k := range g.Dimensions {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for i := 0; i < g.Count; i++ {
+			id := fmt.Sprintf("%s%03d", g.Prefix, i)
+			if ids[id] {
+				return nil, fmt.Errorf("Duplicate bot ID %q", id)
+			}
+			ids[id] = true
+			dims := make([]*swarming_api.SwarmingRpcsStringListPair, 0, len(keys)+1)
+			for _, k := range keys {
+				dims = append(dims, &swarming_api.SwarmingRpcsStringListPair{
+					Key:   k,
+					Value: util.CopyStringSlice(g.Dimensions[k]),
+				})
+			}
+			dims = append(dims, &swarming_api.SwarmingRpcsStringListPair{
+				Key:   "id",
+				Value: []string{id},
+			})
+			rv = append(rv, &swarming_api.SwarmingRpcsBotInfo{
+				BotId:      id,
+				Dimensions: dims,
+			})
+		}
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		return rv[i].BotId < rv[j].BotId
+	})
+	return rv, nil
+}
+
+// botPools returns the pools of the given bots, sorted.
+func botPools(bots []*swarming_api.SwarmingRpcsBotInfo) []string {
+	pools := util.StringSet{}
+	for _, b := range bots {
+		pools.AddLists(botDimension(b, swarming.DIMENSION_POOL_KEY))
+	}
+	rv := pools.Keys()
+	sort.Strings(rv)
+	return rv
+}
+
+// botDimension returns the values of the given dimension of the bot.
+func botDimension(b *swarming_api.SwarmingRpcsBotInfo, key string) []string {
+	for _, d := range b.Dimensions {
+		if d.Key == key {
+			return d.Value
+		}
+	}
+	return nil
+}
+
+// botMatches returns true if the bot has all of the given dimensions.
+func botMatches(b *swarming_api.SwarmingRpcsBotInfo, dims []*swarming_api.SwarmingRpcsStringPair) bool {
+	for _, d := range dims {
+		if !util.In(d.Value, botDimension(b, d.Key)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,568 @@
+package main
+
+/*
+	Simulator for the TaskScheduler.
+
+	Loads a snapshot of the task scheduler DB, either a local_db file or a
+	(gzipped) DB backup from the recovery package, along with a set of repos
+	and a synthetic bot fleet. Then runs TaskScheduler.MainLoop against fake
+	Swarming and Isolate servers over simulated time, and reports queue
+	latency, bot utilization and testedness per commit. This allows scoring
+	changes, eg. to --scoreDecay24Hr, to be evaluated offline.
+
+	The bot fleet is described by a JSON file containing a list of groups of
+	identical bots, eg:
+
+	[
+	  {
+	    "prefix": "skia-gce-",
+	    "count": 50,
+	    "dimensions": {"pool": ["Skia"], "os": ["Debian-9.4", "Linux"]}
+	  }
+	]
+
+	Task durations and failure rates are drawn from the history of each
+	TaskSpec in the snapshot, using a seeded random number generator, so
+	simulations with the same inputs produce the same results. For the same
+	reason, the repos should be local mirrors which do not change during the
+	simulation. Commits only become visible to the TaskScheduler once the
+	simulated time reaches their timestamp.
+*/
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	swarming_api "go.chromium.org/luci/common/api/swarming/swarming/v1"
+	"go.skia.org/infra/go/common"
+	"go.skia.org/infra/go/gerrit"
+	"go.skia.org/infra/go/git/repograph"
+	"go.skia.org/infra/go/human"
+	"go.skia.org/infra/go/isolate"
+	"go.skia.org/infra/go/mockhttpclient"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/swarming"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/task_scheduler/go/db"
+	"go.skia.org/infra/task_scheduler/go/db/local_db"
+	"go.skia.org/infra/task_scheduler/go/scheduling"
+	"go.skia.org/infra/task_scheduler/go/tryjobs"
+)
+
+var (
+	// Flags.
+	commitWindow    = flag.Int("commitWindow", 10, "Minimum number of recent commits to keep in the timeWindow.")
+	dbSnapshot      = flag.String("db_snapshot", "", "Path to a local_db file or a gzipped DB backup.")
+	defaultDuration = flag.Duration("default_task_duration", 10*time.Minute, "Duration of tasks whose TaskSpec has no history in the snapshot.")
+	depotTools      = flag.String("depot_tools", "", "Path to a depot_tools checkout.")
+	duration        = flag.String("duration", "1d", "Amount of time to simulate.")
+	fleet           = flag.String("fleet", "", "Path to a JSON file describing the bot fleet.")
+	history         = flag.String("history", "7d", "Amount of history before --start to load from the snapshot. Must be at least --timeWindow.")
+	output          = flag.String("output", "", "If set, write the report as JSON to this file.")
+	repoUrls        = common.NewMultiStringFlag("repo", nil, "Repositories for which to schedule tasks. Should be local mirrors.")
+	scoreDecay24Hr  = flag.Float64("scoreDecay24Hr", 0.9, "Task candidate scores are penalized using linear time decay. This is the desired value after 24 hours. Setting it to 1.0 causes commits not to be prioritized according to commit time.")
+	seed            = flag.Int64("seed", 0, "Seed for the random number generator used to predict task durations and results.")
+	startTime       = flag.String("start", "", "Start of the simulation, in RFC3339 format. Typically the time at which the snapshot was taken.")
+	step            = flag.Duration("step", time.Minute, "Amount of simulated time between scheduling loops.")
+	timePeriod      = flag.String("timeWindow", "4d", "Time period to use.")
+	workdir         = flag.String("workdir", "workdir", "Working directory to use.")
+)
+
+// runningTask describes a simulated task which is running on a bot.
+type runningTask struct {
+	bot      *swarming_api.SwarmingRpcsBotInfo
+	finish   time.Time
+	started  time.Time
+	status   db.TaskStatus
+	swarming *swarming_api.SwarmingRpcsTaskRequestMetadata
+}
+
+// simulator runs tasks triggered by the TaskScheduler on a simulated fleet.
+type simulator struct {
+	bots      []*swarming_api.SwarmingRpcsBotInfo
+	busy      map[string]time.Duration
+	clock     *simClock
+	d         db.DB
+	finished  int
+	imported  int
+	latencies []time.Duration
+	model     *taskModel
+	repos     repograph.Map
+	running   map[string]*runningTask
+	start     time.Time
+	swarm     *simSwarming
+}
+
+// copySnapshot copies the DB snapshot to the given file, decompressing it if
+// necessary, so that the snapshot itself is not modified.
+func copySnapshot(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("Failed to read DB snapshot: %s", err)
+	}
+	defer util.Close(in)
+	var r io.Reader = in
+	if strings.HasSuffix(src, ".gz") {
+		gz, err := gzip.NewReader(in)
+		if err != nil {
+			return fmt.Errorf("Failed to decompress DB snapshot: %s", err)
+		}
+		defer util.Close(gz)
+		r = gz
+	}
+	return util.WithWriteFile(dst, func(w io.Writer) error {
+		_, err := io.Copy(w, r)
+		return err
+	})
+}
+
+// loadSnapshot returns an in-memory DB containing the tasks and jobs created
+// between the given times in the snapshot. Unfinished try jobs are dropped,
+// since the simulation can't apply their patches.
+func loadSnapshot(file, wd string, from, to time.Time) (db.DB, []*db.Task, error) {
+	dbFile := path.Join(wd, "snapshot.db")
+	if err := copySnapshot(file, dbFile); err != nil {
+		return nil, nil, err
+	}
+	snapshot, err := local_db.NewDB("snapshot", dbFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to open DB snapshot: %s", err)
+	}
+	defer util.Close(snapshot)
+	tasks, err := snapshot.GetTasksFromDateRange(from, to)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to read tasks from snapshot: %s", err)
+	}
+	jobs, err := snapshot.GetJobsFromDateRange(from, to)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to read jobs from snapshot: %s", err)
+	}
+	keep := make([]*db.Job, 0, len(jobs))
+	for _, j := range jobs {
+		if j.IsTryJob() && !j.Done() {
+			continue
+		}
+		keep = append(keep, j)
+	}
+	sklog.Infof("Loaded %d tasks and %d jobs from the snapshot.", len(tasks), len(keep))
+
+	d := db.NewInMemoryDB()
+	if err := d.PutTasks(tasks); err != nil {
+		return nil, nil, err
+	}
+	if err := d.PutJobs(keep); err != nil {
+		return nil, nil, err
+	}
+	return d, tasks, nil
+}
+
+// importUnfinishedTasks handles the tasks which were pending or running when
+// the snapshot was taken, by adding them to the fake Swarming server. Running
+// tasks keep their bot, if it is in the fleet, until they finish. Pending
+// tasks can't be dispatched since their dimensions are unknown, so they expire
+// at the start of the simulation.
+func (s *simulator) importUnfinishedTasks(tasks []*db.Task) {
+	botsById := make(map[string]*swarming_api.SwarmingRpcsBotInfo, len(s.bots))
+	for _, b := range s.bots {
+		botsById[b.BotId] = b
+	}
+	mocks := []*swarming_api.SwarmingRpcsTaskRequestMetadata{}
+	expired := 0
+	for _, t := range tasks {
+		if t.Done() || t.Fake() {
+			continue
+		}
+		m := makeSwarmingTask(t)
+		mocks = append(mocks, m)
+		if t.Status == db.TASK_STATUS_PENDING {
+			m.TaskResult.State = swarming.TASK_STATE_EXPIRED
+			m.TaskResult.AbandonedTs = s.start.UTC().Format(swarming.TIMESTAMP_FORMAT)
+			expired++
+			continue
+		}
+		d, status := s.model.predict(t.Name)
+		finish := t.Started.Add(d)
+		if finish.Before(s.start) {
+			finish = s.start
+		}
+		rt := &runningTask{
+			finish:   finish,
+			started:  t.Started,
+			status:   status,
+			swarming: m,
+		}
+		if b, ok := botsById[t.SwarmingBotId]; ok && b.TaskId == "" {
+			b.TaskId = m.TaskId
+			rt.bot = b
+		}
+		s.running[t.Id] = rt
+	}
+	s.swarm.MockTasks(mocks)
+	s.imported = len(mocks)
+	sklog.Infof("Imported %d running tasks; %d pending tasks expired.", len(s.running), expired)
+}
+
+// finishTasks finishes the running tasks which are done by the given time. The
+// TaskScheduler picks up the results from Swarming.
+func (s *simulator) finishTasks(now time.Time) {
+	ids := make([]string, 0, len(s.running))
+	for id, rt := range s.running {
+		if !rt.finish.After(now) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		rt := s.running[id]
+		rt.swarming.TaskResult.State = swarming.TASK_STATE_COMPLETED
+		rt.swarming.TaskResult.Failure = rt.status == db.TASK_STATUS_FAILURE
+		rt.swarming.TaskResult.CompletedTs = rt.finish.UTC().Format(swarming.TIMESTAMP_FORMAT)
+		rt.swarming.TaskResult.OutputsRef = &swarming_api.SwarmingRpcsFilesRef{
+			Isolated: fmt.Sprintf("simulated-output-%s", id),
+		}
+		if rt.bot != nil {
+			rt.bot.TaskId = ""
+			s.addBusyTime(rt.bot.BotId, rt.started, rt.finish)
+		}
+		delete(s.running, id)
+		s.finished++
+	}
+}
+
+// addBusyTime records that the given bot was busy between the given times,
+// excluding any time before the start of the simulation.
+func (s *simulator) addBusyTime(bot string, from, to time.Time) {
+	if from.Before(s.start) {
+		from = s.start
+	}
+	if to.After(from) {
+		s.busy[bot] += to.Sub(from)
+	}
+}
+
+// pendingTasks returns the pending Swarming tasks in the order in which
+// Swarming would run them.
+func (s *simulator) pendingTasks() []*swarming_api.SwarmingRpcsTaskRequestMetadata {
+	pending := []*swarming_api.SwarmingRpcsTaskRequestMetadata{}
+	s.swarm.DoMockTasks(func(t *swarming_api.SwarmingRpcsTaskRequestMetadata) {
+		if t.TaskResult.State == swarming.TASK_STATE_PENDING {
+			pending = append(pending, t)
+		}
+	})
+	sort.Slice(pending, func(i, j int) bool {
+		a, b := pending[i], pending[j]
+		if a.Request.Priority != b.Request.Priority {
+			return a.Request.Priority < b.Request.Priority
+		}
+		if a.Request.CreatedTs != b.Request.CreatedTs {
+			return a.Request.CreatedTs < b.Request.CreatedTs
+		}
+		if a.Request.Name != b.Request.Name {
+			return a.Request.Name < b.Request.Name
+		}
+		revA, _ := swarming.GetTagValue(a.TaskResult, db.SWARMING_TAG_REVISION)
+		revB, _ := swarming.GetTagValue(b.TaskResult, db.SWARMING_TAG_REVISION)
+		return revA < revB
+	})
+	return pending
+}
+
+// dispatchTasks runs pending Swarming tasks on free bots which match their
+// dimensions. The TaskScheduler picks up the new state from Swarming.
+func (s *simulator) dispatchTasks(now time.Time) error {
+	for _, p := range s.pendingTasks() {
+		var bot *swarming_api.SwarmingRpcsBotInfo
+		for _, b := range s.bots {
+			if b.TaskId == "" && botMatches(b, p.Request.Properties.Dimensions) {
+				bot = b
+				break
+			}
+		}
+		if bot == nil {
+			continue
+		}
+		id, err := swarming.GetTagValue(p.TaskResult, db.SWARMING_TAG_ID)
+		if err != nil {
+			return err
+		}
+		t, err := s.d.GetTaskById(id)
+		if err != nil {
+			return err
+		}
+		if t == nil {
+			return fmt.Errorf("No such task %s", id)
+		}
+		if err := s.recordLatency(t, now); err != nil {
+			return err
+		}
+		d, status := s.model.predict(t.Name)
+		p.TaskResult.State = swarming.TASK_STATE_RUNNING
+		p.TaskResult.BotId = bot.BotId
+		p.TaskResult.StartedTs = now.UTC().Format(swarming.TIMESTAMP_FORMAT)
+		bot.TaskId = p.TaskId
+		s.running[t.Id] = &runningTask{
+			bot:      bot,
+			finish:   now.Add(d),
+			started:  now,
+			status:   status,
+			swarming: p,
+		}
+	}
+	return nil
+}
+
+// recordLatency records the time the given task, which is starting at the
+// given time, spent waiting to run after it became ready.
+func (s *simulator) recordLatency(t *db.Task, now time.Time) error {
+	parents := make(map[string]*db.Task, len(t.ParentTaskIds))
+	for _, id := range t.ParentTaskIds {
+		p, err := s.d.GetTaskById(id)
+		if err != nil {
+			return err
+		}
+		if p != nil {
+			parents[id] = p
+		}
+	}
+	commitTime := time.Time{}
+	if r, ok := s.repos[t.Repo]; ok {
+		if c := r.Get(t.Revision); c != nil {
+			commitTime = c.Timestamp
+		}
+	}
+	latency := now.Sub(readyTime(t, parents, commitTime, s.start))
+	if latency < 0 {
+		latency = 0
+	}
+	s.latencies = append(s.latencies, latency)
+	return nil
+}
+
+// makeReport summarizes the simulation, which ended at the given time.
+func (s *simulator) makeReport(end time.Time, period time.Duration) (*report, error) {
+	for _, rt := range s.running {
+		if rt.bot != nil {
+			s.addBusyTime(rt.bot.BotId, rt.started, end)
+		}
+	}
+	total := end.Sub(s.start)
+	rv := &report{
+		Start:           s.start,
+		End:             end,
+		TasksFinished:   s.finished,
+		TasksPending:    len(s.pendingTasks()),
+		QueueLatency:    computeLatencyStats(s.latencies),
+		PoolUtilization: map[string]float64{},
+		Bots:            make([]*botUsage, 0, len(s.bots)),
+		Commits:         []*commitTestedness{},
+	}
+	s.swarm.DoMockTasks(func(*swarming_api.SwarmingRpcsTaskRequestMetadata) {
+		rv.TasksTriggered++
+	})
+	rv.TasksTriggered -= s.imported
+
+	busyByPool := map[string]time.Duration{}
+	botsByPool := map[string]int{}
+	busy := time.Duration(0)
+	for _, b := range s.bots {
+		pools := botDimension(b, swarming.DIMENSION_POOL_KEY)
+		u := &botUsage{
+			Id:       b.BotId,
+			Pool:     strings.Join(pools, ","),
+			BusySecs: s.busy[b.BotId].Seconds(),
+		}
+		if total > 0 {
+			u.Utilization = float64(s.busy[b.BotId]) / float64(total)
+		}
+		rv.Bots = append(rv.Bots, u)
+		busy += s.busy[b.BotId]
+		for _, p := range pools {
+			busyByPool[p] += s.busy[b.BotId]
+			botsByPool[p]++
+		}
+	}
+	if total > 0 && len(s.bots) > 0 {
+		rv.BotUtilization = float64(busy) / (float64(total) * float64(len(s.bots)))
+		for p, count := range botsByPool {
+			rv.PoolUtilization[p] = float64(busyByPool[p]) / (float64(total) * float64(count))
+		}
+	}
+
+	// Testedness of the commits in the window at the end of the simulation.
+	tasks, err := s.d.GetTasksFromDateRange(end.Add(-2*period), end)
+	if err != nil {
+		return nil, err
+	}
+	for _, repoUrl := range s.repos.RepoURLs() {
+		commits := []*repograph.Commit{}
+		if err := s.repos[repoUrl].RecurseAllBranches(func(c *repograph.Commit) (bool, error) {
+			if c.Timestamp.Before(end.Add(-period)) || c.Timestamp.After(end) {
+				return false, nil
+			}
+			commits = append(commits, c)
+			return true, nil
+		}); err != nil {
+			return nil, err
+		}
+		sort.Sort(repograph.CommitSlice(commits))
+		before := computeTestedness(tasks, repoUrl, commits, s.start)
+		after := computeTestedness(tasks, repoUrl, commits, end)
+		for _, c := range commits {
+			rv.Commits = append(rv.Commits, &commitTestedness{
+				Repo:      repoUrl,
+				Hash:      c.Hash,
+				Timestamp: c.Timestamp,
+				Before:    before[c.Hash],
+				After:     after[c.Hash],
+			})
+		}
+	}
+	return rv, nil
+}
+
+func main() {
+	common.Init()
+	defer common.LogPanic()
+
+	if *dbSnapshot == "" || *fleet == "" || *startTime == "" || *depotTools == "" || len(*repoUrls) == 0 {
+		sklog.Fatal("--db_snapshot, --fleet, --start, --depot_tools and --repo are required.")
+	}
+	start, err := time.Parse(time.RFC3339, *startTime)
+	if err != nil {
+		sklog.Fatalf("Invalid --start: %s", err)
+	}
+	simDuration, err := human.ParseDuration(*duration)
+	if err != nil {
+		sklog.Fatal(err)
+	}
+	period, err := human.ParseDuration(*timePeriod)
+	if err != nil {
+		sklog.Fatal(err)
+	}
+	historyPeriod, err := human.ParseDuration(*history)
+	if err != nil {
+		sklog.Fatal(err)
+	}
+	if historyPeriod < period {
+		sklog.Fatal("--history must be at least --timeWindow.")
+	}
+	if *step <= 0 {
+		sklog.Fatal("--step must be positive.")
+	}
+	wdAbs, err := filepath.Abs(*workdir)
+	if err != nil {
+		sklog.Fatal(err)
+	}
+	if err := os.MkdirAll(wdAbs, os.ModePerm); err != nil {
+		sklog.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// Set up the bot fleet.
+	groups, err := readFleet(*fleet)
+	if err != nil {
+		sklog.Fatal(err)
+	}
+	bots, err := makeBots(groups)
+	if err != nil {
+		sklog.Fatal(err)
+	}
+	clock := &simClock{}
+	clock.Set(start)
+	swarm := newSimSwarming(clock)
+	swarm.MockBots(bots)
+
+	// Load the snapshot and the repos.
+	d, snapshotTasks, err := loadSnapshot(*dbSnapshot, wdAbs, start.Add(-historyPeriod), start)
+	if err != nil {
+		sklog.Fatal(err)
+	}
+	simRepos, repos, err := newSimRepos(ctx, *repoUrls, wdAbs, start)
+	if err != nil {
+		sklog.Fatal(err)
+	}
+
+	// Create the TaskScheduler. The caches in the TaskScheduler load the
+	// tasks and jobs in the window ending at the real current time, so the
+	// window is extended to include the start of the simulation.
+	isolateClient, err := isolate.NewClient(wdAbs, isolate.ISOLATE_SERVER_URL_FAKE)
+	if err != nil {
+		sklog.Fatal(err)
+	}
+	urlMock := mockhttpclient.NewURLMock()
+	gitcookies := path.Join(wdAbs, "gitcookies_fake")
+	if err := ioutil.WriteFile(gitcookies, []byte(".googlesource.com\tTRUE\t/\tTRUE\t123\to\tgit-user.google.com=abc123"), os.ModePerm); err != nil {
+		sklog.Fatal(err)
+	}
+	g, err := gerrit.NewGerrit("https://fake-skia-review.googlesource.com", gitcookies, urlMock.Client())
+	if err != nil {
+		sklog.Fatal(err)
+	}
+	schedulerPeriod := period + time.Now().Sub(start)
+	s, err := scheduling.NewTaskScheduler(ctx, d, schedulerPeriod, *commitWindow, wdAbs, "fake.server", repos, isolateClient, swarm, http.DefaultClient, *scoreDecay24Hr, tryjobs.API_URL_TESTING, tryjobs.BUCKET_TESTING, map[string]string{}, botPools(bots), "", *depotTools, g)
+	if err != nil {
+		sklog.Fatal(err)
+	}
+	s.SetTimeNowFunc(clock.Now)
+
+	sim := &simulator{
+		bots:    bots,
+		busy:    map[string]time.Duration{},
+		clock:   clock,
+		d:       d,
+		model:   newTaskModel(snapshotTasks, *defaultDuration, *seed),
+		repos:   repos,
+		running: map[string]*runningTask{},
+		start:   start,
+		swarm:   swarm,
+	}
+	sim.importUnfinishedTasks(snapshotTasks)
+
+	// Run the simulation.
+	end := start.Add(simDuration)
+	now := start
+	for ; !now.After(end); now = now.Add(*step) {
+		clock.Set(now)
+		if err := simRepos.Show(ctx, now); err != nil {
+			sklog.Fatal(err)
+		}
+		sim.finishTasks(now)
+		if err := s.MainLoop(ctx); err != nil {
+			sklog.Fatal(err)
+		}
+		if err := sim.dispatchTasks(now); err != nil {
+			sklog.Fatal(err)
+		}
+		sklog.Infof("Simulated %s: %d tasks running, %d in queue.", now.Sub(start), len(sim.running), s.QueueLen())
+	}
+
+	// Report the results.
+	r, err := sim.makeReport(end, period)
+	if err != nil {
+		sklog.Fatal(err)
+	}
+	if err := r.writeSummary(os.Stdout); err != nil {
+		sklog.Fatal(err)
+	}
+	if *output != "" {
+		if err := util.WithWriteFile(*output, func(w io.Writer) error {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(r)
+		}); err != nil {
+			sklog.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/task_scheduler/go/db"
+)
+
+// taskModel predicts how long simulated tasks run and whether they succeed,
+// based on the history of each TaskSpec in the snapshot.
+type taskModel struct {
+	defaultDuration time.Duration
+	durations       map[string][]time.Duration
+	failures        map[string]int
+	rng             *rand.Rand
+	runs            map[string]int
+}
+
+// newTaskModel returns a taskModel derived from the given finished tasks. The
+// given seed makes the predictions reproducible, as long as they are requested
+// in the same order.
+func newTaskModel(tasks []*db.Task, defaultDuration time.Duration, seed int64) *taskModel {
+	m := &taskModel{
+		defaultDuration: defaultDuration,
+		durations:       map[string][]time.Duration{},
+		failures:        map[string]int{},
+		rng:             rand.New(rand.NewSource(seed)),
+		runs:            map[string]int{},
+	}
+	for _, t := range tasks {
+		if t.Fake() || util.TimeIsZero(t.Started) || util.TimeIsZero(t.Finished) {
+			continue
+		}
+		if t.Status != db.TASK_STATUS_SUCCESS && t.Status != db.TASK_STATUS_FAILURE {
+			continue
+		}
+		m.durations[t.Name] = append(m.durations[t.Name], t.Finished.Sub(t.Started))
+		m.runs[t.Name]++
+		if t.Status == db.TASK_STATUS_FAILURE {
+			m.failures[t.Name]++
+		}
+	}
+	// Sort so that the predictions don't depend on the order of the tasks.
+	for _, d := range m.durations {
+		sort.Slice(d, func(i, j int) bool {
+			return d[i] < d[j]
+		})
+	}
+	return m
+}
+
+// predict returns the duration and result of a run of the given TaskSpec. The
+// duration is drawn from the TaskSpec's history, or is the default if there is
+// none, and the task fails with the TaskSpec's historical failure rate.
+func (m *taskModel) predict(name string) (time.Duration, db.TaskStatus) {
+	duration := m.defaultDuration
+	if d := m.durations[name]; len(d) > 0 {
+		duration = d[m.rng.Intn(len(d))]
+	}
+	status := db.TASK_STATUS_SUCCESS
+	if runs := m.runs[name]; runs > 0 && m.rng.Float64() < float64(m.failures[name])/float64(runs) {
+		status = db.TASK_STATUS_FAILURE
+	}
+	return duration, status
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/task_scheduler/go/db"
+)
+
+// makeTask returns a finished Task with the given name, duration and status.
+func makeTask(name string, d time.Duration, status db.TaskStatus) *db.Task {
+	started := time.Unix(1513000000, 0)
+	return &db.Task{
+		Finished:       started.Add(d),
+		Started:        started,
+		Status:         status,
+		SwarmingTaskId: "swarmid",
+		TaskKey: db.TaskKey{
+			Name: name,
+		},
+	}
+}
+
+func TestTaskModel(t *testing.T) {
+	testutils.SmallTest(t)
+
+	tasks := []*db.Task{
+		makeTask("Build", 20*time.Minute, db.TASK_STATUS_SUCCESS),
+		makeTask("Build", 30*time.Minute, db.TASK_STATUS_SUCCESS),
+		makeTask("Test", 5*time.Minute, db.TASK_STATUS_FAILURE),
+		// Mishaps and unfinished tasks are ignored.
+		makeTask("Test", time.Hour, db.TASK_STATUS_MISHAP),
+		makeTask("Perf", 0, db.TASK_STATUS_RUNNING),
+	}
+	tasks[4].Finished = time.Time{}
+	m := newTaskModel(tasks, 7*time.Minute, 0)
+
+	for i := 0; i < 10; i++ {
+		d, status := m.predict("Build")
+		assert.True(t, d == 20*time.Minute || d == 30*time.Minute)
+		assert.Equal(t, db.TASK_STATUS_SUCCESS, status)
+
+		d, status = m.predict("Test")
+		assert.Equal(t, 5*time.Minute, d)
+		assert.Equal(t, db.TASK_STATUS_FAILURE, status)
+
+		d, status = m.predict("Perf")
+		assert.Equal(t, 7*time.Minute, d)
+		assert.Equal(t, db.TASK_STATUS_SUCCESS, status)
+	}
+}
+
+func TestTaskModelDeterministic(t *testing.T) {
+	testutils.SmallTest(t)
+
+	tasks := []*db.Task{}
+	for i := 0; i < 20; i++ {
+		status := db.TASK_STATUS_SUCCESS
+		if i%3 == 0 {
+			status = db.TASK_STATUS_FAILURE
+		}
+		tasks = append(tasks, makeTask("Test", time.Duration(i+1)*time.Minute, status))
+	}
+	reversed := make([]*db.Task, 0, len(tasks))
+	for i := len(tasks) - 1; i >= 0; i-- {
+		reversed = append(reversed, tasks[i])
+	}
+
+	// The same seed gives the same predictions, regardless of the order of
+	// the history.
+	m1 := newTaskModel(tasks, time.Minute, 42)
+	m2 := newTaskModel(reversed, time.Minute, 42)
+	for i := 0; i < 50; i++ {
+		d1, s1 := m1.predict("Test")
+		d2, s2 := m2.predict("Test")
+		assert.Equal(t, d1, d2)
+		assert.Equal(t, s1, s2)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"go.skia.org/infra/go/git/repograph"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/task_scheduler/go/db"
+)
+
+// latencyStats summarizes a set of queue latencies.
+type latencyStats struct {
+	Count      int     `json:"count"`
+	MeanSecs   float64 `json:"mean_secs"`
+	MedianSecs float64 `json:"median_secs"`
+	P90Secs    float64 `json:"p90_secs"`
+	MaxSecs    float64 `json:"max_secs"`
+}
+
+// computeLatencyStats returns the latencyStats for the given latencies.
+func computeLatencyStats(latencies []time.Duration) *latencyStats {
+	rv := &latencyStats{
+		Count: len(latencies),
+	}
+	if len(latencies) == 0 {
+		return rv
+	}
+	sorted := make([]time.Duration, len(latencies))
+	copy(sorted, latencies)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	total := time.Duration(0)
+	for _, l := range sorted {
+		total += l
+	}
+	rv.MeanSecs = total.Seconds() / float64(len(sorted))
+	rv.MedianSecs = sorted[len(sorted)/2].Seconds()
+	rv.P90Secs = sorted[(len(sorted)*9)/10].Seconds()
+	rv.MaxSecs = sorted[len(sorted)-1].Seconds()
+	return rv
+}
+
+// readyTime returns the time at which the given task could have started
+// running: the latest of the start of the simulation, the time its commit
+// landed and the time its last parent task finished.
+func readyTime(t *db.Task, parents map[string]*db.Task, commitTime, simStart time.Time) time.Time {
+	rv := simStart
+	if commitTime.After(rv) {
+		rv = commitTime
+	}
+	for _, id := range t.ParentTaskIds {
+		if p, ok := parents[id]; ok && p.Finished.After(rv) {
+			rv = p.Finished
+		}
+	}
+	return rv
+}
+
+// botUsage describes how much of the simulation a bot spent running tasks.
+type botUsage struct {
+	Id          string  `json:"id"`
+	Pool        string  `json:"pool"`
+	BusySecs    float64 `json:"busy_secs"`
+	Utilization float64 `json:"utilization"`
+}
+
+// commitTestedness is the fraction of TaskSpecs which have tested a commit,
+// at the start and the end of the simulation.
+type commitTestedness struct {
+	Repo      string    `json:"repo"`
+	Hash      string    `json:"hash"`
+	Timestamp time.Time `json:"timestamp"`
+	Before    float64   `json:"before"`
+	After     float64   `json:"after"`
+}
+
+// computeTestedness returns the fraction of TaskSpecs which have tested each
+// of the given commits, counting only the tasks which finished by the given
+// time. A commit is tested by a TaskSpec if a successful or failed task
+// includes it in its blamelist. TaskSpecs are identified by the names of the
+// tasks in the repo, since the set of TaskSpecs may vary between commits.
+func computeTestedness(tasks []*db.Task, repo string, commits []*repograph.Commit, at time.Time) map[string]float64 {
+	names := util.StringSet{}
+	tested := map[string]util.StringSet{}
+	for _, t := range tasks {
+		if t.Repo != repo || t.Fake() || t.IsTryJob() {
+			continue
+		}
+		names[t.Name] = true
+		if t.Status != db.TASK_STATUS_SUCCESS && t.Status != db.TASK_STATUS_FAILURE {
+			continue
+		}
+		if util.TimeIsZero(t.Finished) || t.Finished.After(at) {
+			continue
+		}
+		for _, c := range t.Commits {
+			if _, ok := tested[c]; !ok {
+				tested[c] = util.StringSet{}
+			}
+			tested[c][t.Name] = true
+		}
+	}
+	rv := make(map[string]float64, len(commits))
+	for _, c := range commits {
+		if len(names) == 0 {
+			rv[c.Hash] = 0.0
+		} else {
+			rv[c.Hash] = float64(len(tested[c.Hash])) / float64(len(names))
+		}
+	}
+	return rv
+}
+
+// report describes the results of a simulation.
+type report struct {
+	Start           time.Time           `json:"start"`
+	End             time.Time           `json:"end"`
+	TasksTriggered  int                 `json:"tasks_triggered"`
+	TasksFinished   int                 `json:"tasks_finished"`
+	TasksPending    int                 `json:"tasks_pending"`
+	QueueLatency    *latencyStats       `json:"queue_latency"`
+	BotUtilization  float64             `json:"bot_utilization"`
+	PoolUtilization map[string]float64  `json:"pool_utilization"`
+	Bots            []*botUsage         `json:"bots"`
+	Commits         []*commitTestedness `json:"commits"`
+}
+
+// writeSummary writes a human-readable summary of the report.
+func (r *report) writeSummary(w io.Writer) error {
+	before, after := 0.0, 0.0
+	for _, c := range r.Commits {
+		before += c.Before
+		after += c.After
+	}
+	if len(r.Commits) > 0 {
+		before /= float64(len(r.Commits))
+		after /= float64(len(r.Commits))
+	}
+	pools := make([]string, 0, len(r.PoolUtilization))
+	for p := range r.PoolUtilization {
+		pools = append(pools, p)
+	}
+	sort.Strings(pools)
+
+	lines := []string{
+		fmt.Sprintf("Simulated %s to %s (%s)", r.Start.UTC().Format(time.RFC3339), r.End.UTC().Format(time.RFC3339), r.End.Sub(r.Start)),
+		fmt.Sprintf("Tasks: %d triggered, %d finished, %d still pending", r.TasksTriggered, r.TasksFinished, r.TasksPending),
+		fmt.Sprintf("Queue latency: mean %s, median %s, p90 %s, max %s (%d tasks)", secs(r.QueueLatency.MeanSecs), secs(r.QueueLatency.MedianSecs), secs(r.QueueLatency.P90Secs), secs(r.QueueLatency.MaxSecs), r.QueueLatency.Count),
+		fmt.Sprintf("Bot utilization: %.1f%%", 100.0*r.BotUtilization),
+	}
+	for _, p := range pools {
+		lines = append(lines, fmt.Sprintf("  %s: %.1f%%", p, 100.0*r.PoolUtilization[p]))
+	}
+	lines = append(lines, fmt.Sprintf("Mean testedness of %d commits: %.1f%% -> %.1f%%", len(r.Commits), 100.0*before, 100.0*after))
+	for _, l := range lines {
+		if _, err := fmt.Fprintln(w, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// secs formats the given number of seconds as a duration.
+func secs(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second)).Round(time.Second)
+}
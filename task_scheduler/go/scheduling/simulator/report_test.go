@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+
+	"go.skia.org/infra/go/git/repograph"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/go/vcsinfo"
+	"go.skia.org/infra/task_scheduler/go/db"
+)
+
+func TestComputeLatencyStats(t *testing.T) {
+	testutils.SmallTest(t)
+
+	s := computeLatencyStats(nil)
+	assert.Equal(t, &latencyStats{}, s)
+
+	latencies := []time.Duration{}
+	for i := 10; i > 0; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Second)
+	}
+	s = computeLatencyStats(latencies)
+	assert.Equal(t, &latencyStats{
+		Count:      10,
+		MeanSecs:   5.5,
+		MedianSecs: 6,
+		P90Secs:    10,
+		MaxSecs:    10,
+	}, s)
+	// The input is not modified.
+	assert.Equal(t, 10*time.Second, latencies[0])
+}
+
+func TestReadyTime(t *testing.T) {
+	testutils.SmallTest(t)
+
+	start := time.Unix(1513000000, 0)
+	task := &db.Task{
+		ParentTaskIds: []string{"p1", "p2", "missing"},
+	}
+	parents := map[string]*db.Task{
+		"p1": {Finished: start.Add(5 * time.Minute)},
+		"p2": {Finished: start.Add(10 * time.Minute)},
+	}
+
+	// The last parent to finish.
+	assert.Equal(t, start.Add(10*time.Minute), readyTime(task, parents, start.Add(-time.Hour), start))
+	// The commit landed after the parents finished.
+	assert.Equal(t, start.Add(time.Hour), readyTime(task, parents, start.Add(time.Hour), start))
+	// Nothing happened after the start of the simulation.
+	assert.Equal(t, start, readyTime(&db.Task{}, nil, start.Add(-time.Hour), start))
+}
+
+func TestComputeTestedness(t *testing.T) {
+	testutils.SmallTest(t)
+
+	now := time.Unix(1513000000, 0)
+	commit := func(hash string) *repograph.Commit {
+		return &repograph.Commit{
+			LongCommit: &vcsinfo.LongCommit{
+				ShortCommit: &vcsinfo.ShortCommit{
+					Hash: hash,
+				},
+			},
+		}
+	}
+	task := func(name, repo string, status db.TaskStatus, finished time.Time, commits ...string) *db.Task {
+		return &db.Task{
+			Commits:        commits,
+			Finished:       finished,
+			Status:         status,
+			SwarmingTaskId: "swarmid",
+			TaskKey: db.TaskKey{
+				RepoState: db.RepoState{
+					Repo: repo,
+				},
+				Name: name,
+			},
+		}
+	}
+	tasks := []*db.Task{
+		task("Build", "skia.git", db.TASK_STATUS_SUCCESS, now.Add(-time.Hour), "a", "b"),
+		task("Test", "skia.git", db.TASK_STATUS_FAILURE, now.Add(time.Hour), "b"),
+		// Mishaps don't count as testing a commit, but their TaskSpec
+		// counts towards the total.
+		task("Perf", "skia.git", db.TASK_STATUS_MISHAP, now.Add(-time.Hour), "a"),
+		// Other repos are ignored.
+		task("Other", "other.git", db.TASK_STATUS_SUCCESS, now.Add(-time.Hour), "a"),
+	}
+	commits := []*repograph.Commit{commit("a"), commit("b"), commit("c")}
+
+	assert.Equal(t, map[string]float64{
+		"a": 1.0 / 3.0,
+		"b": 1.0 / 3.0,
+		"c": 0.0,
+	}, computeTestedness(tasks, "skia.git", commits, now))
+	assert.Equal(t, map[string]float64{
+		"a": 1.0 / 3.0,
+		"b": 2.0 / 3.0,
+		"c": 0.0,
+	}, computeTestedness(tasks, "skia.git", commits, now.Add(2*time.Hour)))
+	assert.Equal(t, map[string]float64{
+		"a": 0.0,
+	}, computeTestedness(tasks, "nope.git", commits[:1], now))
+}
+
+func TestWriteSummary(t *testing.T) {
+	testutils.SmallTest(t)
+
+	start := time.Unix(1513000000, 0).UTC()
+	r := &report{
+		Start:          start,
+		End:            start.Add(24 * time.Hour),
+		TasksTriggered: 100,
+		TasksFinished:  90,
+		TasksPending:   5,
+		QueueLatency: computeLatencyStats([]time.Duration{
+			time.Minute,
+			3 * time.Minute,
+		}),
+		BotUtilization: 0.5,
+		PoolUtilization: map[string]float64{
+			"Skia":   0.75,
+			"SkiaCT": 0.25,
+		},
+		Commits: []*commitTestedness{
+			{Before: 0.5, After: 1.0},
+			{Before: 0.0, After: 0.5},
+		},
+	}
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, r.writeSummary(buf))
+	assert.Equal(t, strings.Join([]string{
+		"Simulated 2017-12-11T13:46:40Z to 2017-12-12T13:46:40Z (24h0m0s)",
+		"Tasks: 100 triggered, 90 finished, 5 still pending",
+		"Queue latency: mean 2m0s, median 3m0s, p90 3m0s, max 3m0s (2 tasks)",
+		"Bot utilization: 50.0%",
+		"  Skia: 75.0%",
+		"  SkiaCT: 25.0%",
+		"Mean testedness of 2 commits: 25.0% -> 75.0%",
+		"",
+	}, "\n"), buf.String())
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"go.skia.org/infra/go/git"
+	"go.skia.org/infra/go/git/repograph"
+)
+
+// simRepos makes the commits of a set of repos visible to the TaskScheduler as
+// the simulated time reaches their timestamps.
+//
+// The full history of each repo is loaded into a staging repo, whose branches
+// are reset to the newest commit which had landed at the simulated time. The
+// TaskScheduler uses clones of the staging repos, so it picks up the commits
+// which have landed when it updates its repos.
+type simRepos struct {
+	// history holds the full history of each repo, keyed by repo URL.
+	history map[string]*repograph.Graph
+
+	// visible holds the head of each branch of each repo, as currently seen
+	// by the TaskScheduler. Branches without any visible commits are omitted.
+	visible map[string]map[string]string
+}
+
+// newSimRepos loads the given repos and returns a simRepos along with the
+// repograph.Map which should be used by the TaskScheduler, which only contains
+// the commits which had landed at the given start time.
+func newSimRepos(ctx context.Context, repoUrls []string, workdir string, start time.Time) (*simRepos, repograph.Map, error) {
+	stagingDir := path.Join(workdir, "staging")
+	if err := os.MkdirAll(stagingDir, os.ModePerm); err != nil {
+		return nil, nil, err
+	}
+	s := &simRepos{
+		history: make(map[string]*repograph.Graph, len(repoUrls)),
+		visible: make(map[string]map[string]string, len(repoUrls)),
+	}
+	for _, repoUrl := range repoUrls {
+		staging, err := repograph.NewGraph(ctx, repoUrl, stagingDir)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := staging.Update(ctx); err != nil {
+			return nil, nil, err
+		}
+		s.history[repoUrl] = staging
+		s.visible[repoUrl] = map[string]string{}
+		for _, b := range staging.BranchHeads() {
+			s.visible[repoUrl][b.Name] = b.Head
+		}
+	}
+	if err := s.Show(ctx, start); err != nil {
+		return nil, nil, err
+	}
+
+	// Clone the staging repos where repograph.NewMap expects to find the
+	// repos. Existing clones are removed since they may contain commits
+	// from a later simulated time.
+	for _, repoUrl := range repoUrls {
+		dest := path.Join(workdir, strings.TrimSuffix(path.Base(repoUrl), ".git"))
+		if err := os.RemoveAll(dest); err != nil {
+			return nil, nil, err
+		}
+		if _, err := git.NewRepo(ctx, s.history[repoUrl].Repo().Dir(), workdir); err != nil {
+			return nil, nil, err
+		}
+	}
+	repos, err := repograph.NewMap(ctx, repoUrls, workdir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := repos.Update(ctx); err != nil {
+		return nil, nil, err
+	}
+	return s, repos, nil
+}
+
+// Show resets the branches of the staging repos to the newest commit which had
+// landed at the given time. Branches whose commits are all newer than the
+// given time are removed.
+func (s *simRepos) Show(ctx context.Context, now time.Time) error {
+	for repoUrl, g := range s.history {
+		for _, b := range g.BranchHeads() {
+			// Follow the first parent back to the newest commit which
+			// had landed.
+			c := g.Get(b.Head)
+			for c != nil && c.Timestamp.After(now) {
+				parents := c.GetParents()
+				if len(parents) == 0 {
+					c = nil
+				} else {
+					c = parents[0]
+				}
+			}
+			head := ""
+			if c != nil {
+				head = c.Hash
+			}
+			if head == s.visible[repoUrl][b.Name] {
+				continue
+			}
+			ref := "refs/heads/" + b.Name
+			if head == "" {
+				if _, err := g.Repo().Git(ctx, "update-ref", "-d", ref); err != nil {
+					return fmt.Errorf("Failed to remove branch %s: %s", b.Name, err)
+				}
+				delete(s.visible[repoUrl], b.Name)
+			} else {
+				if _, err := g.Repo().Git(ctx, "update-ref", ref, head); err != nil {
+					return fmt.Errorf("Failed to update branch %s: %s", b.Name, err)
+				}
+				s.visible[repoUrl][b.Name] = head
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"sort"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+
+	git_testutils "go.skia.org/infra/go/git/testutils"
+	"go.skia.org/infra/go/testutils"
+)
+
+func TestSimRepos(t *testing.T) {
+	testutils.LargeTest(t)
+
+	ctx := context.Background()
+	gb := git_testutils.GitInit(t, ctx)
+	defer gb.Cleanup()
+
+	base := time.Unix(1513000000, 0)
+	c1 := gb.CommitGenAt(ctx, "a.txt", base)
+	c2 := gb.CommitGenAt(ctx, "a.txt", base.Add(time.Hour))
+	gb.CreateBranchTrackBranch(ctx, "branch2", "origin/master")
+	c3 := gb.CommitGenAt(ctx, "b.txt", base.Add(3*time.Hour))
+	gb.CreateOrphanBranch(ctx, "orphan")
+	c4 := gb.CommitGenAt(ctx, "c.txt", base.Add(3*time.Hour))
+	gb.CheckoutBranch(ctx, "master")
+
+	wd, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer testutils.RemoveAll(t, wd)
+
+	branches := func(s []string) []string {
+		sort.Strings(s)
+		return s
+	}
+
+	// Only the commits which had landed at the start are visible. Branches
+	// without any such commits are hidden.
+	sim, repos, err := newSimRepos(ctx, []string{gb.RepoUrl()}, wd, base.Add(30*time.Minute))
+	assert.NoError(t, err)
+	repo := repos[gb.RepoUrl()]
+	assert.Equal(t, []string{"branch2", "master"}, branches(repo.Branches()))
+	assert.Equal(t, c1, repo.Get("master").Hash)
+	assert.Equal(t, c1, repo.Get("branch2").Hash)
+	assert.Nil(t, repo.Get(c2))
+	assert.Nil(t, repo.Get(c3))
+	assert.Nil(t, repo.Get(c4))
+
+	// Commits become visible as time passes.
+	assert.NoError(t, sim.Show(ctx, base.Add(2*time.Hour)))
+	assert.NoError(t, repos.Update(ctx))
+	assert.Equal(t, []string{"branch2", "master"}, branches(repo.Branches()))
+	assert.Equal(t, c2, repo.Get("master").Hash)
+	assert.Equal(t, c2, repo.Get("branch2").Hash)
+	assert.Nil(t, repo.Get(c3))
+
+	assert.NoError(t, sim.Show(ctx, base.Add(4*time.Hour)))
+	assert.NoError(t, repos.Update(ctx))
+	assert.Equal(t, []string{"branch2", "master", "orphan"}, branches(repo.Branches()))
+	assert.Equal(t, c3, repo.Get("branch2").Hash)
+	assert.Equal(t, c4, repo.Get("orphan").Hash)
+
+	// A new simulation in the same workdir starts over.
+	_, repos, err = newSimRepos(ctx, []string{gb.RepoUrl()}, wd, base.Add(30*time.Minute))
+	assert.NoError(t, err)
+	repo = repos[gb.RepoUrl()]
+	assert.Equal(t, []string{"branch2", "master"}, branches(repo.Branches()))
+	assert.Equal(t, c1, repo.Get("master").Hash)
+	assert.Nil(t, repo.Get(c2))
+}
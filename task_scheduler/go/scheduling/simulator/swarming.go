@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	swarming_api "go.chromium.org/luci/common/api/swarming/swarming/v1"
+	"go.skia.org/infra/go/swarming"
+	"go.skia.org/infra/task_scheduler/go/db"
+	"go.skia.org/infra/task_scheduler/go/testutils"
+)
+
+// simClock is a clock which only moves when told to.
+type simClock struct {
+	mtx sync.RWMutex
+	now time.Time
+}
+
+// Now returns the current simulated time.
+func (c *simClock) Now() time.Time {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.now
+}
+
+// Set sets the current simulated time.
+func (c *simClock) Set(now time.Time) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.now = now
+}
+
+// simSwarming is a fake Swarming client which creates tasks at the simulated
+// time. Tasks remain pending until the simulator runs them.
+type simSwarming struct {
+	*testutils.TestClient
+	clock *simClock
+}
+
+// newSimSwarming returns a simSwarming instance.
+func newSimSwarming(clock *simClock) *simSwarming {
+	return &simSwarming{
+		TestClient: testutils.NewTestClient(),
+		clock:      clock,
+	}
+}
+
+// See documentation for swarming.ApiClient.
+func (c *simSwarming) TriggerTask(t *swarming_api.SwarmingRpcsNewTaskRequest) (*swarming_api.SwarmingRpcsTaskRequestMetadata, error) {
+	rv, err := c.TestClient.TriggerTask(t)
+	if err != nil {
+		return nil, err
+	}
+	created := c.clock.Now().UTC().Format(swarming.TIMESTAMP_FORMAT)
+	rv.Request.CreatedTs = created
+	rv.TaskResult.CreatedTs = created
+	return rv, nil
+}
+
+// See documentation for swarming.ApiClient.
+func (c *simSwarming) RetryTask(t *swarming_api.SwarmingRpcsTaskRequestMetadata) (*swarming_api.SwarmingRpcsTaskRequestMetadata, error) {
+	return c.TriggerTask(&swarming_api.SwarmingRpcsNewTaskRequest{
+		Name:       t.Request.Name,
+		Priority:   t.Request.Priority,
+		Properties: t.Request.Properties,
+		Tags:       t.Request.Tags,
+		User:       t.Request.User,
+	})
+}
+
+// makeSwarmingTask returns a fake Swarming task corresponding to the given
+// unfinished task from the snapshot.
+func makeSwarmingTask(t *db.Task) *swarming_api.SwarmingRpcsTaskRequestMetadata {
+	tag := func(k, v string) string {
+		return fmt.Sprintf("%s:%s", k, v)
+	}
+	tags := []string{
+		tag(db.SWARMING_TAG_ATTEMPT, fmt.Sprintf("%d", t.Attempt)),
+		tag(db.SWARMING_TAG_ID, t.Id),
+		tag(db.SWARMING_TAG_NAME, t.Name),
+		tag(db.SWARMING_TAG_REPO, t.Repo),
+		tag(db.SWARMING_TAG_REVISION, t.Revision),
+	}
+	optional := map[string]string{
+		db.SWARMING_TAG_FORCED_JOB_ID: t.ForcedJobId,
+		db.SWARMING_TAG_ISSUE:         t.Issue,
+		db.SWARMING_TAG_PATCHSET:      t.Patchset,
+		db.SWARMING_TAG_RETRY_OF:      t.RetryOf,
+		db.SWARMING_TAG_SERVER:        t.Server,
+	}
+	for k, v := range optional {
+		if v != "" {
+			tags = append(tags, tag(k, v))
+		}
+	}
+	for _, p := range t.ParentTaskIds {
+		tags = append(tags, tag(db.SWARMING_TAG_PARENT_TASK_ID, p))
+	}
+	sort.Strings(tags)
+
+	state := swarming.TASK_STATE_PENDING
+	started := ""
+	if t.Status == db.TASK_STATUS_RUNNING {
+		state = swarming.TASK_STATE_RUNNING
+		started = t.Started.UTC().Format(swarming.TIMESTAMP_FORMAT)
+	}
+	created := t.Created.UTC().Format(swarming.TIMESTAMP_FORMAT)
+	return &swarming_api.SwarmingRpcsTaskRequestMetadata{
+		Request: &swarming_api.SwarmingRpcsTaskRequest{
+			CreatedTs:  created,
+			Name:       t.Name,
+			Properties: &swarming_api.SwarmingRpcsTaskProperties{},
+			Tags:       tags,
+		},
+		TaskId: t.SwarmingTaskId,
+		TaskResult: &swarming_api.SwarmingRpcsTaskResult{
+			BotId:     t.SwarmingBotId,
+			CreatedTs: created,
+			Name:      t.Name,
+			StartedTs: started,
+			State:     state,
+			TaskId:    t.SwarmingTaskId,
+			Tags:      tags,
+		},
+	}
+}
+
+var _ swarming.ApiClient = (*simSwarming)(nil)
@@ -102,6 +102,7 @@ func (c *taskCandidate) MakeTask() *db.Task {
 	}
 	return &db.Task{
 		Attempt:       c.Attempt,
+		AutoRetry:     c.TaskSpec.AutoRetry,
 		Commits:       commits,
 		Id:            "", // Filled in when the task is inserted into the DB.
 		Jobs:          jobs,
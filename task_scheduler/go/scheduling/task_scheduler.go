@@ -81,8 +81,14 @@ type TaskScheduler struct {
 	busyBots            *busyBots
 	candidateMetrics    map[string]metrics2.Int64Metric
 	candidateMetricsMtx sync.Mutex
+	cronTriggers        *cronTriggers
 	db                  db.DB
 	depotToolsDir       string
+	fairShareCfg        *FairShareConfig // protected by fairSharesMtx.
+	fairShares          *fairShares      // protected by fairSharesMtx.
+	fairSharesMtx       sync.RWMutex
+	flakeStats          map[string]map[string]*FlakeStats // protected by flakeStatsMtx.
+	flakeStatsMtx       sync.RWMutex
 	isolate             *isolate.Client
 	jCache              db.JobCache
 	lastScheduled       time.Time // protected by queueMtx.
@@ -101,6 +107,7 @@ type TaskScheduler struct {
 	taskCfgCache     *specs.TaskCfgCache
 	tCache           db.TaskCache
 	timeDecayAmt24Hr float64
+	timeNowFunc      func() time.Time
 	tryjobs          *tryjobs.TryJobIntegrator
 	window           *window.Window
 	workdir          string
@@ -142,10 +149,16 @@ func NewTaskScheduler(ctx context.Context, d db.DB, period time.Duration, numCom
 		return nil, fmt.Errorf("Failed to create periodic triggers: %s", err)
 	}
 
+	ct, err := newCronTriggers(workdir)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create cron triggers: %s", err)
+	}
+
 	s := &TaskScheduler{
 		bl:               bl,
 		busyBots:         newBusyBots(),
 		candidateMetrics: map[string]metrics2.Int64Metric{},
+		cronTriggers:     ct,
 		db:               d,
 		depotToolsDir:    depotTools,
 		isolate:          isolateClient,
@@ -162,6 +175,7 @@ func NewTaskScheduler(ctx context.Context, d db.DB, period time.Duration, numCom
 		taskCfgCache:     taskCfgCache,
 		tCache:           tCache,
 		timeDecayAmt24Hr: timeDecayAmt24Hr,
+		timeNowFunc:      time.Now,
 		tryjobs:          tryjobs,
 		window:           w,
 		workdir:          workdir,
@@ -196,8 +210,10 @@ func (s *TaskScheduler) Start(ctx context.Context, beforeMainLoop func()) {
 // TaskSchedulerStatus is a struct which provides status information about the
 // TaskScheduler.
 type TaskSchedulerStatus struct {
-	LastScheduled time.Time        `json:"last_scheduled"`
-	TopCandidates []*taskCandidate `json:"top_candidates"`
+	FairShares    []*FairShareStatus                `json:"fair_shares"`
+	FlakeStats    map[string]map[string]*FlakeStats `json:"flake_stats"`
+	LastScheduled time.Time                         `json:"last_scheduled"`
+	TopCandidates []*taskCandidate                  `json:"top_candidates"`
 }
 
 // Status returns the current status of the TaskScheduler.
@@ -213,6 +229,8 @@ func (s *TaskScheduler) Status() *TaskSchedulerStatus {
 		candidates = append(candidates, c.Copy())
 	}
 	return &TaskSchedulerStatus{
+		FairShares:    s.FairShareStatus(),
+		FlakeStats:    s.FlakeStats(),
 		LastScheduled: s.lastScheduled,
 		TopCandidates: candidates,
 	}
@@ -459,7 +477,7 @@ func (s *TaskScheduler) filterTaskCandidates(preFilterCandidates map[db.TaskKey]
 	total := 0
 	for _, c := range preFilterCandidates {
 		// Reject blacklisted tasks.
-		if rule := s.bl.MatchRule(c.Name, c.Revision); rule != "" {
+		if rule := s.bl.MatchRule(c.Name, c.Revision, c.TaskSpec.Dimensions); rule != "" {
 			sklog.Warningf("Skipping blacklisted task candidate: %s @ %s due to rule %q", c.Name, c.Revision, rule)
 			continue
 		}
@@ -496,7 +514,15 @@ func (s *TaskScheduler) filterTaskCandidates(preFilterCandidates map[db.TaskKey]
 			// TaskSpec. Fortunately, TaskCache.GetTasksByKey sorts
 			// by creation time, and we've selected the last of the
 			// results.
+			//
+			// If the TaskSpec opted in to AutoRetry, the MaxAttempts
+			// of the first attempt takes precedence over the
+			// TaskSpec, since it may have been adjusted by the retry
+			// policy. See updateFlakyTasks.
 			maxAttempts := c.TaskSpec.MaxAttempts
+			if prevTasks[0].AutoRetry && prevTasks[0].MaxAttempts != 0 {
+				maxAttempts = prevTasks[0].MaxAttempts
+			}
 			if maxAttempts == 0 {
 				maxAttempts = specs.DEFAULT_TASK_SPEC_MAX_ATTEMPTS
 			}
@@ -629,6 +655,9 @@ func (s *TaskScheduler) processTaskCandidates(ctx context.Context, candidates ma
 	s.newTasksMtx.RLock()
 	defer s.newTasksMtx.RUnlock()
 
+	// Penalize candidates which use more than their fair share.
+	multipliers := s.fairShareMultipliers(candidates)
+
 	processed := make(chan *taskCandidate)
 	errs := make(chan error)
 	wg := sync.WaitGroup{}
@@ -649,6 +678,9 @@ func (s *TaskScheduler) processTaskCandidates(ctx context.Context, candidates ma
 							errs <- err
 							return
 						}
+						if m, ok := multipliers[candidate]; ok {
+							c.Score *= m
+						}
 						if best == nil || c.Score > best.Score {
 							best = c
 							idx = i
@@ -807,6 +839,11 @@ func (s *TaskScheduler) regenerateTaskQueue(ctx context.Context, now time.Time)
 	// Record the number of task candidates per dimension set.
 	s.recordCandidateMetrics(candidates)
 
+	// Find the recent bot usage of each fair-share group.
+	if err := s.updateFairShares(ctx, now); err != nil {
+		return nil, err
+	}
+
 	// Process the remaining task candidates.
 	queue, err := s.processTaskCandidates(ctx, candidates, now)
 	if err != nil {
@@ -818,69 +855,25 @@ func (s *TaskScheduler) regenerateTaskQueue(ctx context.Context, now time.Time)
 
 // getCandidatesToSchedule matches the list of free Swarming bots to task
 // candidates in the queue and returns the candidates which should be run.
-// Assumes that the tasks are sorted in decreasing order by score.
+// Assumes that the tasks are sorted in decreasing order by score. See
+// botMatcher for how bots are matched to candidates.
 func getCandidatesToSchedule(bots []*swarming_api.SwarmingRpcsBotInfo, tasks []*taskCandidate) []*taskCandidate {
 	defer metrics2.FuncTimer().Stop()
-	// Create a bots-by-swarming-dimension mapping.
-	botsByDim := map[string]util.StringSet{}
-	for _, b := range bots {
-		for _, dim := range b.Dimensions {
-			for _, val := range dim.Value {
-				d := fmt.Sprintf("%s:%s", dim.Key, val)
-				if _, ok := botsByDim[d]; !ok {
-					botsByDim[d] = util.StringSet{}
-				}
-				botsByDim[d][b.BotId] = true
-			}
-		}
-	}
-
-	// Match bots to tasks.
-	// TODO(borenet): Some tasks require a more specialized bot. We should
-	// match so that less-specialized tasks don't "steal" more-specialized
-	// bots which they don't actually need.
+	m := newBotMatcher(bots)
 	rv := make([]*taskCandidate, 0, len(bots))
 	for _, c := range tasks {
+		// If we've exhausted the bot list, stop here.
+		if m.full() {
+			break
+		}
 		// TODO(borenet): Make this threshold configurable.
 		if c.Score <= 0.0 {
 			sklog.Warningf("candidate %s @ %s has a score of %2f; skipping (%d commits).", c.Name, c.Revision, c.Score, len(c.Commits))
 			continue
 		}
-
-		// For each dimension of the task, find the set of bots which matches.
-		matches := util.StringSet{}
-		for i, d := range c.TaskSpec.Dimensions {
-			if i == 0 {
-				matches = matches.Union(botsByDim[d])
-			} else {
-				matches = matches.Intersect(botsByDim[d])
-			}
-		}
-		if len(matches) > 0 {
-			// We're going to run this task. Choose a bot. Sort the
-			// bots by ID so that the choice is deterministic.
-			choices := make([]string, 0, len(matches))
-			for botId := range matches {
-				choices = append(choices, botId)
-			}
-			sort.Strings(choices)
-			bot := choices[0]
-
-			// Remove the bot from consideration.
-			for dim, subset := range botsByDim {
-				delete(subset, bot)
-				if len(subset) == 0 {
-					delete(botsByDim, dim)
-				}
-			}
-
+		if m.add(c) {
 			// Add the task to the scheduling list.
 			rv = append(rv, c)
-
-			// If we've exhausted the bot list, stop here.
-			if len(botsByDim) == 0 {
-				break
-			}
 		}
 	}
 	sort.Sort(taskCandidateSlice(rv))
@@ -1085,7 +1078,7 @@ func (s *TaskScheduler) scheduleTasks(ctx context.Context, bots []*swarming_api.
 	s.queueMtx.Lock()
 	defer s.queueMtx.Unlock()
 	s.queue = queue
-	s.lastScheduled = time.Now()
+	s.lastScheduled = s.timeNowFunc()
 
 	if len(errs) > 0 {
 		rvErr := "Got failures: "
@@ -1156,6 +1149,9 @@ func (s *TaskScheduler) gatherNewJobs(ctx context.Context) error {
 		if err != nil {
 			return false, err
 		}
+		// The files changed in this commit, only loaded if a JobSpec
+		// has TriggerPaths.
+		var files []string
 		for name, spec := range cfg.Jobs {
 			shouldRun := false
 			if !util.In(spec.Trigger, specs.PERIODIC_TRIGGERS) {
@@ -1170,6 +1166,15 @@ func (s *TaskScheduler) gatherNewJobs(ctx context.Context) error {
 					}
 				}
 			}
+			if shouldRun && len(spec.TriggerPaths) > 0 {
+				if files == nil {
+					files, err = changedFiles(ctx, r, c)
+					if err != nil {
+						return false, err
+					}
+				}
+				shouldRun = spec.MatchesPaths(files)
+			}
 			if shouldRun {
 				j, err := s.taskCfgCache.MakeJob(ctx, rs, name)
 				if err != nil {
@@ -1198,9 +1203,36 @@ func (s *TaskScheduler) gatherNewJobs(ctx context.Context) error {
 		return err
 	}
 
+	// And any cron jobs which are due.
+	if err := s.triggerCronJobs(ctx, s.timeNowFunc()); err != nil {
+		return err
+	}
+
 	return s.jCache.Update()
 }
 
+// changedFiles returns the files modified by the given commit, relative to
+// its first parent.
+func changedFiles(ctx context.Context, r *repograph.Graph, c *repograph.Commit) ([]string, error) {
+	var out string
+	var err error
+	if len(c.Parents) == 0 {
+		out, err = r.Repo().Git(ctx, "diff-tree", "--no-commit-id", "--name-only", "-r", "--root", c.Hash)
+	} else {
+		out, err = r.Repo().Git(ctx, "diff", "--name-only", c.Parents[0], c.Hash)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to obtain changed files for %s: %s", c.Hash, err)
+	}
+	files := []string{}
+	for _, f := range strings.Split(out, "\n") {
+		if f = strings.TrimSpace(f); f != "" {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
 // updateAddedTaskSpecs updates the mapping of RepoStates to the new task specs
 // they added.
 func (s *TaskScheduler) updateAddedTaskSpecs(ctx context.Context) error {
@@ -1256,7 +1288,7 @@ func (s *TaskScheduler) MainLoop(ctx context.Context) error {
 		}
 	}()
 
-	now := time.Now()
+	now := s.timeNowFunc()
 	// TODO(borenet): This is only needed for the perftest because it no
 	// longer has access to the TaskCache used by TaskScheduler. Since it
 	// pushes tasks into the DB between executions of MainLoop, we need to
@@ -1269,6 +1301,19 @@ func (s *TaskScheduler) MainLoop(ctx context.Context) error {
 		return err
 	}
 
+	// Expiring blacklist rules is best-effort; any rules which failed to
+	// expire are retried on the next cycle.
+	if err := s.bl.RemoveExpiredRules(now); err != nil {
+		sklog.Errorf("Failed to remove expired blacklist rules: %s", err)
+	}
+
+	// Decide whether to retry failed tasks, before deriving the status of
+	// the Jobs which depend on them. The retry policy is best-effort, so
+	// don't let it prevent scheduling.
+	if err := s.updateFlakyTasks(now); err != nil {
+		sklog.Errorf("Failed to update flaky tasks: %s", err)
+	}
+
 	if err := s.updateUnfinishedJobs(); err != nil {
 		return err
 	}
@@ -1300,7 +1345,7 @@ func (s *TaskScheduler) MainLoop(ctx context.Context) error {
 		return err
 	}
 
-	if err := s.taskCfgCache.Cleanup(time.Now().Sub(s.window.EarliestStart())); err != nil {
+	if err := s.taskCfgCache.Cleanup(s.timeNowFunc().Sub(s.window.EarliestStart())); err != nil {
 		return fmt.Errorf("Failed to Cleanup TaskCfgCache: %s", err)
 	}
 	return nil
@@ -1314,12 +1359,20 @@ func (s *TaskScheduler) updateRepos(ctx context.Context) error {
 			return err
 		}
 	}
-	if err := s.window.Update(); err != nil {
+	if err := s.window.UpdateWithTime(s.timeNowFunc()); err != nil {
 		return err
 	}
 	return nil
 }
 
+// SetTimeNowFunc overrides the function used by MainLoop to determine the
+// current time. It allows the TaskScheduler to run against a simulated clock
+// and must be called before MainLoop.
+func (s *TaskScheduler) SetTimeNowFunc(now func() time.Time) {
+	s.timeNowFunc = now
+	s.taskCfgCache.SetTimeNowFunc(now)
+}
+
 // QueueLen returns the length of the queue.
 func (s *TaskScheduler) QueueLen() int {
 	s.queueMtx.RLock()
@@ -1524,7 +1577,7 @@ func (s *TaskScheduler) jobFinished(j *db.Job) error {
 	if !j.Done() {
 		return fmt.Errorf("jobFinished called on Job with status %q", j.Status)
 	}
-	j.Finished = time.Now()
+	j.Finished = s.timeNowFunc()
 	return nil
 }
 
@@ -1790,7 +1843,7 @@ func (s *TaskScheduler) ValidateAndAddTask(ctx context.Context, task *db.Task) e
 	}
 
 	if util.TimeIsZero(task.Created) {
-		task.Created = time.Now().UTC()
+		task.Created = s.timeNowFunc().UTC()
 	}
 	if len(task.Commits) > 0 {
 		sklog.Warning("Ignoring Commits in ValidateAndAddTask. %v", task)
@@ -1864,7 +1917,7 @@ func (s *TaskScheduler) HandleSwarmingPubSub(msg *swarming.PubSubTaskMessage) bo
 			if err != nil {
 				sklog.Errorf("Failed to parse userdata as task ID: %s", err)
 				return true
-			} else if time.Now().Sub(ts) < 2*time.Minute {
+			} else if s.timeNowFunc().Sub(ts) < 2*time.Minute {
 				sklog.Infof("Failed to update task %q from pub/sub: no such task ID: %q. Less than two minutes old; try again later.", msg.SwarmingTaskId, msg.UserData)
 				return false
 			} else {
@@ -1898,7 +1951,7 @@ func (s *TaskScheduler) HandleSwarmingPubSub(msg *swarming.PubSubTaskMessage) bo
 				sklog.Errorf("Failed to parse timestamp: %s; %s", res.CreatedTs, err)
 				return true
 			}
-			if time.Now().Sub(created) < 2*time.Minute {
+			if s.timeNowFunc().Sub(created) < 2*time.Minute {
 				sklog.Infof("Failed to update task %q: No such task ID: %q. Less than two minutes old; try again later.", msg.SwarmingTaskId, id)
 				return false
 			}
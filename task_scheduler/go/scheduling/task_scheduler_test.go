@@ -1514,16 +1514,15 @@ func TestGetCandidatesToSchedule(t *testing.T) {
 	t1 = makeTaskCandidate("task1", []string{"k:v"})
 	t2 = makeTaskCandidate("task2", dims)
 	// In the first two cases, the task with fewer dimensions has the
-	// higher priority. It gets the bot with more dimensions because it
-	// is first in sorted order. The second task does not get scheduled
-	// because there is no bot available which can run it.
-	// TODO(borenet): Use a more optimal solution to avoid this case.
+	// higher priority. It gets the bot with fewer dimensions so that the
+	// bot with more dimensions is left for the second task, and both
+	// tasks get scheduled.
 	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1, b2}, []*taskCandidate{t1, t2})
-	deepequal.AssertDeepEqual(t, []*taskCandidate{t1}, rv)
+	deepequal.AssertDeepEqual(t, []*taskCandidate{t1, t2}, rv)
 	t1 = makeTaskCandidate("task1", []string{"k:v"})
 	t2 = makeTaskCandidate("task2", dims)
 	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b2, b1}, []*taskCandidate{t1, t2})
-	deepequal.AssertDeepEqual(t, []*taskCandidate{t1}, rv)
+	deepequal.AssertDeepEqual(t, []*taskCandidate{t1, t2}, rv)
 	// In these two cases, the task with more dimensions has the higher
 	// priority. Both tasks get scheduled.
 	t1 = makeTaskCandidate("task1", []string{"k:v"})
@@ -2160,6 +2159,10 @@ func TestSchedulingRetry(t *testing.T) {
 	t2.Finished = time.Now()
 	t2.IsolatedOutput = "abc123"
 
+	// The TaskSpec's MaxAttempts takes precedence over the Task's, unless
+	// the TaskSpec opted in to AutoRetry.
+	t1.MaxAttempts = 1
+
 	assert.NoError(t, d.PutTasks([]*db.Task{t1, t2}))
 	assert.NoError(t, s.tCache.Update())
 
@@ -2659,6 +2662,120 @@ func TestPeriodicJobs(t *testing.T) {
 	assert.Equal(t, 6, len(unfinished))
 }
 
+// makeSingleJobTasksCfg returns a TasksCfg containing only the given JobSpec,
+// which runs a single task.
+func makeSingleJobTasksCfg(jobName string, job *specs.JobSpec) *specs.TasksCfg {
+	name := jobName + "-Task"
+	job.Priority = 1.0
+	job.TaskSpecs = []string{name}
+	return &specs.TasksCfg{
+		Jobs: map[string]*specs.JobSpec{
+			jobName: job,
+		},
+		Tasks: map[string]*specs.TaskSpec{
+			name: {
+				CipdPackages: []*specs.CipdPackage{},
+				Dependencies: []string{},
+				Dimensions: []string{
+					"pool:Skia",
+					"os:Mac",
+					"gpu:my-gpu",
+				},
+				ExecutionTimeout: 40 * time.Minute,
+				Expiration:       2 * time.Hour,
+				IoTimeout:        3 * time.Minute,
+				Isolate:          "compile_skia.isolate",
+				Priority:         1.0,
+			},
+		},
+	}
+}
+
+func TestCronJobs(t *testing.T) {
+	ctx, gb, _, _, s, _, cleanup := setup(t)
+	defer cleanup()
+
+	// Rewrite tasks.json with a job which runs every four hours.
+	cfg := makeSingleJobTasksCfg("Cron-Job", &specs.JobSpec{
+		Trigger: "cron:0 */4 * * *",
+	})
+	gb.Add(ctx, specs.TASKS_CFG_FILE, testutils.MarshalJSON(t, &cfg))
+	gb.Commit(ctx)
+
+	// Cycle, ensure that the cron job is not added the first time it's
+	// seen.
+	assert.NoError(t, s.MainLoop(ctx))
+	assert.NoError(t, s.jCache.Update())
+	unfinished, err := s.jCache.UnfinishedJobs()
+	assert.NoError(t, err)
+	assert.Equal(t, 5, len(unfinished)) // Existing per-commit jobs.
+
+	// The job is triggered once the schedule fires, but only once.
+	later := time.Now().Add(5 * time.Hour)
+	assert.NoError(t, s.triggerCronJobs(ctx, later))
+	assert.NoError(t, s.jCache.Update())
+	unfinished, err = s.jCache.UnfinishedJobs()
+	assert.NoError(t, err)
+	assert.Equal(t, 6, len(unfinished))
+	assert.NoError(t, s.triggerCronJobs(ctx, later.Add(time.Minute)))
+	assert.NoError(t, s.jCache.Update())
+	unfinished, err = s.jCache.UnfinishedJobs()
+	assert.NoError(t, err)
+	assert.Equal(t, 6, len(unfinished))
+
+	// The last-triggered time was persisted.
+	ct, err := newCronTriggers(s.workdir)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(ct.LastTriggered))
+	for _, last := range ct.LastTriggered {
+		assert.True(t, later.Equal(last))
+	}
+
+	// The file is not rewritten if nothing changed.
+	assert.NoError(t, os.Remove(ct.jsonFile))
+	assert.NoError(t, s.triggerCronJobs(ctx, later.Add(2*time.Minute)))
+	_, err = os.Stat(ct.jsonFile)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestTriggerPaths(t *testing.T) {
+	ctx, gb, _, _, s, _, cleanup := setup(t)
+	defer cleanup()
+
+	// Rewrite tasks.json with a job which only runs for changes to the
+	// site directory.
+	cfg := makeSingleJobTasksCfg("Site-Job", &specs.JobSpec{
+		TriggerPaths: []string{"site"},
+	})
+	gb.Add(ctx, specs.TASKS_CFG_FILE, testutils.MarshalJSON(t, &cfg))
+	gb.Commit(ctx)
+
+	// The commit only modified tasks.json, so the job isn't added.
+	assert.NoError(t, s.MainLoop(ctx))
+	assert.NoError(t, s.jCache.Update())
+	unfinished, err := s.jCache.UnfinishedJobs()
+	assert.NoError(t, err)
+	assert.Equal(t, 5, len(unfinished)) // Existing per-commit jobs.
+
+	// Modify a file in the site directory.
+	gb.Add(ctx, "site/index.md", "Welcome!")
+	gb.Commit(ctx)
+	assert.NoError(t, s.MainLoop(ctx))
+	assert.NoError(t, s.jCache.Update())
+	unfinished, err = s.jCache.UnfinishedJobs()
+	assert.NoError(t, err)
+	assert.Equal(t, 6, len(unfinished))
+
+	// Modify a file elsewhere.
+	gb.Add(ctx, "README.md", "Hello!")
+	gb.Commit(ctx)
+	assert.NoError(t, s.MainLoop(ctx))
+	assert.NoError(t, s.jCache.Update())
+	unfinished, err = s.jCache.UnfinishedJobs()
+	assert.NoError(t, err)
+	assert.Equal(t, 6, len(unfinished))
+}
+
 func TestUpdateUnfinishedTasks(t *testing.T) {
 	_, _, _, swarmingClient, s, _, cleanup := setup(t)
 	defer cleanup()
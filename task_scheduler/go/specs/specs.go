@@ -16,6 +16,7 @@ import (
 	"sync"
 	"time"
 
+	"go.skia.org/infra/go/cron"
 	"go.skia.org/infra/go/exec"
 	"go.skia.org/infra/go/git"
 	"go.skia.org/infra/go/git/repograph"
@@ -48,6 +49,10 @@ const (
 	TRIGGER_ON_DEMAND = "on demand"
 	// Trigger this job weekly.
 	TRIGGER_WEEKLY = "weekly"
+	// Trigger this job at HEAD of master according to a cron expression,
+	// eg. "cron:0 */4 * * *" for every four hours or "cron:0 9 * * mon-fri"
+	// for 09:00 UTC on weekdays. See go/cron for the syntax.
+	TRIGGER_CRON_PREFIX = "cron:"
 
 	VARIABLE_SYNTAX = "<(%s)"
 
@@ -153,6 +158,12 @@ func (c *TasksCfg) Validate() error {
 		}
 	}
 
+	for name, j := range c.Jobs {
+		if err := j.Validate(); err != nil {
+			return fmt.Errorf("Invalid job %q: %s", name, err)
+		}
+	}
+
 	if err := findCycles(c.Tasks, c.Jobs); err != nil {
 		return err
 	}
@@ -163,6 +174,11 @@ func (c *TasksCfg) Validate() error {
 // TaskSpec is a struct which describes a Swarming task to run.
 // Be sure to add any new fields to the Copy() method.
 type TaskSpec struct {
+	// AutoRetry indicates that the Task Scheduler may adjust MaxAttempts
+	// for this TaskSpec based on its flake history: failures which are
+	// likely flaky are retried, and deterministic failures are not.
+	AutoRetry bool `json:"auto_retry,omitempty"`
+
 	// Caches are named Swarming caches which should be used for this task.
 	Caches []*Cache `json:"caches,omitempty"`
 
@@ -287,6 +303,7 @@ func (t *TaskSpec) Copy() *TaskSpec {
 	extraTags := util.CopyStringMap(t.ExtraTags)
 	outputs := util.CopyStringSlice(t.Outputs)
 	return &TaskSpec{
+		AutoRetry:        t.AutoRetry,
 		Caches:           caches,
 		CipdPackages:     cipdPackages,
 		Command:          cmd,
@@ -327,6 +344,14 @@ type JobSpec struct {
 	Priority  float64  `json:"priority"`
 	TaskSpecs []string `json:"tasks"`
 	Trigger   string   `json:"trigger,omitempty"`
+
+	// TriggerPaths restricts a job which is triggered by commits, ie. one
+	// with TRIGGER_ANY_BRANCH or TRIGGER_MASTER_ONLY, to commits which
+	// modify at least one file matching one of the given globs. The globs
+	// use the syntax of path.Match and are relative to the repo root. A
+	// glob which matches a directory matches every file within it, eg.
+	// "site" matches "site/index.md".
+	TriggerPaths []string `json:"trigger_paths,omitempty"`
 }
 
 // Copy returns a copy of the JobSpec.
@@ -337,10 +362,69 @@ func (j *JobSpec) Copy() *JobSpec {
 		copy(taskSpecs, j.TaskSpecs)
 	}
 	return &JobSpec{
-		Priority:  j.Priority,
-		TaskSpecs: taskSpecs,
-		Trigger:   j.Trigger,
+		Priority:     j.Priority,
+		TaskSpecs:    taskSpecs,
+		Trigger:      j.Trigger,
+		TriggerPaths: util.CopyStringSlice(j.TriggerPaths),
+	}
+}
+
+// Validate returns an error if the JobSpec is not valid.
+func (j *JobSpec) Validate() error {
+	switch j.Trigger {
+	case TRIGGER_ANY_BRANCH, TRIGGER_MASTER_ONLY, TRIGGER_NIGHTLY, TRIGGER_ON_DEMAND, TRIGGER_WEEKLY:
+	default:
+		if !strings.HasPrefix(j.Trigger, TRIGGER_CRON_PREFIX) {
+			return fmt.Errorf("Unknown trigger %q", j.Trigger)
+		}
+		if _, err := j.CronSchedule(); err != nil {
+			return err
+		}
+	}
+
+	if len(j.TriggerPaths) > 0 && j.Trigger != TRIGGER_ANY_BRANCH && j.Trigger != TRIGGER_MASTER_ONLY {
+		return fmt.Errorf("trigger_paths may only be used with jobs which are triggered by commits, not %q", j.Trigger)
+	}
+	for _, glob := range j.TriggerPaths {
+		if glob == "" {
+			return fmt.Errorf("trigger_paths may not contain empty globs.")
+		}
+		if _, err := path.Match(glob, ""); err != nil {
+			return fmt.Errorf("Invalid glob %q in trigger_paths: %s", glob, err)
+		}
+	}
+	return nil
+}
+
+// CronSchedule returns the cron.Schedule given by the JobSpec's trigger, or
+// nil if the JobSpec isn't triggered by a cron expression.
+func (j *JobSpec) CronSchedule() (*cron.Schedule, error) {
+	if !strings.HasPrefix(j.Trigger, TRIGGER_CRON_PREFIX) {
+		return nil, nil
+	}
+	return cron.Parse(strings.TrimPrefix(j.Trigger, TRIGGER_CRON_PREFIX))
+}
+
+// MatchesPaths returns true if a commit which modifies the given files should
+// trigger the JobSpec, according to its TriggerPaths. Always returns true if
+// the JobSpec has no TriggerPaths.
+func (j *JobSpec) MatchesPaths(files []string) bool {
+	if len(j.TriggerPaths) == 0 {
+		return true
+	}
+	for _, f := range files {
+		// Check the file itself, followed by each of its parent
+		// directories.
+		for p := f; p != "." && p != "/" && p != ""; p = path.Dir(p) {
+			for _, glob := range j.TriggerPaths {
+				// The globs have already been validated.
+				if ok, _ := path.Match(glob, p); ok {
+					return true
+				}
+			}
+		}
 	}
+	return false
 }
 
 // GetTaskSpecDAG returns a map describing all of the dependencies of the
@@ -401,6 +485,7 @@ type TaskCfgCache struct {
 	recentTaskSpecs map[string]time.Time
 	repos           repograph.Map
 	queue           chan func(int)
+	timeNowFunc     func() time.Time
 	workdir         string
 }
 
@@ -434,6 +519,7 @@ func NewTaskCfgCache(ctx context.Context, repos repograph.Map, depotToolsDir, wo
 		file:          file,
 		queue:         queue,
 		repos:         repos,
+		timeNowFunc:   time.Now,
 		workdir:       workdir,
 	}
 	f, err := os.Open(file)
@@ -744,6 +830,13 @@ func (c *TaskCfgCache) GetJobSpec(ctx context.Context, rs db.RepoState, name str
 	return j.Copy(), nil
 }
 
+// SetTimeNowFunc overrides the function used to determine the current time,
+// eg. the creation time of Jobs. It must be called before the TaskCfgCache is
+// used.
+func (c *TaskCfgCache) SetTimeNowFunc(now func() time.Time) {
+	c.timeNowFunc = now
+}
+
 // MakeJob is a helper function which retrieves the given JobSpec at the given
 // RepoState and uses it to create a Job instance.
 func (c *TaskCfgCache) MakeJob(ctx context.Context, rs db.RepoState, name string) (*db.Job, error) {
@@ -761,7 +854,7 @@ func (c *TaskCfgCache) MakeJob(ctx context.Context, rs db.RepoState, name string
 	}
 
 	return &db.Job{
-		Created:      time.Now(),
+		Created:      c.timeNowFunc(),
 		Dependencies: deps,
 		Name:         name,
 		Priority:     spec.Priority,
@@ -774,7 +867,7 @@ func (c *TaskCfgCache) MakeJob(ctx context.Context, rs db.RepoState, name string
 func (c *TaskCfgCache) Cleanup(period time.Duration) error {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
-	periodStart := time.Now().Add(-period)
+	periodStart := c.timeNowFunc().Add(-period)
 	for repoState := range c.cache {
 		details, err := repoState.GetCommit(c.repos)
 		if err != nil || details.Timestamp.Before(periodStart) {
@@ -34,6 +34,7 @@ var (
 func TestCopyTaskSpec(t *testing.T) {
 	testutils.SmallTest(t)
 	v := &TaskSpec{
+		AutoRetry: true,
 		Caches: []*Cache{
 			&Cache{
 				Name: "cache-me",
@@ -75,13 +76,77 @@ func TestCopyTaskSpec(t *testing.T) {
 func TestCopyJobSpec(t *testing.T) {
 	testutils.SmallTest(t)
 	v := &JobSpec{
-		TaskSpecs: []string{"Build", "Test"},
-		Trigger:   "trigger-name",
-		Priority:  753,
+		TaskSpecs:    []string{"Build", "Test"},
+		Trigger:      "trigger-name",
+		Priority:     753,
+		TriggerPaths: []string{"src/*", "DEPS"},
 	}
 	deepequal.AssertCopy(t, v, v.Copy())
 }
 
+func TestJobSpecValidate(t *testing.T) {
+	testutils.SmallTest(t)
+	for _, j := range []*JobSpec{
+		{Trigger: TRIGGER_ANY_BRANCH},
+		{Trigger: TRIGGER_MASTER_ONLY},
+		{Trigger: TRIGGER_NIGHTLY},
+		{Trigger: TRIGGER_ON_DEMAND},
+		{Trigger: TRIGGER_WEEKLY},
+		{Trigger: "cron:0 */4 * * *"},
+		{Trigger: "cron:0 9 * * mon-fri"},
+		{Trigger: "cron:@daily"},
+		{Trigger: TRIGGER_ANY_BRANCH, TriggerPaths: []string{"DEPS", "site/*.md", "infra/bots"}},
+		{Trigger: TRIGGER_MASTER_ONLY, TriggerPaths: []string{"src/[a-m]*"}},
+	} {
+		assert.NoError(t, j.Validate(), j.Trigger)
+	}
+
+	for _, tc := range []struct {
+		job *JobSpec
+		err string
+	}{
+		{&JobSpec{Trigger: "hourly"}, "Unknown trigger"},
+		{&JobSpec{Trigger: "cron:"}, "Invalid cron expression"},
+		{&JobSpec{Trigger: "cron:0 25 * * *"}, "out of range"},
+		{&JobSpec{Trigger: TRIGGER_NIGHTLY, TriggerPaths: []string{"DEPS"}}, "only be used with jobs which are triggered by commits"},
+		{&JobSpec{Trigger: "cron:@daily", TriggerPaths: []string{"DEPS"}}, "only be used with jobs which are triggered by commits"},
+		{&JobSpec{TriggerPaths: []string{""}}, "empty globs"},
+		{&JobSpec{TriggerPaths: []string{"src/[a-"}}, "Invalid glob"},
+	} {
+		err := tc.job.Validate()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), tc.err)
+	}
+}
+
+func TestJobSpecCronSchedule(t *testing.T) {
+	testutils.SmallTest(t)
+	s, err := (&JobSpec{Trigger: TRIGGER_NIGHTLY}).CronSchedule()
+	assert.NoError(t, err)
+	assert.Nil(t, s)
+	s, err = (&JobSpec{Trigger: "cron:0 */4 * * *"}).CronSchedule()
+	assert.NoError(t, err)
+	assert.Equal(t, "0 */4 * * *", s.String())
+}
+
+func TestJobSpecMatchesPaths(t *testing.T) {
+	testutils.SmallTest(t)
+	j := &JobSpec{}
+	assert.True(t, j.MatchesPaths(nil))
+	assert.True(t, j.MatchesPaths([]string{"README.md"}))
+
+	j.TriggerPaths = []string{"DEPS", "site", "src/*.cpp"}
+	assert.False(t, j.MatchesPaths(nil))
+	assert.False(t, j.MatchesPaths([]string{"README.md", "src/foo.h"}))
+	assert.True(t, j.MatchesPaths([]string{"README.md", "DEPS"}))
+	assert.True(t, j.MatchesPaths([]string{"site/index.md"}))
+	assert.True(t, j.MatchesPaths([]string{"site/dev/testing/index.md"}))
+	assert.True(t, j.MatchesPaths([]string{"src/foo.cpp"}))
+	// "*" doesn't match "/".
+	assert.False(t, j.MatchesPaths([]string{"src/core/foo.cpp"}))
+	assert.False(t, j.MatchesPaths([]string{"third_party/DEPS", "website/index.md"}))
+}
+
 func TestTaskSpecs(t *testing.T) {
 	testutils.LargeTest(t)
 
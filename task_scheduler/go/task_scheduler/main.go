@@ -78,6 +78,7 @@ var (
 	host           = flag.String("host", "localhost", "HTTP service host")
 	port           = flag.String("port", ":8000", "HTTP service port for the web server (e.g., ':8000')")
 	dbPort         = flag.String("db_port", ":8008", "HTTP service port for the database RPC server (e.g., ':8008')")
+	fairShareCfg   = flag.String("fair_share_config", "", "Path to a JSON file describing fair-share quotas for repos, job name prefixes and pools. If blank, task candidates are scored without regard to fair share.")
 	isolateServer  = flag.String("isolate_server", isolate.ISOLATE_SERVER_URL, "Which Isolate server to use.")
 	local          = flag.Bool("local", false, "Whether we're running on a dev machine vs in production.")
 	repoUrls       = common.NewMultiStringFlag("repo", nil, "Repositories for which to schedule tasks.")
@@ -149,6 +150,16 @@ func mainHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// jsonStatusHandler returns the status of the TaskScheduler, including the
+// current consumption of each fair-share group.
+func jsonStatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ts.Status()); err != nil {
+		httputils.ReportError(w, r, err, fmt.Sprintf("Failed to encode response: %s", err))
+		return
+	}
+}
+
 func blacklistHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html")
 
@@ -216,14 +227,15 @@ func jsonBlacklistHandler(w http.ResponseWriter, r *http.Request) {
 
 	if r.Method == http.MethodDelete {
 		var msg struct {
-			Name string `json:"name"`
+			Name   string `json:"name"`
+			Reason string `json:"reason"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
 			httputils.ReportError(w, r, err, fmt.Sprintf("Failed to decode request body: %s", err))
 			return
 		}
 		defer util.Close(r.Body)
-		if err := ts.GetBlacklist().RemoveRule(msg.Name); err != nil {
+		if err := ts.GetBlacklist().RemoveRule(msg.Name, login.LoggedInAs(r), msg.Reason); err != nil {
 			httputils.ReportError(w, r, err, fmt.Sprintf("Failed to delete blacklist rule: %s", err))
 			return
 		}
@@ -241,6 +253,8 @@ func jsonBlacklistHandler(w http.ResponseWriter, r *http.Request) {
 				httputils.ReportError(w, r, err, fmt.Sprintf("Failed to create commit range rule: %s", err))
 				return
 			}
+			rangeRule.Dimensions = rule.Dimensions
+			rangeRule.Expires = rule.Expires
 			rule = *rangeRule
 		}
 		if err := ts.GetBlacklist().AddRule(&rule, repos); err != nil {
@@ -254,6 +268,19 @@ func jsonBlacklistHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func jsonBlacklistAuditHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	log, err := ts.GetBlacklist().AuditLog()
+	if err != nil {
+		httputils.ReportError(w, r, err, "Failed to read blacklist audit log.")
+		return
+	}
+	if err := json.NewEncoder(w).Encode(log); err != nil {
+		httputils.ReportError(w, r, err, fmt.Sprintf("Failed to encode response: %s", err))
+		return
+	}
+}
+
 func jsonTriggerHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "https://status.skia.org")
@@ -321,6 +348,76 @@ func jsonJobHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// jsonJobTimingHandler returns the critical path and the time spent on each
+// TaskSpec of a Job.
+func jsonJobTimingHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		httputils.ReportError(w, r, nil, "Job ID is required.")
+		return
+	}
+
+	job, err := ts.GetJob(id)
+	if err != nil {
+		if err == db.ErrNotFound {
+			http.Error(w, "Unknown Job", 404)
+			return
+		}
+		httputils.ReportError(w, r, err, "Error retrieving Job.")
+		return
+	}
+	timing, err := db.GetJobTiming(tsDb, job, time.Now())
+	if err != nil {
+		httputils.ReportError(w, r, err, "Failed to analyze Job.")
+		return
+	}
+	if err := json.NewEncoder(w).Encode(timing); err != nil {
+		httputils.ReportError(w, r, err, "Failed to encode response.")
+		return
+	}
+}
+
+// jsonCriticalPathHandler returns the TaskSpecs which are most often on the
+// critical paths of finished Jobs matching the given search parameters.
+func jsonCriticalPathHandler(w http.ResponseWriter, r *http.Request) {
+	var params db.JobSearchParams
+	if err := httputils.ParseFormValues(r, &params); err != nil {
+		httputils.ReportError(w, r, err, "Failed to parse request parameters.")
+		return
+	}
+	jobs, err := db.SearchJobs(tsDb, &params)
+	if err != nil {
+		httputils.ReportError(w, r, err, "Failed to search for jobs.")
+		return
+	}
+	now := time.Now()
+	timings := make([]*db.JobTiming, 0, len(jobs))
+	for _, job := range jobs {
+		if !job.Done() {
+			continue
+		}
+		timing, err := db.GetJobTiming(tsDb, job, now)
+		if err != nil {
+			httputils.ReportError(w, r, err, "Failed to analyze Jobs.")
+			return
+		}
+		timings = append(timings, timing)
+	}
+	rv := struct {
+		Jobs      int                    `json:"jobs"`
+		TaskSpecs []*db.CriticalPathStat `json:"task_specs"`
+	}{
+		Jobs:      len(timings),
+		TaskSpecs: db.CriticalPathStats(timings),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(rv); err != nil {
+		httputils.ReportError(w, r, err, fmt.Sprintf("Failed to encode response: %s", err))
+		return
+	}
+}
+
 func jsonCancelJobHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	if !login.IsGoogler(r) {
@@ -562,9 +659,13 @@ func runServer(serverURL string, taskDb db.RemoteDB) {
 	r.HandleFunc("/task/{id}", taskHandler)
 	r.HandleFunc("/trigger", triggerHandler)
 	r.HandleFunc("/json/blacklist", jsonBlacklistHandler).Methods(http.MethodPost, http.MethodDelete)
+	r.HandleFunc("/json/blacklist/audit", jsonBlacklistAuditHandler).Methods(http.MethodGet)
 	r.HandleFunc("/json/job/{id}", jsonJobHandler)
 	r.HandleFunc("/json/job/{id}/cancel", jsonCancelJobHandler).Methods(http.MethodPost)
+	r.HandleFunc("/json/job/{id}/timing", jsonJobTimingHandler)
+	r.HandleFunc("/json/jobs/critical_path", jsonCriticalPathHandler)
 	r.HandleFunc("/json/jobs/search", jsonJobSearchHandler)
+	r.HandleFunc("/json/status", jsonStatusHandler)
 	r.HandleFunc("/json/task", jsonTaskHandler).Methods(http.MethodPost, http.MethodPut)
 	r.HandleFunc("/json/task/{id}", jsonGetTaskHandler)
 	r.HandleFunc("/json/taskCandidates/search", jsonTaskCandidateSearchHandler)
@@ -737,6 +838,13 @@ func main() {
 	if err != nil {
 		sklog.Fatal(err)
 	}
+	if *fairShareCfg != "" {
+		cfg, err := scheduling.FairShareConfigFromFile(*fairShareCfg)
+		if err != nil {
+			sklog.Fatal(err)
+		}
+		ts.SetFairShareConfig(cfg)
+	}
 
 	sklog.Infof("Created task scheduler. Starting loop.")
 	ts.Start(ctx, b.Tick)